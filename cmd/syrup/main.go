@@ -47,10 +47,37 @@ func init() {
 	viper.SetDefault("server.privateKey", "id_rsa")
 	viper.SetDefault("server.portRedirection", "disable")
 	viper.SetDefault("server.commandOutputDir", "cmdOutput")
+	viper.SetDefault("persona.prompt", honeyos.DefaultPS1)
+	viper.SetDefault("persona.cpuModel", honeyos.DefaultPersona.CPUModel)
+	viper.SetDefault("persona.cpus", honeyos.DefaultPersona.CPUs)
+	viper.SetDefault("persona.cpuMHz", honeyos.DefaultPersona.CPUMHz)
+	viper.SetDefault("persona.memTotal", honeyos.DefaultPersona.MemTotal)
+	viper.SetDefault("persona.kernelRelease", honeyos.DefaultPersona.KernelRelease)
+	viper.SetDefault("persona.kernelVersion", honeyos.DefaultPersona.KernelVersion)
+	viper.SetDefault("persona.uptime", honeyos.DefaultPersona.Uptime)
+	viper.SetDefault("persona.interface", honeyos.DefaultPersona.Interface)
+	viper.SetDefault("persona.mac", honeyos.DefaultPersona.MAC)
+	viper.SetDefault("persona.address", honeyos.DefaultPersona.Address)
+	viper.SetDefault("persona.gateway", honeyos.DefaultPersona.Gateway)
 	viper.SetDefault("virtualfs.imageFile", "filesystem.zip")
 	viper.SetDefault("virtualfs.uidMappingFile", "passwd")
 	viper.SetDefault("virtualfs.gidMappingFile", "group")
 	viper.SetDefault("virtualfs.savedFileDir", "tempdir")
+	viper.SetDefault("virtualfs.overlay", "session")
+	viper.SetDefault("virtualfs.overlayStorage", "disk")
+	// Layers hold the files attackers dropped, they are never expired unless
+	// configured
+	viper.SetDefault("virtualfs.overlayExpiry", time.Duration(0))
+	viper.SetDefault("capture.dir", "captures")
+	viper.SetDefault("download.policy", "live")
+	viper.SetDefault("download.offline.size", 16384)
+	viper.SetDefault("download.offline.contentType", "application/octet-stream")
+	viper.SetDefault("download.offline.speed", 512)
+	viper.SetDefault("download.offline.maxDelay", time.Duration(time.Second*10))
+	viper.SetDefault("download.maxSize", 10485760)
+	viper.SetDefault("download.timeout", time.Duration(time.Second*60))
+	viper.SetDefault("download.connectTimeout", time.Duration(time.Second*10))
+	viper.SetDefault("download.maxRedirects", 5)
 	viper.SetDefault("asciinema.apiEndpoint", "https://asciinema.org")
 }
 
@@ -95,9 +122,9 @@ func main() {
 		log.AddHook(hook)
 	}
 
-	err = honeyos.LoadGroups(path.Join(configPath, viper.GetString("virtualfs.uidMappingFile")))
+	err = honeyos.LoadGroups(path.Join(configPath, viper.GetString("virtualfs.gidMappingFile")))
 	if err != nil {
-		log.Errorf("Cannot load group mapping file %v", path.Join(configPath, viper.GetString("virtualfs.uidMappingFile")))
+		log.Errorf("Cannot load group mapping file %v", path.Join(configPath, viper.GetString("virtualfs.gidMappingFile")))
 	}
 	// Load command list
 	honeyos.RegisterFakeCommand(readFiletoArray(path.Join(configPath, viper.GetString("server.commandList"))))
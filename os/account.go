@@ -5,8 +5,11 @@ import (
 	"errors"
 	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/mkishere/sshsyrup/virtualfs"
 )
 
 type User struct {
@@ -77,10 +80,14 @@ func LoadGroups(groupFile string) error {
 		if err != nil {
 			return err
 		}
-		groups[gid] = Group{
+		g := Group{
 			GID:  gid,
 			Name: fields[0],
 		}
+		if len(fields) > 3 && len(fields[3]) > 0 {
+			g.Userlist = strings.Split(fields[3], ",")
+		}
+		groups[gid] = g
 	}
 
 	return nil
@@ -106,6 +113,39 @@ func GetGroupByID(id int) Group {
 	return groups[id]
 }
 
+// GetGroup returns the group with the name
+func GetGroup(name string) Group {
+	for _, g := range groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return Group{}
+}
+
+// UserGroups returns the supplementary groups of the user, those listing
+// the user as a member
+func UserGroups(name string) []int {
+	var gids []int
+	for gid, g := range groups {
+		for _, member := range g.Userlist {
+			if member == name {
+				gids = append(gids, gid)
+				break
+			}
+		}
+	}
+	sort.Ints(gids)
+	return gids
+}
+
+// Credentials returns the user and groups the files are accessed as by the
+// processes of the user
+func Credentials(uid int) virtualfs.Credentials {
+	u := GetUserByID(uid)
+	return virtualfs.Credentials{UID: uid, GID: u.GID, Groups: UserGroups(u.Name)}
+}
+
 func CreateUser(name, password string) (newUser User, e error) {
 	if _, exists := usernameMapping[name]; exists {
 		return newUser, errors.New("User already exists")
@@ -0,0 +1,197 @@
+package os
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type builtinFunc func(sh *Shell, args []string, stdio *procIO) int
+
+// builtins are commands that are handled by the shell itself as they
+// modify the state of the shell
+var builtins map[string]builtinFunc
+
+// dquoteEscaper escapes the string for putting inside double quotes
+var dquoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+
+func init() {
+	builtins = map[string]builtinFunc{
+		"cd":       builtinCd,
+		"exit":     builtinExit,
+		"logout":   builtinExit,
+		"export":   builtinExport,
+		"unset":    builtinUnset,
+		"env":      builtinEnv,
+		"printenv": builtinPrintenv,
+		"history":  builtinHistory,
+		"su":       builtinSu,
+		"sudo":     builtinSudo,
+		"source":   builtinSource,
+		".":        builtinSource,
+		"jobs":     builtinJobs,
+		"wait":     builtinWait,
+		"disown":   builtinDisown,
+		"nohup":    builtinNohup,
+		"setsid":   builtinSetsid,
+		"screen":   builtinScreen,
+	}
+}
+
+func builtinCd(sh *Shell, args []string, stdio *procIO) int {
+	dir, printDir := "", false
+	switch {
+	case len(args) == 0:
+		home, ok := sh.sys.envVars["HOME"]
+		if !ok {
+			fmt.Fprintf(stdio.err, "%vcd: HOME not set\n", sh.errPrefix())
+			return 1
+		}
+		if len(home) == 0 {
+			return 0
+		}
+		dir = home
+	case args[0] == "-":
+		oldPwd, ok := sh.sys.envVars["OLDPWD"]
+		if !ok {
+			fmt.Fprintf(stdio.err, "%vcd: OLDPWD not set\n", sh.errPrefix())
+			return 1
+		}
+		dir, printDir = oldPwd, true
+	default:
+		dir = args[0]
+	}
+	oldPwd := sh.sys.Getcwd()
+	if err := sh.sys.Chdir(dir); err != nil {
+		fmt.Fprintf(stdio.err, "%vcd: %v: %v\n", sh.errPrefix(), dir, ErrnoString(err))
+		return 1
+	}
+	sh.sys.SetEnv("OLDPWD", oldPwd)
+	sh.sys.SetEnv("PWD", sh.sys.Getcwd())
+	if printDir {
+		fmt.Fprintln(stdio.out, sh.sys.Getcwd())
+	}
+	return 0
+}
+
+func builtinExit(sh *Shell, args []string, stdio *procIO) int {
+	status := sh.lastStatus
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Fprintf(stdio.err, "%vexit: %v: numeric argument required\n", sh.errPrefix(), args[0])
+			n = 2
+		}
+		status = n & 0xff
+	}
+	// Leaving the shell of su returns to the previous user
+	if id, ok := sh.restoreUser(); ok {
+		if !sh.inSubshell {
+			if id.login {
+				fmt.Fprint(stdio.out, "logout\n")
+			} else {
+				fmt.Fprint(stdio.out, "exit\n")
+			}
+		}
+		return status
+	}
+	if !sh.inSubshell {
+		sh.log.Infof("User logged out")
+		fmt.Fprint(stdio.out, "logout\n")
+	}
+	sh.exited = true
+	return status
+}
+
+func builtinExport(sh *Shell, args []string, stdio *procIO) int {
+	status := 0
+	names := 0
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		names++
+		kv := strings.SplitN(arg, "=", 2)
+		if !isName(kv[0]) {
+			fmt.Fprintf(stdio.err, "%vexport: `%v': not a valid identifier\n", sh.errPrefix(), arg)
+			status = 1
+			continue
+		}
+		if len(kv) == 2 {
+			sh.sys.SetEnv(kv[0], kv[1])
+		} else if _, set := sh.sys.envVars[kv[0]]; !set {
+			sh.sys.SetEnv(kv[0], "")
+		}
+	}
+	if names == 0 {
+		env := sh.sys.Environ()
+		sort.Strings(env)
+		for _, kv := range env {
+			pair := strings.SplitN(kv, "=", 2)
+			fmt.Fprintf(stdio.out, "declare -x %v=\"%v\"\n", pair[0], dquoteEscaper.Replace(pair[1]))
+		}
+	}
+	return status
+}
+
+func builtinUnset(sh *Shell, args []string, stdio *procIO) int {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if !isName(arg) {
+			fmt.Fprintf(stdio.err, "%vunset: `%v': not a valid identifier\n", sh.errPrefix(), arg)
+			return 1
+		}
+		sh.sys.UnsetEnv(arg)
+	}
+	return 0
+}
+
+// builtinEnv prints the environment, or runs the command in the
+// modified environment
+func builtinEnv(sh *Shell, args []string, stdio *procIO) int {
+	sub := sh.newSubshell()
+	for len(args) > 0 {
+		switch arg := args[0]; {
+		case arg == "-i" || arg == "-" || arg == "--ignore-environment":
+			for _, kv := range sub.sys.Environ() {
+				sub.sys.UnsetEnv(strings.SplitN(kv, "=", 2)[0])
+			}
+		case arg == "-u" && len(args) > 1:
+			sub.sys.UnsetEnv(args[1])
+			args = args[1:]
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintf(stdio.err, "env: invalid option -- '%v'\nTry 'env --help' for more information.\n", strings.TrimLeft(arg, "-"))
+			return 125
+		case strings.Contains(arg, "="):
+			kv := strings.SplitN(arg, "=", 2)
+			sub.sys.SetEnv(kv[0], kv[1])
+		default:
+			return sub.execArgs(args, stdio)
+		}
+		args = args[1:]
+	}
+	env := sub.sys.Environ()
+	sort.Strings(env)
+	for _, kv := range env {
+		fmt.Fprintln(stdio.out, kv)
+	}
+	return 0
+}
+
+func builtinPrintenv(sh *Shell, args []string, stdio *procIO) int {
+	if len(args) == 0 {
+		return builtinEnv(sh, nil, stdio)
+	}
+	status := 0
+	for _, name := range args {
+		if val, set := sh.sys.envVars[name]; set {
+			fmt.Fprintln(stdio.out, val)
+		} else {
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,1119 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+)
+
+// awk is a small interpreter of the awk language, in the flavour of mawk
+// which is the default awk of Ubuntu
+type awk struct{}
+
+// awkMaxSteps bounds the statements run by one program, so that an endless
+// loop does not hang the session
+const awkMaxSteps = 10000000
+
+// awkMaxNF is the most fields of a record, the compiled limit of mawk
+const awkMaxNF = 32767
+
+// Kinds of awk values. Fields and input strings which look like numbers
+// compare as numbers
+const (
+	awkUninit = iota
+	awkNum
+	awkStr
+	awkStrNum
+)
+
+type awkValue struct {
+	kind int
+	s    string
+	n    float64
+}
+
+// awkFlow tells how a statement ends
+type awkFlow int
+
+const (
+	flowNormal awkFlow = iota
+	flowNext
+	flowExit
+	flowBreak
+	flowContinue
+)
+
+// awkRuntimeError is raised by the interpreter to stop the program
+type awkRuntimeError string
+
+// awkInterp holds the state of a running program
+type awkInterp struct {
+	sys      honeyos.Sys
+	vars     map[string]awkValue
+	arrays   map[string]map[string]awkValue
+	fields   []string
+	record   string
+	out      bytes.Buffer
+	files    map[string]*bytes.Buffer
+	order    []string
+	regexps  map[string]*regexp.Regexp
+	exitCode int
+	steps    int
+	rand     *rand.Rand
+}
+
+func init() {
+	honeyos.RegisterCommand("awk", awk{})
+	honeyos.RegisterCommand("mawk", awk{})
+}
+
+func (awk) GetHelp() string {
+	return `Usage: mawk [Options] [Program] [file ...]
+
+Program:
+    The -f option value is the name of a file containing program text.
+    If no -f option is given, a "--" ends option processing; the following
+    parameters are the program text.
+
+Options:
+    -f program-file  Program  text is read from file instead of from the
+                     command-line.  Multiple -f options are accepted.
+    -F value         sets the field separator, FS, to value.
+    -v var=value     assigns value to program variable var.
+    --               unambiguous end of options.
+
+    Implementation-specific options are prefixed with "-W".  They can be
+    abbreviated:
+
+    -W version       show version information and exit.
+    -W dump          show assembler-like listing of program and exit.
+    -W help          show this message and exit.
+    -W interactive   set unbuffered output, line-buffered input
+    -W exec file     use file as program as well as last option.
+    -W random=number set initial random seed.
+    -W sprintf=number adjust size of sprintf buffer
+    -W posix_space   do not consider "\n" a space.
+    -W usage         show this message and exit.
+`
+}
+
+func (a awk) Exec(args []string, sys honeyos.Sys) int {
+	var progFiles, assigns []string
+	fs := ""
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			i++
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		opt, value := arg[1], arg[2:]
+		if strings.IndexByte("fFvW", opt) < 0 {
+			fmt.Fprintf(sys.Err(), "awk: not an option: %v\n", arg)
+			return 2
+		}
+		if len(value) == 0 {
+			if i+1 >= len(args) {
+				fmt.Fprintf(sys.Err(), "awk: option requires an argument -- %c\n", opt)
+				fmt.Fprint(sys.Err(), a.GetHelp())
+				return 2
+			}
+			i++
+			value = args[i]
+		}
+		switch opt {
+		case 'f':
+			progFiles = append(progFiles, value)
+		case 'F':
+			fs = value
+		case 'v':
+			if !awkAssignment(value) {
+				fmt.Fprintf(sys.Err(), "awk: improper assignment: -v %v\n", value)
+				return 2
+			}
+			assigns = append(assigns, value)
+		case 'W':
+			switch {
+			case strings.HasPrefix(value, "v"):
+				fmt.Fprint(sys.Out(), "mawk 1.3.3 Nov 1996, Copyright (C) Michael D. Brennan\n\n"+
+					"compiled limits:\nmax NF             32767\nsprintf buffer      2040\n")
+				return 0
+			case strings.HasPrefix(value, "h"), strings.HasPrefix(value, "u"):
+				fmt.Fprint(sys.Out(), a.GetHelp())
+				return 0
+			}
+		}
+	}
+	args = args[i:]
+	var src string
+	if len(progFiles) == 0 {
+		if len(args) == 0 {
+			fmt.Fprint(sys.Err(), a.GetHelp())
+			return 2
+		}
+		src, args = args[0], args[1:]
+	} else {
+		for _, name := range progFiles {
+			f, err := openInput(sys, name)
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "awk: couldn't open file %v.\n", name)
+				return 2
+			}
+			b, _ := ioutil.ReadAll(f)
+			f.Close()
+			src += string(b) + "\n"
+		}
+	}
+	rules, err := parseAwk(src)
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "awk: %v\n", err)
+		return 2
+	}
+	in := &awkInterp{
+		sys:     sys,
+		arrays:  map[string]map[string]awkValue{},
+		files:   map[string]*bytes.Buffer{},
+		regexps: map[string]*regexp.Regexp{},
+		vars: map[string]awkValue{
+			"FS": awkStrVal(" "), "OFS": awkStrVal(" "), "ORS": awkStrVal("\n"), "RS": awkStrVal("\n"),
+			"SUBSEP": awkStrVal("\x1c"), "CONVFMT": awkStrVal("%.6g"), "OFMT": awkStrVal("%.6g"),
+			"NR": awkNumVal(0), "NF": awkNumVal(0), "FNR": awkNumVal(0), "FILENAME": awkStrVal(""),
+			"RSTART": awkNumVal(0), "RLENGTH": awkNumVal(-1),
+		},
+		rand: rand.New(rand.NewSource(0)),
+	}
+	if len(fs) > 0 {
+		if fs == "t" {
+			fs = "\t"
+		}
+		in.vars["FS"] = awkStrVal(awkUnescape(fs))
+	}
+	for _, assign := range assigns {
+		in.assign(assign)
+	}
+	status := in.run(rules, args)
+	sys.Out().Write(in.out.Bytes())
+	for _, name := range in.order {
+		p := fullPath(sys, name)
+		f, err := createFile(sys.FSys(), p, os.O_WRONLY|os.O_TRUNC, 0666&^defaultUmask)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "awk: cannot open \"%v\" for output\n", name)
+			return 2
+		}
+		f.Write(in.files[name].Bytes())
+		f.Close()
+		sys.FsEvent("write", p, log.Fields{"cmd": "awk"})
+	}
+	return status
+}
+
+func (awk) Where() string {
+	return "/usr/bin/awk"
+}
+
+// awkAssignment reports if the argument is a var=value assignment
+func awkAssignment(s string) bool {
+	eq := strings.IndexByte(s, '=')
+	if eq <= 0 || isDigit(s[0]) {
+		return false
+	}
+	for i := 0; i < eq; i++ {
+		if !isAlpha(s[i]) && !isDigit(s[i]) && s[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func (in *awkInterp) assign(s string) {
+	eq := strings.IndexByte(s, '=')
+	in.setVar(s[:eq], awkInput(awkUnescape(s[eq+1:])))
+}
+
+// run runs the BEGIN rules, the main rules on each record of the files
+// and the END rules, returning the exit status
+func (in *awkInterp) run(rules []*awkRule, files []string) (status int) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg, ok := r.(awkRuntimeError)
+			if !ok {
+				panic(r)
+			}
+			fmt.Fprintf(in.sys.Err(), "awk: %v\n", msg)
+			status = 2
+		}
+	}()
+	hasMain := false
+	for _, r := range rules {
+		if r.begin {
+			if in.execBlock(r.action) == flowExit {
+				return in.runEnd(rules)
+			}
+		} else if !r.end {
+			hasMain = true
+		}
+	}
+	hasEnd := false
+	for _, r := range rules {
+		hasEnd = hasEnd || r.end
+	}
+	if !hasMain && !hasEnd {
+		return in.exitCode
+	}
+	var inputs []string
+	for _, f := range files {
+		if !awkAssignment(f) {
+			inputs = append(inputs, f)
+		}
+	}
+	if len(inputs) == 0 {
+		files = append(files, "-")
+	}
+	for _, name := range files {
+		if awkAssignment(name) {
+			in.assign(name)
+			continue
+		}
+		f, err := openInput(in.sys, name)
+		if err != nil {
+			fmt.Fprintf(in.sys.Err(), "awk: cannot open %v (%v)\n", name, honeyos.ErrnoString(err))
+			in.sys.Out().Write(in.out.Bytes())
+			in.out.Reset()
+			return 2
+		}
+		lines, _ := readLines(f)
+		f.Close()
+		if name != "-" {
+			in.vars["FILENAME"] = awkStrVal(name)
+		}
+		in.vars["FNR"] = awkNumVal(0)
+		for _, line := range lines {
+			in.vars["NR"] = awkNumVal(in.num(in.vars["NR"]) + 1)
+			in.vars["FNR"] = awkNumVal(in.num(in.vars["FNR"]) + 1)
+			in.setRecord(line)
+			switch in.execRules(rules) {
+			case flowExit:
+				return in.runEnd(rules)
+			}
+		}
+	}
+	return in.runEnd(rules)
+}
+
+func (in *awkInterp) runEnd(rules []*awkRule) int {
+	for _, r := range rules {
+		if r.end && in.execBlock(r.action) == flowExit {
+			break
+		}
+	}
+	return in.exitCode
+}
+
+// execRules runs the main rules on the current record
+func (in *awkInterp) execRules(rules []*awkRule) awkFlow {
+	for _, r := range rules {
+		if r.begin || r.end {
+			continue
+		}
+		switch {
+		case r.pattern == nil:
+		case r.pattern2 != nil:
+			if !r.inRange {
+				if !in.truth(in.eval(r.pattern)) {
+					continue
+				}
+				r.inRange = true
+			}
+			if in.truth(in.eval(r.pattern2)) {
+				r.inRange = false
+			}
+		case !in.truth(in.eval(r.pattern)):
+			continue
+		}
+		if r.action == nil {
+			in.output("", "", in.record+in.str(in.vars["ORS"]))
+			continue
+		}
+		switch flow := in.execBlock(r.action); flow {
+		case flowNext:
+			return flowNormal
+		case flowExit:
+			return flow
+		}
+	}
+	return flowNormal
+}
+
+func (in *awkInterp) execBlock(b awkBlock) awkFlow {
+	for _, s := range b {
+		if flow := in.exec(s); flow != flowNormal {
+			return flow
+		}
+	}
+	return flowNormal
+}
+
+func (in *awkInterp) exec(s awkStmt) awkFlow {
+	in.steps++
+	if in.steps > awkMaxSteps {
+		panic(awkRuntimeError("program limit exceeded: maximum number of statements"))
+	}
+	switch s := s.(type) {
+	case awkBlock:
+		return in.execBlock(s)
+	case *awkExprStmt:
+		in.eval(s.expr)
+	case *awkPrint:
+		in.print(s)
+	case *awkIf:
+		if in.truth(in.eval(s.cond)) {
+			return in.exec(s.then)
+		} else if s.els != nil {
+			return in.exec(s.els)
+		}
+	case *awkWhile:
+		for first := true; first && s.doLoop || in.truth(in.eval(s.cond)); first = false {
+			switch flow := in.exec(s.body); flow {
+			case flowBreak:
+				return flowNormal
+			case flowNext, flowExit:
+				return flow
+			}
+			in.steps++
+		}
+	case *awkFor:
+		if s.init != nil {
+			in.exec(s.init)
+		}
+		for s.cond == nil || in.truth(in.eval(s.cond)) {
+			switch flow := in.exec(s.body); flow {
+			case flowBreak:
+				return flowNormal
+			case flowNext, flowExit:
+				return flow
+			}
+			if s.post != nil {
+				in.exec(s.post)
+			}
+		}
+	case *awkForIn:
+		keys := make([]string, 0, len(in.array(s.array)))
+		for k := range in.array(s.array) {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			in.setVar(s.key, awkInput(k))
+			switch flow := in.exec(s.body); flow {
+			case flowBreak:
+				return flowNormal
+			case flowNext, flowExit:
+				return flow
+			}
+		}
+	case *awkDelete:
+		if s.subs == nil {
+			in.arrays[s.name] = map[string]awkValue{}
+		} else {
+			delete(in.array(s.name), in.subscript(s.subs))
+		}
+	case *awkJump:
+		switch s.kind {
+		case "next":
+			return flowNext
+		case "break":
+			return flowBreak
+		case "continue":
+			return flowContinue
+		}
+		if s.code != nil {
+			in.exitCode = int(in.num(in.eval(s.code)))
+		}
+		return flowExit
+	}
+	return flowNormal
+}
+
+func (in *awkInterp) print(s *awkPrint) {
+	var text string
+	if s.printf {
+		values := make([]awkValue, len(s.args))
+		for i, arg := range s.args {
+			values[i] = in.eval(arg)
+		}
+		text = in.sprintf(in.str(values[0]), values[1:])
+	} else {
+		parts := make([]string, len(s.args))
+		for i, arg := range s.args {
+			parts[i] = in.outputStr(in.eval(arg))
+		}
+		if len(s.args) == 0 {
+			parts = []string{in.record}
+		}
+		text = strings.Join(parts, in.str(in.vars["OFS"])) + in.str(in.vars["ORS"])
+	}
+	dest := ""
+	if s.dest != nil {
+		dest = in.str(in.eval(s.dest))
+	}
+	in.output(s.redirect, dest, text)
+}
+
+// output writes the text to the standard output or the redirected file.
+// Piping to commands is not supported and goes to the standard output
+func (in *awkInterp) output(redirect, dest, text string) {
+	if redirect != ">" && redirect != ">>" {
+		in.out.WriteString(text)
+		return
+	}
+	buf, ok := in.files[dest]
+	if !ok {
+		buf = &bytes.Buffer{}
+		if redirect == ">>" {
+			if f, err := openInput(in.sys, dest); err == nil {
+				content, _ := ioutil.ReadAll(f)
+				f.Close()
+				buf.Write(content)
+			}
+		}
+		in.files[dest] = buf
+		in.order = append(in.order, dest)
+	}
+	buf.WriteString(text)
+}
+
+// setRecord sets $0 and splits it into the fields
+func (in *awkInterp) setRecord(record string) {
+	in.record = record
+	in.fields = in.split(record, in.str(in.vars["FS"]))
+	in.vars["NF"] = awkNumVal(float64(len(in.fields)))
+}
+
+// split splits the string by the field separator
+func (in *awkInterp) split(s, fs string) []string {
+	switch {
+	case fs == " ":
+		return strings.Fields(s)
+	case len(s) == 0:
+		return nil
+	case len(fs) == 1 && fs != "\\":
+		return strings.Split(s, fs)
+	}
+	return in.regexp(fs).Split(s, -1)
+}
+
+// rebuild joins the fields into $0 with OFS after a field is assigned
+func (in *awkInterp) rebuild() {
+	in.record = strings.Join(in.fields, in.str(in.vars["OFS"]))
+}
+
+func (in *awkInterp) field(i int) awkValue {
+	switch {
+	case i < 0:
+		panic(awkRuntimeError(fmt.Sprintf("negative field index $%v", i)))
+	case i == 0:
+		return awkInput(in.record)
+	case i <= len(in.fields):
+		return awkInput(in.fields[i-1])
+	}
+	return awkValue{}
+}
+
+// fieldIndex converts the number to a field index. Numbers too large for
+// an int are kept out of range
+func fieldIndex(f float64) int {
+	switch {
+	case f > awkMaxNF:
+		return awkMaxNF + 1
+	case f < -awkMaxNF:
+		return -awkMaxNF - 1
+	}
+	return int(f)
+}
+
+// checkNF fails when the record would have more fields than mawk allows
+func checkNF(n int) {
+	if n > awkMaxNF {
+		panic(awkRuntimeError(fmt.Sprintf("program limit exceeded: maximum number of fields size=%d", awkMaxNF)))
+	}
+}
+
+func (in *awkInterp) setField(i int, v string) {
+	if i < 0 {
+		panic(awkRuntimeError(fmt.Sprintf("negative field index $%v", i)))
+	}
+	checkNF(i)
+	if i == 0 {
+		in.setRecord(v)
+		return
+	}
+	for len(in.fields) < i {
+		in.fields = append(in.fields, "")
+	}
+	in.fields[i-1] = v
+	in.vars["NF"] = awkNumVal(float64(len(in.fields)))
+	in.rebuild()
+}
+
+func (in *awkInterp) setVar(name string, v awkValue) {
+	in.vars[name] = v
+	if name == "NF" {
+		n := fieldIndex(in.num(v))
+		if n < 0 {
+			n = 0
+		}
+		checkNF(n)
+		for len(in.fields) < n {
+			in.fields = append(in.fields, "")
+		}
+		in.fields = in.fields[:n]
+		in.rebuild()
+	}
+}
+
+func (in *awkInterp) array(name string) map[string]awkValue {
+	a, ok := in.arrays[name]
+	if !ok {
+		a = map[string]awkValue{}
+		in.arrays[name] = a
+	}
+	return a
+}
+
+func (in *awkInterp) subscript(subs []awkExpr) string {
+	keys := make([]string, len(subs))
+	for i, s := range subs {
+		keys[i] = in.str(in.eval(s))
+	}
+	return strings.Join(keys, in.str(in.vars["SUBSEP"]))
+}
+
+// regexp compiles the dynamic regular expression, caching the result
+func (in *awkInterp) regexp(expr string) *regexp.Regexp {
+	if re, ok := in.regexps[expr]; ok {
+		return re
+	}
+	re, err := compileRegexp(expr, true, false)
+	if err != nil {
+		panic(awkRuntimeError(fmt.Sprintf("regular expression compile failed (%v)\n%v", regexpError(err), expr)))
+	}
+	in.regexps[expr] = re
+	return re
+}
+
+// toRegexp returns the regular expression of the right side of ~ and the
+// arguments of the functions taking one
+func (in *awkInterp) toRegexp(e awkExpr) *regexp.Regexp {
+	if r, ok := e.(*awkRegexLit); ok {
+		return r.re
+	}
+	return in.regexp(in.str(in.eval(e)))
+}
+
+func (in *awkInterp) eval(e awkExpr) awkValue {
+	switch e := e.(type) {
+	case awkNumLit:
+		return awkNumVal(float64(e))
+	case awkStrLit:
+		return awkStrVal(string(e))
+	case *awkRegexLit:
+		return awkBool(e.re.MatchString(in.record))
+	case awkVar:
+		return in.vars[string(e)]
+	case *awkField:
+		return in.field(fieldIndex(in.num(in.eval(e.index))))
+	case *awkIndex:
+		a := in.array(e.name)
+		key := in.subscript(e.subs)
+		v, ok := a[key]
+		if !ok {
+			a[key] = v
+		}
+		return v
+	case awkGrouping:
+		return awkStrVal(in.subscript(e))
+	case *awkAssign:
+		v := in.eval(e.value)
+		if e.op != "=" {
+			v = awkNumVal(in.arith(e.op[:1], in.num(in.eval(e.target)), in.num(v)))
+		}
+		if v.kind == awkUninit {
+			v = awkValue{kind: awkStrNum}
+		}
+		in.store(e.target, v)
+		return v
+	case *awkCond:
+		if in.truth(in.eval(e.cond)) {
+			return in.eval(e.yes)
+		}
+		return in.eval(e.no)
+	case *awkBinary:
+		return in.binary(e)
+	case *awkUnary:
+		v := in.eval(e.operand)
+		switch e.op {
+		case "!":
+			return awkBool(!in.truth(v))
+		case "-":
+			return awkNumVal(-in.num(v))
+		}
+		return awkNumVal(in.num(v))
+	case *awkIncr:
+		old := in.num(in.eval(e.target))
+		n := old + 1
+		if e.op == "--" {
+			n = old - 1
+		}
+		in.store(e.target, awkNumVal(n))
+		if e.prefix {
+			return awkNumVal(n)
+		}
+		return awkNumVal(old)
+	case *awkIn:
+		_, ok := in.array(e.array)[in.subscript(e.subs)]
+		return awkBool(ok)
+	case *awkCall:
+		return in.call(e)
+	}
+	return awkValue{}
+}
+
+func (in *awkInterp) store(target awkExpr, v awkValue) {
+	switch t := target.(type) {
+	case awkVar:
+		in.setVar(string(t), v)
+	case *awkField:
+		in.setField(fieldIndex(in.num(in.eval(t.index))), in.str(v))
+	case *awkIndex:
+		in.array(t.name)[in.subscript(t.subs)] = v
+	}
+}
+
+func (in *awkInterp) binary(e *awkBinary) awkValue {
+	switch e.op {
+	case "&&":
+		return awkBool(in.truth(in.eval(e.left)) && in.truth(in.eval(e.right)))
+	case "||":
+		return awkBool(in.truth(in.eval(e.left)) || in.truth(in.eval(e.right)))
+	case "~", "!~":
+		matched := in.toRegexp(e.right).MatchString(in.str(in.eval(e.left)))
+		return awkBool(matched == (e.op == "~"))
+	}
+	left, right := in.eval(e.left), in.eval(e.right)
+	switch e.op {
+	case " ":
+		return awkStrVal(in.str(left) + in.str(right))
+	case "<", "<=", "==", "!=", ">", ">=":
+		var c int
+		if in.isNumeric(left) && in.isNumeric(right) {
+			switch l, r := in.num(left), in.num(right); {
+			case l < r:
+				c = -1
+			case l > r:
+				c = 1
+			}
+		} else {
+			c = strings.Compare(in.str(left), in.str(right))
+		}
+		switch e.op {
+		case "<":
+			return awkBool(c < 0)
+		case "<=":
+			return awkBool(c <= 0)
+		case "==":
+			return awkBool(c == 0)
+		case "!=":
+			return awkBool(c != 0)
+		case ">":
+			return awkBool(c > 0)
+		}
+		return awkBool(c >= 0)
+	}
+	return awkNumVal(in.arith(e.op, in.num(left), in.num(right)))
+}
+
+func (in *awkInterp) arith(op string, l, r float64) float64 {
+	switch op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			panic(awkRuntimeError("division by zero"))
+		}
+		return l / r
+	case "%":
+		if r == 0 {
+			panic(awkRuntimeError("division by zero in %"))
+		}
+		return math.Mod(l, r)
+	}
+	return math.Pow(l, r)
+}
+
+func (in *awkInterp) call(e *awkCall) awkValue {
+	arg := func(i int) awkValue {
+		if i < len(e.args) {
+			return in.eval(e.args[i])
+		}
+		return awkValue{}
+	}
+	argc := map[string][2]int{
+		"length": {0, 1}, "substr": {2, 3}, "index": {2, 2}, "split": {2, 3}, "sub": {2, 3},
+		"gsub": {2, 3}, "match": {2, 2}, "sprintf": {1, 255}, "tolower": {1, 1}, "toupper": {1, 1},
+		"int": {1, 1}, "sqrt": {1, 1}, "exp": {1, 1}, "log": {1, 1}, "sin": {1, 1}, "cos": {1, 1},
+		"atan2": {2, 2}, "rand": {0, 0}, "srand": {0, 1},
+	}[e.name]
+	if len(e.args) < argc[0] || len(e.args) > argc[1] {
+		panic(awkRuntimeError(fmt.Sprintf("wrong number of arguments in call to %v", e.name)))
+	}
+	switch e.name {
+	case "length":
+		if len(e.args) == 0 {
+			return awkNumVal(float64(utf8.RuneCountInString(in.record)))
+		}
+		if v, ok := e.args[0].(awkVar); ok {
+			if a, ok := in.arrays[string(v)]; ok {
+				return awkNumVal(float64(len(a)))
+			}
+		}
+		return awkNumVal(float64(utf8.RuneCountInString(in.str(arg(0)))))
+	case "substr":
+		s := []rune(in.str(arg(0)))
+		start := math.Floor(in.num(arg(1)) + .5)
+		end := math.Inf(1)
+		if len(e.args) == 3 {
+			end = start + math.Floor(in.num(arg(2))+.5)
+		}
+		start = math.Max(start, 1)
+		end = math.Min(end, float64(len(s)+1))
+		if end <= start {
+			return awkStrVal("")
+		}
+		return awkStrVal(string(s[int(start)-1 : int(end)-1]))
+	case "index":
+		s, t := in.str(arg(0)), in.str(arg(1))
+		i := strings.Index(s, t)
+		if i < 0 {
+			return awkNumVal(0)
+		}
+		return awkNumVal(float64(utf8.RuneCountInString(s[:i]) + 1))
+	case "split":
+		name, ok := e.args[1].(awkVar)
+		if !ok {
+			panic(awkRuntimeError("split: second argument must be an array"))
+		}
+		fs := in.str(in.vars["FS"])
+		if len(e.args) == 3 {
+			if r, ok := e.args[2].(*awkRegexLit); ok {
+				fs = r.re.String()
+			} else {
+				fs = in.str(arg(2))
+			}
+		}
+		parts := in.split(in.str(arg(0)), fs)
+		a := map[string]awkValue{}
+		for i, p := range parts {
+			a[strconv.Itoa(i+1)] = awkInput(p)
+		}
+		in.arrays[string(name)] = a
+		return awkNumVal(float64(len(parts)))
+	case "sub", "gsub":
+		var target awkExpr = &awkField{awkNumLit(0)}
+		if len(e.args) == 3 {
+			if !isLvalue(e.args[2]) {
+				panic(awkRuntimeError(fmt.Sprintf("%v: third argument must be a variable", e.name)))
+			}
+			target = e.args[2]
+		}
+		re := in.toRegexp(e.args[0])
+		repl := in.str(arg(1))
+		n, s := awkSubstitute(re, in.str(in.eval(target)), repl, e.name == "gsub")
+		if n > 0 {
+			in.store(target, awkStrVal(s))
+		}
+		return awkNumVal(float64(n))
+	case "match":
+		s := in.str(arg(0))
+		loc := in.toRegexp(e.args[1]).FindStringIndex(s)
+		start, length := 0, -1
+		if loc != nil {
+			start = utf8.RuneCountInString(s[:loc[0]]) + 1
+			length = utf8.RuneCountInString(s[loc[0]:loc[1]])
+		}
+		in.vars["RSTART"], in.vars["RLENGTH"] = awkNumVal(float64(start)), awkNumVal(float64(length))
+		return awkNumVal(float64(start))
+	case "sprintf":
+		values := make([]awkValue, len(e.args)-1)
+		for i := range values {
+			values[i] = arg(i + 1)
+		}
+		return awkStrVal(in.sprintf(in.str(arg(0)), values))
+	case "tolower":
+		return awkStrVal(strings.ToLower(in.str(arg(0))))
+	case "toupper":
+		return awkStrVal(strings.ToUpper(in.str(arg(0))))
+	case "int":
+		return awkNumVal(math.Trunc(in.num(arg(0))))
+	case "sqrt":
+		return awkNumVal(math.Sqrt(in.num(arg(0))))
+	case "exp":
+		return awkNumVal(math.Exp(in.num(arg(0))))
+	case "log":
+		return awkNumVal(math.Log(in.num(arg(0))))
+	case "sin":
+		return awkNumVal(math.Sin(in.num(arg(0))))
+	case "cos":
+		return awkNumVal(math.Cos(in.num(arg(0))))
+	case "atan2":
+		return awkNumVal(math.Atan2(in.num(arg(0)), in.num(arg(1))))
+	case "rand":
+		return awkNumVal(in.rand.Float64())
+	case "srand":
+		seed := time.Now().Unix()
+		if len(e.args) == 1 {
+			seed = int64(in.num(arg(0)))
+		}
+		in.rand.Seed(seed)
+		return awkNumVal(0)
+	}
+	return awkValue{}
+}
+
+// awkSubstitute replaces the first or all matches of re in s, & in the
+// replacement standing for the matched text
+func awkSubstitute(re *regexp.Regexp, s, repl string, global bool) (int, string) {
+	var buf bytes.Buffer
+	n, pos := 0, 0
+	for pos <= len(s) {
+		loc := re.FindStringIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		buf.WriteString(s[pos:start])
+		for i := 0; i < len(repl); i++ {
+			switch {
+			case repl[i] == '\\' && i+1 < len(repl) && (repl[i+1] == '&' || repl[i+1] == '\\'):
+				i++
+				buf.WriteByte(repl[i])
+			case repl[i] == '&':
+				buf.WriteString(s[start:end])
+			default:
+				buf.WriteByte(repl[i])
+			}
+		}
+		n++
+		pos = end
+		if start == end {
+			// An empty match moves past the next character
+			if end < len(s) {
+				buf.WriteByte(s[end])
+			}
+			pos++
+		}
+		if !global {
+			break
+		}
+	}
+	if pos < len(s) {
+		buf.WriteString(s[pos:])
+	}
+	return n, buf.String()
+}
+
+// sprintf formats the values like printf of awk
+func (in *awkInterp) sprintf(format string, values []awkValue) string {
+	var buf bytes.Buffer
+	next := func() awkValue {
+		if len(values) == 0 {
+			panic(awkRuntimeError("not enough arguments passed to sprintf(\"" + format + "\")"))
+		}
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			buf.WriteByte(format[i])
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			buf.WriteByte('%')
+			i++
+			continue
+		}
+		spec := []byte{'%'}
+		j := i + 1
+		for j < len(format) && strings.IndexByte("-+ #0", format[j]) >= 0 {
+			spec = append(spec, format[j])
+			j++
+		}
+		for part := 0; part < 2; part++ {
+			if j < len(format) && format[j] == '*' {
+				spec = strconv.AppendInt(spec, int64(in.num(next())), 10)
+				j++
+			}
+			for j < len(format) && isDigit(format[j]) {
+				spec = append(spec, format[j])
+				j++
+			}
+			if part == 0 && j < len(format) && format[j] == '.' {
+				spec = append(spec, '.')
+				j++
+			} else {
+				break
+			}
+		}
+		for j < len(format) && strings.IndexByte("hlLqjzt", format[j]) >= 0 {
+			j++
+		}
+		if j >= len(format) {
+			buf.Write(spec)
+			break
+		}
+		switch c := format[j]; c {
+		case 'd', 'i':
+			fmt.Fprintf(&buf, string(spec)+"d", int64(in.num(next())))
+		case 'o', 'x', 'X', 'u':
+			if c == 'u' {
+				c = 'd'
+			}
+			fmt.Fprintf(&buf, string(spec)+string(c), uint64(int64(in.num(next()))))
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			fmt.Fprintf(&buf, string(spec)+strings.ToLower(string(c)), in.num(next()))
+		case 'c':
+			v := next()
+			s := in.str(v)
+			if v.kind == awkNum {
+				s = string(rune(int(v.n)))
+			} else if len(s) > 0 {
+				_, size := utf8.DecodeRuneInString(s)
+				s = s[:size]
+			}
+			fmt.Fprintf(&buf, string(spec)+"s", s)
+		case 's':
+			fmt.Fprintf(&buf, string(spec)+"s", in.str(next()))
+		default:
+			panic(awkRuntimeError(fmt.Sprintf("bad conversion character %c in sprintf(\"%v\")", c, format)))
+		}
+		i = j
+	}
+	return buf.String()
+}
+
+func awkNumVal(n float64) awkValue {
+	return awkValue{kind: awkNum, n: n}
+}
+
+func awkStrVal(s string) awkValue {
+	return awkValue{kind: awkStr, s: s}
+}
+
+// awkInput returns the value of the input string, which is a number if it
+// looks like one
+func awkInput(s string) awkValue {
+	v := awkValue{kind: awkStr, s: s}
+	t := strings.Trim(s, " \t\n")
+	if len(t) > 0 && (t[0] == '-' || t[0] == '+') {
+		t = t[1:]
+	}
+	if len(t) > 0 && awkNumberPrefix(t) == t && t != "." {
+		v.kind = awkStrNum
+		v.n = awkToNumber(s)
+	}
+	return v
+}
+
+func awkBool(b bool) awkValue {
+	if b {
+		return awkNumVal(1)
+	}
+	return awkNumVal(0)
+}
+
+// awkToNumber converts the leading number of the string like strtod
+func awkToNumber(s string) float64 {
+	s = strings.TrimLeft(s, " \t\n")
+	sign := ""
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		sign, s = s[:1], s[1:]
+	}
+	n, _ := strconv.ParseFloat(sign+awkNumberPrefix(s), 64)
+	return n
+}
+
+func (in *awkInterp) isNumeric(v awkValue) bool {
+	return v.kind == awkNum || v.kind == awkStrNum || v.kind == awkUninit
+}
+
+func (in *awkInterp) num(v awkValue) float64 {
+	switch v.kind {
+	case awkNum, awkStrNum:
+		return v.n
+	case awkStr:
+		return awkToNumber(v.s)
+	}
+	return 0
+}
+
+// str converts the value to a string, numbers with CONVFMT unless they
+// are integers
+func (in *awkInterp) str(v awkValue) string {
+	if v.kind != awkNum {
+		return v.s
+	}
+	return in.formatNumber(v.n, "CONVFMT")
+}
+
+// outputStr converts the value to a string for print, with OFMT
+func (in *awkInterp) outputStr(v awkValue) string {
+	if v.kind != awkNum {
+		return v.s
+	}
+	return in.formatNumber(v.n, "OFMT")
+}
+
+func (in *awkInterp) formatNumber(n float64, fmtVar string) string {
+	switch {
+	case math.IsNaN(n):
+		return "nan"
+	case math.IsInf(n, 1):
+		return "inf"
+	case math.IsInf(n, -1):
+		return "-inf"
+	case n == math.Trunc(n) && math.Abs(n) < 1e16:
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return in.sprintf(in.vars[fmtVar].s, []awkValue{awkNumVal(n)})
+}
+
+func (in *awkInterp) truth(v awkValue) bool {
+	switch v.kind {
+	case awkNum:
+		return v.n != 0
+	case awkStrNum:
+		return v.n != 0
+	case awkStr:
+		return len(v.s) > 0
+	}
+	return false
+}
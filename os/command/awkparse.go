@@ -0,0 +1,897 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Token kinds of the awk lexer
+const (
+	awkEOF = iota
+	awkNewline
+	awkNumber
+	awkString
+	awkRegexp
+	awkName
+	awkFuncName
+	awkKeyword
+	awkPunct
+)
+
+// awkKeywords are the reserved words of awk, the builtin functions being
+// lexed as keywords too
+var awkKeywords = map[string]bool{
+	"BEGIN": true, "END": true, "print": true, "printf": true, "if": true, "else": true,
+	"while": true, "for": true, "do": true, "in": true, "next": true, "exit": true,
+	"break": true, "continue": true, "delete": true, "getline": true, "function": true,
+	"return": true,
+}
+
+// awkBuiltins are the builtin functions which are implemented
+var awkBuiltins = map[string]bool{
+	"length": true, "substr": true, "index": true, "split": true, "sub": true, "gsub": true,
+	"match": true, "sprintf": true, "tolower": true, "toupper": true, "int": true,
+	"sqrt": true, "exp": true, "log": true, "sin": true, "cos": true, "atan2": true,
+	"rand": true, "srand": true,
+}
+
+type awkToken struct {
+	kind int
+	text string
+}
+
+// awkSyntaxError is the error of the program reported like mawk
+type awkSyntaxError struct {
+	line int
+	msg  string
+}
+
+func (e awkSyntaxError) Error() string {
+	return fmt.Sprintf("line %v: %v", e.line, e.msg)
+}
+
+// awkLexer splits the program into tokens. Whether a slash starts a regular
+// expression depends on the previous token
+type awkLexer struct {
+	src  string
+	pos  int
+	line int
+	last awkToken
+}
+
+func (l *awkLexer) fail(format string, args ...interface{}) {
+	panic(awkSyntaxError{l.line, fmt.Sprintf(format, args...)})
+}
+
+func (l *awkLexer) next() awkToken {
+	t := l.scan()
+	l.last = t
+	return t
+}
+
+func (l *awkLexer) scan() awkToken {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '\\' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '\n':
+			l.pos += 2
+			l.line++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			goto token
+		}
+	}
+	return awkToken{kind: awkEOF}
+token:
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '\n':
+		l.pos++
+		l.line++
+		return awkToken{awkNewline, "\n"}
+	case isDigit(c) || c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+		l.pos += len(awkNumberPrefix(l.src[l.pos:]))
+		return awkToken{awkNumber, l.src[start:l.pos]}
+	case isAlpha(c) || c == '_':
+		for l.pos < len(l.src) && (isAlpha(l.src[l.pos]) || isDigit(l.src[l.pos]) || l.src[l.pos] == '_') {
+			l.pos++
+		}
+		name := l.src[start:l.pos]
+		switch {
+		case awkKeywords[name] || awkBuiltins[name]:
+			return awkToken{awkKeyword, name}
+		case l.pos < len(l.src) && l.src[l.pos] == '(':
+			return awkToken{awkFuncName, name}
+		}
+		return awkToken{awkName, name}
+	case c == '"':
+		return awkToken{awkString, l.quoted('"', "runaway string constant")}
+	case c == '/' && !l.operandBefore():
+		return awkToken{awkRegexp, l.quoted('/', "runaway regular expression")}
+	}
+	for _, op := range []string{"+=", "-=", "*=", "/=", "%=", "^=", "==", "<=", ">=", "!=", "++", "--",
+		"&&", "||", ">>", "!~", "**"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			if op == "**" {
+				op = "^"
+			}
+			return awkToken{awkPunct, op}
+		}
+	}
+	if strings.IndexByte("{}()[];,+-*/%^!<>|?:~$=", c) < 0 {
+		l.fail("syntax error at or near %c", c)
+	}
+	l.pos++
+	return awkToken{awkPunct, string(c)}
+}
+
+// operandBefore reports if the previous token ends an operand, in which
+// case a slash is the division
+func (l *awkLexer) operandBefore() bool {
+	switch l.last.kind {
+	case awkNumber, awkString, awkName, awkRegexp:
+		return true
+	case awkKeyword:
+		return l.last.text == "getline" || awkBuiltins[l.last.text]
+	case awkPunct:
+		return l.last.text == ")" || l.last.text == "]" || l.last.text == "$" ||
+			l.last.text == "++" || l.last.text == "--"
+	}
+	return false
+}
+
+// quoted reads the string or regular expression ending with the delimiter
+func (l *awkLexer) quoted(delim byte, runaway string) string {
+	start := l.pos
+	l.pos++
+	var buf []byte
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+			l.fail("%v %c%v ...", runaway, delim, l.src[start+1:l.pos])
+		}
+		c := l.src[l.pos]
+		if c == delim {
+			l.pos++
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.src) {
+			l.pos++
+			if delim == '/' {
+				// Regular expressions keep their escapes except the slash
+				if l.src[l.pos] != '/' {
+					buf = append(buf, '\\')
+				}
+				buf = append(buf, l.src[l.pos])
+				l.pos++
+				continue
+			}
+			buf = append(buf, awkEscape(l.src, &l.pos)...)
+			continue
+		}
+		buf = append(buf, c)
+		l.pos++
+	}
+	return string(buf)
+}
+
+// awkEscape interprets the escape at pos, right after the backslash, and
+// advances pos past it
+func awkEscape(s string, pos *int) []byte {
+	c := s[*pos]
+	*pos++
+	switch c {
+	case 'n':
+		return []byte{'\n'}
+	case 't':
+		return []byte{'\t'}
+	case 'r':
+		return []byte{'\r'}
+	case '\\', '"', '/':
+		return []byte{c}
+	case 'a':
+		return []byte{'\a'}
+	case 'b':
+		return []byte{'\b'}
+	case 'f':
+		return []byte{'\f'}
+	case 'v':
+		return []byte{'\v'}
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n := int(c - '0')
+		for i := 0; i < 2 && *pos < len(s) && s[*pos] >= '0' && s[*pos] <= '7'; i++ {
+			n = n*8 + int(s[*pos]-'0')
+			*pos++
+		}
+		return []byte{byte(n)}
+	}
+	return []byte{'\\', c}
+}
+
+// awkUnescape interprets the escapes of the values given with -v and -F
+func awkUnescape(s string) string {
+	var buf []byte
+	for i := 0; i < len(s); {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			buf = append(buf, awkEscape(s, &i)...)
+			continue
+		}
+		buf = append(buf, s[i])
+		i++
+	}
+	return string(buf)
+}
+
+// awkNumberPrefix returns the longest prefix of s which is a number
+func awkNumberPrefix(s string) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	if i > 0 && i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+	return s[:i]
+}
+
+// The nodes of the parsed program
+type (
+	awkExpr interface{}
+	awkStmt interface{}
+
+	awkNumLit   float64
+	awkStrLit   string
+	awkRegexLit struct{ re *regexp.Regexp }
+	awkVar      string
+	awkField    struct{ index awkExpr }
+	awkIndex    struct {
+		name string
+		subs []awkExpr
+	}
+	awkGrouping []awkExpr
+	awkAssign   struct {
+		op            string
+		target, value awkExpr
+	}
+	awkCond   struct{ cond, yes, no awkExpr }
+	awkBinary struct {
+		op          string
+		left, right awkExpr
+	}
+	awkUnary struct {
+		op      string
+		operand awkExpr
+	}
+	awkIncr struct {
+		op     string
+		prefix bool
+		target awkExpr
+	}
+	awkCall struct {
+		name string
+		args []awkExpr
+	}
+	awkIn struct {
+		subs  []awkExpr
+		array string
+	}
+
+	awkBlock []awkStmt
+	awkPrint struct {
+		printf   bool
+		args     []awkExpr
+		redirect string
+		dest     awkExpr
+	}
+	awkExprStmt struct{ expr awkExpr }
+	awkIf       struct {
+		cond      awkExpr
+		then, els awkStmt
+	}
+	awkWhile struct {
+		cond   awkExpr
+		body   awkStmt
+		doLoop bool
+	}
+	awkFor struct {
+		init, post awkStmt
+		cond       awkExpr
+		body       awkStmt
+	}
+	awkForIn struct {
+		key, array string
+		body       awkStmt
+	}
+	awkDelete struct {
+		name string
+		subs []awkExpr
+	}
+	awkJump struct {
+		kind string
+		code awkExpr
+	}
+)
+
+// awkRule is a pattern-action pair, the action being nil when the rule
+// prints the record
+type awkRule struct {
+	begin, end, inRange bool
+	pattern, pattern2   awkExpr
+	action              awkBlock
+}
+
+// awkParser is a recursive descent parser of the awk program
+type awkParser struct {
+	lex *awkLexer
+	tok awkToken
+}
+
+// parseAwk parses the program text into the rules
+func parseAwk(src string) (rules []*awkRule, err error) {
+	p := &awkParser{lex: &awkLexer{src: src, line: 1}}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(awkSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	p.advance()
+	p.skipTerminators()
+	for p.tok.kind != awkEOF {
+		rules = append(rules, p.rule())
+		p.skipTerminators()
+	}
+	return rules, nil
+}
+
+func (p *awkParser) advance() {
+	p.tok = p.lex.next()
+}
+
+func (p *awkParser) fail() {
+	text := p.tok.text
+	switch p.tok.kind {
+	case awkEOF:
+		text = "end of file"
+	case awkNewline:
+		text = "end of line"
+	case awkString:
+		text = strconv.Quote(text)
+	case awkRegexp:
+		text = "/" + text + "/"
+	}
+	p.lex.fail("syntax error at or near %v", text)
+}
+
+func (p *awkParser) is(text string) bool {
+	return (p.tok.kind == awkPunct || p.tok.kind == awkKeyword) && p.tok.text == text
+}
+
+func (p *awkParser) expect(text string) {
+	if !p.is(text) {
+		p.fail()
+	}
+	p.advance()
+}
+
+func (p *awkParser) skipNewlines() {
+	for p.tok.kind == awkNewline {
+		p.advance()
+	}
+}
+
+func (p *awkParser) skipTerminators() {
+	for p.tok.kind == awkNewline || p.is(";") {
+		p.advance()
+	}
+}
+
+func (p *awkParser) rule() *awkRule {
+	r := &awkRule{}
+	switch {
+	case p.is("BEGIN"):
+		r.begin = true
+		p.advance()
+	case p.is("END"):
+		r.end = true
+		p.advance()
+	case p.is("function"):
+		p.lex.fail("function definitions are not supported")
+	case !p.is("{"):
+		r.pattern = p.expr(false)
+		if p.is(",") {
+			p.advance()
+			p.skipNewlines()
+			r.pattern2 = p.expr(false)
+		}
+	}
+	if (r.begin || r.end) && !p.is("{") {
+		p.fail()
+	}
+	if p.is("{") {
+		r.action = p.block()
+		if r.action == nil {
+			r.action = awkBlock{}
+		}
+	}
+	return r
+}
+
+func (p *awkParser) block() awkBlock {
+	p.expect("{")
+	var stmts awkBlock
+	p.skipTerminators()
+	for !p.is("}") {
+		stmts = append(stmts, p.stmt())
+		p.skipTerminators()
+	}
+	p.advance()
+	return stmts
+}
+
+// simpleEnd consumes the end of a simple statement
+func (p *awkParser) simpleEnd() {
+	switch {
+	case p.is(";") || p.tok.kind == awkNewline:
+		p.advance()
+	case p.is("}") || p.tok.kind == awkEOF:
+	default:
+		p.fail()
+	}
+}
+
+// optStmt parses the body of if, while and for, which may start on the
+// next line
+func (p *awkParser) optStmt() awkStmt {
+	p.skipNewlines()
+	if p.is(";") {
+		p.advance()
+		return awkBlock{}
+	}
+	return p.stmt()
+}
+
+func (p *awkParser) stmt() awkStmt {
+	switch {
+	case p.is("{"):
+		return p.block()
+	case p.is("if"):
+		p.advance()
+		p.expect("(")
+		s := &awkIf{cond: p.expr(false)}
+		p.expect(")")
+		s.then = p.optStmt()
+		// else may follow after terminators
+		save, saveLex := p.tok, *p.lex
+		p.skipTerminators()
+		if p.is("else") {
+			p.advance()
+			s.els = p.optStmt()
+		} else {
+			p.tok, *p.lex = save, saveLex
+		}
+		return s
+	case p.is("while"):
+		p.advance()
+		p.expect("(")
+		s := &awkWhile{cond: p.expr(false)}
+		p.expect(")")
+		if p.is(";") {
+			p.advance()
+			s.body = awkBlock{}
+			return s
+		}
+		s.body = p.optStmt()
+		return s
+	case p.is("do"):
+		p.advance()
+		s := &awkWhile{doLoop: true, body: p.optStmt()}
+		p.skipTerminators()
+		p.expect("while")
+		p.expect("(")
+		s.cond = p.expr(false)
+		p.expect(")")
+		p.simpleEnd()
+		return s
+	case p.is("for"):
+		return p.forStmt()
+	case p.is(";"):
+		p.advance()
+		return awkBlock{}
+	}
+	s := p.simpleStmt()
+	p.simpleEnd()
+	return s
+}
+
+func (p *awkParser) forStmt() awkStmt {
+	p.advance()
+	p.expect("(")
+	if p.tok.kind == awkName {
+		// Look ahead for (key in array)
+		save, saveLex := p.tok, *p.lex
+		key := p.tok.text
+		p.advance()
+		if p.is("in") {
+			p.advance()
+			if p.tok.kind != awkName {
+				p.fail()
+			}
+			array := p.tok.text
+			p.advance()
+			if p.is(")") {
+				p.advance()
+				return &awkForIn{key: key, array: array, body: p.optStmt()}
+			}
+		}
+		p.tok, *p.lex = save, saveLex
+	}
+	s := &awkFor{}
+	if !p.is(";") {
+		s.init = p.simpleStmt()
+	}
+	p.expect(";")
+	p.skipNewlines()
+	if !p.is(";") {
+		s.cond = p.expr(false)
+	}
+	p.expect(";")
+	p.skipNewlines()
+	if !p.is(")") {
+		s.post = p.simpleStmt()
+	}
+	p.expect(")")
+	if p.is(";") {
+		p.advance()
+		s.body = awkBlock{}
+		return s
+	}
+	s.body = p.optStmt()
+	return s
+}
+
+func (p *awkParser) simpleStmt() awkStmt {
+	switch {
+	case p.is("print") || p.is("printf"):
+		s := &awkPrint{printf: p.tok.text == "printf"}
+		p.advance()
+		if !p.is(";") && !p.is("}") && !p.is(">") && !p.is(">>") && !p.is("|") &&
+			p.tok.kind != awkNewline && p.tok.kind != awkEOF {
+			s.args = p.exprList(true)
+			if len(s.args) == 1 {
+				if g, ok := s.args[0].(awkGrouping); ok {
+					s.args = g
+				}
+			}
+		}
+		if s.printf && len(s.args) == 0 {
+			p.fail()
+		}
+		if p.is(">") || p.is(">>") || p.is("|") {
+			s.redirect = p.tok.text
+			p.advance()
+			s.dest = p.concat(true)
+		}
+		return s
+	case p.is("next") || p.is("break") || p.is("continue"):
+		s := &awkJump{kind: p.tok.text}
+		p.advance()
+		return s
+	case p.is("exit"):
+		s := &awkJump{kind: "exit"}
+		p.advance()
+		if !p.is(";") && !p.is("}") && p.tok.kind != awkNewline && p.tok.kind != awkEOF {
+			s.code = p.expr(false)
+		}
+		return s
+	case p.is("delete"):
+		p.advance()
+		if p.tok.kind != awkName {
+			p.fail()
+		}
+		s := &awkDelete{name: p.tok.text}
+		p.advance()
+		if p.is("[") {
+			p.advance()
+			s.subs = p.exprList(false)
+			p.expect("]")
+		}
+		return s
+	case p.is("getline") || p.is("return"):
+		p.fail()
+	}
+	return &awkExprStmt{p.expr(false)}
+}
+
+func (p *awkParser) exprList(noGT bool) []awkExpr {
+	list := []awkExpr{p.expr(noGT)}
+	for p.is(",") {
+		p.advance()
+		p.skipNewlines()
+		list = append(list, p.expr(noGT))
+	}
+	return list
+}
+
+// expr parses an expression. noGT is set in the arguments of print, where
+// > is the output redirection
+func (p *awkParser) expr(noGT bool) awkExpr {
+	left := p.ternary(noGT)
+	switch {
+	case p.is("=") || p.is("+=") || p.is("-=") || p.is("*=") || p.is("/=") || p.is("%=") || p.is("^="):
+		if !isLvalue(left) {
+			p.fail()
+		}
+		op := p.tok.text
+		p.advance()
+		p.skipNewlines()
+		return &awkAssign{op: op, target: left, value: p.expr(noGT)}
+	}
+	return left
+}
+
+func isLvalue(e awkExpr) bool {
+	switch e.(type) {
+	case awkVar, *awkField, *awkIndex:
+		return true
+	}
+	return false
+}
+
+func (p *awkParser) ternary(noGT bool) awkExpr {
+	cond := p.or(noGT)
+	if !p.is("?") {
+		return cond
+	}
+	p.advance()
+	p.skipNewlines()
+	yes := p.expr(noGT)
+	p.skipNewlines()
+	p.expect(":")
+	p.skipNewlines()
+	return &awkCond{cond, yes, p.expr(noGT)}
+}
+
+func (p *awkParser) or(noGT bool) awkExpr {
+	left := p.and(noGT)
+	for p.is("||") {
+		p.advance()
+		p.skipNewlines()
+		left = &awkBinary{"||", left, p.and(noGT)}
+	}
+	return left
+}
+
+func (p *awkParser) and(noGT bool) awkExpr {
+	left := p.in(noGT)
+	for p.is("&&") {
+		p.advance()
+		p.skipNewlines()
+		left = &awkBinary{"&&", left, p.in(noGT)}
+	}
+	return left
+}
+
+func (p *awkParser) in(noGT bool) awkExpr {
+	left := p.match(noGT)
+	for p.is("in") {
+		p.advance()
+		if p.tok.kind != awkName {
+			p.fail()
+		}
+		subs := []awkExpr{left}
+		if g, ok := left.(awkGrouping); ok {
+			subs = g
+		}
+		left = &awkIn{subs, p.tok.text}
+		p.advance()
+	}
+	return left
+}
+
+func (p *awkParser) match(noGT bool) awkExpr {
+	left := p.comparison(noGT)
+	for p.is("~") || p.is("!~") {
+		op := p.tok.text
+		p.advance()
+		left = &awkBinary{op, left, p.comparison(noGT)}
+	}
+	return left
+}
+
+func (p *awkParser) comparison(noGT bool) awkExpr {
+	left := p.concat(noGT)
+	if p.is("<") || p.is("<=") || p.is("==") || p.is("!=") || p.is(">=") || !noGT && p.is(">") {
+		op := p.tok.text
+		p.advance()
+		left = &awkBinary{op, left, p.concat(noGT)}
+	}
+	return left
+}
+
+// startsOperand reports if the token can start the right operand of a
+// concatenation
+func (p *awkParser) startsOperand() bool {
+	switch p.tok.kind {
+	case awkNumber, awkString, awkRegexp, awkName, awkFuncName:
+		return true
+	case awkKeyword:
+		return awkBuiltins[p.tok.text]
+	case awkPunct:
+		return p.is("$") || p.is("(") || p.is("!") || p.is("-") || p.is("+") || p.is("++") || p.is("--")
+	}
+	return false
+}
+
+func (p *awkParser) concat(noGT bool) awkExpr {
+	left := p.additive()
+	for p.startsOperand() && !p.is("-") && !p.is("+") && !p.is("!") {
+		left = &awkBinary{" ", left, p.additive()}
+	}
+	return left
+}
+
+func (p *awkParser) additive() awkExpr {
+	left := p.multiplicative()
+	for p.is("+") || p.is("-") {
+		op := p.tok.text
+		p.advance()
+		left = &awkBinary{op, left, p.multiplicative()}
+	}
+	return left
+}
+
+func (p *awkParser) multiplicative() awkExpr {
+	left := p.unary()
+	for p.is("*") || p.is("/") || p.is("%") {
+		op := p.tok.text
+		p.advance()
+		left = &awkBinary{op, left, p.unary()}
+	}
+	return left
+}
+
+func (p *awkParser) unary() awkExpr {
+	if p.is("!") || p.is("-") || p.is("+") {
+		op := p.tok.text
+		p.advance()
+		return &awkUnary{op, p.unary()}
+	}
+	return p.power()
+}
+
+func (p *awkParser) power() awkExpr {
+	left := p.postfix()
+	if p.is("^") {
+		p.advance()
+		// Right associative, and binds tighter than unary minus on the left
+		return &awkBinary{"^", left, p.unary()}
+	}
+	return left
+}
+
+func (p *awkParser) postfix() awkExpr {
+	if p.is("++") || p.is("--") {
+		op := p.tok.text
+		p.advance()
+		target := p.primary()
+		if !isLvalue(target) {
+			p.fail()
+		}
+		return &awkIncr{op, true, target}
+	}
+	e := p.primary()
+	if (p.is("++") || p.is("--")) && isLvalue(e) {
+		op := p.tok.text
+		p.advance()
+		return &awkIncr{op, false, e}
+	}
+	return e
+}
+
+func (p *awkParser) primary() awkExpr {
+	t := p.tok
+	switch t.kind {
+	case awkNumber:
+		p.advance()
+		n, _ := strconv.ParseFloat(t.text, 64)
+		return awkNumLit(n)
+	case awkString:
+		p.advance()
+		return awkStrLit(t.text)
+	case awkRegexp:
+		re, err := compileRegexp(t.text, true, false)
+		if err != nil {
+			p.lex.fail("regular expression compile failed (%v)\n%v", regexpError(err), t.text)
+		}
+		p.advance()
+		return &awkRegexLit{re}
+	case awkName:
+		p.advance()
+		if p.is("[") {
+			p.advance()
+			e := &awkIndex{name: t.text, subs: p.exprList(false)}
+			p.expect("]")
+			return e
+		}
+		return awkVar(t.text)
+	case awkFuncName:
+		p.lex.fail("function %v never defined", t.text)
+	case awkKeyword:
+		if !awkBuiltins[t.text] {
+			break
+		}
+		p.advance()
+		call := &awkCall{name: t.text}
+		if !p.is("(") {
+			// length may be used without parentheses
+			if t.text != "length" {
+				p.fail()
+			}
+			return call
+		}
+		p.advance()
+		if !p.is(")") {
+			call.args = p.exprList(false)
+		}
+		p.expect(")")
+		return call
+	case awkPunct:
+		switch t.text {
+		case "$":
+			p.advance()
+			if p.is("++") || p.is("--") {
+				return &awkField{p.postfix()}
+			}
+			if p.is("-") {
+				p.advance()
+				return &awkField{&awkUnary{"-", p.primary()}}
+			}
+			return &awkField{p.primary()}
+		case "(":
+			p.advance()
+			list := p.exprList(false)
+			p.expect(")")
+			if len(list) > 1 {
+				if !p.is("in") && !p.is(">") && !p.is(">>") && !p.is("|") && !p.is(";") && !p.is("}") &&
+					p.tok.kind != awkNewline && p.tok.kind != awkEOF {
+					p.fail()
+				}
+				return awkGrouping(list)
+			}
+			return list[0]
+		case "-", "+", "!":
+			p.advance()
+			return &awkUnary{t.text, p.unary()}
+		}
+	}
+	p.fail()
+	return nil
+}
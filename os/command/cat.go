@@ -1,46 +1,172 @@
 package command
 
 import (
+	"bytes"
 	"fmt"
-	"io"
-	"os"
-	"path"
+	"io/ioutil"
 
 	honeyos "github.com/mkishere/sshsyrup/os"
 )
 
 type cat struct{}
 
+// catOptions are the options given to cat
+type catOptions struct {
+	number, numberNonblank, squeeze, showEnds, showTabs, showNonprinting bool
+}
+
 func init() {
 	honeyos.RegisterCommand("cat", cat{})
 }
 
 func (c cat) GetHelp() string {
-	return ""
+	return `Usage: cat [OPTION]... [FILE]...
+Concatenate FILE(s) to standard output.
+
+With no FILE, or when FILE is -, read standard input.
+
+  -A, --show-all           equivalent to -vET
+  -b, --number-nonblank    number nonempty output lines, overrides -n
+  -e                       equivalent to -vE
+  -E, --show-ends          display $ at end of each line
+  -n, --number             number all output lines
+  -s, --squeeze-blank      suppress repeated empty output lines
+  -t                       equivalent to -vT
+  -T, --show-tabs          display TAB characters as ^I
+  -u                       (ignored)
+  -v, --show-nonprinting   use ^ and M- notation, except for LFD and TAB
+      --help     display this help and exit
+      --version  output version information and exit
+
+Examples:
+  cat f - g  Output f's contents, then standard input, then g's contents.
+  cat        Copy standard input to standard output.
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/cat>
+or available locally via: info '(coreutils) cat invocation'
+`
 }
 
 func (c cat) Exec(args []string, sys honeyos.Sys) int {
-	if len(args) == 0 {
-		return 0
+	opts, operands, err := getopt(args, optionSpec{
+		short: "AbeEnstTuv",
+		long: map[string]string{
+			"show-all": "A", "number-nonblank": "b", "show-ends": "E", "number": "n",
+			"squeeze-blank": "s", "show-tabs": "T", "show-nonprinting": "v",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "cat", err)
+	}
+	var o catOptions
+	for _, opt := range opts {
+		switch opt.name {
+		case "A":
+			o.showNonprinting, o.showEnds, o.showTabs = true, true, true
+		case "b":
+			o.numberNonblank = true
+		case "e":
+			o.showNonprinting, o.showEnds = true, true
+		case "E":
+			o.showEnds = true
+		case "n":
+			o.number = true
+		case "s":
+			o.squeeze = true
+		case "t":
+			o.showNonprinting, o.showTabs = true, true
+		case "T":
+			o.showTabs = true
+		case "v":
+			o.showNonprinting = true
+		case "help":
+			fmt.Fprint(sys.Out(), c.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("cat", "Torbjorn Granlund and Richard M. Stallman"))
+			return 0
+		}
 	}
-	filePath := args[0]
-	if !path.IsAbs(filePath) {
-		filePath = path.Join(sys.Getcwd(), filePath)
+	if len(operands) == 0 {
+		operands = []string{"-"}
 	}
-	f, err := sys.FSys().OpenFile(filePath, os.O_RDONLY, os.ModeType)
-	if err != nil {
-		if err == os.ErrNotExist {
-			fmt.Fprintf(sys.Out(), "cat: %v: No such file or directory\n", args[0])
-			return 1
-		} else if err == os.ErrPermission {
-			fmt.Fprintf(sys.Out(), "cat: %v: Permission denied\n", args[0])
-			return 1
+	plain := o == catOptions{}
+	status := 0
+	// The line number and blank line state carry over between files
+	lineNo, blanks := 0, 0
+	for _, name := range operands {
+		f, err := openInput(sys, name)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "cat: %v: %v\n", name, honeyos.ErrnoString(err))
+			status = 1
+			continue
+		}
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		if plain {
+			sys.Out().Write(content)
+			continue
+		}
+		var buf bytes.Buffer
+		for len(content) > 0 {
+			line := content
+			end := bytes.IndexByte(content, '\n')
+			if end >= 0 {
+				line, content = content[:end], content[end+1:]
+			} else {
+				content = nil
+			}
+			if len(line) == 0 {
+				blanks++
+				if o.squeeze && blanks > 1 {
+					continue
+				}
+			} else {
+				blanks = 0
+			}
+			if o.numberNonblank && len(line) > 0 || o.number && !o.numberNonblank {
+				lineNo++
+				fmt.Fprintf(&buf, "%6d\t", lineNo)
+			}
+			for _, b := range line {
+				switch {
+				case b == '\t' && o.showTabs:
+					buf.WriteString("^I")
+				case b == '\t' || !o.showNonprinting:
+					buf.WriteByte(b)
+				default:
+					buf.WriteString(nonprinting(b))
+				}
+			}
+			if end >= 0 {
+				if o.showEnds {
+					buf.WriteByte('$')
+				}
+				buf.WriteByte('\n')
+			}
 		}
+		sys.Out().Write(buf.Bytes())
+	}
+	return status
+}
+
+// nonprinting returns the byte in the ^ and M- notation of cat -v
+func nonprinting(b byte) string {
+	prefix := ""
+	if b >= 128 {
+		prefix, b = "M-", b-128
+	}
+	switch {
+	case b < 32:
+		return prefix + "^" + string(b+64)
+	case b == 127:
+		return prefix + "^?"
 	}
-	io.Copy(sys.Out(), f)
-	return 0
+	return prefix + string(b)
 }
 
 func (c cat) Where() string {
-	return "/bin/pwd"
+	return "/bin/cat"
 }
@@ -0,0 +1,178 @@
+package command
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+type chmod struct{}
+
+// chmodOptions are the options given to chmod
+type chmodOptions struct {
+	recursive, verbose, changes, quiet bool
+}
+
+func init() {
+	honeyos.RegisterCommand("chmod", chmod{})
+}
+
+func (chmod) GetHelp() string {
+	return `Usage: chmod [OPTION]... MODE[,MODE]... FILE...
+  or:  chmod [OPTION]... OCTAL-MODE FILE...
+  or:  chmod [OPTION]... --reference=RFILE FILE...
+Change the mode of each FILE to MODE.
+With --reference, change the mode of each FILE to that of RFILE.
+
+  -c, --changes          like verbose but report only when a change is made
+  -f, --silent, --quiet  suppress most error messages
+  -v, --verbose          output a diagnostic for every file processed
+      --no-preserve-root  do not treat '/' specially (the default)
+      --preserve-root    fail to operate recursively on '/'
+      --reference=RFILE  use RFILE's mode instead of MODE values
+  -R, --recursive        change files and directories recursively
+      --help     display this help and exit
+      --version  output version information and exit
+
+Each MODE is of the form '[ugoa]*([-+=]([rwxXst]*|[ugo]))+|[-+=][0-7]+'.
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/chmod>
+or available locally via: info '(coreutils) chmod invocation'
+`
+}
+
+func (c chmod) Exec(args []string, sys honeyos.Sys) int {
+	// Modes like -w look like options, so they are taken out first
+	var mode string
+	rest := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if len(mode) == 0 && len(arg) > 1 && arg[0] == '-' && strings.Trim(arg[1:], "rwxXst") == "" {
+			mode = arg
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	opts, operands, err := getopt(rest, optionSpec{
+		short: "cfvR",
+		long: map[string]string{
+			"changes": "c", "silent": "f", "quiet": "f", "verbose": "v", "recursive": "R",
+			"no-preserve-root": "no-preserve-root", "preserve-root": "preserve-root",
+			"reference=": "reference", "help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "chmod", err)
+	}
+	var o chmodOptions
+	reference := ""
+	for _, opt := range opts {
+		switch opt.name {
+		case "c":
+			o.changes = true
+		case "f":
+			o.quiet = true
+		case "v":
+			o.verbose = true
+		case "R":
+			o.recursive = true
+		case "reference":
+			reference = opt.value
+		case "help":
+			fmt.Fprint(sys.Out(), c.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("chmod", "David MacKenzie and Jim Meyering"))
+			return 0
+		}
+	}
+	if len(mode) == 0 && len(reference) == 0 {
+		if len(operands) == 0 {
+			return usageError(sys, "chmod", "missing operand")
+		}
+		mode, operands = operands[0], operands[1:]
+	}
+	if len(operands) == 0 {
+		if len(mode) > 0 {
+			return usageError(sys, "chmod", fmt.Sprintf("missing operand after %v", quote(mode)))
+		}
+		return usageError(sys, "chmod", "missing operand")
+	}
+	if len(reference) > 0 {
+		fi, err := sys.FSys().Stat(fullPath(sys, reference))
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "chmod: failed to get attributes of %v: %v\n", quote(reference), honeyos.ErrnoString(err))
+			return 1
+		}
+		mode = fmt.Sprintf("%o", unixMode(fi.Mode()))
+	}
+	if _, ok := parseMode(mode, 0, false); !ok {
+		fmt.Fprintf(sys.Err(), "chmod: invalid mode: %v\n", quote(mode))
+		fmt.Fprintln(sys.Err(), "Try 'chmod --help' for more information.")
+		return 1
+	}
+	status := 0
+	for _, name := range operands {
+		if !c.change(sys, fullPath(sys, name), name, mode, o) {
+			status = 1
+		}
+	}
+	return status
+}
+
+// change applies the mode to the file, and to the content of the directory
+// when recursive
+func (c chmod) change(sys honeyos.Sys, p, name, mode string, o chmodOptions) bool {
+	fs := sys.FSys()
+	fi, err := fs.Stat(p)
+	if err != nil {
+		if !o.quiet {
+			fmt.Fprintf(sys.Err(), "chmod: cannot access %v: %v\n", quote(name), honeyos.ErrnoString(err))
+		}
+		return false
+	}
+	old := unixMode(fi.Mode())
+	bits, _ := parseMode(mode, old, fi.IsDir())
+	ok := true
+	if err := fs.Chmod(p, fileMode(bits)); err != nil {
+		if !o.quiet {
+			fmt.Fprintf(sys.Err(), "chmod: changing permissions of %v: %v\n", quote(name), honeyos.ErrnoString(err))
+		}
+		ok = false
+	} else {
+		if bits != old {
+			sys.FsEvent("chmod", p, log.Fields{"cmd": "chmod", "mode": fmt.Sprintf("%04o", bits), "oldMode": fmt.Sprintf("%04o", old)})
+		}
+		switch {
+		case bits != old && (o.verbose || o.changes):
+			fmt.Fprintf(sys.Out(), "mode of %v changed from %04o (%v) to %04o (%v)\n", quote(name), old, modeString(old), bits, modeString(bits))
+		case bits == old && o.verbose:
+			fmt.Fprintf(sys.Out(), "mode of %v retained as %04o (%v)\n", quote(name), old, modeString(old))
+		}
+	}
+	if o.recursive && fi.IsDir() {
+		entries, err := afero.ReadDir(fs, p)
+		if err != nil {
+			if !o.quiet {
+				fmt.Fprintf(sys.Err(), "chmod: cannot read directory %v: %v\n", quote(name), honeyos.ErrnoString(err))
+			}
+			return false
+		}
+		for _, entry := range entries {
+			ok = c.change(sys, path.Join(p, entry.Name()), path.Join(name, entry.Name()), mode, o) && ok
+		}
+	}
+	return ok
+}
+
+func (chmod) Where() string {
+	return "/bin/chmod"
+}
@@ -0,0 +1,252 @@
+package command
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	"github.com/mkishere/sshsyrup/virtualfs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+type chown struct{}
+
+// chownOptions are the options given to chown
+type chownOptions struct {
+	recursive, verbose, changes, quiet bool
+}
+
+func init() {
+	honeyos.RegisterCommand("chown", chown{})
+}
+
+func (chown) GetHelp() string {
+	return `Usage: chown [OPTION]... [OWNER][:[GROUP]] FILE...
+  or:  chown [OPTION]... --reference=RFILE FILE...
+Change the owner and/or group of each FILE to OWNER and/or GROUP.
+With --reference, change the owner and group of each FILE to those of RFILE.
+
+  -c, --changes          like verbose but report only when a change is made
+  -f, --silent, --quiet  suppress most error messages
+  -v, --verbose          output a diagnostic for every file processed
+      --dereference      affect the referent of each symbolic link (this is
+                         the default), rather than the symbolic link itself
+  -h, --no-dereference   affect symbolic links instead of any referenced file
+      --from=CURRENT_OWNER:CURRENT_GROUP
+                         change the owner and/or group of each file only if
+                         its current owner and/or group match those specified
+                         here.  Either may be omitted, in which case a match
+                         is not required for the omitted attribute
+      --no-preserve-root  do not treat '/' specially (the default)
+      --preserve-root    fail to operate recursively on '/'
+      --reference=RFILE  use RFILE's owner and group rather than
+                         specifying OWNER:GROUP values
+  -R, --recursive        operate on files and directories recursively
+
+      --help     display this help and exit
+      --version  output version information and exit
+
+Owner is unchanged if missing.  Group is unchanged if missing, but changed
+to login group if implied by a ':' following a symbolic OWNER.
+OWNER and GROUP may be numeric as well as symbolic.
+
+Examples:
+  chown root /u        Change the owner of /u to "root".
+  chown root:staff /u  Likewise, but also change its group to "staff".
+  chown -hR root /u    Change the owner of /u and subfiles to "root".
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/chown>
+or available locally via: info '(coreutils) chown invocation'
+`
+}
+
+func (c chown) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "cfvhHLPR",
+		long: map[string]string{
+			"changes": "c", "silent": "f", "quiet": "f", "verbose": "v", "dereference": "dereference",
+			"no-dereference": "h", "from=": "from", "no-preserve-root": "no-preserve-root",
+			"preserve-root": "preserve-root", "reference=": "reference", "recursive": "R",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "chown", err)
+	}
+	var o chownOptions
+	reference := ""
+	for _, opt := range opts {
+		switch opt.name {
+		case "c":
+			o.changes = true
+		case "f":
+			o.quiet = true
+		case "v":
+			o.verbose = true
+		case "R":
+			o.recursive = true
+		case "reference":
+			reference = opt.value
+		case "help":
+			fmt.Fprint(sys.Out(), c.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("chown", "David MacKenzie and Jim Meyering"))
+			return 0
+		}
+	}
+	uid, gid := -1, -1
+	if len(reference) > 0 {
+		fi, err := sys.FSys().Stat(fullPath(sys, reference))
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "chown: failed to get attributes of %v: %v\n", quote(reference), honeyos.ErrnoString(err))
+			return 1
+		}
+		uid, gid, _, _ = virtualfs.GetExtraInfo(fi)
+	} else {
+		if len(operands) == 0 {
+			return usageError(sys, "chown", "missing operand")
+		}
+		spec := operands[0]
+		operands = operands[1:]
+		var msg string
+		if uid, gid, msg = parseOwner(spec); len(msg) > 0 {
+			fmt.Fprintf(sys.Err(), "chown: %v\n", msg)
+			return 1
+		}
+		if len(operands) == 0 {
+			return usageError(sys, "chown", fmt.Sprintf("missing operand after %v", quote(spec)))
+		}
+	}
+	status := 0
+	for _, name := range operands {
+		if !c.change(sys, fullPath(sys, name), name, uid, gid, o) {
+			status = 1
+		}
+	}
+	return status
+}
+
+// parseOwner parses the OWNER[:[GROUP]] argument of chown. -1 is returned
+// for the ID which is not changed, with the error message if it is invalid
+func parseOwner(spec string) (uid, gid int, msg string) {
+	uid, gid = -1, -1
+	owner, group := spec, ""
+	sep := strings.IndexByte(spec, ':')
+	if sep < 0 {
+		// user.group is the obsolete form of user:group
+		if dot := strings.IndexByte(spec, '.'); dot >= 0 && len(honeyos.GetUser(spec).Name) == 0 {
+			sep = dot
+		}
+	}
+	if sep >= 0 {
+		owner, group = spec[:sep], spec[sep+1:]
+	}
+	if len(owner) > 0 {
+		u := honeyos.GetUser(owner)
+		switch n, err := strconv.Atoi(owner); {
+		case len(u.Name) > 0:
+			uid = u.UID
+		case err == nil && n >= 0:
+			uid = n
+			u = honeyos.GetUserByID(n)
+		default:
+			return -1, -1, fmt.Sprintf("invalid user: %v", quote(spec))
+		}
+		if sep >= 0 && len(group) == 0 {
+			// The login group is implied by a ':' after the owner
+			gid = u.GID
+		}
+	}
+	if len(group) > 0 {
+		g := honeyos.GetGroup(group)
+		switch n, err := strconv.Atoi(group); {
+		case len(g.Name) > 0:
+			gid = g.GID
+		case err == nil && n >= 0:
+			gid = n
+		default:
+			return -1, -1, fmt.Sprintf("invalid group: %v", quote(spec))
+		}
+	}
+	return
+}
+
+// change sets the ownership of the file, and of the content of the
+// directory when recursive
+func (c chown) change(sys honeyos.Sys, p, name string, uid, gid int, o chownOptions) bool {
+	fs := sys.FSys()
+	fi, err := fs.Stat(p)
+	if err != nil {
+		if !o.quiet {
+			fmt.Fprintf(sys.Err(), "chown: cannot access %v: %v\n", quote(name), honeyos.ErrnoString(err))
+		}
+		return false
+	}
+	oldUID, oldGID, _, _ := virtualfs.GetExtraInfo(fi)
+	newUID, newGID := uid, gid
+	if newUID < 0 {
+		newUID = oldUID
+	}
+	if newGID < 0 {
+		newGID = oldGID
+	}
+	changed := newUID != oldUID || newGID != oldGID
+	ok := true
+	// Only root can give the files away, and other users can only change
+	// the group of their own files
+	if sys.CurrentUser() != 0 && (newUID != oldUID || oldUID != sys.CurrentUser()) {
+		if !o.quiet {
+			fmt.Fprintf(sys.Err(), "chown: changing ownership of %v: Operation not permitted\n", quote(name))
+		}
+		ok = false
+	} else if err := honeyos.Chown(fs, p, newUID, newGID); err != nil {
+		if !o.quiet {
+			fmt.Fprintf(sys.Err(), "chown: changing ownership of %v: %v\n", quote(name), honeyos.ErrnoString(err))
+		}
+		ok = false
+	} else {
+		if changed {
+			sys.FsEvent("chown", p, log.Fields{"cmd": "chown", "owner": newUID, "group": newGID})
+		}
+		switch {
+		case changed && (o.verbose || o.changes):
+			fmt.Fprintf(sys.Out(), "changed ownership of %v from %v to %v\n", quote(name), ownerString(oldUID, oldGID), ownerString(newUID, newGID))
+		case !changed && o.verbose:
+			fmt.Fprintf(sys.Out(), "ownership of %v retained as %v\n", quote(name), ownerString(oldUID, oldGID))
+		}
+	}
+	if o.recursive && fi.IsDir() {
+		entries, err := afero.ReadDir(fs, p)
+		if err != nil {
+			if !o.quiet {
+				fmt.Fprintf(sys.Err(), "chown: cannot read directory %v: %v\n", quote(name), honeyos.ErrnoString(err))
+			}
+			return false
+		}
+		for _, entry := range entries {
+			ok = c.change(sys, path.Join(p, entry.Name()), path.Join(name, entry.Name()), uid, gid, o) && ok
+		}
+	}
+	return ok
+}
+
+// ownerString formats the owner and group by name like chown -v
+func ownerString(uid, gid int) string {
+	owner, group := strconv.Itoa(uid), strconv.Itoa(gid)
+	if u := honeyos.GetUserByID(uid); len(u.Name) > 0 {
+		owner = u.Name
+	}
+	if g := honeyos.GetGroupByID(gid); len(g.Name) > 0 {
+		group = g.Name
+	}
+	return owner + ":" + group
+}
+
+func (chown) Where() string {
+	return "/bin/chown"
+}
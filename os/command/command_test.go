@@ -0,0 +1,1079 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	"github.com/mkishere/sshsyrup/util/capture"
+	"github.com/mkishere/sshsyrup/virtualfs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+)
+
+// testSys is the system commands run on in tests, with the image as the
+// filesystem and the output kept in buffers
+type testSys struct {
+	honeyos.Sys
+	cwd      string
+	fs       afero.Fs
+	in       io.Reader
+	out, err bytes.Buffer
+	mounts   []virtualfs.Mount
+	procs    *honeyos.ProcessTable
+	pid      int
+}
+
+func (s *testSys) Getcwd() string                             { return s.cwd }
+func (s *testSys) In() io.Reader                              { return s.in }
+func (s *testSys) Out() io.Writer                             { return &s.out }
+func (s *testSys) Err() io.Writer                             { return &s.err }
+func (s *testSys) FSys() afero.Fs                             { return s.fs }
+func (s *testSys) Width() int                                 { return 80 }
+func (s *testSys) Height() int                                { return 24 }
+func (s *testSys) CurrentUser() int                           { return 0 }
+func (s *testSys) CurrentGroup() int                          { return 0 }
+func (s *testSys) FsEvent(op, path string, fields log.Fields) {}
+func (s *testSys) LogEvent(msg string, fields log.Fields)     {}
+func (s *testSys) Capture(data []byte, src capture.Source)    {}
+func (s *testSys) Mounts() []virtualfs.Mount                  { return s.mounts }
+func (s *testSys) Processes() *honeyos.ProcessTable           { return s.procs }
+func (s *testSys) Getpid() int                                { return s.pid }
+
+func newTestSys(t *testing.T) *testSys {
+	vfs, err := virtualfs.NewVirtualFS("../../filesystem.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := honeyos.LoadUsers("../../passwd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := honeyos.LoadGroups("../../group"); err != nil {
+		t.Fatal(err)
+	}
+	return &testSys{
+		cwd: "/",
+		fs:  virtualfs.NewOwnerFs(virtualfs.NewLayerFs(vfs, afero.NewMemMapFs())),
+		in:  strings.NewReader(""),
+	}
+}
+
+// run runs the command with the arguments, returning the output and exit
+// status
+func (s *testSys) run(cmd honeyos.Command, args ...string) (stdout, stderr string, status int) {
+	s.out.Reset()
+	s.err.Reset()
+	status = cmd.Exec(args, s)
+	return s.out.String(), s.err.String(), status
+}
+
+func TestCat(t *testing.T) {
+	sys := newTestSys(t)
+	sys.fs.MkdirAll("/tmp", 01777)
+	afero.WriteFile(sys.fs, "/tmp/a", []byte("one\n\n\n\ttwo\n"), 0644)
+	afero.WriteFile(sys.fs, "/tmp/b", []byte("three"), 0644)
+	sys.in = strings.NewReader("stdin\n")
+	tests := []struct {
+		args           []string
+		stdout, stderr string
+		status         int
+	}{
+		{[]string{"/tmp/a", "/tmp/b"}, "one\n\n\n\ttwo\nthree", "", 0},
+		{[]string{"/tmp/b", "-", "/etc/hostname"}, "threestdin\n", "", 0},
+		{[]string{"-n", "/tmp/a", "/tmp/b"}, "     1\tone\n     2\t\n     3\t\n     4\t\ttwo\n     5\tthree", "", 0},
+		{[]string{"-bsA", "/tmp/a"}, "     1\tone$\n$\n     2\t^Itwo$\n", "", 0},
+		{[]string{"/nonexistent", "/etc", "/tmp/b"}, "three", "cat: /nonexistent: No such file or directory\ncat: /etc: Is a directory\n", 1},
+		{[]string{"-z"}, "", "cat: invalid option -- 'z'\nTry 'cat --help' for more information.\n", 1},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := sys.run(cat{}, test.args...)
+		if stdout != test.stdout || stderr != test.stderr || status != test.status {
+			t.Errorf("cat %v: got %q %q %v, want %q %q %v", test.args, stdout, stderr, status,
+				test.stdout, test.stderr, test.status)
+		}
+	}
+}
+
+func TestLs(t *testing.T) {
+	sys := newTestSys(t)
+	sys.cwd = "/etc"
+	tests := []struct {
+		args             []string
+		contains, absent []string
+		status           int
+	}{
+		{[]string{"cron.d"}, nil, []string{".placeholder"}, 0},
+		{[]string{"-a", "cron.d"}, []string{".\n..\n.placeholder\n"}, nil, 0},
+		{[]string{"-A", "cron.d"}, []string{".placeholder\n"}, []string{".\n"}, 0},
+		{[]string{"-d", "/etc", "/bin/nc"}, []string{"/bin/nc\n/etc\n"}, nil, 0},
+		{[]string{"-l", "/bin/nc"}, []string{"lrwxrwxrwx 1 root root ", " /bin/nc -> "}, nil, 0},
+		{[]string{"-ld", "/etc"}, []string{"drwxr-xr-x ", " 4096 "}, nil, 0},
+		{[]string{"-lhd", "/etc"}, []string{" 4.0K "}, nil, 0},
+		{[]string{"-1", "cron.d", "skel"}, []string{"cron.d:\n\nskel:\n"}, nil, 0},
+		{[]string{"-AR", "skel"}, []string{"skel:\n.bash_logout\n.bashrc\n.profile\n"}, nil, 0},
+		{[]string{"--color=always", "-d", "/etc"}, []string{"\x1b[01;34m/etc\x1b[0m"}, nil, 0},
+		{[]string{"-A", "/nonexistent", "skel"}, []string{".bashrc"}, nil, 2},
+	}
+	for _, test := range tests {
+		stdout, _, status := sys.run(ls{}, test.args...)
+		if status != test.status {
+			t.Errorf("ls %v: unexpected status %v", test.args, status)
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(stdout, s) {
+				t.Errorf("ls %v: %q not found in %q", test.args, s, stdout)
+			}
+		}
+		for _, s := range test.absent {
+			if strings.Contains(stdout, s) {
+				t.Errorf("ls %v: unexpected %q in %q", test.args, s, stdout)
+			}
+		}
+	}
+	_, stderr, _ := sys.run(ls{}, "/nonexistent")
+	if stderr != "ls: cannot access '/nonexistent': No such file or directory\n" {
+		t.Errorf("Unexpected error %q", stderr)
+	}
+}
+
+func TestLsSort(t *testing.T) {
+	sys := newTestSys(t)
+	sys.fs.MkdirAll("/tmp", 01777)
+	afero.WriteFile(sys.fs, "/tmp/big", make([]byte, 5000), 0644)
+	afero.WriteFile(sys.fs, "/tmp/small", []byte("x"), 0644)
+	afero.WriteFile(sys.fs, "/tmp/a", nil, 0644)
+	tests := map[string]string{
+		"":   "a\nbig\nsmall\n",
+		"-r": "small\nbig\na\n",
+		"-S": "big\nsmall\na\n",
+	}
+	for opt, want := range tests {
+		args := []string{"/tmp"}
+		if len(opt) > 0 {
+			args = append(args, opt)
+		}
+		if stdout, _, _ := sys.run(ls{}, args...); stdout != want {
+			t.Errorf("ls %v: got %q, want %q", args, stdout, want)
+		}
+	}
+	stdout, _, _ := sys.run(ls{}, "-lh", "/tmp/big")
+	if !strings.Contains(stdout, " 4.9K ") {
+		t.Errorf("Unexpected human readable size %q", stdout)
+	}
+}
+
+func TestCurl(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/x.sh", http.StatusFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%v %v %v %s\n", r.Method, r.URL.Path, r.UserAgent(), body)
+	}))
+	defer srv.Close()
+	// The test server is on the loopback, which is denied by default
+	viper.Set("download.denylist", []string{})
+	defer viper.Reset()
+	sys := newTestSys(t)
+	sys.fs.MkdirAll("/tmp", 01777)
+	tests := []struct {
+		args   []string
+		stdout string
+		status int
+	}{
+		{[]string{"-s", srv.URL + "/x.sh"}, "GET /x.sh curl/7.47.0 \n", 0},
+		{[]string{"-sL", srv.URL + "/moved"}, "GET /x.sh curl/7.47.0 \n", 0},
+		{[]string{"-s", "-A", "agent", "-d", "a=1", "-d", "b=2", srv.URL}, "POST / agent a=1&b=2\n", 0},
+		{[]string{"-so", "/tmp/out", srv.URL + "/out"}, "", 0},
+		{[]string{"-sO", srv.URL + "/x.sh"}, "", 0},
+		{[]string{"-sO", srv.URL + "/"}, "", 23},
+		{[]string{"-s", "ftp://localhost/"}, "", 1},
+		{[]string{"-Z"}, "", 2},
+	}
+	for _, test := range tests {
+		stdout, _, status := sys.run(curl{}, test.args...)
+		if stdout != test.stdout || status != test.status {
+			t.Errorf("curl %v: got %q %v, want %q %v", test.args, stdout, status, test.stdout, test.status)
+		}
+	}
+	for p, want := range map[string]string{"/tmp/out": "GET /out curl/7.47.0 \n", "/x.sh": "GET /x.sh curl/7.47.0 \n"} {
+		if b, _ := afero.ReadFile(sys.fs, p); string(b) != want {
+			t.Errorf("Unexpected content of %v: %q", p, b)
+		}
+	}
+	if _, stderr, _ := sys.run(curl{}, "-o", "/tmp/out", srv.URL); !strings.Contains(stderr, "% Total") {
+		t.Errorf("Progress meter not shown %q", stderr)
+	}
+	// Transfers leave no connection behind
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		sys.run(curl{}, "-s", srv.URL)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before+2 {
+		t.Errorf("Goroutines grew from %v to %v", before, after)
+	}
+}
+
+func TestDownloadPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://nonexistent.invalid/bot.sh", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "live")
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "payloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "bot.sh"), []byte("echo fake\n"), 0644)
+	viper.Set("download.denylist", []string{})
+	viper.Set("download.offline.payloadDir", dir)
+	viper.Set("download.offline.size", 100)
+	defer viper.Reset()
+
+	sys := newTestSys(t)
+	tests := []struct {
+		policy, url, body string
+	}{
+		{"offline", "http://nonexistent.invalid/bot.sh", "echo fake\n"},
+		{"offline", srv.URL + "/bot.sh", "echo fake\n"},
+		{"allowlisted", srv.URL, "live"},
+		{"allowlisted", "http://nonexistent.invalid/../../bot.sh", "echo fake\n"},
+		{"allowlisted", srv.URL + "/redirect", "echo fake\n"},
+	}
+	viper.Set("download.allowlist", []string{"127.0.0.0/8"})
+	for _, test := range tests {
+		viper.Set("download.policy", test.policy)
+		if stdout, _, _ := sys.run(curl{}, "-sL", test.url); stdout != test.body {
+			t.Errorf("%v %v: got %q, want %q", test.policy, test.url, stdout, test.body)
+		}
+	}
+	viper.Set("download.policy", "offline")
+	if stdout, _, status := sys.run(curl{}, "-s", "http://nonexistent.invalid/x.bin"); status != 0 || len(stdout) != 100 {
+		t.Errorf("Unexpected emulated download %v bytes status %v", len(stdout), status)
+	}
+}
+
+func TestDownloadLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/internal":
+			http.Redirect(w, r, "http://10.0.0.1/", http.StatusFound)
+		default:
+			w.Write(make([]byte, 2000))
+		}
+	}))
+	defer srv.Close()
+	defer viper.Reset()
+	sys := newTestSys(t)
+
+	if _, stderr, status := sys.run(curl{}, "-sS", srv.URL); status != 7 || !strings.Contains(stderr, "Connection refused") {
+		t.Errorf("Loopback not denied: %v %q", status, stderr)
+	}
+	viper.Set("download.denylist", []string{"10.0.0.0/8"})
+	viper.Set("download.maxSize", 1000)
+	viper.Set("download.maxRedirects", 2)
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{srv.URL, 56},
+		{srv.URL + "/loop", 0},
+		{srv.URL + "/internal", 7},
+	}
+	for _, test := range tests {
+		if _, _, status := sys.run(curl{}, "-sL", test.url); status != test.status {
+			t.Errorf("curl %v: got %v, want %v", test.url, status, test.status)
+		}
+	}
+}
+
+func TestFtpget(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	dl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dl.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			text := textproto.NewConn(conn)
+			text.PrintfLine("220 ready")
+			for {
+				line, err := text.ReadLine()
+				if err != nil {
+					break
+				}
+				switch {
+				case strings.HasPrefix(line, "USER bad"):
+					text.PrintfLine("530 Login incorrect.")
+				case strings.HasPrefix(line, "USER"):
+					text.PrintfLine("331 Please specify the password.")
+				case strings.HasPrefix(line, "PASS"):
+					text.PrintfLine("230 Login successful.")
+				case strings.HasPrefix(line, "TYPE"):
+					text.PrintfLine("200 Switching to Binary mode.")
+				case line == "PASV":
+					// The announced address is ignored in favour of the server one
+					port := dl.Addr().(*net.TCPAddr).Port
+					text.PrintfLine("227 Entering Passive Mode (10,0,0,1,%d,%d).", port>>8, port&0xff)
+				case line == "RETR bins.sh":
+					data, _ := dl.Accept()
+					text.PrintfLine("150 Opening BINARY mode data connection.")
+					data.Write([]byte("#!/bin/sh\n"))
+					data.Close()
+					text.PrintfLine("226 Transfer complete.")
+				case strings.HasPrefix(line, "RETR"):
+					text.PrintfLine("550 Failed to open file.")
+				default:
+					text.PrintfLine("221 Goodbye.")
+				}
+			}
+			conn.Close()
+		}
+	}()
+	viper.Set("download.denylist", []string{})
+	defer viper.Reset()
+	sys := newTestSys(t)
+	sys.fs.MkdirAll("/tmp", 01777)
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	tests := []struct {
+		args   []string
+		stderr string
+		status int
+	}{
+		{[]string{"-P", port, "127.0.0.1", "/tmp/bins.sh", "bins.sh"}, "", 0},
+		{[]string{"-P", port, "127.0.0.1", "x"}, "ftpget: unexpected server response to RETR: 550 Failed to open file.\n", 1},
+		{[]string{"-u", "bad", "-P", port, "127.0.0.1", "x"}, "ftpget: unexpected server response to USER: 530 Login incorrect.\n", 1},
+		{[]string{"127.0.0.1"}, ftpget{}.GetHelp(), 1},
+	}
+	for _, test := range tests {
+		if _, stderr, status := sys.run(ftpget{}, test.args...); stderr != test.stderr || status != test.status {
+			t.Errorf("ftpget %v: got %q %v, want %q %v", test.args, stderr, status, test.stderr, test.status)
+		}
+	}
+	if b, _ := afero.ReadFile(sys.fs, "/tmp/bins.sh"); string(b) != "#!/bin/sh\n" {
+		t.Errorf("Unexpected content %q", b)
+	}
+}
+
+func TestTftp(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	payload := bytes.Repeat([]byte("x"), 700)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			switch {
+			case bytes.HasPrefix(buf[:n], []byte("\x00\x01mips\x00")):
+				pc.WriteTo(append([]byte{0, 3, 0, 1}, payload[:512]...), addr)
+			case bytes.Equal(buf[:n], []byte{0, 4, 0, 1}):
+				pc.WriteTo(append([]byte{0, 3, 0, 2}, payload[512:]...), addr)
+			case buf[1] == 1:
+				pc.WriteTo([]byte("\x00\x05\x00\x01File not found\x00"), addr)
+			}
+		}
+	}()
+	viper.Set("download.denylist", []string{})
+	defer viper.Reset()
+	sys := newTestSys(t)
+	sys.cwd = "/home/mk"
+	port := strconv.Itoa(pc.LocalAddr().(*net.UDPAddr).Port)
+	tests := []struct {
+		args   []string
+		stderr string
+		status int
+	}{
+		{[]string{"-g", "-r", "mips", "127.0.0.1", port}, "", 0},
+		{[]string{"-g", "-r", "arm7", "127.0.0.1", port}, "tftp: server error: (1) File not found\n", 1},
+		{[]string{"-r", "arm7", "127.0.0.1"}, tftp{}.GetHelp(), 1},
+	}
+	for _, test := range tests {
+		if _, stderr, status := sys.run(tftp{}, test.args...); stderr != test.stderr || status != test.status {
+			t.Errorf("tftp %v: got %q %v, want %q %v", test.args, stderr, status, test.stderr, test.status)
+		}
+	}
+	if b, _ := afero.ReadFile(sys.fs, "/home/mk/mips"); !bytes.Equal(b, payload) {
+		t.Errorf("Unexpected content of %v bytes", len(b))
+	}
+}
+
+func TestWget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/bins.sh", http.StatusFound)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "text/x-sh; charset=utf-8")
+			http.ServeContent(w, r, "bins.sh", time.Time{}, strings.NewReader("#!/bin/sh\necho hi\n"))
+		}
+	}))
+	defer srv.Close()
+	viper.Set("download.denylist", []string{})
+	defer viper.Reset()
+	sys := newTestSys(t)
+	sys.cwd = "/home/mk"
+	tests := []struct {
+		args           []string
+		stdout, stderr string
+		status         int
+	}{
+		{[]string{srv.URL + "/moved"}, "", "Location: /bins.sh [following]\n", 0},
+		{[]string{srv.URL + "/bins.sh"}, "", "Length: 18 [text/x-sh]\nSaving to: ‘bins.sh’\n", 0},
+		{[]string{"-qO", "-", srv.URL + "/x"}, "#!/bin/sh\necho hi\n", "", 0},
+		{[]string{"-P", "/tmp/dl", srv.URL + "/missing"}, "", "HTTP request sent, awaiting response... 404 Not Found\n", 8},
+		{[]string{"-c", srv.URL + "/bins.sh"}, "", "\n    The file is already fully retrieved; nothing to do.\n", 0},
+		{[]string{"foo://x"}, "", "foo://x: Unsupported scheme ‘foo’.\n", 1},
+		{nil, "", "wget: missing URL\n", 1},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := sys.run(wget{}, test.args...)
+		if stdout != test.stdout || !strings.Contains(stderr, test.stderr) || status != test.status {
+			t.Errorf("wget %v: got %q %q %v, want %q %q %v", test.args, stdout, stderr, status,
+				test.stdout, test.stderr, test.status)
+		}
+	}
+	if b, _ := afero.ReadFile(sys.fs, "/home/mk/moved"); string(b) != "#!/bin/sh\necho hi\n" {
+		t.Errorf("Unexpected content %q", b)
+	}
+
+	afero.WriteFile(sys.fs, "/home/mk/part.sh", []byte("#!/bin/sh\n"), 0644)
+	_, stderr, _ := sys.run(wget{}, "-c", "-O", "part.sh", srv.URL+"/bins.sh")
+	if !strings.Contains(stderr, "206 Partial Content\nLength: 18, 8 remaining [text/x-sh]\n") ||
+		!strings.Contains(stderr, "‘part.sh’ saved [18/18]") {
+		t.Errorf("Unexpected output of resumed download %q", stderr)
+	}
+	if b, _ := afero.ReadFile(sys.fs, "/home/mk/part.sh"); string(b) != "#!/bin/sh\necho hi\n" {
+		t.Errorf("Unexpected content of resumed download %q", b)
+	}
+}
+
+func TestDd(t *testing.T) {
+	sys := newTestSys(t)
+	sys.fs = virtualfs.NewMountFs(sys.fs, virtualfs.Mount{Dir: "/dev", Fs: virtualfs.NewDevFs(nil)})
+	sys.fs.MkdirAll("/tmp", 01777)
+
+	_, stderr, status := sys.run(dd{}, "if=/dev/urandom", "of=/tmp/key", "bs=1K", "count=2")
+	if status != 0 || !strings.HasPrefix(stderr, "2+0 records in\n2+0 records out\n2048 bytes (2.0 kB, 2.0 KiB) copied, ") {
+		t.Errorf("dd from /dev/urandom exited with %v:\n%v", status, stderr)
+	}
+	if fi, err := sys.fs.Stat("/tmp/key"); err != nil || fi.Size() != 2048 {
+		t.Errorf("Output of dd: %v", err)
+	}
+	_, stderr, _ = sys.run(dd{}, "if=/tmp/key", "of=/dev/null", "bs=1000")
+	if !strings.HasPrefix(stderr, "2+1 records in\n2+1 records out\n") {
+		t.Errorf("dd of partial block:\n%v", stderr)
+	}
+	stdout, stderr, _ := sys.run(dd{}, "if=/dev/zero", "bs=3", "count=1", "status=none")
+	if stdout != "\x00\x00\x00" || len(stderr) > 0 {
+		t.Errorf("dd with status=none wrote %q, %q", stdout, stderr)
+	}
+	_, stderr, status = sys.run(dd{}, "if=/dev/zero", "of=/dev/full", "count=1")
+	if status != 1 || !strings.HasPrefix(stderr, "dd: error writing '/dev/full': No space left on device\n") {
+		t.Errorf("dd to /dev/full exited with %v:\n%v", status, stderr)
+	}
+	if _, stderr, status = sys.run(dd{}, "bs=x"); status != 1 || stderr != "dd: invalid number: 'x'\n" {
+		t.Errorf("dd with invalid number exited with %v: %q", status, stderr)
+	}
+}
+
+// testMounts mounts tmpfs at /tmp and a read-only directory at /srv like
+// the configuration
+func testMounts(sys *testSys) {
+	tmp := virtualfs.NewTmpFs(0777 | os.ModeSticky)
+	afero.WriteFile(tmp, "/big", make([]byte, 10000), 0644)
+	srv := afero.NewMemMapFs()
+	srv.MkdirAll("/www", 0755)
+	sys.mounts = []virtualfs.Mount{
+		{Dir: "/", Fs: sys.fs, Kind: virtualfs.FsImage, Source: "/dev/xvda1", Type: "ext4",
+			Options: "rw,relatime,discard,data=ordered", Size: 8065444, Used: 1679792},
+		{Dir: "/proc", Fs: virtualfs.NewReadOnlyFs(afero.NewMemMapFs()), Kind: virtualfs.FsProc, Source: "proc", Type: "proc", Options: "rw,nosuid,nodev,noexec,relatime"},
+		{Dir: "/tmp", Fs: tmp, Kind: virtualfs.FsTmpfs, Source: "tmpfs", Type: "tmpfs",
+			Options: "rw,nosuid,nodev,size=1012116k", Size: 1012116},
+		{Dir: "/srv", Fs: virtualfs.NewReadOnlyFs(srv), Kind: virtualfs.FsHost, Source: "/dev/xvdf", Type: "ext4",
+			Options: "ro,relatime,data=ordered", Size: 10190136, Used: 36888},
+	}
+	var mounts []virtualfs.Mount
+	for _, mnt := range sys.mounts {
+		if mnt.Fs != nil && mnt.Dir != "/" {
+			mounts = append(mounts, mnt)
+		}
+	}
+	sys.fs = virtualfs.NewMountFs(sys.fs, mounts...)
+}
+
+// testProcesses gives the system the process table of a new layer, with
+// root logged in on pts/0 and the command run by the login shell
+func testProcesses(t *testing.T, sys *testSys, layer string, args ...string) (shell int) {
+	sys.procs = honeyos.NewSystem("root", "spr1139", layer, sys.fs, nil, 80, 24, nil).Processes()
+	shell, _, err := sys.procs.NewSession(0, "root", []string{"-bash"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sys.pid, err = sys.procs.Spawn(shell, 0, args); err != nil {
+		t.Fatal(err)
+	}
+	// In the foreground process group like the commands run by the shell
+	sys.procs.Update(sys.pid, func(p *honeyos.Process) { p.State = "S+" })
+	return shell
+}
+
+func TestPs(t *testing.T) {
+	sys := newTestSys(t)
+	shell := testProcesses(t, sys, "ps-test", "ps")
+	defer honeyos.DropProcesses("ps-test")
+	rsyslogd := 0
+	for _, p := range sys.procs.List() {
+		if p.Name == "rsyslogd" {
+			rsyslogd = p.PID
+		}
+	}
+
+	stdout, _, status := sys.run(ps{}, "aux")
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if status != 0 || lines[0] != "USER       PID %CPU %MEM    VSZ   RSS TTY      STAT START   TIME COMMAND" {
+		t.Fatalf("ps aux exited with %v:\n%v", status, stdout)
+	}
+	expected := []*regexp.Regexp{
+		regexp.MustCompile(`^root         1  0\.0  0\.\d  37808  5888 \?        Ss   \S+ +\d+:\d\d /sbin/init$`),
+		regexp.MustCompile(`^root         2  0\.0  0\.0      0     0 \?        S    \S+ +\d+:\d\d \[kthreadd\]$`),
+		regexp.MustCompile(fmt.Sprintf(`^syslog   %5d  0\.0  0\.\d 256396  3136 \?        Ssl  \S+ +\d+:\d\d /usr/sbin/rsyslogd -n$`, rsyslogd)),
+		regexp.MustCompile(fmt.Sprintf(`^root     %5d  0\.0  0\.\d +\d+ +\d+ pts/0    Ss\+  \S+ +0:00 -bash$`, shell)),
+		regexp.MustCompile(fmt.Sprintf(`^root     %5d  0\.0  0\.\d +\d+ +\d+ pts/0    R\+   \S+ +0:00 ps$`, sys.pid)),
+	}
+	for _, re := range expected {
+		found := false
+		for _, line := range lines[1:] {
+			found = found || re.MatchString(line)
+		}
+		if !found {
+			t.Errorf("ps aux without line matching %v:\n%v", re, stdout)
+		}
+	}
+
+	stdout, _, _ = sys.run(ps{}, "-ef")
+	lines = strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if lines[0] != "UID        PID  PPID  C STIME TTY          TIME CMD" || len(lines) != len(sys.procs.List())+1 {
+		t.Fatalf("ps -ef:\n%v", stdout)
+	}
+	expected = []*regexp.Regexp{
+		regexp.MustCompile(`^root         1     0  0 \S+ \?        00:00:00 /sbin/init$`),
+		regexp.MustCompile(fmt.Sprintf(`^syslog   %5d     1  0 \S+ \?        00:00:00 /usr/sbin/rsyslogd -n$`, rsyslogd)),
+		regexp.MustCompile(fmt.Sprintf(`^root     %5d %5d  0 \S+ pts/0    00:00:00 ps$`, sys.pid, shell)),
+	}
+	for _, re := range expected {
+		found := false
+		for _, line := range lines[1:] {
+			found = found || re.MatchString(line)
+		}
+		if !found {
+			t.Errorf("ps -ef without line matching %v:\n%v", re, stdout)
+		}
+	}
+
+	if stdout, _, status := sys.run(ps{}, "-p", "99999"); status != 1 || stdout != "  PID TTY          TIME CMD\n" {
+		t.Errorf("ps of missing process exited with %v:\n%v", status, stdout)
+	}
+}
+
+func TestTop(t *testing.T) {
+	sys := newTestSys(t)
+	testProcesses(t, sys, "top-test", "top", "-b", "-n1")
+	defer honeyos.DropProcesses("top-test")
+
+	stdout, _, status := sys.run(top{}, "-b", "-n1")
+	lines := strings.Split(stdout, "\n")
+	summary := []*regexp.Regexp{
+		regexp.MustCompile(`^top - \d\d:\d\d:\d\d up .+,  1 user,  load average: \d+\.\d\d, \d+\.\d\d, \d+\.\d\d$`),
+		regexp.MustCompile(fmt.Sprintf(`^Tasks: %3d total,   1 running, +\d+ sleeping,   0 stopped,   0 zombie$`, len(sys.procs.List()))),
+		regexp.MustCompile(`^%Cpu\(s\): +\d+\.\d us,  0\.3 sy,  0\.0 ni, +\d+\.\d id,  0\.0 wa,  0\.0 hi,  0\.0 si,  0\.0 st$`),
+		regexp.MustCompile(`^KiB Mem : +\d+ total, +\d+ free, +\d+ used, +\d+ buff/cache$`),
+		regexp.MustCompile(`^KiB Swap:        0 total,        0 free,        0 used\. +\d+ avail Mem $`),
+		regexp.MustCompile(`^$`),
+		regexp.MustCompile(`^  PID USER      PR  NI    VIRT    RES    SHR S  %CPU %MEM     TIME\+ COMMAND$`),
+	}
+	if status != 0 || len(lines) != len(summary)+len(sys.procs.List())+2 {
+		t.Fatalf("top -b -n1 exited with %v:\n%v", status, stdout)
+	}
+	for i, re := range summary {
+		if !re.MatchString(lines[i]) {
+			t.Errorf("Line %d of top -b -n1 is %q", i+1, lines[i])
+		}
+	}
+	init := regexp.MustCompile(`^    1 root      20   0   37808   5888   3532 S   0\.0  0\.\d +\d+:\d\d\.\d\d systemd$`)
+	found := false
+	for _, line := range lines[len(summary):] {
+		found = found || init.MatchString(line)
+	}
+	if !found {
+		t.Errorf("top -b -n1 without systemd:\n%v", stdout)
+	}
+	if lines[len(lines)-2] != "" || lines[len(lines)-1] != "" {
+		t.Errorf("top -b -n1 does not end with empty line:\n%q", stdout)
+	}
+}
+
+func TestKill(t *testing.T) {
+	sys := newTestSys(t)
+	shell := testProcesses(t, sys, "kill-test", "kill")
+	defer honeyos.DropProcesses("kill-test")
+	sleep, _ := sys.procs.Spawn(shell, 0, []string{"sleep", "100"})
+
+	tests := []struct {
+		cmd    honeyos.Command
+		args   []string
+		stderr string
+		status int
+	}{
+		{kill{}, []string{"99999"}, "kill: (99999): No such process\n", 1},
+		{kill{}, []string{"-9", "99999", "abc"}, "kill: (99999): No such process\nkill: failed to parse argument: 'abc'\n", 1},
+		{kill{}, []string{"-FOO", "1"}, "kill: unknown signal: FOO\n", 1},
+		{pgrep{"pkill", true}, []string{"nosuch"}, "", 1},
+		{pgrep{"pkill", true}, []string{"-9"}, "pkill: no matching criteria specified\nTry `pkill --help' for more information.\n", 2},
+		{killall{}, []string{"nosuch"}, "nosuch: no process found\n", 1},
+		{killall{}, []string{"-q", "nosuch"}, "", 1},
+		{killall{}, []string{"-FOO", "sleep"}, "FOO: unknown signal; killall -l lists signals.\n", 1},
+		{kill{}, []string{strconv.Itoa(sleep)}, "", 0},
+	}
+	for _, test := range tests {
+		if stdout, stderr, status := sys.run(test.cmd, test.args...); stdout != "" || stderr != test.stderr || status != test.status {
+			t.Errorf("%T %v exited with %v: %q %q", test.cmd, test.args, status, stdout, stderr)
+		}
+	}
+	if _, alive := sys.procs.Get(sleep); alive {
+		t.Error("Process still alive after kill")
+	}
+}
+
+func TestDf(t *testing.T) {
+	sys := newTestSys(t)
+	testMounts(sys)
+
+	stdout, _, status := sys.run(df{})
+	expected := `Filesystem     1K-blocks    Used Available Use% Mounted on
+/dev/xvda1       8065444 1679792   6385652  21% /
+tmpfs            1012116      12   1012104   1% /tmp
+/dev/xvdf       10190136   36888  10153248   1% /srv
+`
+	if status != 0 || stdout != expected {
+		t.Errorf("df exited with %v:\n%v", status, stdout)
+	}
+	stdout, _, _ = sys.run(df{}, "-hT", "/srv/www", "/proc")
+	expected = `Filesystem     Type  Size  Used Avail Use% Mounted on
+/dev/xvdf      ext4  9.8G   37M  9.7G   1% /srv
+proc           proc     0     0     0    - /proc
+`
+	if stdout != expected {
+		t.Errorf("df -hT of files:\n%v", stdout)
+	}
+	stdout, _, _ = sys.run(df{}, "-a", "-x", "ext4")
+	if !strings.Contains(stdout, "\nproc                   0     0         0    - /proc\n") ||
+		strings.Contains(stdout, "xvd") {
+		t.Errorf("df -a -x ext4:\n%v", stdout)
+	}
+	if _, stderr, status := sys.run(df{}, "/nonexistent"); status != 1 ||
+		stderr != "df: '/nonexistent': No such file or directory\n" {
+		t.Errorf("df of missing file exited with %v: %q", status, stderr)
+	}
+	if _, err := sys.fs.Create("/srv/www/index.html"); err == nil || honeyos.ErrnoString(err) != "Read-only file system" {
+		t.Errorf("Writing to the read-only mount: %v", err)
+	}
+}
+
+func TestMount(t *testing.T) {
+	sys := newTestSys(t)
+	testMounts(sys)
+
+	stdout, _, status := sys.run(mount{}, "-t", "tmpfs,ext4")
+	expected := `/dev/xvda1 on / type ext4 (rw,relatime,discard,data=ordered)
+tmpfs on /tmp type tmpfs (rw,nosuid,nodev,size=1012116k)
+/dev/xvdf on /srv type ext4 (ro,relatime,data=ordered)
+`
+	if status != 0 || stdout != expected {
+		t.Errorf("mount -t exited with %v:\n%v", status, stdout)
+	}
+	if stdout, _, _ = sys.run(mount{}, "-t", "noext4"); strings.Contains(stdout, "ext4") {
+		t.Errorf("mount -t noext4:\n%v", stdout)
+	}
+	_, stderr, status := sys.run(mount{}, "/dev/sdb1", "/mnt")
+	if status != 32 || stderr != "mount: special device /dev/sdb1 does not exist\n" {
+		t.Errorf("mount of a device exited with %v: %q", status, stderr)
+	}
+}
+
+func TestAwkLimits(t *testing.T) {
+	sys := newTestSys(t)
+	for _, prog := range []string{`{$100000000=1}`, `{NF=40000}`, `{$1e300="x"}`} {
+		sys.in = strings.NewReader("a b\n")
+		_, stderr, status := sys.run(awk{}, prog)
+		if status != 2 || stderr != "awk: program limit exceeded: maximum number of fields size=32767\n" {
+			t.Errorf("awk '%v' exited with %v: %q", prog, status, stderr)
+		}
+	}
+	sys.in = strings.NewReader("a b\n")
+	if stdout, _, _ := sys.run(awk{}, `{$5="e"; print NF; NF=2; print; print $100000000 "."}`); stdout != "5\na b\n.\n" {
+		t.Errorf("awk fields within limits: %q", stdout)
+	}
+}
+
+// textTest is a run of a text processing command in /tmp, where fruit and
+// sorted are the input files and the standard input is fruit
+type textTest struct {
+	cmd            honeyos.Command
+	args           []string
+	stdout, stderr string
+	status         int
+}
+
+func newTextSys(t *testing.T) *testSys {
+	sys := newTestSys(t)
+	sys.fs.MkdirAll("/tmp", 01777)
+	afero.WriteFile(sys.fs, "/tmp/fruit", []byte(fruit), 0644)
+	afero.WriteFile(sys.fs, "/tmp/sorted", []byte("apple\napple\nApple\nbanana\ncherry\ncherry\n"), 0644)
+	sys.cwd = "/tmp"
+	return sys
+}
+
+const fruit = "banana 3\napple 10\ncherry 2\napple 10\nBanana 1\n"
+
+func runTextTests(t *testing.T, tests []textTest) {
+	sys := newTextSys(t)
+	for _, test := range tests {
+		sys.in = strings.NewReader(fruit)
+		stdout, stderr, status := sys.run(test.cmd, test.args...)
+		if stdout != test.stdout || stderr != test.stderr || status != test.status {
+			t.Errorf("%T %q: got %q %q %v, want %q %q %v", test.cmd, test.args, stdout, stderr, status,
+				test.stdout, test.stderr, test.status)
+		}
+	}
+}
+
+func TestLn(t *testing.T) {
+	sys := newTestSys(t)
+	testMounts(sys)
+	afero.WriteFile(sys.fs, "/etc/hostname", []byte("syrup\n"), 0644)
+	tests := []struct {
+		args           []string
+		stdout, stderr string
+		status         int
+	}{
+		{[]string{"-s", "hostname", "/etc/name"}, "", "", 0},
+		{[]string{"-sv", "/etc/hostname", "/tmp/name"}, "'/tmp/name' -> '/etc/hostname'\n", "", 0},
+		{[]string{"-s", "/etc/passwd", "/etc/name"}, "", "ln: failed to create symbolic link '/etc/name': File exists\n", 1},
+		{[]string{"-sf", "/etc", "/tmp/etc"}, "", "", 0},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := sys.run(ln{}, test.args...)
+		if stdout != test.stdout || stderr != test.stderr || status != test.status {
+			t.Errorf("ln %v: got %q %q %v, want %q %q %v", test.args, stdout, stderr, status,
+				test.stdout, test.stderr, test.status)
+		}
+	}
+	for name, target := range map[string]string{"/etc/name": "hostname", "/tmp/name": "/etc/hostname"} {
+		stdout, _, _ := sys.run(ls{}, "-l", name)
+		if !strings.HasPrefix(stdout, "lrwxrwxrwx 1 root root ") || !strings.HasSuffix(stdout, " "+name+" -> "+target+"\n") {
+			t.Errorf("ls -l %v: got %q", name, stdout)
+		}
+		if stdout, stderr, _ := sys.run(cat{}, name); stdout != "syrup\n" {
+			t.Errorf("cat %v: got %q %q", name, stdout, stderr)
+		}
+	}
+	if stdout, _, _ := sys.run(ls{}, "/tmp/etc/"); !strings.Contains(stdout, "hostname\n") {
+		t.Errorf("ls through link to directory: got %q", stdout)
+	}
+}
+
+func TestRm(t *testing.T) {
+	sys := newTestSys(t)
+	testMounts(sys)
+	honeyos.Symlink(sys.fs, "/home/mk/.ssh", "/tmp/ssh")
+	tests := []struct {
+		args           []string
+		stdout, stderr string
+		status         int
+	}{
+		{[]string{"/etc/hostname"}, "", "", 0},
+		{[]string{"/etc/hostname"}, "", "rm: cannot remove '/etc/hostname': No such file or directory\n", 1},
+		{[]string{"-f", "/etc/hostname"}, "", "", 0},
+		{[]string{"/etc/skel"}, "", "rm: cannot remove '/etc/skel': Is a directory\n", 1},
+		{[]string{"-d", "/etc/skel"}, "", "rm: cannot remove '/etc/skel': Directory not empty\n", 1},
+		{[]string{"-rv", "/tmp/ssh"}, "removed '/tmp/ssh'\n", "", 0},
+		{[]string{"-r", "/etc/skel"}, "", "", 0},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := sys.run(rm{}, test.args...)
+		if stdout != test.stdout || stderr != test.stderr || status != test.status {
+			t.Errorf("rm %v: got %q %q %v, want %q %q %v", test.args, stdout, stderr, status,
+				test.stdout, test.stderr, test.status)
+		}
+	}
+	for _, name := range []string{"/etc/hostname", "/etc/skel", "/etc/skel/.bashrc", "/tmp/ssh"} {
+		if _, err := sys.fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%v is not removed: %v", name, err)
+		}
+	}
+	// Removing the link leaves the directory it points to
+	if _, err := sys.fs.Stat("/home/mk/.ssh/id_rsa"); err != nil {
+		t.Errorf("Target of the link is removed: %v", err)
+	}
+	if stdout, _, _ := sys.run(ls{}, "-A", "/etc"); strings.Contains(stdout, "skel") || strings.Contains(stdout, "hostname") {
+		t.Errorf("Removed files listed in /etc: %q", stdout)
+	}
+	// A file created in place of a removed directory does not bring its
+	// content back
+	sys.fs.Mkdir("/etc/skel", 0755)
+	if stdout, _, _ := sys.run(ls{}, "-A", "/etc/skel"); stdout != "" {
+		t.Errorf("Removed files listed in recreated directory: %q", stdout)
+	}
+}
+
+func TestFileTools(t *testing.T) {
+	sys := newTestSys(t)
+	testMounts(sys)
+	tests := []struct {
+		cmd            honeyos.Command
+		args           []string
+		stdout, stderr string
+		status         int
+	}{
+		{mkdir{}, []string{"/tmp/a/b"}, "", "mkdir: cannot create directory '/tmp/a/b': No such file or directory\n", 1},
+		{mkdir{}, []string{"-pv", "/tmp/a/b"}, "mkdir: created directory '/tmp/a'\nmkdir: created directory '/tmp/a/b'\n", "", 0},
+		{mkdir{}, []string{"/tmp/a"}, "", "mkdir: cannot create directory '/tmp/a': File exists\n", 1},
+		{mkdir{}, []string{"-m", "700", "/tmp/c"}, "", "", 0},
+		{touch{}, []string{"/tmp/a/f", "/nonexistent/f"}, "", "touch: cannot touch '/nonexistent/f': No such file or directory\n", 1},
+		{touch{}, []string{"-d", "2017-01-02 03:04:05", "/tmp/a/f"}, "", "", 0},
+		{cp{}, []string{"/etc/hostname", "/tmp/a"}, "", "", 0},
+		{cp{}, []string{"/etc/skel", "/tmp"}, "", "cp: omitting directory '/etc/skel'\n", 1},
+		{cp{}, []string{"-rv", "/etc/skel", "/tmp"}, "'/etc/skel' -> '/tmp/skel'\n'/etc/skel/.bash_logout' -> '/tmp/skel/.bash_logout'\n" +
+			"'/etc/skel/.bashrc' -> '/tmp/skel/.bashrc'\n'/etc/skel/.profile' -> '/tmp/skel/.profile'\n", "", 0},
+		{cp{}, []string{"/nonexistent", "/tmp"}, "", "cp: cannot stat '/nonexistent': No such file or directory\n", 1},
+		{mv{}, []string{"/etc/issue", "/home/mk/"}, "", "", 0},
+		{mv{}, []string{"/etc/issue", "/home/mk/"}, "", "mv: cannot stat '/etc/issue': No such file or directory\n", 1},
+		{mv{}, []string{"/tmp/a", "/home/mk/"}, "", "", 0},
+		{chmod{}, []string{"640", "/home/mk/issue"}, "", "", 0},
+		{chmod{}, []string{"-v", "u+x", "/home/mk/issue"}, "mode of '/home/mk/issue' changed from 0640 (rw-r-----) to 0740 (rwxr-----)\n", "", 0},
+		{chmod{}, []string{"xyz", "/home/mk/issue"}, "", "chmod: invalid mode: 'xyz'\nTry 'chmod --help' for more information.\n", 1},
+		{chmod{}, []string{"644", "/nonexistent"}, "", "chmod: cannot access '/nonexistent': No such file or directory\n", 1},
+		{chown{}, []string{"daemon:bin", "/home/mk/issue"}, "", "", 0},
+		{chown{}, []string{"nobody2", "/home/mk/issue"}, "", "chown: invalid user: 'nobody2'\n", 1},
+		{chown{}, []string{"-R", "1000", "/home/mk/a"}, "", "", 0},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := sys.run(test.cmd, test.args...)
+		if stdout != test.stdout || stderr != test.stderr || status != test.status {
+			t.Errorf("%T %v: got %q %q %v, want %q %q %v", test.cmd, test.args, stdout, stderr, status,
+				test.stdout, test.stderr, test.status)
+		}
+	}
+	files := []struct {
+		name     string
+		mode     os.FileMode
+		uid, gid int
+	}{
+		{"/tmp/c", os.ModeDir | 0700, 0, 0},
+		{"/tmp/skel/.bashrc", 0644, 0, 0},
+		{"/home/mk/issue", 0740, 1, 2},
+		{"/home/mk/a/b", os.ModeDir | 0755, 1000, 0},
+		{"/home/mk/a/f", 0644, 1000, 0},
+		{"/home/mk/a/hostname", 0644, 1000, 0},
+	}
+	for _, f := range files {
+		fi, err := sys.fs.Stat(f.name)
+		if err != nil {
+			t.Errorf("%v: %v", f.name, err)
+			continue
+		}
+		if uid, gid, _, _ := virtualfs.GetExtraInfo(fi); fi.Mode() != f.mode || uid != f.uid || gid != f.gid {
+			t.Errorf("%v is %v %v:%v, want %v %v:%v", f.name, fi.Mode(), uid, gid, f.mode, f.uid, f.gid)
+		}
+	}
+	if fi, err := sys.fs.Stat("/home/mk/a/f"); err != nil || fi.ModTime().Format("2006-01-02 15:04:05") != "2017-01-02 03:04:05" {
+		t.Errorf("Time of touched file: %v, %v", fi, err)
+	}
+	for _, name := range []string{"/etc/issue", "/tmp/a"} {
+		if _, err := sys.fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Moved %v still exists: %v", name, err)
+		}
+	}
+}
+
+func TestTextTools(t *testing.T) {
+	runTextTests(t, []textTest{
+		{grep{"grep"}, []string{"-i", "banana", "fruit"}, "banana 3\nBanana 1\n", "", 0},
+		{grep{"grep"}, []string{"-v", "apple", "fruit"}, "banana 3\ncherry 2\nBanana 1\n", "", 0},
+		{grep{"grep"}, []string{"-c", "apple", "fruit"}, "2\n", "", 0},
+		{grep{"grep"}, []string{"-n", "^c", "fruit"}, "3:cherry 2\n", "", 0},
+		{grep{"grep"}, []string{"-E", "ch|1$", "fruit"}, "cherry 2\nBanana 1\n", "", 0},
+		{grep{"grep"}, []string{"-o", "an", "fruit"}, "an\nan\nan\nan\n", "", 0},
+		{grep{"grep"}, []string{"-w", "-e", "apple", "-e", "nan", "fruit"}, "apple 10\napple 10\n", "", 0},
+		{grep{"grep"}, []string{`a\(n\)a 3`, "fruit"}, "banana 3\n", "", 0},
+		{grep{"grep"}, []string{"-F", "a.", "fruit"}, "", "", 1},
+		{grep{"grep"}, []string{"-x", "apple 10", "fruit"}, "apple 10\napple 10\n", "", 0},
+		{grep{"grep"}, []string{"-l", "apple", "fruit", "-"}, "fruit\n(standard input)\n", "", 0},
+		{grep{"grep"}, []string{"-h", "-m1", "apple", "fruit", "fruit"}, "apple 10\napple 10\n", "", 0},
+		{grep{"grep"}, []string{"apple", "fruit", "/nonexistent"}, "fruit:apple 10\nfruit:apple 10\n", "grep: /nonexistent: No such file or directory\n", 2},
+		{head{"head"}, []string{"-n", "2", "fruit"}, "banana 3\napple 10\n", "", 0},
+		{head{"head"}, []string{"-c", "5", "fruit"}, "banan", "", 0},
+		{head{"head"}, []string{"-n", "-3", "fruit"}, "banana 3\napple 10\n", "", 0},
+		{head{"head"}, []string{"-2", "fruit"}, "banana 3\napple 10\n", "", 0},
+		{head{"tail"}, []string{"-n", "2", "fruit"}, "apple 10\nBanana 1\n", "", 0},
+		{head{"tail"}, []string{"-n", "+4", "fruit"}, "apple 10\nBanana 1\n", "", 0},
+		{head{"tail"}, []string{"-c", "3", "fruit"}, " 1\n", "", 0},
+		{wc{}, []string{"fruit"}, " 5 10 45 fruit\n", "", 0},
+		{wc{}, []string{"-l", "fruit"}, "5 fruit\n", "", 0},
+		{wc{}, []string{"-wc", "fruit", "fruit"}, "10 45 fruit\n10 45 fruit\n20 90 total\n", "", 0},
+		{wc{}, []string{"-L", "fruit"}, "8 fruit\n", "", 0},
+		{sortCmd{}, []string{"fruit"}, "Banana 1\napple 10\napple 10\nbanana 3\ncherry 2\n", "", 0},
+		{sortCmd{}, []string{"-r", "fruit"}, "cherry 2\nbanana 3\napple 10\napple 10\nBanana 1\n", "", 0},
+		{sortCmd{}, []string{"-n", "-k2", "fruit"}, "Banana 1\ncherry 2\nbanana 3\napple 10\napple 10\n", "", 0},
+		{sortCmd{}, []string{"-u", "fruit"}, "Banana 1\napple 10\nbanana 3\ncherry 2\n", "", 0},
+		{sortCmd{}, []string{"-f", "fruit"}, "apple 10\napple 10\nBanana 1\nbanana 3\ncherry 2\n", "", 0},
+		{sortCmd{}, []string{"-t", " ", "-k2,2nr", "-k1,1", "fruit"}, "apple 10\napple 10\nbanana 3\ncherry 2\nBanana 1\n", "", 0},
+		{uniq{}, []string{"-c", "sorted"}, "      2 apple\n      1 Apple\n      1 banana\n      2 cherry\n", "", 0},
+		{uniq{}, []string{"-d", "sorted"}, "apple\ncherry\n", "", 0},
+		{uniq{}, []string{"-u", "sorted"}, "Apple\nbanana\n", "", 0},
+		{uniq{}, []string{"-i", "-c", "sorted"}, "      3 apple\n      1 banana\n      2 cherry\n", "", 0},
+		{cut{}, []string{"-d", " ", "-f2", "fruit"}, "3\n10\n2\n10\n1\n", "", 0},
+		{cut{}, []string{"-c", "1-3,5", "fruit"}, "bann\nappe\ncher\nappe\nBann\n", "", 0},
+		{cut{}, []string{"-d", "a", "-f", "2-", "fruit"}, "nana 3\npple 10\ncherry 2\npple 10\nnana 1\n", "", 0},
+		{cut{}, []string{"-s", "-d", "p", "-f1", "fruit"}, "a\na\n", "", 0},
+		{tr{}, []string{"a-z", "A-Z"}, "BANANA 3\nAPPLE 10\nCHERRY 2\nAPPLE 10\nBANANA 1\n", "", 0},
+		{tr{}, []string{"-d", "an"}, "b 3\npple 10\ncherry 2\npple 10\nB 1\n", "", 0},
+		{tr{}, []string{"-s", "p0"}, "banana 3\naple 10\ncherry 2\naple 10\nBanana 1\n", "", 0},
+		{tr{}, []string{"-cd", "a-z\n"}, "banana\napple\ncherry\napple\nanana\n", "", 0},
+		{tr{}, []string{"[:lower:]", "[:upper:]"}, "BANANA 3\nAPPLE 10\nCHERRY 2\nAPPLE 10\nBANANA 1\n", "", 0},
+	})
+}
+
+func TestSed(t *testing.T) {
+	runTextTests(t, []textTest{
+		{sed{}, []string{"s/a/A/", "fruit"}, "bAnana 3\nApple 10\ncherry 2\nApple 10\nBAnana 1\n", "", 0},
+		{sed{}, []string{"s/a/A/g", "fruit"}, "bAnAnA 3\nApple 10\ncherry 2\nApple 10\nBAnAnA 1\n", "", 0},
+		{sed{}, []string{"s/a/A/2", "fruit"}, "banAna 3\napple 10\ncherry 2\napple 10\nBanAna 1\n", "", 0},
+		{sed{}, []string{"-n", "2p", "fruit"}, "apple 10\n", "", 0},
+		{sed{}, []string{"2,3d", "fruit"}, "banana 3\napple 10\nBanana 1\n", "", 0},
+		{sed{}, []string{"/apple/d", "fruit"}, "banana 3\ncherry 2\nBanana 1\n", "", 0},
+		{sed{}, []string{"$d", "fruit"}, "banana 3\napple 10\ncherry 2\napple 10\n", "", 0},
+		{sed{}, []string{"-n", "/cherry/,$p", "fruit"}, "cherry 2\napple 10\nBanana 1\n", "", 0},
+		{sed{}, []string{"-n", "/apple/!p", "fruit"}, "banana 3\ncherry 2\nBanana 1\n", "", 0},
+		{sed{}, []string{`s/\(a\)\(n\)/\2\1/g`, "fruit"}, "bnanaa 3\napple 10\ncherry 2\napple 10\nBnanaa 1\n", "", 0},
+		{sed{}, []string{"-E", "s/(an)+/<&>/", "fruit"}, "b<anan>a 3\napple 10\ncherry 2\napple 10\nB<anan>a 1\n", "", 0},
+		{sed{}, []string{"-e", "3,$s/^/#/", "-e", `$a\end`, "fruit"}, "banana 3\napple 10\n#cherry 2\n#apple 10\n#Banana 1\nend\n", "", 0},
+		{sed{}, []string{"s/x/y", "fruit"}, "", "sed: -e expression #1, char 5: unterminated `s' command\n", 1},
+	})
+}
+
+func TestAwk(t *testing.T) {
+	runTextTests(t, []textTest{
+		{awk{}, []string{"{print $2}", "fruit"}, "3\n10\n2\n10\n1\n", "", 0},
+		{awk{}, []string{"-F", "a", "{print $1, NF}", "fruit"}, "b 4\n 2\ncherry 2 1\n 2\nB 4\n", "", 0},
+		{awk{}, []string{"/apple/{n++} END{print n, NR}", "fruit"}, "2 5\n", "", 0},
+		{awk{}, []string{"$2>2", "fruit"}, "banana 3\napple 10\napple 10\n", "", 0},
+		{awk{}, []string{`NR==2,NR==3{print NR": "$0}`, "fruit"}, "2: apple 10\n3: cherry 2\n", "", 0},
+		{awk{}, []string{`{printf "%-8s|%5.2f|%x|%c\n", $1, $2, $2, $1}`, "fruit"}, "banana  | 3.00|3|b\napple   |10.00|a|a\ncherry  | 2.00|2|c\napple   |10.00|a|a\nBanana  | 1.00|1|B\n", "", 0},
+		{awk{}, []string{`{$2=""; print; print NF}`, "fruit"}, "banana \n2\napple \n2\ncherry \n2\napple \n2\nBanana \n2\n", "", 0},
+		{awk{}, []string{`BEGIN{OFS="-"}{$1=$1; print}`, "fruit"}, "banana-3\napple-10\ncherry-2\napple-10\nBanana-1\n", "", 0},
+		{awk{}, []string{"-v", "x=5", `BEGIN{print x*2, length("abc")}`}, "10 3\n", "", 0},
+		{awk{}, []string{"{s[$1]+=$2} END{for (k in s) if (k ~ /^a/) print k, s[k]}", "fruit"}, "apple 20\n", "", 0},
+		{awk{}, []string{`{print toupper(substr($1,1,3)), index($1,"an")}`, "fruit"}, "BAN 2\nAPP 0\nCHE 0\nAPP 0\nBAN 2\n", "", 0},
+	})
+}
+
+func TestGetopt(t *testing.T) {
+	spec := optionSpec{
+		short: "abn:o",
+		long:  map[string]string{"all": "a", "number=": "n", "output?": "o", "outline": "outline"},
+	}
+	tests := []struct {
+		args     []string
+		opts     string
+		operands []string
+		err      string
+	}{
+		{[]string{"-ab", "x", "-n", "5", "y"}, "a= b= n=5", []string{"x", "y"}, ""},
+		{[]string{"-n5", "-an", "-b"}, "n=5 a= n=-b", nil, ""},
+		{[]string{"--all", "--number=3", "--num", "4", "--output"}, "a= n=3 n=4 o=", nil, ""},
+		{[]string{"--output=x", "-", "--", "-a"}, "o=x", []string{"-", "-a"}, ""},
+		{[]string{"--out"}, "", nil, "option '--out' is ambiguous; possibilities: '--outline' '--output'"},
+		{[]string{"--none"}, "", nil, "unrecognized option '--none'"},
+		{[]string{"--all=1"}, "", nil, "option '--all' doesn't allow an argument"},
+		{[]string{"--number"}, "", nil, "option '--number' requires an argument"},
+		{[]string{"-a", "-n"}, "", nil, "option requires an argument -- 'n'"},
+		{[]string{"-az"}, "", nil, "invalid option -- 'z'"},
+	}
+	for _, test := range tests {
+		opts, operands, err := getopt(test.args, spec)
+		var names []string
+		for _, opt := range opts {
+			names = append(names, opt.name+"="+opt.value)
+		}
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if strings.Join(names, " ") != test.opts || fmt.Sprint(operands) != fmt.Sprint(test.operands) || errMsg != test.err {
+			t.Errorf("getopt %q: got %v %q %q, want %v %q %q", test.args, names, operands, errMsg,
+				test.opts, test.operands, test.err)
+		}
+	}
+}
+
+func TestBreToERE(t *testing.T) {
+	tests := []struct {
+		bre, ere string
+	}{
+		{`a\(b\)*c`, `a(b)*c`},
+		{`a+b?{1}|(c)`, `a\+b\?\{1\}\|\(c\)`},
+		{`x\{2,3\}\|y`, `x{2,3}|y`},
+		{`*a`, `\*a`},
+		{`^*a\(*b\)`, `^\*a(\*b)`},
+		{`[]+(]x[^]a]`, `[]+(]x[^]a]`},
+		{`[[:alpha:]+]+`, `[[:alpha:]+]\+`},
+		{`\<w\>\.`, `\bw\b\.`},
+		{`a[b`, `a\[b`},
+	}
+	for _, test := range tests {
+		if ere := breToERE(test.bre); ere != test.ere {
+			t.Errorf("breToERE(%q) = %q, want %q", test.bre, ere, test.ere)
+		}
+	}
+}
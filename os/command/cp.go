@@ -0,0 +1,287 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+type cp struct{}
+
+// copier copies files and directories for cp and mv
+type copier struct {
+	sys                          honeyos.Sys
+	cmd                          string
+	recursive, preserve, verbose bool
+	force, interactive           bool
+	noClobber, update            bool
+}
+
+func init() {
+	honeyos.RegisterCommand("cp", cp{})
+}
+
+func (cp) GetHelp() string {
+	return `Usage: cp [OPTION]... [-T] SOURCE DEST
+  or:  cp [OPTION]... SOURCE... DIRECTORY
+  or:  cp [OPTION]... -t DIRECTORY SOURCE...
+Copy SOURCE to DEST, or multiple SOURCE(s) to DIRECTORY.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -a, --archive                same as -dR --preserve=all
+  -d                           same as --no-dereference --preserve=links
+  -f, --force                  if an existing destination file cannot be
+                                 opened, remove it and try again (this option
+                                 is ignored when the -n option is also used)
+  -i, --interactive            prompt before overwrite (overrides a previous -n
+                                  option)
+  -L, --dereference            always follow symbolic links in SOURCE
+  -n, --no-clobber             do not overwrite an existing file (overrides
+                                 a previous -i option)
+  -P, --no-dereference         never follow symbolic links in SOURCE
+  -p                           same as --preserve=mode,ownership,timestamps
+      --preserve[=ATTR_LIST]   preserve the specified attributes (default:
+                                 mode,ownership,timestamps), if possible
+                                 additional attributes: context, links, xattr,
+                                 all
+      --no-preserve=ATTR_LIST  don't preserve the specified attributes
+  -R, -r, --recursive          copy directories recursively
+  -t, --target-directory=DIRECTORY  copy all SOURCE arguments into DIRECTORY
+  -T, --no-target-directory    treat DEST as a normal file
+  -u, --update                 copy only when the SOURCE file is newer
+                                 than the destination file or when the
+                                 destination file is missing
+  -v, --verbose                explain what is being done
+      --help     display this help and exit
+      --version  output version information and exit
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/cp>
+or available locally via: info '(coreutils) cp invocation'
+`
+}
+
+func (c cp) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "adfiLnPpRrt:Tuv",
+		long: map[string]string{
+			"archive": "a", "force": "f", "interactive": "i", "dereference": "L", "no-clobber": "n",
+			"no-dereference": "P", "preserve?": "preserve", "no-preserve=": "no-preserve", "recursive": "r",
+			"target-directory=": "t", "no-target-directory": "T", "update": "u", "verbose": "v",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "cp", err)
+	}
+	cpy := copier{sys: sys, cmd: "cp"}
+	target, noTarget := "", false
+	for _, opt := range opts {
+		switch opt.name {
+		case "a":
+			cpy.recursive, cpy.preserve = true, true
+		case "f":
+			cpy.force = true
+		case "i":
+			cpy.interactive, cpy.noClobber = true, false
+		case "n":
+			cpy.interactive, cpy.noClobber = false, true
+		case "p", "preserve":
+			cpy.preserve = true
+		case "no-preserve":
+			cpy.preserve = false
+		case "r", "R":
+			cpy.recursive = true
+		case "t":
+			target = opt.value
+		case "T":
+			noTarget = true
+		case "u":
+			cpy.update = true
+		case "v":
+			cpy.verbose = true
+		case "help":
+			fmt.Fprint(sys.Out(), c.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("cp", "Torbjorn Granlund, David MacKenzie, and Jim Meyering"))
+			return 0
+		}
+	}
+	sources, dest, ok := targetOperands(sys, "cp", operands, target, noTarget)
+	if !ok {
+		return 1
+	}
+	status := 0
+	for _, src := range sources {
+		dst := dest
+		if len(target) > 0 || !noTarget && isDir(sys.FSys(), fullPath(sys, dest)) {
+			dst = path.Join(dest, path.Base(src))
+		}
+		if !cpy.copy(fullPath(sys, src), fullPath(sys, dst), src, dst) {
+			status = 1
+		}
+	}
+	return status
+}
+
+func (cp) Where() string {
+	return "/bin/cp"
+}
+
+// targetOperands splits the operands of cp, mv and ln into the sources and
+// the destination, checking the destination is a directory if needed
+func targetOperands(sys honeyos.Sys, cmd string, operands []string, target string, noTarget bool) ([]string, string, bool) {
+	switch {
+	case len(target) > 0:
+		if noTarget {
+			usageError(sys, cmd, "cannot combine --target-directory (-t) and --no-target-directory (-T)")
+			return nil, "", false
+		}
+		if fi, err := sys.FSys().Stat(fullPath(sys, target)); err != nil {
+			fmt.Fprintf(sys.Err(), "%v: failed to access %v: %v\n", cmd, quote(target), honeyos.ErrnoString(err))
+			return nil, "", false
+		} else if !fi.IsDir() {
+			fmt.Fprintf(sys.Err(), "%v: target %v is not a directory\n", cmd, quote(target))
+			return nil, "", false
+		}
+		if len(operands) == 0 {
+			usageError(sys, cmd, "missing file operand")
+			return nil, "", false
+		}
+		return operands, target, true
+	case len(operands) == 0:
+		usageError(sys, cmd, "missing file operand")
+		return nil, "", false
+	case len(operands) == 1:
+		usageError(sys, cmd, fmt.Sprintf("missing destination file operand after %v", quote(operands[0])))
+		return nil, "", false
+	}
+	sources, dest := operands[:len(operands)-1], operands[len(operands)-1]
+	if len(sources) > 1 && noTarget {
+		usageError(sys, cmd, fmt.Sprintf("extra operand %v", quote(dest)))
+		return nil, "", false
+	}
+	if len(sources) > 1 && !isDir(sys.FSys(), fullPath(sys, dest)) {
+		fmt.Fprintf(sys.Err(), "%v: target %v is not a directory\n", cmd, quote(dest))
+		return nil, "", false
+	}
+	return sources, dest, true
+}
+
+// isDir reports if the path exists and is a directory
+func isDir(fs afero.Fs, p string) bool {
+	fi, err := fs.Stat(p)
+	return err == nil && fi.IsDir()
+}
+
+// copy copies the file or directory src to dst, and reports if everything
+// has been copied
+func (c *copier) copy(src, dst, srcName, dstName string) bool {
+	fs := c.sys.FSys()
+	fi, err := fs.Stat(src)
+	if err != nil {
+		fmt.Fprintf(c.sys.Err(), "%v: cannot stat %v: %v\n", c.cmd, quote(srcName), honeyos.ErrnoString(err))
+		return false
+	}
+	if fi.IsDir() && !c.recursive {
+		fmt.Fprintf(c.sys.Err(), "%v: omitting directory %v\n", c.cmd, quote(srcName))
+		return false
+	}
+	if src == dst {
+		fmt.Fprintf(c.sys.Err(), "%v: %v and %v are the same file\n", c.cmd, quote(srcName), quote(dstName))
+		return false
+	}
+	if fi.IsDir() && strings.HasPrefix(dst, src+"/") {
+		fmt.Fprintf(c.sys.Err(), "%v: cannot copy a directory, %v, into itself, %v\n", c.cmd, quote(srcName), quote(dstName))
+		return false
+	}
+	dfi, err := fs.Stat(dst)
+	exists := err == nil
+	switch {
+	case exists && dfi.IsDir() && !fi.IsDir():
+		fmt.Fprintf(c.sys.Err(), "%v: cannot overwrite directory %v with non-directory\n", c.cmd, quote(dstName))
+		return false
+	case exists && !dfi.IsDir() && fi.IsDir():
+		fmt.Fprintf(c.sys.Err(), "%v: cannot overwrite non-directory %v with directory %v\n", c.cmd, quote(dstName), quote(srcName))
+		return false
+	case exists && !fi.IsDir():
+		if c.noClobber || c.update && !fi.ModTime().After(dfi.ModTime()) {
+			return true
+		}
+		if c.interactive && !confirm(c.sys, fmt.Sprintf("%v: overwrite %v? ", c.cmd, quote(dstName))) {
+			return true
+		}
+	}
+	mode := unixMode(fi.Mode())
+	if !c.preserve {
+		mode &^= defaultUmask
+	}
+	if fi.IsDir() {
+		if !exists {
+			if err := fs.Mkdir(dst, fileMode(mode)); err != nil {
+				fmt.Fprintf(c.sys.Err(), "%v: cannot create directory %v: %v\n", c.cmd, quote(dstName), honeyos.ErrnoString(err))
+				return false
+			}
+			fs.Chmod(dst, fileMode(mode))
+			c.sys.FsEvent("mkdir", dst, log.Fields{"cmd": c.cmd, "mode": fmt.Sprintf("%04o", mode)})
+			if c.verbose {
+				fmt.Fprintf(c.sys.Out(), "%v -> %v\n", quote(srcName), quote(dstName))
+			}
+		}
+		entries, err := afero.ReadDir(fs, src)
+		if err != nil {
+			fmt.Fprintf(c.sys.Err(), "%v: cannot access %v: %v\n", c.cmd, quote(srcName), honeyos.ErrnoString(err))
+			return false
+		}
+		ok := true
+		for _, entry := range entries {
+			name := entry.Name()
+			ok = c.copy(path.Join(src, name), path.Join(dst, name), path.Join(srcName, name), path.Join(dstName, name)) && ok
+		}
+		if c.preserve {
+			fs.Chtimes(dst, fi.ModTime(), fi.ModTime())
+		}
+		return ok
+	}
+	n, err := c.copyFile(src, dst, fileMode(mode))
+	if err != nil {
+		fmt.Fprintf(c.sys.Err(), "%v: cannot create regular file %v: %v\n", c.cmd, quote(dstName), honeyos.ErrnoString(err))
+		return false
+	}
+	if c.preserve {
+		fs.Chmod(dst, fileMode(mode))
+		fs.Chtimes(dst, fi.ModTime(), fi.ModTime())
+	}
+	c.sys.FsEvent("copy", dst, log.Fields{"cmd": c.cmd, "source": src, "size": n})
+	if c.verbose {
+		fmt.Fprintf(c.sys.Out(), "%v -> %v\n", quote(srcName), quote(dstName))
+	}
+	return true
+}
+
+// copyFile copies the content of the regular file
+func (c *copier) copyFile(src, dst string, mode os.FileMode) (int64, error) {
+	fs := c.sys.FSys()
+	in, err := fs.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := createFile(fs, dst, os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil && c.force {
+		removeFile(fs, dst)
+		out, err = createFile(fs, dst, os.O_WRONLY|os.O_TRUNC, mode)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	return io.Copy(out, in)
+}
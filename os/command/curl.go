@@ -0,0 +1,530 @@
+package command
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type curl struct{}
+
+// curlOptions are the options given to curl
+type curlOptions struct {
+	silent, showError, location, insecure, head, include, fail, verbose bool
+	help, version                                                       bool
+	agent, method, referer, user                                        string
+	headers                                                             []string
+	data                                                                []curlData
+	maxTime                                                             time.Duration
+	maxRedirs                                                           int
+	// outputs are the output files for the URLs in order, "" for -O
+	outputs []string
+	urls    []string
+}
+
+// curlData is the post data of a -d, --data-binary or --data-raw option
+type curlData struct {
+	option, value string
+}
+
+// curlLongOptions maps the long options of curl to the short ones, or to
+// themselves for options without short form. Options taking a parameter
+// are listed in curlParams
+var curlLongOptions = map[string]string{
+	"output": "o", "remote-name": "O", "silent": "s", "show-error": "S", "location": "L",
+	"insecure": "k", "user-agent": "A", "header": "H", "data": "d", "data-ascii": "d",
+	"data-binary": "data-binary", "data-raw": "data-raw", "request": "X", "head": "I",
+	"include": "i", "fail": "f", "verbose": "v", "max-time": "m", "referer": "e",
+	"user": "u", "proxy": "x", "url": "url", "max-redirs": "max-redirs",
+	"connect-timeout": "connect-timeout", "retry": "retry", "compressed": "compressed",
+	"progress-bar": "#", "help": "h", "version": "V", "ipv4": "4", "ipv6": "6",
+}
+
+var curlParams = map[string]bool{
+	"o": true, "A": true, "H": true, "d": true, "data-binary": true, "data-raw": true,
+	"X": true, "m": true, "e": true, "u": true, "x": true, "url": true, "max-redirs": true,
+	"connect-timeout": true, "retry": true,
+}
+
+// curlFlags are the short options without parameter
+const curlFlags = "OsSLkIifvq#hV46"
+
+func init() {
+	honeyos.RegisterCommand("curl", curl{})
+}
+
+func (c curl) GetHelp() string {
+	return `Usage: curl [options...] <url>
+Options: (H) means HTTP/HTTPS only, (F) means FTP only
+     --anyauth       Pick "any" authentication method (H)
+ -a, --append        Append to target file when uploading (F/SFTP)
+     --basic         Use HTTP Basic Authentication (H)
+     --cacert FILE   CA certificate to verify peer against (SSL)
+     --capath DIR    CA directory to verify peer against (SSL)
+ -E, --cert CERT[:PASSWD]  Client certificate file and password (SSL)
+     --compressed    Request compressed response (using deflate or gzip)
+ -K, --config FILE   Read config from FILE
+     --connect-timeout SECONDS  Maximum time allowed for connection
+ -C, --continue-at OFFSET  Resumed transfer OFFSET
+ -b, --cookie STRING/FILE  Read cookies from STRING/FILE (H)
+ -c, --cookie-jar FILE  Write cookies to FILE after operation (H)
+ -d, --data DATA     HTTP POST data (H)
+     --data-raw DATA  HTTP POST data, '@' allowed (H)
+     --data-ascii DATA  HTTP POST ASCII data (H)
+     --data-binary DATA  HTTP POST binary data (H)
+ -D, --dump-header FILE  Write the headers to FILE
+ -f, --fail          Fail silently (no output at all) on HTTP errors (H)
+ -F, --form CONTENT  Specify HTTP multipart POST data (H)
+ -G, --get           Send the -d data with a HTTP GET (H)
+ -H, --header LINE   Pass custom header LINE to server (H)
+ -I, --head          Show document info only
+ -h, --help          This help text
+ -i, --include       Include protocol headers in the output (H/F)
+ -k, --insecure      Allow connections to SSL sites without certs (H)
+ -L, --location      Follow redirects (H)
+ -m, --max-time SECONDS  Maximum time allowed for the transfer
+     --max-redirs NUM  Maximum number of redirects allowed (H)
+ -o, --output FILE   Write to FILE instead of stdout
+ -O, --remote-name   Write output to a file named as the remote file
+ -#, --progress-bar  Display transfer progress as a progress bar
+ -x, --proxy [PROTOCOL://]HOST[:PORT]  Use proxy on given port
+ -e, --referer       Referer URL (H)
+ -X, --request COMMAND  Specify request command to use
+     --retry NUM     Retry request NUM times if transient problems occur
+ -S, --show-error    Show error. With -s, make curl show errors when they occur
+ -s, --silent        Silent mode (don't output anything)
+ -u, --user USER[:PASSWORD]  Server user and password
+ -A, --user-agent STRING  Send User-Agent STRING to server (H)
+ -v, --verbose       Make the operation more talkative
+ -V, --version       Show version number and quit
+`
+}
+
+func (c curl) Where() string {
+	return "/usr/bin/curl"
+}
+
+func (c curl) Exec(args []string, sys honeyos.Sys) int {
+	o, msg := parseCurlArgs(args)
+	if len(msg) > 0 {
+		fmt.Fprintf(sys.Err(), "curl: %v\ncurl: try 'curl --help' or 'curl --manual' for more information\n", msg)
+		return 2
+	}
+	if o.help {
+		fmt.Fprint(sys.Out(), c.GetHelp())
+		return 0
+	}
+	if o.version {
+		fmt.Fprint(sys.Out(), `curl 7.47.0 (x86_64-pc-linux-gnu) libcurl/7.47.0 GnuTLS/3.4.10 zlib/1.2.8 libidn/1.32 librtmp/2.3
+Protocols: dict file ftp ftps gopher http https imap imaps ldap ldaps pop3 pop3s rtmp rtsp smb smbs smtp smtps telnet tftp
+Features: AsynchDNS IDN IPv6 Largefile GSS-API Kerberos SPNEGO NTLM NTLM_WB SSL libz TLS-SRP UnixSockets
+`)
+		return 0
+	}
+	if len(o.urls) == 0 {
+		fmt.Fprint(sys.Err(), "curl: try 'curl --help' or 'curl --manual' for more information\n")
+		return 2
+	}
+	body := o.postData(sys)
+	status := 0
+	for i, rawurl := range o.urls {
+		output := "-"
+		if i < len(o.outputs) {
+			output = o.outputs[i]
+		}
+		if s := o.transfer(sys, rawurl, output, body); s != 0 {
+			status = s
+		}
+	}
+	return status
+}
+
+// parseCurlArgs parses the arguments of curl, returning the message of
+// invalid options
+func parseCurlArgs(args []string) (*curlOptions, string) {
+	o := &curlOptions{maxRedirs: 50}
+	apply := func(name, value string) string {
+		switch name {
+		case "o":
+			o.outputs = append(o.outputs, value)
+		case "O":
+			o.outputs = append(o.outputs, "")
+		case "s":
+			o.silent = true
+		case "S":
+			o.showError = true
+		case "L":
+			o.location = true
+		case "k":
+			o.insecure = true
+		case "A":
+			o.agent = value
+		case "H":
+			o.headers = append(o.headers, value)
+		case "d", "data-binary", "data-raw":
+			o.data = append(o.data, curlData{name, value})
+		case "X":
+			o.method = value
+		case "I":
+			o.head = true
+		case "i":
+			o.include = true
+		case "f":
+			o.fail = true
+		case "v":
+			o.verbose = true
+		case "e":
+			o.referer = value
+		case "u":
+			o.user = value
+		case "url":
+			o.urls = append(o.urls, value)
+		case "m":
+			secs, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "option -m: expected a proper numerical parameter"
+			}
+			o.maxTime = time.Duration(secs * float64(time.Second))
+		case "max-redirs":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return "option --max-redirs: expected a proper numerical parameter"
+			}
+			o.maxRedirs = n
+		case "h":
+			o.help = true
+		case "V":
+			o.version = true
+		}
+		return ""
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case strings.HasPrefix(arg, "--") && len(arg) > 2:
+			name, ok := curlLongOptions[arg[2:]]
+			if !ok {
+				return nil, fmt.Sprintf("option %v: is unknown", arg)
+			}
+			value := ""
+			if curlParams[name] {
+				if i+1 >= len(args) {
+					return nil, fmt.Sprintf("option %v: requires parameter", arg)
+				}
+				i++
+				value = args[i]
+			}
+			if msg := apply(name, value); len(msg) > 0 {
+				return nil, msg
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for j := 1; j < len(arg); j++ {
+				name := arg[j : j+1]
+				if curlParams[name] {
+					value := arg[j+1:]
+					if len(value) == 0 {
+						if i+1 >= len(args) {
+							return nil, fmt.Sprintf("option -%v: requires parameter", name)
+						}
+						i++
+						value = args[i]
+					}
+					if msg := apply(name, value); len(msg) > 0 {
+						return nil, msg
+					}
+					break
+				}
+				if !strings.Contains(curlFlags, name) {
+					return nil, fmt.Sprintf("option -%v: is unknown", name)
+				}
+				apply(name, "")
+			}
+		default:
+			o.urls = append(o.urls, arg)
+		}
+	}
+	return o, ""
+}
+
+// postData returns the body joined from the -d options, reading those
+// starting with @ from files
+func (o *curlOptions) postData(sys honeyos.Sys) []byte {
+	if len(o.data) == 0 {
+		return nil
+	}
+	var parts [][]byte
+	for _, d := range o.data {
+		value := d.value
+		part := []byte(value)
+		if d.option != "data-raw" && strings.HasPrefix(value, "@") {
+			f, err := openInput(sys, value[1:])
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "Warning: Couldn't read data from file \"%v\", this makes \nWarning: an empty POST.\n", value[1:])
+				part = nil
+			} else {
+				part, _ = ioutil.ReadAll(f)
+				f.Close()
+				if d.option == "d" {
+					part = bytes.Replace(bytes.Replace(part, []byte("\r"), nil, -1), []byte("\n"), nil, -1)
+				}
+			}
+		}
+		parts = append(parts, part)
+	}
+	return bytes.Join(parts, []byte("&"))
+}
+
+// showErrors reports if the error messages are printed
+func (o *curlOptions) showErrors() bool {
+	return !o.silent || o.showError
+}
+
+// transfer downloads the URL to the output, "-" for stdout and "" for the
+// remote name, returning the exit status
+func (o *curlOptions) transfer(sys honeyos.Sys, rawurl, output string, body []byte) int {
+	fail := func(code int, format string, a ...interface{}) int {
+		if o.showErrors() {
+			fmt.Fprintf(sys.Err(), "curl: (%v) %v\n", code, fmt.Sprintf(format, a...))
+		}
+		return code
+	}
+	req, err := newDownloadRequest("curl", rawurl)
+	if err != nil || len(req.url.Hostname()) == 0 {
+		return fail(3, "<url> malformed")
+	}
+	if output == "" {
+		output = path.Base(req.url.Path)
+		if output == "/" || output == "." {
+			if o.showErrors() {
+				fmt.Fprintln(sys.Err(), "curl: Remote file name has no length!")
+			}
+			return 23
+		}
+	}
+	switch {
+	case len(o.method) > 0:
+		req.method = o.method
+	case o.head:
+		req.method = "HEAD"
+	case body != nil:
+		req.method = "POST"
+	}
+	req.body = body
+	req.insecure = o.insecure
+	req.timeout = o.maxTime
+	if o.location {
+		req.redirects = o.maxRedirs
+	}
+	req.header.Set("User-Agent", "curl/7.47.0")
+	if len(o.agent) > 0 {
+		req.header.Set("User-Agent", o.agent)
+	}
+	req.header.Set("Accept", "*/*")
+	if len(o.referer) > 0 {
+		req.header.Set("Referer", o.referer)
+	}
+	if len(o.user) > 0 {
+		req.header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(o.user)))
+	}
+	if body != nil {
+		req.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, h := range o.headers {
+		switch {
+		case strings.HasSuffix(h, ":"):
+			req.header.Del(strings.TrimSuffix(h, ":"))
+		case strings.HasSuffix(h, ";"):
+			req.header.Set(strings.TrimSuffix(h, ";"), "")
+		case strings.Contains(h, ":"):
+			kv := strings.SplitN(h, ":", 2)
+			req.header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+
+	// The transfers of the other protocols curl lists are not emulated
+	if req.url.Scheme != "http" && req.url.Scheme != "https" {
+		return fail(1, "Protocol \"%v\" not supported or disabled in libcurl", req.url.Scheme)
+	}
+	start := time.Now()
+	d, err := fetch(sys, req)
+	if err != nil {
+		de, _ := err.(*downloadError)
+		if de == nil {
+			return fail(56, "Recv failure: Connection reset by peer")
+		}
+		if o.verbose && de.kind != errResolve && de.kind != errUnsupported {
+			fmt.Fprintf(sys.Err(), "*   Trying %v...\n", de.host)
+		}
+		switch de.kind {
+		case errUnsupported:
+			return fail(1, "Protocol \"%v\" not supported or disabled in libcurl", req.url.Scheme)
+		case errResolve:
+			return fail(6, "Could not resolve host: %v", de.host)
+		case errConnect:
+			return fail(7, "Failed to connect to %v port %v: Connection refused", de.host, de.port)
+		case errTimeout:
+			return fail(28, "Connection timed out after %v milliseconds", int64(time.Since(start)/time.Millisecond))
+		case errTLS:
+			code := fail(60, "SSL certificate problem: unable to get local issuer certificate")
+			if o.showErrors() {
+				fmt.Fprint(sys.Err(), curlCertHelp)
+			}
+			return code
+		}
+		return fail(56, "Recv failure: Connection reset by peer")
+	}
+	elapsed := time.Since(start)
+	if o.verbose {
+		o.printVerbose(sys, req, d)
+	}
+	if o.fail && d.resp.StatusCode >= 400 {
+		return fail(22, "The requested URL returned error: %v", d.resp.Status)
+	}
+
+	var out bytes.Buffer
+	if o.include || o.head {
+		fmt.Fprintf(&out, "%v %v\r\n", d.resp.Proto, d.resp.Status)
+		writeHeaders(&out, "", d)
+		out.WriteString("\r\n")
+	}
+	if req.method != "HEAD" {
+		out.Write(d.body)
+	}
+	toStdout := output == "-"
+	// The progress meter is shown unless the output goes to the terminal
+	if !o.silent && !(toStdout && honeyos.IsTerminal(sys.Out())) {
+		curlProgress(sys, len(d.body), len(body), elapsed)
+	}
+	saved := *d
+	saved.body = out.Bytes()
+	if toStdout {
+		sys.Out().Write(out.Bytes())
+		captureDownload(sys, "curl", "", &saved)
+	} else {
+		if err := saveDownload(sys, "curl", fullPath(sys, output), &saved); err != nil {
+			if o.showErrors() {
+				fmt.Fprintf(sys.Err(), "Warning: Failed to create the file %v: %v\n", output, honeyos.ErrnoString(err))
+			}
+			return fail(23, "Failed writing body (0 != %v)", out.Len())
+		}
+	}
+	if o.verbose {
+		fmt.Fprintf(sys.Err(), "* Connection #0 to host %v left intact\n", d.url.Hostname())
+	}
+	return 0
+}
+
+// printVerbose writes the connection, request and response headers like -v
+func (o *curlOptions) printVerbose(sys honeyos.Sys, req *downloadRequest, d *download) {
+	var buf bytes.Buffer
+	host, port := d.url.Hostname(), urlPort(d.url)
+	ip := host
+	if len(d.remote) > 0 {
+		ip, _, _ = net.SplitHostPort(d.remote)
+	}
+	fmt.Fprintf(&buf, "*   Trying %v...\n* Connected to %v (%v) port %v (#0)\n", ip, host, ip, port)
+	uri := d.url.RequestURI()
+	fmt.Fprintf(&buf, "> %v %v HTTP/1.1\r\n> Host: %v\r\n", req.method, uri, d.url.Host)
+	if _, ok := req.header["User-Agent"]; ok {
+		fmt.Fprintf(&buf, "> User-Agent: %v\r\n", req.header.Get("User-Agent"))
+	}
+	var keys []string
+	for k := range req.header {
+		if k != "User-Agent" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "> %v: %v\r\n", k, req.header.Get(k))
+	}
+	if req.body != nil {
+		fmt.Fprintf(&buf, "> Content-Length: %v\r\n", len(req.body))
+	}
+	buf.WriteString("> \r\n")
+	fmt.Fprintf(&buf, "< %v %v\r\n", d.resp.Proto, d.resp.Status)
+	writeHeaders(&buf, "< ", d)
+	buf.WriteString("< \r\n")
+	sys.Err().Write(buf.Bytes())
+}
+
+// writeHeaders writes the response headers in sorted order, each line
+// starting with the prefix
+func writeHeaders(buf *bytes.Buffer, prefix string, d *download) {
+	var keys []string
+	for k := range d.resp.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range d.resp.Header[k] {
+			fmt.Fprintf(buf, "%v%v: %v\r\n", prefix, k, v)
+		}
+	}
+}
+
+// curlProgress writes the progress meter of the finished transfer
+func curlProgress(sys honeyos.Sys, received, sent int, elapsed time.Duration) {
+	speed := func(n int) int {
+		if elapsed < time.Millisecond {
+			return n
+		}
+		return int(float64(n) / elapsed.Seconds())
+	}
+	spent := "--:--:--"
+	if elapsed >= time.Second {
+		secs := int(elapsed / time.Second)
+		spent = fmt.Sprintf("%2d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	percent := func(n int) int {
+		if n == 0 {
+			return 0
+		}
+		return 100
+	}
+	fmt.Fprint(sys.Err(), "  % Total    % Received % Xferd  Average Speed   Time    Time     Time  Current\n"+
+		"                                 Dload  Upload   Total   Spent    Left  Speed\n")
+	fmt.Fprint(sys.Err(), "\r  0     0    0     0    0     0      0      0 --:--:-- --:--:-- --:--:--     0")
+	fmt.Fprintf(sys.Err(), "\r%3d %v  %3d %v  %3d %v  %v  %v %v %v --:--:-- %v\n",
+		percent(received), curlSize(received), percent(received), curlSize(received),
+		percent(sent), curlSize(sent), curlSize(speed(received)), curlSize(speed(sent)),
+		spent, spent, curlSize(speed(received)))
+}
+
+// curlSize formats the number of bytes in 5 characters
+func curlSize(n int) string {
+	switch {
+	case n < 100000:
+		return fmt.Sprintf("%5d", n)
+	case n < 10000*1024:
+		return fmt.Sprintf("%4dk", n/1024)
+	case n < 100*1024*1024:
+		return fmt.Sprintf("%2d.%dM", n/(1024*1024), n%(1024*1024)/(1024*1024/10))
+	case n < 10000*1024*1024:
+		return fmt.Sprintf("%4dM", n/(1024*1024))
+	}
+	return fmt.Sprintf("%4dG", n/(1024*1024*1024))
+}
+
+const curlCertHelp = `More details here: http://curl.haxx.se/docs/sslcerts.html
+
+curl performs SSL certificate verification by default, using a "bundle"
+ of Certificate Authority (CA) public keys (CA certs). If the default
+ bundle file isn't adequate, you can specify an alternate file
+ using the --cacert option.
+If this HTTPS server uses a certificate signed by a CA represented in
+ the bundle, the certificate verification probably failed due to a
+ problem with the certificate (it might be expired, or the name might
+ not match the domain name in the URL).
+If you'd like to turn off curl's verification of the certificate, use
+ the -k (or --insecure) option.
+`
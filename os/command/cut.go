@@ -0,0 +1,234 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type cut struct{}
+
+// cutRange is a range of the list of cut, counted from 1 with an end of 0
+// meaning the end of line
+type cutRange struct {
+	start, end int
+}
+
+func init() {
+	honeyos.RegisterCommand("cut", cut{})
+}
+
+func (cut) GetHelp() string {
+	return `Usage: cut OPTION... [FILE]...
+Print selected parts of lines from each FILE to standard output.
+
+With no FILE, or when FILE is -, read standard input.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -b, --bytes=LIST        select only these bytes
+  -c, --characters=LIST   select only these characters
+  -d, --delimiter=DELIM   use DELIM instead of TAB for field delimiter
+  -f, --fields=LIST       select only these fields;  also print any line
+                            that contains no delimiter character, unless
+                            the -s option is specified
+  -n                      (ignored)
+      --complement        complement the set of selected bytes, characters
+                            or fields
+  -s, --only-delimited    do not print lines not containing delimiters
+      --output-delimiter=STRING  use STRING as the output delimiter
+                            the default is to use the input delimiter
+  -z, --zero-terminated    line delimiter is NUL, not newline
+      --help     display this help and exit
+      --version  output version information and exit
+
+Use one, and only one of -b, -c or -f.  Each LIST is made up of one
+range, or many ranges separated by commas.  Selected input is written
+in the same order that it is read, and is written exactly once.
+Each range is one of:
+
+  N     N'th byte, character or field, counted from 1
+  N-    from N'th byte, character or field, to end of line
+  N-M   from N'th to M'th (included) byte, character or field
+  -M    from first to M'th (included) byte, character or field
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/cut>
+or available locally via: info '(coreutils) cut invocation'
+`
+}
+
+func (c cut) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "b:c:d:f:nsz",
+		long: map[string]string{
+			"bytes=": "b", "characters=": "c", "delimiter=": "d", "fields=": "f",
+			"complement": "complement", "only-delimited": "s", "output-delimiter=": "output-delimiter",
+			"zero-terminated": "z", "help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "cut", err)
+	}
+	mode, list := "", ""
+	delim, outDelim := "\t", ""
+	delimGiven, outDelimGiven, complement, onlyDelimited := false, false, false, false
+	for _, opt := range opts {
+		switch opt.name {
+		case "b", "c", "f":
+			if len(mode) > 0 {
+				return usageError(sys, "cut", "only one type of list may be specified")
+			}
+			mode, list = opt.name, opt.value
+		case "d":
+			if len([]rune(opt.value)) > 1 {
+				return usageError(sys, "cut", "the delimiter must be a single character")
+			}
+			delim, delimGiven = opt.value, true
+			if len(delim) == 0 {
+				delim = "\x00"
+			}
+		case "output-delimiter":
+			outDelim, outDelimGiven = opt.value, true
+		case "complement":
+			complement = true
+		case "s":
+			onlyDelimited = true
+		case "help":
+			fmt.Fprint(sys.Out(), c.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("cut", "David M. Ihnat, David MacKenzie, and Jim Meyering"))
+			return 0
+		}
+	}
+	if len(mode) == 0 {
+		return usageError(sys, "cut", "you must specify a list of bytes, characters, or fields")
+	}
+	if mode != "f" && delimGiven {
+		return usageError(sys, "cut", "an input delimiter may be specified only when operating on fields")
+	}
+	if mode != "f" && onlyDelimited {
+		return usageError(sys, "cut", "suppressing non-delimited lines makes sense\n\tonly when operating on fields")
+	}
+	ranges, msg := parseCutList(list)
+	if len(msg) > 0 {
+		return usageError(sys, "cut", msg)
+	}
+	if !outDelimGiven {
+		outDelim = delim
+		if mode != "f" {
+			outDelim = ""
+		}
+	}
+	selected := func(n int) bool {
+		for _, r := range ranges {
+			if n >= r.start && (r.end == 0 || n <= r.end) {
+				return !complement
+			}
+		}
+		return complement
+	}
+	if len(operands) == 0 {
+		operands = []string{"-"}
+	}
+	status := 0
+	var buf bytes.Buffer
+	for _, name := range operands {
+		f, err := openInput(sys, name)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "cut: %v: %v\n", name, honeyos.ErrnoString(err))
+			status = 1
+			continue
+		}
+		lines, _ := readLines(f)
+		f.Close()
+		for _, l := range lines {
+			var parts []string
+			switch mode {
+			case "f":
+				if !strings.Contains(l, delim) {
+					if !onlyDelimited {
+						buf.WriteString(l + "\n")
+					}
+					continue
+				}
+				parts = strings.Split(l, delim)
+			case "c":
+				for _, r := range l {
+					parts = append(parts, string(r))
+				}
+			default:
+				for i := 0; i < len(l); i++ {
+					parts = append(parts, l[i:i+1])
+				}
+			}
+			// Fields are always separated, bytes and characters only
+			// between the ranges that are not adjacent
+			last := -1
+			for i, p := range parts {
+				if !selected(i + 1) {
+					continue
+				}
+				if last >= 0 && (mode == "f" || last != i-1) {
+					buf.WriteString(outDelim)
+				}
+				buf.WriteString(p)
+				last = i
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	sys.Out().Write(buf.Bytes())
+	return status
+}
+
+// parseCutList parses the LIST of cut, returning the error message if it
+// is invalid
+func parseCutList(list string) ([]cutRange, string) {
+	var ranges []cutRange
+	for _, item := range strings.Split(list, ",") {
+		if len(item) == 0 {
+			return nil, "fields and positions are numbered from 1"
+		}
+		var r cutRange
+		var err error
+		dash := strings.IndexByte(item, '-')
+		switch {
+		case item == "-":
+			return nil, "invalid range with no endpoint: -"
+		case dash < 0:
+			if r.start, err = strconv.Atoi(item); err == nil {
+				r.end = r.start
+			}
+		case dash == 0:
+			r.start = 1
+			r.end, err = strconv.Atoi(item[1:])
+		case dash == len(item)-1:
+			r.start, err = strconv.Atoi(item[:dash])
+		default:
+			if r.start, err = strconv.Atoi(item[:dash]); err == nil {
+				r.end, err = strconv.Atoi(item[dash+1:])
+			}
+		}
+		switch {
+		case err != nil:
+			if dash < 0 {
+				return nil, fmt.Sprintf("invalid field value %v", quote(item))
+			}
+			return nil, "invalid byte or field list"
+		case r.start < 1 || dash >= 0 && dash != len(item)-1 && r.end < 1:
+			return nil, "fields and positions are numbered from 1"
+		case r.end > 0 && r.end < r.start:
+			return nil, "invalid decreasing range"
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, ""
+}
+
+func (cut) Where() string {
+	return "/usr/bin/cut"
+}
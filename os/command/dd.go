@@ -0,0 +1,338 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	"github.com/mkishere/sshsyrup/util/capture"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// dd copies a file block by block, e.g. to read /dev/urandom
+type dd struct{}
+
+func init() {
+	honeyos.RegisterCommand("dd", dd{})
+}
+
+func (dd) GetHelp() string {
+	return `Usage: dd [OPERAND]...
+  or:  dd OPTION
+Copy a file, converting and formatting according to the operands.
+
+  bs=BYTES        read and write up to BYTES bytes at a time
+  cbs=BYTES       convert BYTES bytes at a time
+  conv=CONVS      convert the file as per the comma separated symbol list
+  count=N         copy only N input blocks
+  ibs=BYTES       read up to BYTES bytes at a time (default: 512)
+  if=FILE         read from FILE instead of stdin
+  iflag=FLAGS     read as per the comma separated symbol list
+  obs=BYTES       write BYTES bytes at a time (default: 512)
+  of=FILE         write to FILE instead of stdout
+  oflag=FLAGS     write as per the comma separated symbol list
+  seek=N          skip N obs-sized blocks at start of output
+  skip=N          skip N ibs-sized blocks at start of input
+  status=LEVEL    The LEVEL of information to print to stderr;
+                  'none' suppresses everything but error messages,
+                  'noxfer' suppresses the final transfer statistics,
+                  'progress' shows periodic transfer statistics
+
+N and BYTES may be followed by the following multiplicative suffixes:
+c =1, w =2, b =512, kB =1000, K =1024, MB =1000*1000, M =1024*1024, xM =M
+GB =1000*1000*1000, G =1024*1024*1024, and so on for T, P, E, Z, Y.
+
+      --help     display this help and exit
+      --version  output version information and exit
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/dd>
+or available locally via: info '(coreutils) dd invocation'
+`
+}
+
+func (dd) Where() string {
+	return "/bin/dd"
+}
+
+// ddNumber parses the number of bytes or blocks with the suffixes of dd,
+// which also multiplies numbers joined by x
+func ddNumber(s string) (int64, bool) {
+	res := int64(1)
+	for _, part := range strings.Split(s, "x") {
+		mult := int64(1)
+		for _, m := range []struct {
+			suffix string
+			n      int64
+		}{
+			{"kB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+			{"c", 1}, {"w", 2}, {"b", 512}, {"K", 1024}, {"k", 1024}, {"M", 1024 * 1024}, {"G", 1024 * 1024 * 1024},
+		} {
+			if strings.HasSuffix(part, m.suffix) {
+				part, mult = strings.TrimSuffix(part, m.suffix), m.n
+				break
+			}
+		}
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		res *= n * mult
+	}
+	return res, true
+}
+
+func (d dd) Exec(args []string, sys honeyos.Sys) int {
+	if len(args) == 1 && args[0] == "--help" {
+		fmt.Fprint(sys.Out(), d.GetHelp())
+		return 0
+	}
+	if len(args) == 1 && args[0] == "--version" {
+		fmt.Fprint(sys.Out(), coreutilsVersion("dd", "Paul Rubin, David MacKenzie, and Stuart Kemp"))
+		return 0
+	}
+	ibs, obs, count, skip, seek := int64(512), int64(512), int64(-1), int64(0), int64(0)
+	bs := false
+	inName, outName, status := "", "", ""
+	conv := make(map[string]bool)
+	for _, arg := range args {
+		i := strings.IndexByte(arg, '=')
+		if i < 0 {
+			return usageError(sys, "dd", fmt.Sprintf("unrecognized operand %v", quote(arg)))
+		}
+		key, val := arg[:i], arg[i+1:]
+		switch key {
+		case "if":
+			inName = val
+		case "of":
+			outName = val
+		case "status":
+			if val != "none" && val != "noxfer" && val != "progress" {
+				return usageError(sys, "dd", fmt.Sprintf("invalid status level: %v", quote(val)))
+			}
+			status = val
+		case "conv":
+			for _, c := range strings.Split(val, ",") {
+				conv[c] = true
+			}
+		case "iflag", "oflag":
+		case "bs", "ibs", "obs", "cbs", "count", "skip", "seek":
+			n, ok := ddNumber(val)
+			if !ok || n == 0 && strings.HasSuffix(key, "bs") {
+				fmt.Fprintf(sys.Err(), "dd: invalid number: %v\n", quote(val))
+				return 1
+			}
+			switch key {
+			case "bs":
+				ibs, obs, bs = n, n, true
+			case "ibs":
+				ibs = n
+			case "obs":
+				obs = n
+			case "count":
+				count = n
+			case "skip":
+				skip = n
+			case "seek":
+				seek = n
+			}
+		default:
+			return usageError(sys, "dd", fmt.Sprintf("unrecognized operand %v", quote(arg)))
+		}
+	}
+	// Blocks are held in memory, so huge ones are refused like when the
+	// host cannot allocate them
+	if ibs > 64<<20 || obs > 64<<20 {
+		fmt.Fprintf(sys.Err(), "dd: memory exhausted by input buffer of size %v bytes (%v)\n",
+			ibs, ddHuman(float64(ibs), false))
+		return 1
+	}
+
+	fs := sys.FSys()
+	var in io.Reader = sys.In()
+	if len(inName) > 0 {
+		f, err := fs.Open(fullPath(sys, inName))
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "dd: failed to open %v: %v\n", quote(inName), honeyos.ErrnoString(err))
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	var out io.Writer = sys.Out()
+	var outFile afero.File
+	if len(outName) > 0 {
+		flag := os.O_WRONLY
+		if conv["excl"] {
+			flag |= os.O_EXCL
+		}
+		if !conv["notrunc"] && seek == 0 {
+			flag |= os.O_TRUNC
+		}
+		var err error
+		if conv["nocreat"] {
+			outFile, err = fs.OpenFile(fullPath(sys, outName), flag, 0)
+		} else {
+			outFile, err = createFile(fs, fullPath(sys, outName), flag, 0666&^defaultUmask)
+		}
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "dd: failed to open %v: %v\n", quote(outName), honeyos.ErrnoString(err))
+			return 1
+		}
+		defer outFile.Close()
+		if seek > 0 {
+			if !conv["notrunc"] {
+				outFile.Truncate(seek * obs)
+			}
+			outFile.Seek(seek*obs, io.SeekStart)
+		}
+		out = outFile
+	}
+
+	start := time.Now()
+	exit := 0
+	if skip > 0 {
+		if s, ok := in.(io.Seeker); ok && len(inName) > 0 {
+			s.Seek(skip*ibs, io.SeekStart)
+		} else if _, err := io.CopyN(ioutil.Discard, in, skip*ibs); err != nil {
+			fmt.Fprintf(sys.Err(), "dd: %v: cannot skip to specified offset\n", quote(ddName(inName, "standard input")))
+		}
+	}
+	var fullIn, partIn, fullOut, partOut, total int64
+	buf := make([]byte, ibs)
+	var pending []byte
+	write := func(p []byte) bool {
+		n, err := out.Write(p)
+		total += int64(n)
+		if int64(n) == obs {
+			fullOut++
+		} else if n > 0 {
+			partOut++
+		}
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "dd: error writing %v: %v\n", quote(ddName(outName, "standard output")), honeyos.ErrnoString(err))
+			exit = 1
+			return false
+		}
+		return true
+	}
+blocks:
+	for count < 0 || fullIn+partIn < count {
+		n, err := in.Read(buf)
+		if n == 0 && err == nil {
+			continue
+		}
+		if n > 0 {
+			if int64(n) == ibs {
+				fullIn++
+			} else {
+				partIn++
+			}
+			block := buf[:n]
+			if conv["sync"] && int64(n) < ibs {
+				for i := n; i < len(buf); i++ {
+					buf[i] = 0
+				}
+				block = buf
+			}
+			// With bs= each block read is written as is
+			if bs {
+				if !write(block) {
+					break blocks
+				}
+			} else {
+				pending = append(pending, block...)
+				for int64(len(pending)) >= obs {
+					if !write(pending[:obs]) {
+						break blocks
+					}
+					pending = pending[obs:]
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "dd: error reading %v: %v\n", quote(ddName(inName, "standard input")), honeyos.ErrnoString(err))
+			exit = 1
+			if !conv["noerror"] {
+				break
+			}
+		}
+	}
+	if len(pending) > 0 && exit == 0 {
+		write(pending)
+	}
+	elapsed := time.Since(start).Seconds()
+
+	if outFile != nil && total > 0 {
+		p := fullPath(sys, outName)
+		sys.FsEvent("write", p, log.Fields{"cmd": "dd", "size": total})
+		if fi, err := fs.Stat(p); err == nil && fi.Mode().IsRegular() {
+			if data, err := afero.ReadFile(fs, p); err == nil {
+				sys.Capture(data, capture.Source{Method: "dd", Path: p})
+			}
+		}
+	}
+	if status != "none" {
+		fmt.Fprintf(sys.Err(), "%d+%d records in\n%d+%d records out\n", fullIn, partIn, fullOut, partOut)
+		if status != "noxfer" {
+			fmt.Fprintln(sys.Err(), ddStats(total, elapsed))
+		}
+	}
+	return exit
+}
+
+func ddName(name, std string) string {
+	if len(name) == 0 {
+		return std
+	}
+	return name
+}
+
+// ddStats formats the bytes copied and the speed like dd of coreutils 8.25
+func ddStats(total int64, elapsed float64) string {
+	var res string
+	switch {
+	case total == 1:
+		res = "1 byte copied"
+	case total < 1000:
+		res = fmt.Sprintf("%d bytes copied", total)
+	default:
+		res = fmt.Sprintf("%d bytes (%v, %v) copied", total, ddHuman(float64(total), true), ddHuman(float64(total), false))
+	}
+	rate := "Infinity B"
+	if elapsed > 0 {
+		rate = ddHuman(float64(total)/elapsed, true)
+	}
+	return fmt.Sprintf("%v, %v s, %v/s", res, strconv.FormatFloat(elapsed, 'g', 6, 64), rate)
+}
+
+// ddHuman formats the size rounded to the nearest with the unit, e.g.
+// 1.0 MB or 1.0 MiB
+func ddHuman(v float64, si bool) string {
+	base, units, suffix := 1024.0, "KMGTPEZY", "iB"
+	if si {
+		base, units, suffix = 1000.0, "kMGTPEZY", "B"
+	}
+	if v < base {
+		return fmt.Sprintf("%.0f B", v)
+	}
+	unit := -1
+	for v >= base && unit < len(units)-1 {
+		v /= base
+		unit++
+	}
+	if v < 10 && math.Floor(v*10+0.5) < 100 {
+		return fmt.Sprintf("%.1f %c%v", v, units[unit], suffix)
+	}
+	return fmt.Sprintf("%.0f %c%v", v, units[unit], suffix)
+}
@@ -0,0 +1,262 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	"github.com/mkishere/sshsyrup/virtualfs"
+)
+
+// df reports the space of the filesystems in the mount table
+type df struct{}
+
+func init() {
+	honeyos.RegisterCommand("df", df{})
+}
+
+func (df) GetHelp() string {
+	return `Usage: df [OPTION]... [FILE]...
+Show information about the file system on which each FILE resides,
+or all file systems by default.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -a, --all             include pseudo, duplicate, inaccessible file systems
+  -B, --block-size=SIZE  scale sizes by SIZE before printing them; e.g.,
+                           '-BM' prints sizes in units of 1,048,576 bytes;
+                           see SIZE format below
+  -h, --human-readable  print sizes in powers of 1024 (e.g., 1023M)
+  -H, --si              print sizes in powers of 1000 (e.g., 1.1G)
+  -i, --inodes          list inode information instead of block usage
+  -k                    like --block-size=1K
+  -l, --local           limit listing to local file systems
+      --no-sync         do not invoke sync before getting usage info (default)
+      --output[=FIELD_LIST]  use the output format defined by FIELD_LIST,
+                               or print all fields if FIELD_LIST is omitted.
+  -P, --portability     use the POSIX output format
+      --sync            invoke sync before getting usage info
+      --total           elide all entries insignificant to available space,
+                          and produce a grand total
+  -t, --type=TYPE       limit listing to file systems of type TYPE
+  -T, --print-type      print file system type
+  -x, --exclude-type=TYPE   limit listing to file systems not of type TYPE
+  -v                    (ignored)
+      --help     display this help and exit
+      --version  output version information and exit
+
+Display values are in units of the first available SIZE from --block-size,
+and the DF_BLOCK_SIZE, BLOCK_SIZE and BLOCKSIZE environment variables.
+Otherwise, units default to 1024 bytes (or 512 if POSIXLY_CORRECT is set).
+
+The SIZE argument is an integer and optional unit (example: 10K is 10*1024).
+Units are K,M,G,T,P,E,Z,Y (powers of 1024) or KB,MB,... (powers of 1000).
+
+FIELD_LIST is a comma-separated list of columns to be included.  Valid
+field names are: 'source', 'fstype', 'itotal', 'iused', 'iavail', 'ipcent',
+'size', 'used', 'avail', 'pcent', 'file' and 'target' (see info page).
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/df>
+or available locally via: info '(coreutils) df invocation'
+`
+}
+
+func (df) Where() string {
+	return "/bin/df"
+}
+
+func (d df) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "ahHiklPt:Tx:v",
+		long: map[string]string{
+			"all": "a", "human-readable": "h", "si": "H", "inodes": "i", "local": "l", "portability": "P",
+			"type=": "t", "print-type": "T", "exclude-type=": "x", "no-sync": "no-sync", "sync": "sync",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "df", err)
+	}
+	all, printType, posix := false, false, false
+	// human is 1024 or 1000 for sizes with units
+	human := 0
+	var include, exclude []string
+	for _, opt := range opts {
+		switch opt.name {
+		case "a":
+			all = true
+		case "h":
+			human = 1024
+		case "H":
+			human = 1000
+		case "k":
+			human = 0
+		case "P":
+			posix = true
+		case "T":
+			printType = true
+		case "t":
+			include = append(include, opt.value)
+		case "x":
+			exclude = append(exclude, opt.value)
+		case "help":
+			fmt.Fprint(sys.Out(), d.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("df", "Torbjorn Granlund, David MacKenzie, and Paul Eggert"))
+			return 0
+		}
+	}
+
+	mounts := sys.Mounts()
+	status := 0
+	var shown []virtualfs.Mount
+	if len(operands) == 0 {
+		for _, mnt := range mounts {
+			size, _ := mnt.Usage()
+			// Pseudo filesystems without space are left out unless asked
+			if size == 0 && !all {
+				continue
+			}
+			shown = append(shown, mnt)
+		}
+	} else {
+		for _, name := range operands {
+			p := fullPath(sys, name)
+			if _, err := sys.FSys().Stat(p); err != nil {
+				fmt.Fprintf(sys.Err(), "df: %v: %v\n", quote(name), honeyos.ErrnoString(err))
+				status = 1
+				continue
+			}
+			if mnt, found := mountOf(mounts, p); found {
+				shown = append(shown, mnt)
+			}
+		}
+	}
+
+	header := []string{"Filesystem", "Type", "1K-blocks", "Used", "Available", "Use%", "Mounted on"}
+	switch {
+	case human > 0:
+		header[2], header[4] = "Size", "Avail"
+	case posix:
+		header[2], header[5] = "1024-blocks", "Capacity"
+	}
+	rows := [][]string{header}
+	for _, mnt := range shown {
+		if !fsTypeListed(include, exclude, mnt.Type) {
+			continue
+		}
+		size, used := mnt.Usage()
+		avail := size - used
+		if avail < 0 {
+			avail = 0
+		}
+		pcent := "-"
+		if size > 0 {
+			pcent = fmt.Sprintf("%d%%", (used*100+used+avail-1)/(used+avail))
+		}
+		rows = append(rows, []string{mnt.Source, mnt.Type, dfSize(size, human), dfSize(used, human),
+			dfSize(avail, human), pcent, mnt.Dir})
+	}
+	if len(rows) == 1 {
+		if status == 0 {
+			fmt.Fprintln(sys.Err(), "df: no file systems processed")
+		}
+		return 1
+	}
+
+	// Columns are as wide as their widest value, at least the minimum
+	// widths of coreutils. The type is shown only with -T
+	widths := []int{14, 4, 5, 5, 5, 4, 0}
+	for _, row := range rows {
+		for i, field := range row {
+			if len(field) > widths[i] {
+				widths[i] = len(field)
+			}
+		}
+	}
+	for _, row := range rows {
+		var line []string
+		for i, field := range row {
+			switch {
+			case i == 1 && !printType:
+			case i == len(row)-1:
+				line = append(line, field)
+			case i <= 1:
+				line = append(line, fmt.Sprintf("%-*s", widths[i], field))
+			default:
+				line = append(line, fmt.Sprintf("%*s", widths[i], field))
+			}
+		}
+		fmt.Fprintln(sys.Out(), strings.Join(line, " "))
+	}
+	return status
+}
+
+// fsTypeListed tells if the filesystem type is selected by the types of -t
+// and not excluded by those of -x
+func fsTypeListed(include, exclude []string, typ string) bool {
+	for _, t := range exclude {
+		if t == typ {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, t := range include {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// mountOf returns the mount the path is in, the one mounted at its deepest
+// parent
+func mountOf(mounts []virtualfs.Mount, p string) (virtualfs.Mount, bool) {
+	var res virtualfs.Mount
+	found := false
+	for _, mnt := range mounts {
+		if p == mnt.Dir || mnt.Dir == "/" || strings.HasPrefix(p, mnt.Dir+"/") {
+			// Of mounts at the same directory the last one is seen
+			if !found || len(mnt.Dir) >= len(res.Dir) {
+				res, found = mnt, true
+			}
+		}
+	}
+	return res, found
+}
+
+// dfSize formats the size in KiB as 1K blocks, or with -h and -H rounded
+// up to one decimal digit below 10 with the unit, e.g. 7.7G
+func dfSize(kib int, base int) string {
+	if base == 0 {
+		return fmt.Sprint(kib)
+	}
+	units := "KMGTPEZY"
+	if base == 1000 {
+		units = "kMGTPEZY"
+	}
+	v := float64(kib) * 1024
+	b := float64(base)
+	if v < b {
+		return fmt.Sprint(kib * 1024)
+	}
+	unit := -1
+	for v >= b && unit < len(units)-1 {
+		v /= b
+		unit++
+	}
+	if v < 10 {
+		if r := math.Ceil(v*10) / 10; r < 10 {
+			return fmt.Sprintf("%.1f%c", r, units[unit])
+		}
+	}
+	v = math.Ceil(v)
+	if v >= b && unit < len(units)-1 {
+		return fmt.Sprintf("1.0%c", units[unit+1])
+	}
+	return fmt.Sprintf("%.0f%c", v, units[unit])
+}
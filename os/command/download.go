@@ -0,0 +1,294 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	urllib "net/url"
+	"os"
+	"strings"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	"github.com/mkishere/sshsyrup/util/capture"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinds of download errors, which the downloaders report in their own words
+const (
+	errDownload = iota
+	errResolve
+	errConnect
+	errTimeout
+	errTLS
+	errUnsupported
+)
+
+// downloadTimeout is the longest time allowed for a download unless
+// configured
+const downloadTimeout = 60 * time.Second
+
+// downloadRequest is a transfer requested by a downloader command
+type downloadRequest struct {
+	// cmd is the command name reported in the logs
+	cmd    string
+	method string
+	url    *urllib.URL
+	header http.Header
+	body   []byte
+	// redirects is the number of redirects followed, the response of the
+	// last one is returned when exceeded
+	redirects int
+	insecure  bool
+	timeout   time.Duration
+}
+
+// download is the result of a transfer, with the whole body read
+type download struct {
+	// url is the final URL after redirects
+	url    *urllib.URL
+	addrs  []net.IP
+	remote string
+	resp   *http.Response
+	body   []byte
+	// offline is set when the transfer is emulated under the download
+	// policy, and the body is not from the host
+	offline bool
+}
+
+// downloadError is a failed transfer
+type downloadError struct {
+	kind int
+	host string
+	port string
+	// addrs are the addresses the host resolved to before the failure
+	addrs []net.IP
+	err   error
+}
+
+func (e *downloadError) Error() string {
+	return e.err.Error()
+}
+
+// offlineRedirect stops following the redirect to a host the download
+// policy does not allow to reach
+type offlineRedirect struct {
+	req *http.Request
+}
+
+func (e *offlineRedirect) Error() string {
+	return "redirect to " + e.req.URL.Hostname() + " not allowed"
+}
+
+// newDownloadRequest returns a GET request of the URL, adding http:// to
+// URLs without scheme like the downloaders do
+func newDownloadRequest(cmd, rawurl string) (*downloadRequest, error) {
+	if !strings.Contains(rawurl, "://") {
+		rawurl = "http://" + rawurl
+	}
+	u, err := urllib.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Path) == 0 {
+		u.Path = "/"
+	}
+	return &downloadRequest{cmd: cmd, method: "GET", url: u, header: make(http.Header)}, nil
+}
+
+// urlPort returns the port of the URL, or the default one of the scheme
+func urlPort(u *urllib.URL) string {
+	if port := u.Port(); len(port) > 0 {
+		return port
+	}
+	switch u.Scheme {
+	case "https":
+		return "443"
+	case "ftp":
+		return "21"
+	case "tftp":
+		return "69"
+	}
+	return "80"
+}
+
+// fetch performs the transfer within the download limits, or emulates it
+// under the download policy, and logs the downloaded payload
+func fetch(sys honeyos.Sys, req *downloadRequest) (*download, error) {
+	host, port := req.url.Hostname(), urlPort(req.url)
+	fail := func(kind int, err error) (*download, error) {
+		return nil, &downloadError{kind: kind, host: host, port: port, err: err}
+	}
+	switch req.url.Scheme {
+	case "http", "https", "ftp", "tftp":
+	default:
+		return fail(errUnsupported, fmt.Errorf("unsupported scheme %v", req.url.Scheme))
+	}
+	if downloadPolicy(host) == policyOffline {
+		return fetchOffline(sys, req)
+	}
+	lim := currentLimits()
+	ctx, cancel := context.WithTimeout(context.Background(), lim.requestTimeout(req.timeout))
+	defer cancel()
+	var d *download
+	var err error
+	switch req.url.Scheme {
+	case "ftp":
+		d, err = fetchFTP(ctx, sys, req, lim)
+	case "tftp":
+		d, err = fetchTFTP(ctx, sys, req, lim)
+	default:
+		d, err = fetchHTTP(ctx, sys, req, lim)
+	}
+	if err == errTooLargeBody {
+		sys.LogEvent("Download exceeded size limit", log.Fields{
+			"cmd":   req.cmd,
+			"url":   req.url.String(),
+			"limit": lim.maxSize,
+		})
+	}
+	if err != nil {
+		de, ok := err.(*downloadError)
+		if !ok {
+			de = &downloadError{kind: downloadErrorKind(err), host: host, port: port, err: err}
+		}
+		if d != nil {
+			de.addrs = d.addrs
+		}
+		return nil, de
+	}
+	fields := log.Fields{
+		"cmd":   req.cmd,
+		"url":   req.url.String(),
+		"final": d.url.String(),
+		"size":  len(d.body),
+	}
+	if d.resp != nil {
+		fields["status"] = d.resp.StatusCode
+	}
+	sys.LogEvent("File downloaded", fields)
+	return d, nil
+}
+
+// fetchHTTP performs the HTTP transfer. Every connection, including those
+// of redirects, goes through dialTarget. Like the other transfers, the
+// download is returned with the addresses of the host on failure
+func fetchHTTP(ctx context.Context, sys honeyos.Sys, req *downloadRequest, lim downloadLimits) (*download, error) {
+	d := &download{}
+	addrs, _, err := resolveTarget(ctx, sys, req.cmd, lim, req.url.Hostname())
+	d.addrs = addrs
+	if err != nil {
+		return d, err
+	}
+	redirects := minInt(req.redirects, lim.maxRedirects)
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				host, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				conn, err := dialTarget(ctx, sys, req.cmd, lim, host, port)
+				if err == nil {
+					d.remote = conn.RemoteAddr().String()
+				}
+				return conn, err
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: req.insecure},
+			// The transport serves a single transfer, idle connections
+			// would be left open with their goroutines
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if len(via) > redirects {
+				return http.ErrUseLastResponse
+			}
+			// Hosts outside the allowlist are not reached by redirects
+			// either, the transfer is emulated from there
+			if downloadPolicy(r.URL.Hostname()) == policyOffline {
+				return &offlineRedirect{r}
+			}
+			return nil
+		},
+	}
+	httpReq, err := http.NewRequest(req.method, req.url.String(), bytes.NewReader(req.body))
+	if err != nil {
+		return d, err
+	}
+	if req.body == nil {
+		httpReq.Body = nil
+	}
+	httpReq.Header = req.header
+	resp, err := client.Do(httpReq.WithContext(ctx))
+	if ue, ok := err.(*urllib.Error); ok {
+		if redirect, ok := ue.Err.(*offlineRedirect); ok {
+			offline := *req
+			offline.method, offline.url, offline.body = redirect.req.Method, redirect.req.URL, nil
+			return fetchOffline(sys, &offline)
+		}
+	}
+	if err != nil {
+		return d, err
+	}
+	defer resp.Body.Close()
+	d.resp, d.url = resp, resp.Request.URL
+	if d.body, err = readLimited(resp.Body, lim); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// downloadErrorKind classifies the error of the HTTP client
+func downloadErrorKind(err error) int {
+	if ue, ok := err.(*urllib.Error); ok {
+		err = ue.Err
+	}
+	switch err {
+	case errDenied:
+		return errConnect
+	case context.DeadlineExceeded:
+		return errTimeout
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return errTimeout
+	}
+	if _, ok := err.(*net.DNSError); ok {
+		return errResolve
+	}
+	if oe, ok := err.(*net.OpError); ok && oe.Op == "dial" {
+		return errConnect
+	}
+	if strings.Contains(err.Error(), "x509:") || strings.Contains(err.Error(), "tls:") {
+		return errTLS
+	}
+	return errDownload
+}
+
+// saveDownload writes the downloaded file, which unlike the overlay does
+// not create the missing parent directories
+func saveDownload(sys honeyos.Sys, cmd, p string, d *download) error {
+	f, err := createFile(sys.FSys(), p, os.O_WRONLY|os.O_TRUNC, 0666&^defaultUmask)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(d.body); err != nil {
+		return err
+	}
+	sys.FsEvent("write", p, log.Fields{"cmd": cmd, "url": d.url.String(), "size": len(d.body)})
+	captureDownload(sys, cmd, p, d)
+	return nil
+}
+
+// captureDownload saves the payload to the capture store, with the path
+// it is saved to in the filesystem if any. Emulated transfers are not
+// captured
+func captureDownload(sys honeyos.Sys, cmd, p string, d *download) {
+	if d.offline {
+		return
+	}
+	sys.Capture(d.body, capture.Source{Method: cmd, URL: d.url.String(), Path: p})
+}
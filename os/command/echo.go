@@ -0,0 +1,63 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type echo struct{}
+
+func init() {
+	honeyos.RegisterCommand("echo", echo{})
+}
+
+func (e echo) GetHelp() string {
+	return ""
+}
+
+func (e echo) Exec(args []string, sys honeyos.Sys) int {
+	newline, escape := true, false
+	// Like bash, only arguments consisting of the known options are taken as
+	// options, anything else is printed as is
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' &&
+		strings.Trim(args[0][1:], "neE") == "" {
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'n':
+				newline = false
+			case 'e':
+				escape = true
+			case 'E':
+				escape = false
+			}
+		}
+		args = args[1:]
+	}
+	var buf bytes.Buffer
+	for i, arg := range args {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		if !escape {
+			buf.WriteString(arg)
+			continue
+		}
+		b, stop := unescape(arg, true)
+		buf.Write(b)
+		if stop {
+			sys.Out().Write(buf.Bytes())
+			return 0
+		}
+	}
+	if newline {
+		buf.WriteByte('\n')
+	}
+	sys.Out().Write(buf.Bytes())
+	return 0
+}
+
+func (e echo) Where() string {
+	return "/bin/echo"
+}
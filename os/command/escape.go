@@ -0,0 +1,100 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// unescape interprets the backslash escapes in s as done by echo -e and
+// printf. Octal escapes are \0nnn for echo and \nnn for printf format.
+// The second value reports if \c was found, which stops all output
+func unescape(s string, echoOctal bool) ([]byte, bool) {
+	res := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			res = append(res, s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'a':
+			res = append(res, '\a')
+		case 'b':
+			res = append(res, '\b')
+		case 'e', 'E':
+			res = append(res, 0x1b)
+		case 'f':
+			res = append(res, '\f')
+		case 'n':
+			res = append(res, '\n')
+		case 'r':
+			res = append(res, '\r')
+		case 't':
+			res = append(res, '\t')
+		case 'v':
+			res = append(res, '\v')
+		case '\\':
+			res = append(res, '\\')
+		case 'c':
+			return res, true
+		case 'x':
+			n := digitsLen(s[i+1:], 2, "0123456789abcdefABCDEF")
+			if n == 0 {
+				res = append(res, '\\', 'x')
+				continue
+			}
+			v, _ := strconv.ParseUint(s[i+1:i+1+n], 16, 8)
+			res = append(res, byte(v))
+			i += n
+		case 'u', 'U':
+			max := 4
+			if c == 'U' {
+				max = 8
+			}
+			n := digitsLen(s[i+1:], max, "0123456789abcdefABCDEF")
+			if n == 0 {
+				res = append(res, '\\', c)
+				continue
+			}
+			v, _ := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			var buf [utf8.UTFMax]byte
+			res = append(res, buf[:utf8.EncodeRune(buf[:], rune(v))]...)
+			i += n
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			start := i
+			if echoOctal {
+				if c != '0' {
+					res = append(res, '\\', c)
+					continue
+				}
+				start++
+			}
+			n := digitsLen(s[start:], 3, "01234567")
+			v, _ := strconv.ParseUint("0"+s[start:start+n], 8, 16)
+			res = append(res, byte(v))
+			i = start + n - 1
+			if n == 0 {
+				i = start - 1
+			}
+		case '"', '\'':
+			if echoOctal {
+				res = append(res, '\\')
+			}
+			res = append(res, c)
+		default:
+			res = append(res, '\\', c)
+		}
+	}
+	return res, false
+}
+
+// digitsLen returns the length of the prefix of s, up to max bytes, which
+// consists of the digits
+func digitsLen(s string, max int, digits string) int {
+	n := 0
+	for n < len(s) && n < max && strings.IndexByte(digits, s[n]) >= 0 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,242 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	"github.com/spf13/afero"
+)
+
+// defaultUmask is the umask of the shell, applied to new files and to
+// symbolic modes given without who
+const defaultUmask = 022
+
+// fullPath resolves the path given in command line against the working
+// directory
+func fullPath(sys honeyos.Sys, p string) string {
+	if !path.IsAbs(p) {
+		p = path.Join(sys.Getcwd(), p)
+	}
+	return path.Clean(p)
+}
+
+// quote quotes the file name like coreutils does in messages
+func quote(name string) string {
+	if strings.ContainsRune(name, '\'') {
+		return `"` + name + `"`
+	}
+	return "'" + name + "'"
+}
+
+// unixMode converts the file mode to the permission bits of chmod(2)
+func unixMode(m os.FileMode) uint32 {
+	bits := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+// fileMode converts the permission bits of chmod(2) to file mode
+func fileMode(bits uint32) os.FileMode {
+	m := os.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// modeString formats the permission bits like ls, e.g. rwxr-xr-x
+func modeString(bits uint32) string {
+	b := []byte("rwxrwxrwx")
+	for i := range b {
+		if bits&(1<<uint(8-i)) == 0 {
+			b[i] = '-'
+		}
+	}
+	special := func(i int, set bool, c byte) {
+		switch {
+		case !set:
+		case b[i] == 'x':
+			b[i] = c
+		default:
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	special(2, bits&04000 != 0, 's')
+	special(5, bits&02000 != 0, 's')
+	special(8, bits&01000 != 0, 't')
+	return string(b)
+}
+
+// parseMode applies the octal or symbolic mode of chmod to the permission
+// bits, and reports if the mode is valid
+func parseMode(spec string, old uint32, isDir bool) (uint32, bool) {
+	if len(spec) > 0 && strings.Trim(spec, "01234567") == "" {
+		n, err := strconv.ParseUint(spec, 8, 32)
+		if err != nil || n > 07777 {
+			return 0, false
+		}
+		return uint32(n), true
+	}
+	mode := old
+	for _, clause := range strings.Split(spec, ",") {
+		i := 0
+		var who uint32
+		for ; i < len(clause) && strings.IndexByte("ugoa", clause[i]) >= 0; i++ {
+			switch clause[i] {
+			case 'u':
+				who |= 04700
+			case 'g':
+				who |= 02070
+			case 'o':
+				who |= 01007
+			case 'a':
+				who |= 07777
+			}
+		}
+		masked := who == 0
+		if masked {
+			who = 07777
+		}
+		if i == len(clause) {
+			return 0, false
+		}
+		for i < len(clause) {
+			op := clause[i]
+			if op != '+' && op != '-' && op != '=' {
+				return 0, false
+			}
+			i++
+			var perm uint32
+			if i < len(clause) && strings.IndexByte("ugo", clause[i]) >= 0 {
+				var v uint32
+				switch clause[i] {
+				case 'u':
+					v = mode >> 6 & 7
+				case 'g':
+					v = mode >> 3 & 7
+				case 'o':
+					v = mode & 7
+				}
+				perm = v<<6 | v<<3 | v
+				i++
+			}
+			for ; i < len(clause) && strings.IndexByte("rwxXst", clause[i]) >= 0; i++ {
+				switch clause[i] {
+				case 'r':
+					perm |= 0444
+				case 'w':
+					perm |= 0222
+				case 'x':
+					perm |= 0111
+				case 'X':
+					if isDir || mode&0111 != 0 {
+						perm |= 0111
+					}
+				case 's':
+					perm |= 06000
+				case 't':
+					perm |= 01000
+				}
+			}
+			perm &= who
+			if masked {
+				perm &^= defaultUmask
+			}
+			switch op {
+			case '+':
+				mode |= perm
+			case '-':
+				mode &^= perm
+			case '=':
+				clear := who
+				if isDir {
+					clear &^= 06000
+				}
+				mode = mode&^clear | perm
+			}
+		}
+	}
+	return mode, true
+}
+
+// removeFile removes the file or empty directory. Files of filesystems that
+// cannot remove them, such as the image without a layer, are reported like
+// immutable files
+func removeFile(fs afero.Fs, p string) error {
+	err := fs.Remove(p)
+	if err != nil && os.IsNotExist(err) {
+		if _, serr := fs.Stat(p); serr == nil {
+			return &os.PathError{Op: "remove", Path: p, Err: syscall.EPERM}
+		}
+	}
+	return err
+}
+
+// confirm asks the question and reads the answer from stdin like the -i
+// option of coreutils
+func confirm(sys honeyos.Sys, prompt string) bool {
+	fmt.Fprint(sys.Err(), prompt)
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := sys.In().Read(b)
+		if n > 0 && (b[0] == '\n' || b[0] == '\r') {
+			if b[0] == '\r' {
+				fmt.Fprintln(sys.Err())
+			}
+			break
+		}
+		if n > 0 {
+			line = append(line, b[0])
+		}
+		if err != nil {
+			break
+		}
+	}
+	answer := strings.TrimSpace(string(line))
+	return len(answer) > 0 && (answer[0] == 'y' || answer[0] == 'Y')
+}
+
+// coreutilsVersion returns the --version output of the coreutils program
+func coreutilsVersion(cmd, authors string) string {
+	return fmt.Sprintf(`%v (GNU coreutils) 8.25
+Copyright (C) 2016 Free Software Foundation, Inc.
+License GPLv3+: GNU GPL version 3 or later <http://gnu.org/licenses/gpl.html>.
+This is free software: you are free to change and redistribute it.
+There is NO WARRANTY, to the extent permitted by law.
+
+Written by %v.
+`, cmd, authors)
+}
+
+// createFile opens the file for writing, creating it if needed. Unlike
+// the overlay it does not create the missing parent directories
+func createFile(fs afero.Fs, p string, flag int, perm os.FileMode) (afero.File, error) {
+	parent, err := fs.Stat(path.Dir(p))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	if !parent.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: p, Err: syscall.ENOTDIR}
+	}
+	return fs.OpenFile(p, flag|os.O_CREATE, perm)
+}
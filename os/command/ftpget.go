@@ -0,0 +1,244 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	urllib "net/url"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+// busyboxBanner heads the usage of the BusyBox applets
+const busyboxBanner = "BusyBox v1.22.1 (Ubuntu 1:1.22.0-15ubuntu1) multi-call binary.\n\n"
+
+const ftpgetUsage = `Usage: ftpget [OPTIONS] HOST [LOCAL_FILE] REMOTE_FILE
+
+Download a file via FTP
+
+	-c	Continue previous transfer
+	-v	Verbose
+	-u USER	Username
+	-p PASS	Password
+	-P NUM	Port
+`
+
+type ftpget struct{}
+
+func init() {
+	honeyos.RegisterCommand("ftpget", ftpget{})
+}
+
+func (ftpget) GetHelp() string {
+	return busyboxBanner + ftpgetUsage
+}
+
+func (ftpget) Where() string {
+	return "/usr/bin/ftpget"
+}
+
+func (fg ftpget) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "cvu:p:P:",
+		long: map[string]string{
+			"continue": "c", "verbose": "v", "username=": "u", "password=": "p", "port=": "P", "help": "help",
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "ftpget: %v\n", err)
+		fmt.Fprint(sys.Err(), fg.GetHelp())
+		return 1
+	}
+	user, pass, port, verbose := "anonymous", "busybox@", "21", false
+	for _, opt := range opts {
+		switch opt.name {
+		case "v":
+			verbose = true
+		case "u":
+			user = opt.value
+		case "p":
+			pass = opt.value
+		case "P":
+			port = opt.value
+		case "help":
+			fmt.Fprint(sys.Out(), fg.GetHelp())
+			return 0
+		}
+	}
+	if len(operands) < 2 {
+		fmt.Fprint(sys.Err(), fg.GetHelp())
+		return 1
+	}
+	host, local, remote := operands[0], operands[1], operands[1]
+	if len(operands) > 2 {
+		remote = operands[2]
+	}
+	req := &downloadRequest{
+		cmd:    "ftpget",
+		method: "RETR",
+		url: &urllib.URL{
+			Scheme: "ftp",
+			User:   urllib.UserPassword(user, pass),
+			Host:   net.JoinHostPort(host, port),
+			Path:   "/" + remote,
+		},
+	}
+	d, err := fetch(sys, req)
+	if err != nil {
+		de, _ := err.(*downloadError)
+		switch {
+		case de == nil:
+			fmt.Fprintf(sys.Err(), "ftpget: %v\n", err)
+		case de.kind == errResolve:
+			fmt.Fprintf(sys.Err(), "ftpget: bad address '%v'\n", host)
+		case de.kind == errConnect || de.kind == errTimeout:
+			reason := "Connection refused"
+			if de.kind == errTimeout {
+				reason = "Connection timed out"
+			}
+			addr := host
+			if oe, ok := de.err.(*net.OpError); ok && oe.Addr != nil {
+				addr, _, _ = net.SplitHostPort(oe.Addr.String())
+			}
+			fmt.Fprintf(sys.Err(), "ftpget: can't connect to remote host (%v): %v\n", addr, reason)
+		default:
+			if fe, ok := de.err.(*ftpError); ok {
+				fmt.Fprintf(sys.Err(), "ftpget: unexpected server response to %v: %v\n", fe.cmd, fe.line)
+			} else {
+				fmt.Fprintf(sys.Err(), "ftpget: read error: %v\n", "Connection reset by peer")
+			}
+		}
+		return 1
+	}
+	if verbose {
+		fmt.Fprintf(sys.Err(), "ftpget: Connecting to %v (%v)\n", host, d.remote)
+	}
+	if local == "-" {
+		sys.Out().Write(d.body)
+		captureDownload(sys, "ftpget", "", d)
+		return 0
+	}
+	if err := saveDownload(sys, "ftpget", fullPath(sys, local), d); err != nil {
+		fmt.Fprintf(sys.Err(), "ftpget: can't open '%v': %v\n", local, honeyos.ErrnoString(err))
+		return 1
+	}
+	return 0
+}
+
+// ftpError is an unexpected reply of the FTP server to the command
+type ftpError struct {
+	cmd  string
+	line string
+}
+
+func (e *ftpError) Error() string {
+	return fmt.Sprintf("unexpected server response to %v: %v", e.cmd, e.line)
+}
+
+// fetchFTP retrieves the file of the URL in passive mode. The data
+// connection goes to the address of the control connection whatever the
+// server announces, so that the server cannot point it elsewhere
+func fetchFTP(ctx context.Context, sys honeyos.Sys, req *downloadRequest, lim downloadLimits) (*download, error) {
+	addrs, ip, err := resolveTarget(ctx, sys, req.cmd, lim, req.url.Hostname())
+	d := &download{url: req.url, addrs: addrs}
+	if err != nil {
+		return d, err
+	}
+	conn, err := dialAddr(ctx, lim, net.JoinHostPort(ip.String(), urlPort(req.url)))
+	if err != nil {
+		return d, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	d.remote = conn.RemoteAddr().String()
+	text := textproto.NewConn(conn)
+	cmd := func(expect int, name, format string, args ...interface{}) (int, string, error) {
+		if len(format) > 0 {
+			if err := text.PrintfLine(format, args...); err != nil {
+				return 0, "", err
+			}
+		}
+		code, msg, err := text.ReadResponse(expect)
+		if te, ok := err.(*textproto.Error); ok {
+			return code, msg, &ftpError{cmd: name, line: fmt.Sprintf("%03d %v", te.Code, te.Msg)}
+		}
+		return code, msg, err
+	}
+
+	user, pass := "anonymous", "anonymous@"
+	if req.url.User != nil {
+		user = req.url.User.Username()
+		if p, ok := req.url.User.Password(); ok {
+			pass = p
+		}
+	}
+	if _, _, err := cmd(2, "", ""); err != nil {
+		return d, err
+	}
+	code, msg, err := cmd(0, "USER", "USER %v", user)
+	switch {
+	case err != nil:
+		return d, err
+	case code == 331:
+		if _, _, err := cmd(2, "PASS", "PASS %v", pass); err != nil {
+			return d, err
+		}
+	case code/100 != 2:
+		return d, &ftpError{cmd: "USER", line: fmt.Sprintf("%03d %v", code, msg)}
+	}
+	if _, _, err := cmd(2, "TYPE", "TYPE I"); err != nil {
+		return d, err
+	}
+	_, msg, err = cmd(227, "PASV", "PASV")
+	if err != nil {
+		return d, err
+	}
+	port, ok := pasvPort(msg)
+	if !ok {
+		return d, &ftpError{cmd: "PASV", line: "227 " + msg}
+	}
+	data, err := dialAddr(ctx, lim, net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		return d, err
+	}
+	defer data.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		data.SetDeadline(deadline)
+	}
+	if _, _, err := cmd(1, "RETR", "RETR %v", strings.TrimPrefix(req.url.Path, "/")); err != nil {
+		return d, err
+	}
+	if d.body, err = readLimited(data, lim); err != nil {
+		return d, err
+	}
+	data.Close()
+	if _, _, err := cmd(2, "RETR", ""); err != nil {
+		return d, err
+	}
+	text.PrintfLine("QUIT")
+	return d, nil
+}
+
+// pasvPort returns the port in the reply to PASV, given as
+// (h1,h2,h3,h4,p1,p2)
+func pasvPort(msg string) (int, bool) {
+	start, end := strings.IndexByte(msg, '('), strings.LastIndexByte(msg, ')')
+	if start < 0 || end < start {
+		return 0, false
+	}
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return 0, false
+	}
+	p1, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil || p1 < 0 || p1 > 255 || p2 < 0 || p2 > 255 {
+		return 0, false
+	}
+	return p1<<8 | p2, true
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/mkishere/sshsyrup/os"
+)
+
+type getconf struct{}
+
+// getconfVars are the system configuration values of a x86_64 Linux box
+var getconfVars = map[string]string{
+	"LONG_BIT":               "64",
+	"WORD_BIT":               "32",
+	"PAGESIZE":               "4096",
+	"PAGE_SIZE":              "4096",
+	"CLK_TCK":                "100",
+	"ARG_MAX":                "2097152",
+	"CHILD_MAX":              "7735",
+	"OPEN_MAX":               "1024",
+	"HOST_NAME_MAX":          "64",
+	"LOGIN_NAME_MAX":         "256",
+	"GNU_LIBC_VERSION":       "glibc 2.23",
+	"GNU_LIBPTHREAD_VERSION": "NPTL 2.23",
+	"PATH":                   "/bin:/usr/bin",
+}
+
+func init() {
+	os.RegisterCommand("getconf", getconf{})
+}
+
+func (getconf) GetHelp() string {
+	return ""
+}
+
+func (getconf) Exec(args []string, sys os.Sys) int {
+	if len(args) == 0 {
+		fmt.Fprintln(sys.Err(), "Usage: getconf [-v SPEC] VAR")
+		fmt.Fprintln(sys.Err(), "  or:  getconf [-v SPEC] PATH_VAR PATH")
+		return 1
+	}
+	val, ok := getconfVars[args[0]]
+	if args[0] == "_NPROCESSORS_CONF" || args[0] == "_NPROCESSORS_ONLN" {
+		val, ok = strconv.Itoa(os.CurrentPersona().CPUs), true
+	}
+	if !ok {
+		fmt.Fprintf(sys.Err(), "getconf: Unrecognized variable `%v'\n", args[0])
+		return 1
+	}
+	fmt.Fprintln(sys.Out(), val)
+	return 0
+}
+
+func (getconf) Where() string {
+	return "/usr/bin/getconf"
+}
@@ -0,0 +1,119 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+// option is an option parsed from the command line. Name is the short
+// option letter, or the long name for options without short form
+type option struct {
+	name  string
+	value string
+}
+
+// optionSpec describes the options of a command in getopt_long style.
+// Letters in short followed by ':' take an argument. Long maps the long
+// option names to the option name, names ending in '=' take an argument
+// and those ending in '?' take an optional one
+type optionSpec struct {
+	short string
+	long  map[string]string
+}
+
+// getopt parses the arguments like GNU getopt_long. Options and operands
+// may be mixed, and "--" ends the options
+func getopt(args []string, spec optionSpec) (opts []option, operands []string, err error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return opts, append(operands, args[i+1:]...), nil
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := arg[2:], "", false
+			if eq := strings.IndexByte(name, '='); eq >= 0 {
+				name, value, hasValue = name[:eq], name[eq+1:], true
+			}
+			key, err := spec.matchLong(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			long := strings.TrimRight(key, "=?")
+			switch {
+			case strings.HasSuffix(key, "="):
+				if !hasValue {
+					if i+1 >= len(args) {
+						return nil, nil, fmt.Errorf("option '--%v' requires an argument", long)
+					}
+					i++
+					value = args[i]
+				}
+			case strings.HasSuffix(key, "?"):
+			case hasValue:
+				return nil, nil, fmt.Errorf("option '--%v' doesn't allow an argument", long)
+			}
+			opts = append(opts, option{spec.long[key], value})
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for j := 1; j < len(arg); j++ {
+				c := arg[j]
+				idx := strings.IndexByte(spec.short, c)
+				if c == ':' || idx < 0 {
+					return nil, nil, fmt.Errorf("invalid option -- '%c'", c)
+				}
+				if idx+1 >= len(spec.short) || spec.short[idx+1] != ':' {
+					opts = append(opts, option{string(c), ""})
+					continue
+				}
+				value := arg[j+1:]
+				if len(value) == 0 {
+					if i+1 >= len(args) {
+						return nil, nil, fmt.Errorf("option requires an argument -- '%c'", c)
+					}
+					i++
+					value = args[i]
+				}
+				opts = append(opts, option{string(c), value})
+				break
+			}
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	return
+}
+
+// matchLong finds the long option by its name or an unambiguous prefix
+func (spec optionSpec) matchLong(name string) (string, error) {
+	var matches []string
+	for key := range spec.long {
+		long := strings.TrimRight(key, "=?")
+		if long == name {
+			return key, nil
+		}
+		if strings.HasPrefix(long, name) {
+			matches = append(matches, key)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("unrecognized option '--%v'", name)
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	msg := fmt.Sprintf("option '--%v' is ambiguous; possibilities:", name)
+	for _, key := range matches {
+		msg += " '--" + strings.TrimRight(key, "=?") + "'"
+	}
+	return "", fmt.Errorf("%v", msg)
+}
+
+// usageError prints the command line error the way coreutils does
+func usageError(sys honeyos.Sys, cmd string, msg interface{}) int {
+	fmt.Fprintf(sys.Err(), "%v: %v\n", cmd, msg)
+	fmt.Fprintf(sys.Err(), "Try '%v --help' for more information.\n", cmd)
+	return 1
+}
@@ -0,0 +1,355 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	"github.com/spf13/afero"
+)
+
+// grep searches the lines matching the patterns. egrep and fgrep are the
+// same command with -E and -F
+type grep struct {
+	name string
+}
+
+// grepOptions are the options given to grep
+type grepOptions struct {
+	count, invert, lineNumber, onlyMatching, quiet, noMessages bool
+	filesWithMatches, filesWithoutMatch, recursive             bool
+	withFilename                                               *bool
+	maxCount                                                   int
+}
+
+func init() {
+	honeyos.RegisterCommand("grep", grep{"grep"})
+	honeyos.RegisterCommand("egrep", grep{"egrep"})
+	honeyos.RegisterCommand("fgrep", grep{"fgrep"})
+}
+
+func (g grep) GetHelp() string {
+	return `Usage: grep [OPTION]... PATTERN [FILE]...
+Search for PATTERN in each FILE or standard input.
+PATTERN is, by default, a basic regular expression (BRE).
+Example: grep -i 'hello world' menu.h main.c
+
+Regexp selection and interpretation:
+  -E, --extended-regexp     PATTERN is an extended regular expression (ERE)
+  -F, --fixed-strings       PATTERN is a set of newline-separated strings
+  -G, --basic-regexp        PATTERN is a basic regular expression (BRE)
+  -P, --perl-regexp         PATTERN is a Perl regular expression
+  -e, --regexp=PATTERN      use PATTERN for matching
+  -f, --file=FILE           obtain PATTERN from FILE
+  -i, --ignore-case         ignore case distinctions
+  -w, --word-regexp         force PATTERN to match only whole words
+  -x, --line-regexp         force PATTERN to match only whole lines
+  -z, --null-data           a data line ends in 0 byte, not newline
+
+Miscellaneous:
+  -s, --no-messages         suppress error messages
+  -v, --invert-match        select non-matching lines
+  -V, --version             display version information and exit
+      --help                display this help text and exit
+
+Output control:
+  -m, --max-count=NUM       stop after NUM selected lines
+  -b, --byte-offset         print the byte offset with output lines
+  -n, --line-number         print line number with output lines
+      --line-buffered       flush output on every line
+  -H, --with-filename       print the file name for each match
+  -h, --no-filename         suppress the file name prefix on output
+      --label=LABEL         use LABEL as the standard input file name prefix
+  -o, --only-matching       show only the part of a line matching PATTERN
+  -q, --quiet, --silent     suppress all normal output
+  -r, --recursive           like --directories=recurse
+  -R, --dereference-recursive  likewise, but follow all symlinks
+  -L, --files-without-match  print only names of FILEs with no selected lines
+  -l, --files-with-matches  print only names of FILEs with selected lines
+  -c, --count               print only a count of selected lines per FILE
+
+When FILE is '-', read standard input.  With no FILE, read '.' if
+recursive, '-' otherwise.  With fewer than two FILEs, assume -h.
+Exit status is 0 if any line is selected, 1 otherwise;
+if any error occurs and -q is not given, the exit status is 2.
+
+Report bugs to: bug-grep@gnu.org
+GNU grep home page: <http://www.gnu.org/software/grep/>
+General help using GNU software: <http://www.gnu.org/gethelp/>
+`
+}
+
+func (g grep) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "EFGPe:f:iywxzsvVm:bnHhoqrRLlcA:B:C:",
+		long: map[string]string{
+			"extended-regexp": "E", "fixed-strings": "F", "basic-regexp": "G", "perl-regexp": "P",
+			"regexp=": "e", "file=": "f", "ignore-case": "i", "word-regexp": "w", "line-regexp": "x",
+			"null-data": "z", "no-messages": "s", "invert-match": "v", "version": "V", "help": "help",
+			"max-count=": "m", "byte-offset": "b", "line-number": "n", "line-buffered": "line-buffered",
+			"with-filename": "H", "no-filename": "h", "label=": "label", "only-matching": "o",
+			"quiet": "q", "silent": "q", "recursive": "r", "dereference-recursive": "R",
+			"files-without-match": "L", "files-with-matches": "l", "count": "c", "color?": "color",
+			"colour?": "color", "after-context=": "A", "before-context=": "B", "context=": "C",
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "%v: %v\n", g.name, err)
+		fmt.Fprintf(sys.Err(), "Usage: %v [OPTION]... PATTERN [FILE]...\n", g.name)
+		fmt.Fprintf(sys.Err(), "Try '%v --help' for more information.\n", g.name)
+		return 2
+	}
+	extended, fixed := g.name == "egrep", g.name == "fgrep"
+	ignoreCase, word, line := false, false, false
+	var patterns []string
+	patternGiven := false
+	o := grepOptions{maxCount: -1}
+	for _, opt := range opts {
+		switch opt.name {
+		case "E":
+			extended, fixed = true, false
+		case "F":
+			extended, fixed = false, true
+		case "G", "P":
+			extended, fixed = opt.name == "P", false
+		case "e":
+			patterns = append(patterns, strings.Split(opt.value, "\n")...)
+			patternGiven = true
+		case "f":
+			content, err := afero.ReadFile(sys.FSys(), fullPath(sys, opt.value))
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "%v: %v: %v\n", g.name, opt.value, honeyos.ErrnoString(err))
+				return 2
+			}
+			if lines, _ := readLines(bytes.NewReader(content)); len(lines) > 0 {
+				patterns = append(patterns, lines...)
+			}
+			patternGiven = true
+		case "i", "y":
+			ignoreCase = true
+		case "w":
+			word = true
+		case "x":
+			line = true
+		case "s":
+			o.noMessages = true
+		case "v":
+			o.invert = true
+		case "V":
+			fmt.Fprintf(sys.Out(), "%v (GNU grep) 2.25\nCopyright (C) 2016 Free Software Foundation, Inc.\n"+
+				"License GPLv3+: GNU GPL version 3 or later <http://gnu.org/licenses/gpl.html>.\n"+
+				"This is free software: you are free to change and redistribute it.\n"+
+				"There is NO WARRANTY, to the extent permitted by law.\n\n"+
+				"Written by Mike Haertel and others, see <http://git.sv.gnu.org/cgit/grep.git/tree/AUTHORS>.\n", g.name)
+			return 0
+		case "help":
+			fmt.Fprint(sys.Out(), g.GetHelp())
+			return 0
+		case "m":
+			n, err := strconv.Atoi(opt.value)
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "%v: invalid max count\n", g.name)
+				return 2
+			}
+			o.maxCount = n
+		case "n":
+			o.lineNumber = true
+		case "H":
+			withFilename := true
+			o.withFilename = &withFilename
+		case "h":
+			withFilename := false
+			o.withFilename = &withFilename
+		case "o":
+			o.onlyMatching = true
+		case "q":
+			o.quiet = true
+		case "r", "R":
+			o.recursive = true
+		case "L":
+			o.filesWithoutMatch, o.filesWithMatches = true, false
+		case "l":
+			o.filesWithMatches, o.filesWithoutMatch = true, false
+		case "c":
+			o.count = true
+		}
+	}
+	if !patternGiven {
+		if len(operands) == 0 {
+			fmt.Fprintf(sys.Err(), "Usage: %v [OPTION]... PATTERN [FILE]...\n", g.name)
+			fmt.Fprintf(sys.Err(), "Try '%v --help' for more information.\n", g.name)
+			return 2
+		}
+		patterns = strings.Split(operands[0], "\n")
+		operands = operands[1:]
+	}
+	exprs := make([]string, len(patterns))
+	for i, p := range patterns {
+		switch {
+		case fixed:
+			p = regexp.QuoteMeta(p)
+		case !extended:
+			p = breToERE(p)
+		}
+		exprs[i] = "(?:" + p + ")"
+	}
+	expr := strings.Join(exprs, "|")
+	switch {
+	case line:
+		expr = "^(?:" + expr + ")$"
+	case word:
+		expr = `\b(?:` + expr + `)\b`
+	}
+	re, err := compileRegexp(expr, true, ignoreCase)
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "%v: %v\n", g.name, regexpError(err))
+		return 2
+	}
+	if len(operands) == 0 {
+		operands = []string{"-"}
+		if o.recursive {
+			operands = []string{"."}
+		}
+	}
+	if o.withFilename == nil {
+		withFilename := len(operands) > 1 || o.recursive
+		o.withFilename = &withFilename
+	}
+	matched, failed := false, false
+	var search func(name string)
+	search = func(name string) {
+		if o.quiet && matched {
+			return
+		}
+		if o.recursive && name != "-" {
+			p := fullPath(sys, name)
+			if fi, err := sys.FSys().Stat(p); err == nil && fi.IsDir() {
+				entries, err := afero.ReadDir(sys.FSys(), p)
+				if err != nil && !o.noMessages {
+					fmt.Fprintf(sys.Err(), "%v: %v: %v\n", g.name, name, honeyos.ErrnoString(err))
+					failed = true
+				}
+				for _, entry := range entries {
+					search(path.Join(name, entry.Name()))
+				}
+				return
+			}
+		}
+		f, err := openInput(sys, name)
+		if err != nil {
+			if !o.noMessages {
+				fmt.Fprintf(sys.Err(), "%v: %v: %v\n", g.name, name, honeyos.ErrnoString(err))
+			}
+			failed = true
+			return
+		}
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		label := name
+		if name == "-" {
+			label = "(standard input)"
+		}
+		if g.searchContent(sys, re, label, content, o) {
+			matched = true
+		}
+	}
+	for _, name := range operands {
+		search(name)
+	}
+	switch {
+	case failed && !(o.quiet && matched):
+		return 2
+	case matched:
+		return 0
+	}
+	return 1
+}
+
+// searchContent prints the matching lines of the file and reports if
+// there is any
+func (g grep) searchContent(sys honeyos.Sys, re *regexp.Regexp, label string, content []byte, o grepOptions) bool {
+	lines, _ := readLines(bytes.NewReader(content))
+	binary := bytes.IndexByte(content, 0) >= 0
+	prefix := ""
+	if *o.withFilename {
+		prefix = label + ":"
+	}
+	count := 0
+	var out bytes.Buffer
+	for i, l := range lines {
+		if o.maxCount >= 0 && count >= o.maxCount {
+			break
+		}
+		if re.MatchString(l) == o.invert {
+			continue
+		}
+		count++
+		if o.quiet || o.count || o.filesWithMatches || o.filesWithoutMatch || binary {
+			continue
+		}
+		linePrefix := prefix
+		if o.lineNumber {
+			linePrefix += strconv.Itoa(i+1) + ":"
+		}
+		if o.onlyMatching {
+			if o.invert {
+				continue
+			}
+			for _, m := range re.FindAllString(l, -1) {
+				if len(m) > 0 {
+					out.WriteString(linePrefix + m + "\n")
+				}
+			}
+			continue
+		}
+		out.WriteString(linePrefix + l + "\n")
+	}
+	switch {
+	case o.quiet:
+	case o.filesWithMatches:
+		if count > 0 {
+			out.WriteString(label + "\n")
+		}
+	case o.filesWithoutMatch:
+		if count == 0 {
+			out.WriteString(label + "\n")
+		}
+	case o.count:
+		out.WriteString(prefix + strconv.Itoa(count) + "\n")
+	case binary && count > 0:
+		out.WriteString("Binary file " + label + " matches\n")
+	}
+	sys.Out().Write(out.Bytes())
+	return count > 0
+}
+
+func (g grep) Where() string {
+	return "/bin/" + g.name
+}
+
+// regexpError converts the error of Go regexp to the message of GNU regex
+func regexpError(err error) string {
+	e, ok := err.(*syntax.Error)
+	if !ok {
+		return err.Error()
+	}
+	switch e.Code {
+	case syntax.ErrMissingBracket:
+		return "Unmatched [ or [^"
+	case syntax.ErrMissingParen, syntax.ErrUnexpectedParen:
+		return "Unmatched ( or \\("
+	case syntax.ErrMissingRepeatArgument:
+		return "Invalid preceding regular expression"
+	case syntax.ErrTrailingBackslash:
+		return "Trailing backslash"
+	case syntax.ErrInvalidRepeatSize:
+		return "Invalid content of \\{\\}"
+	}
+	return "Invalid regular expression"
+}
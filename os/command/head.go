@@ -0,0 +1,236 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+// head prints the first part of the files, and tail the last part
+type head struct {
+	name string
+}
+
+func init() {
+	honeyos.RegisterCommand("head", head{"head"})
+	honeyos.RegisterCommand("tail", head{"tail"})
+}
+
+func (h head) GetHelp() string {
+	if h.name == "tail" {
+		return `Usage: tail [OPTION]... [FILE]...
+Print the last 10 lines of each FILE to standard output.
+With more than one FILE, precede each with a header giving the file name.
+
+With no FILE, or when FILE is -, read standard input.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -c, --bytes=[+]NUM       output the last NUM bytes; or use -c +NUM to
+                             output starting with byte NUM of each file
+  -f, --follow[={name|descriptor}]
+                           output appended data as the file grows;
+                             an absent option argument means 'descriptor'
+  -F                       same as --follow=name --retry
+  -n, --lines=[+]NUM       output the last NUM lines, instead of the last 10;
+                             or use -n +NUM to output starting with line NUM
+  -q, --quiet, --silent    never output headers giving file names
+  -s, --sleep-interval=N   with -f, sleep for approximately N seconds
+                             (default 1.0) between iterations
+  -v, --verbose            always output headers giving file names
+      --help     display this help and exit
+      --version  output version information and exit
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/tail>
+or available locally via: info '(coreutils) tail invocation'
+`
+	}
+	return `Usage: head [OPTION]... [FILE]...
+Print the first 10 lines of each FILE to standard output.
+With more than one FILE, precede each with a header giving the file name.
+
+With no FILE, or when FILE is -, read standard input.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -c, --bytes=[-]NUM       print the first NUM bytes of each file;
+                             with the leading '-', print all but the last
+                             NUM bytes of each file
+  -n, --lines=[-]NUM       print the first NUM lines instead of the first 10;
+                             with the leading '-', print all but the last
+                             NUM lines of each file
+  -q, --quiet, --silent    never print headers giving file names
+  -v, --verbose            always print headers giving file names
+  -z, --zero-terminated    line delimiter is NUL, not newline
+      --help     display this help and exit
+      --version  output version information and exit
+
+NUM may have a multiplier suffix:
+b 512, kB 1000, K 1024, MB 1000*1000, M 1024*1024,
+GB 1000*1000*1000, G 1024*1024*1024, and so on for T, P, E, Z, Y.
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/head>
+or available locally via: info '(coreutils) head invocation'
+`
+}
+
+func (h head) Exec(args []string, sys honeyos.Sys) int {
+	// The obsolete forms -5 and +5 are turned into -n
+	if len(args) > 0 && len(args[0]) > 1 && (args[0][0] == '-' || h.name == "tail" && args[0][0] == '+') &&
+		strings.Trim(args[0][1:], "0123456789") == "" {
+		num := args[0][1:]
+		if args[0][0] == '+' {
+			num = "+" + num
+		}
+		args = append([]string{"-n", num}, args[1:]...)
+	}
+	opts, operands, err := getopt(args, optionSpec{
+		short: "c:n:qvzfFs:",
+		long: map[string]string{
+			"bytes=": "c", "lines=": "n", "quiet": "q", "silent": "q", "verbose": "v",
+			"zero-terminated": "z", "follow?": "f", "sleep-interval=": "s", "retry": "retry",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, h.name, err)
+	}
+	count, bytesMode, fromStart, allBut := 10, false, false, false
+	var headers *bool
+	for _, opt := range opts {
+		switch opt.name {
+		case "c", "n":
+			v := opt.value
+			fromStart, allBut = false, false
+			switch {
+			case h.name == "tail" && strings.HasPrefix(v, "+"):
+				fromStart, v = true, v[1:]
+			case h.name == "head" && strings.HasPrefix(v, "-"):
+				allBut, v = true, v[1:]
+			}
+			n, ok := parseSize(strings.TrimPrefix(v, "-"))
+			if !ok {
+				kind := "lines"
+				if opt.name == "c" {
+					kind = "bytes"
+				}
+				fmt.Fprintf(sys.Err(), "%v: invalid number of %v: %v\n", h.name, kind, quote(opt.value))
+				return 1
+			}
+			count, bytesMode = n, opt.name == "c"
+		case "q":
+			show := false
+			headers = &show
+		case "v":
+			show := true
+			headers = &show
+		case "help":
+			fmt.Fprint(sys.Out(), h.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion(h.name, "David MacKenzie and Jim Meyering"))
+			return 0
+		}
+	}
+	if len(operands) == 0 {
+		operands = []string{"-"}
+	}
+	if headers == nil {
+		show := len(operands) > 1
+		headers = &show
+	}
+	status := 0
+	first := true
+	for _, name := range operands {
+		f, err := openInput(sys, name)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "%v: cannot open %v for reading: %v\n", h.name, quote(name), honeyos.ErrnoString(err))
+			status = 1
+			continue
+		}
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		if *headers {
+			label := name
+			if name == "-" {
+				label = "standard input"
+			}
+			if !first {
+				fmt.Fprintln(sys.Out())
+			}
+			fmt.Fprintf(sys.Out(), "==> %v <==\n", label)
+		}
+		first = false
+		sys.Out().Write(h.part(content, count, bytesMode, fromStart, allBut))
+	}
+	return status
+}
+
+// part returns the part of the content that head or tail prints
+func (h head) part(content []byte, count int, bytesMode, fromStart, allBut bool) []byte {
+	if bytesMode {
+		switch {
+		case h.name == "head" && allBut:
+			return content[:maxInt(len(content)-count, 0)]
+		case h.name == "head":
+			return content[:minInt(count, len(content))]
+		case fromStart:
+			return content[minInt(maxInt(count-1, 0), len(content)):]
+		}
+		return content[maxInt(len(content)-count, 0):]
+	}
+	lines := bytes.SplitAfter(content, []byte{'\n'})
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	switch {
+	case h.name == "head" && allBut:
+		lines = lines[:maxInt(len(lines)-count, 0)]
+	case h.name == "head":
+		lines = lines[:minInt(count, len(lines))]
+	case fromStart:
+		lines = lines[minInt(maxInt(count-1, 0), len(lines)):]
+	default:
+		lines = lines[maxInt(len(lines)-count, 0):]
+	}
+	return bytes.Join(lines, nil)
+}
+
+func (h head) Where() string {
+	return "/usr/bin/" + h.name
+}
+
+// parseSize parses the number of lines or bytes with the multiplier
+// suffix of coreutils
+func parseSize(s string) (int, bool) {
+	multipliers := []struct {
+		suffix string
+		n      int
+	}{
+		{"kB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+		{"b", 512}, {"K", 1024}, {"M", 1024 * 1024}, {"G", 1024 * 1024 * 1024},
+	}
+	mult := 1
+	for _, m := range multipliers {
+		if strings.HasSuffix(s, m.suffix) {
+			s, mult = strings.TrimSuffix(s, m.suffix), m.n
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n * mult, true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
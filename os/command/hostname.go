@@ -0,0 +1,51 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mkishere/sshsyrup/os"
+	"github.com/spf13/pflag"
+)
+
+type hostname struct{}
+
+func init() {
+	os.RegisterCommand("hostname", hostname{})
+}
+
+func (hostname) GetHelp() string {
+	return ""
+}
+
+func (hostname) Exec(args []string, sys os.Sys) int {
+	flag := pflag.NewFlagSet("arg", pflag.ContinueOnError)
+	flag.SetOutput(sys.Err())
+	short := flag.BoolP("short", "s", false, "short host name")
+	flag.BoolP("fqdn", "f", false, "long host name (FQDN)")
+	ip := flag.BoolP("ip-address", "i", false, "addresses for the host name")
+	if err := flag.Parse(args); err != nil {
+		return 1
+	}
+	if flag.NArg() > 0 {
+		if sys.CurrentUser() != 0 {
+			fmt.Fprintln(sys.Err(), "hostname: you must be root to change the host name")
+			return 1
+		}
+		sys.SetHostname(flag.Arg(0))
+		return 0
+	}
+	switch {
+	case *ip:
+		fmt.Fprintln(sys.Out(), "127.0.1.1")
+	case *short:
+		fmt.Fprintln(sys.Out(), strings.SplitN(sys.Hostname(), ".", 2)[0])
+	default:
+		fmt.Fprintln(sys.Out(), sys.Hostname())
+	}
+	return 0
+}
+
+func (hostname) Where() string {
+	return "/bin/hostname"
+}
@@ -27,5 +27,5 @@ func (i id) Exec(args []string, sys os.Sys) int {
 }
 
 func (i id) Where() string {
-	return "/bin/uname"
+	return "/usr/bin/id"
 }
@@ -0,0 +1,292 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type kill struct{}
+
+type killall struct{}
+
+func init() {
+	honeyos.RegisterCommand("kill", kill{})
+	honeyos.RegisterCommand("killall", killall{})
+}
+
+// signalNames are the names of the signals in the order of their numbers
+var signalNames = []string{
+	"HUP", "INT", "QUIT", "ILL", "TRAP", "ABRT", "BUS", "FPE", "KILL", "USR1", "SEGV", "USR2",
+	"PIPE", "ALRM", "TERM", "STKFLT", "CHLD", "CONT", "STOP", "TSTP", "TTIN", "TTOU", "URG",
+	"XCPU", "XFSZ", "VTALRM", "PROF", "WINCH", "POLL", "PWR", "SYS",
+}
+
+// parseSignal converts the signal name or number given in command line
+func parseSignal(s string) (syscall.Signal, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 64 {
+			return 0, false
+		}
+		return syscall.Signal(n), true
+	}
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	for i, sig := range signalNames {
+		if sig == name {
+			return syscall.Signal(i + 1), true
+		}
+	}
+	switch name {
+	case "IOT":
+		return syscall.SIGABRT, true
+	case "IO":
+		return syscall.SIGIO, true
+	case "CLD":
+		return syscall.SIGCHLD, true
+	}
+	return 0, false
+}
+
+func (k kill) GetHelp() string {
+	return `
+Usage:
+ kill [options] <pid> [...]
+
+Options:
+ <pid> [...]            send signal to every <pid> listed
+ -<signal>, -s, --signal <signal>
+                        specify the <signal> to be sent
+ -l, --list=[<signal>]  list all signal names, or convert one to a name
+ -L, --table            list all signal names in a nice table
+
+ -h, --help     display this help and exit
+ -V, --version  output version information and exit
+
+For more details see kill(1).
+`
+}
+
+func (k kill) Exec(args []string, sys honeyos.Sys) int {
+	sig := syscall.SIGTERM
+	// Only the first option is the signal, -1 after it is a PID
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		arg := args[0]
+		args = args[1:]
+		switch arg {
+		case "--":
+		case "-l", "--list", "-L", "--table":
+			if len(args) > 0 {
+				s, ok := parseSignal(args[0])
+				if !ok || s == 0 || int(s) > len(signalNames) {
+					fmt.Fprintf(sys.Err(), "kill: unknown signal: %v\n", args[0])
+					return 1
+				}
+				if _, err := strconv.Atoi(args[0]); err == nil {
+					fmt.Fprintln(sys.Out(), signalNames[s-1])
+				} else {
+					fmt.Fprintln(sys.Out(), int(s))
+				}
+				return 0
+			}
+			fmt.Fprintln(sys.Out(), strings.Join(signalNames[:16], " "))
+			fmt.Fprintln(sys.Out(), strings.Join(signalNames[16:], " "))
+			return 0
+		case "-h", "--help":
+			fmt.Fprint(sys.Out(), k.GetHelp())
+			return 0
+		case "-V", "--version":
+			fmt.Fprintln(sys.Out(), "kill from procps-ng 3.3.10")
+			return 0
+		default:
+			if arg == "-s" || arg == "--signal" || arg == "-n" {
+				if len(args) == 0 {
+					fmt.Fprint(sys.Err(), k.GetHelp())
+					return 1
+				}
+				arg, args = "-"+args[0], args[1:]
+			}
+			s, ok := parseSignal(arg[1:])
+			if !ok {
+				fmt.Fprintf(sys.Err(), "kill: unknown signal: %v\n", arg[1:])
+				return 1
+			}
+			sig = s
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprint(sys.Err(), k.GetHelp())
+		return 1
+	}
+	status := 0
+	for _, arg := range args {
+		pid, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "kill: failed to parse argument: '%v'\n", arg)
+			status = 1
+			continue
+		}
+		if err := signalProcess(sys, pid, sig); err != nil {
+			fmt.Fprintf(sys.Err(), "kill: (%d): %v\n", pid, errorString(err))
+			status = 1
+		}
+	}
+	return status
+}
+
+func (k kill) Where() string {
+	return "/bin/kill"
+}
+
+// signalProcess sends the signal to the process. PID -1 means all the
+// processes the user can signal, and other negative PIDs are process groups
+func signalProcess(sys honeyos.Sys, pid int, sig syscall.Signal) error {
+	procs := sys.Processes()
+	if pid != -1 {
+		if pid < 0 {
+			pid = -pid
+		}
+		return procs.Signal(pid, sys.CurrentUser(), sig)
+	}
+	for _, p := range procs.List() {
+		if p.PID != sys.Getpid() {
+			procs.Signal(p.PID, sys.CurrentUser(), sig)
+		}
+	}
+	return nil
+}
+
+// errorString returns the message of the error like strerror
+func errorString(err error) string {
+	switch err {
+	case syscall.ESRCH:
+		return "No such process"
+	case syscall.EPERM:
+		return "Operation not permitted"
+	}
+	return err.Error()
+}
+
+func (k killall) GetHelp() string {
+	return `Usage: killall [-Z CONTEXT] [-u USER] [ -eIgiqrvw ] [ -SIGNAL ] NAME...
+       killall -l, --list
+       killall -V, --version
+
+  -e,--exact          require exact match for very long names
+  -I,--ignore-case    case insensitive process name match
+  -g,--process-group  kill process group instead of process
+  -y,--younger-than   kill processes younger than TIME
+  -o,--older-than     kill processes older than TIME
+  -i,--interactive    ask for confirmation before killing
+  -l,--list           list all known signal names
+  -q,--quiet          don't print complaints
+  -r,--regexp         interpret NAME as an extended regular expression
+  -s,--signal SIGNAL  send this signal instead of SIGTERM
+  -u,--user USER      kill only process(es) running as USER
+  -v,--verbose        report if the signal was successfully sent
+  -V,--version        display version information
+  -w,--wait           wait for processes to die
+  -Z,--context REGEXP kill only process(es) having context
+                      (must precede other arguments)
+
+`
+}
+
+func (k killall) Exec(args []string, sys honeyos.Sys) int {
+	sig := syscall.SIGTERM
+	quiet, verbose, ignoreCase := false, false, false
+	user := -1
+	var names []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-l" || arg == "--list":
+			fmt.Fprintln(sys.Out(), strings.Join(signalNames[:16], " "))
+			fmt.Fprintln(sys.Out(), strings.Join(signalNames[16:], " "))
+			return 0
+		case arg == "-V" || arg == "--version":
+			fmt.Fprintln(sys.Err(), "killall (PSmisc) 22.21")
+			return 0
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "-v" || arg == "--verbose":
+			verbose = true
+		case arg == "-I" || arg == "--ignore-case":
+			ignoreCase = true
+		case arg == "-u" || arg == "--user":
+			if i+1 >= len(args) {
+				fmt.Fprint(sys.Err(), k.GetHelp())
+				return 1
+			}
+			i++
+			u := honeyos.GetUser(args[i])
+			if len(u.Name) == 0 {
+				fmt.Fprintf(sys.Err(), "Cannot find user %v\n", args[i])
+				return 1
+			}
+			user = u.UID
+		case arg == "-s" || arg == "--signal":
+			if i+1 >= len(args) {
+				fmt.Fprint(sys.Err(), k.GetHelp())
+				return 1
+			}
+			i++
+			arg = "-" + args[i]
+			fallthrough
+		case strings.HasPrefix(arg, "-") && len(arg) > 1 && !strings.HasPrefix(arg, "--"):
+			s, ok := parseSignal(arg[1:])
+			if !ok {
+				if strings.Trim(arg[1:], "eIgiqrvwZ") == "" {
+					continue
+				}
+				fmt.Fprintf(sys.Err(), "%v: unknown signal; killall -l lists signals.\n", arg[1:])
+				return 1
+			}
+			sig = s
+		case strings.HasPrefix(arg, "--"):
+		default:
+			names = append(names, arg)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprint(sys.Err(), k.GetHelp())
+		return 1
+	}
+	status := 0
+	for _, name := range names {
+		found := false
+		for _, p := range sys.Processes().List() {
+			match := p.Name == name
+			if ignoreCase {
+				match = strings.EqualFold(p.Name, name)
+			}
+			if !match || p.PID == sys.Getpid() || user >= 0 && p.UID != user {
+				continue
+			}
+			found = true
+			err := sys.Processes().Signal(p.PID, sys.CurrentUser(), sig)
+			switch {
+			case err != nil && !quiet:
+				fmt.Fprintf(sys.Err(), "%v(%d): %v\n", name, p.PID, errorString(err))
+			case err == nil && verbose:
+				fmt.Fprintf(sys.Err(), "Killed %v(%d) with signal %d\n", name, p.PID, int(sig))
+			}
+		}
+		if !found {
+			if !quiet {
+				fmt.Fprintf(sys.Err(), "%v: no process found\n", name)
+			}
+			status = 1
+		}
+	}
+	return status
+}
+
+func (k killall) Where() string {
+	return "/usr/bin/killall"
+}
@@ -0,0 +1,169 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+)
+
+type ln struct{}
+
+func init() {
+	honeyos.RegisterCommand("ln", ln{})
+}
+
+func (ln) GetHelp() string {
+	return `Usage: ln [OPTION]... [-T] TARGET LINK_NAME   (1st form)
+  or:  ln [OPTION]... TARGET                  (2nd form)
+  or:  ln [OPTION]... TARGET... DIRECTORY     (3rd form)
+  or:  ln [OPTION]... -t DIRECTORY TARGET...  (4th form)
+In the 1st form, create a link to TARGET with the name LINK_NAME.
+In the 2nd form, create a link to TARGET in the current directory.
+In the 3rd and 4th forms, create links to each TARGET in DIRECTORY.
+Create hard links by default, symbolic links with --symbolic.
+By default, each destination (name of new link) should not already exist.
+When creating hard links, each TARGET must exist.  Symbolic links
+can hold arbitrary text; if later resolved, a relative link is
+interpreted in relation to its parent directory.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -f, --force                 remove existing destination files
+  -i, --interactive           prompt whether to remove destinations
+  -n, --no-dereference        treat LINK_NAME as a normal file if
+                                it is a symbolic link to a directory
+  -s, --symbolic              make symbolic links instead of hard links
+  -t, --target-directory=DIRECTORY  specify the DIRECTORY in which to create
+                                the links
+  -T, --no-target-directory   treat LINK_NAME as a normal file always
+  -v, --verbose               print name of each linked file
+      --help     display this help and exit
+      --version  output version information and exit
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/ln>
+or available locally via: info '(coreutils) ln invocation'
+`
+}
+
+func (l ln) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "finst:Tv",
+		long: map[string]string{
+			"force": "f", "interactive": "i", "no-dereference": "n", "symbolic": "s",
+			"target-directory=": "t", "no-target-directory": "T", "verbose": "v",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "ln", err)
+	}
+	force, interactive, symbolic, verbose := false, false, false, false
+	target, noTarget := "", false
+	for _, opt := range opts {
+		switch opt.name {
+		case "f":
+			force, interactive = true, false
+		case "i":
+			force, interactive = false, true
+		case "s":
+			symbolic = true
+		case "t":
+			target = opt.value
+		case "T":
+			noTarget = true
+		case "v":
+			verbose = true
+		case "help":
+			fmt.Fprint(sys.Out(), l.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("ln", "Mike Parker and David MacKenzie"))
+			return 0
+		}
+	}
+	if len(operands) == 1 && len(target) == 0 && !noTarget {
+		operands = append(operands, ".")
+	}
+	sources, dest, ok := targetOperands(sys, "ln", operands, target, noTarget)
+	if !ok {
+		return 1
+	}
+	fs := sys.FSys()
+	kind := "hard link"
+	if symbolic {
+		kind = "symbolic link"
+	}
+	status := 0
+	for _, src := range sources {
+		linkName := dest
+		if len(target) > 0 || !noTarget && isDir(fs, fullPath(sys, dest)) {
+			linkName = path.Join(dest, path.Base(src))
+		}
+		link := fullPath(sys, linkName)
+		// Symbolic links keep the target as given, hard links need it to exist
+		var fi os.FileInfo
+		if !symbolic {
+			if fi, err = fs.Stat(fullPath(sys, src)); err != nil {
+				fmt.Fprintf(sys.Err(), "ln: failed to access %v: %v\n", quote(src), honeyos.ErrnoString(err))
+				status = 1
+				continue
+			}
+			if fi.IsDir() {
+				fmt.Fprintf(sys.Err(), "ln: %v: hard link not allowed for directory\n", quote(src))
+				status = 1
+				continue
+			}
+		}
+		if dfi, err := fs.Stat(link); err == nil {
+			switch {
+			case !symbolic && fullPath(sys, src) == link:
+				fmt.Fprintf(sys.Err(), "ln: %v and %v are the same file\n", quote(src), quote(linkName))
+				status = 1
+				continue
+			case interactive && !confirm(sys, fmt.Sprintf("ln: replace %v? ", quote(linkName))):
+				continue
+			case !force && !interactive || dfi.IsDir():
+				fmt.Fprintf(sys.Err(), "ln: failed to create %v %v: File exists\n", kind, quote(linkName))
+				status = 1
+				continue
+			}
+			if err := removeFile(fs, link); err != nil {
+				fmt.Fprintf(sys.Err(), "ln: cannot remove %v: %v\n", quote(linkName), honeyos.ErrnoString(err))
+				status = 1
+				continue
+			}
+			sys.FsEvent("remove", link, log.Fields{"cmd": "ln"})
+		}
+		if symbolic {
+			err = honeyos.Symlink(fs, src, link)
+		} else {
+			// Hard links cannot be told apart from a copy of the file
+			cpy := copier{sys: sys, cmd: "ln", preserve: true}
+			_, err = cpy.copyFile(fullPath(sys, src), link, fi.Mode())
+		}
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "ln: failed to create %v %v: %v\n", kind, quote(linkName), honeyos.ErrnoString(err))
+			status = 1
+			continue
+		}
+		if symbolic {
+			sys.FsEvent("symlink", link, log.Fields{"cmd": "ln", "target": src})
+			if verbose {
+				fmt.Fprintf(sys.Out(), "%v -> %v\n", quote(linkName), quote(src))
+			}
+		} else {
+			sys.FsEvent("link", link, log.Fields{"cmd": "ln", "target": fullPath(sys, src)})
+			if verbose {
+				fmt.Fprintf(sys.Out(), "%v => %v\n", quote(linkName), quote(src))
+			}
+		}
+	}
+	return status
+}
+
+func (ln) Where() string {
+	return "/bin/ln"
+}
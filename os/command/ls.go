@@ -1,25 +1,108 @@
 package command
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	honeyos "github.com/mkishere/sshsyrup/os"
 	"github.com/mkishere/sshsyrup/virtualfs"
-	"github.com/spf13/pflag"
+	"github.com/spf13/afero"
 )
 
 type ls struct{}
-type lsFileInfoSort []os.FileInfo
+
+// lsOptions are the options given to ls
+type lsOptions struct {
+	all, almostAll, dirOnly, human, si, long, recursive, reverse bool
+	sortBy                                                       byte
+	showOwner, showGroup, numeric, dirsFirst, color              bool
+	format                                                       byte
+	indicator                                                    byte
+}
+
+// lsEntry is a file to be listed, with the target of symbolic links
+// resolved for the long format and colors
+type lsEntry struct {
+	name     string
+	path     string
+	fi       os.FileInfo
+	target   string
+	tfi      os.FileInfo
+	resolved string
+}
+
+// lsColors are the default colors of dircolors on Ubuntu
+var lsColors = map[string]string{
+	"dir": "01;34", "link": "01;36", "orphan": "40;31;01", "exec": "01;32",
+	"setuid": "37;41", "setgid": "30;43", "sticky": "37;44", "otherWritable": "34;42",
+	"stickyOtherWritable": "30;42", "fifo": "40;33", "socket": "01;35", "device": "40;33;01",
+}
 
 func init() {
 	honeyos.RegisterCommand("ls", ls{})
 }
 
 func (cmd ls) GetHelp() string {
-	return ""
+	return `Usage: ls [OPTION]... [FILE]...
+List information about the FILEs (the current directory by default).
+Sort entries alphabetically if none of -cftuvSUX nor --sort is specified.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -a, --all                  do not ignore entries starting with .
+  -A, --almost-all           do not list implied . and ..
+  -C                         list entries by columns
+      --color[=WHEN]         colorize the output; WHEN can be 'always' (default
+                               if omitted), 'auto', or 'never'; more info below
+  -d, --directory            list directories themselves, not their contents
+  -f                         do not sort, enable -aU, disable -ls --color
+  -F, --classify             append indicator (one of */=>@|) to entries
+  -g                         like -l, but do not list owner
+      --group-directories-first
+                             group directories before files;
+                               can be augmented with a --sort option, but any
+                               use of --sort=none (-U) disables grouping
+  -G, --no-group             in a long listing, don't print group names
+  -h, --human-readable       with -l and/or -s, print human readable sizes
+                               (e.g., 1K 234M 2G)
+      --si                   likewise, but use powers of 1000 not 1024
+  -l                         use a long listing format
+  -n, --numeric-uid-gid      like -l, but list numeric user and group IDs
+  -o                         like -l, but do not list group information
+  -p, --indicator-style=slash
+                             append / indicator to directories
+  -r, --reverse              reverse order while sorting
+  -R, --recursive            list subdirectories recursively
+  -S                         sort by file size, largest first
+  -t                         sort by modification time, newest first
+  -U                         do not sort; list entries in directory order
+  -1                         list one file per line.  Avoid '\n' with -q or -b
+      --help     display this help and exit
+      --version  output version information and exit
+
+The SIZE argument is an integer and optional unit (example: 10K is 10*1024).
+Units are K,M,G,T,P,E,Z,Y (powers of 1024) or KB,MB,... (powers of 1000).
+
+Using color to distinguish file types is disabled both by default and
+with --color=never.  With --color=auto, ls emits color codes only when
+standard output is connected to a terminal.  The LS_COLORS environment
+variable can change the settings.  Use the dircolors command to set it.
+
+Exit status:
+ 0  if OK,
+ 1  if minor problems (e.g., cannot access subdirectory),
+ 2  if serious trouble (e.g., cannot access command-line argument).
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/ls>
+or available locally via: info '(coreutils) ls invocation'
+`
 }
 
 func (cmd ls) Where() string {
@@ -27,78 +110,588 @@ func (cmd ls) Where() string {
 }
 
 func (cmd ls) Exec(args []string, sys honeyos.Sys) int {
-	flag := pflag.NewFlagSet("arg", pflag.PanicOnError)
-	flag.SetOutput(sys.Out())
-	lMode := flag.BoolP("", "l", false, "use a long listing format")
-	err := flag.Parse(args)
-	f := flag.Args()
-	var path string
-	if len(f) > 0 {
-		path = f[len(f)-1]
+	opts, operands, err := getopt(args, optionSpec{
+		short: "aACdfFgGhlnopRrStU1",
+		long: map[string]string{
+			"all": "a", "almost-all": "A", "color?": "color", "colour?": "color", "directory": "d",
+			"classify": "F", "group-directories-first": "group-directories-first", "no-group": "G",
+			"human-readable": "h", "si": "si", "numeric-uid-gid": "n", "indicator-style=": "indicator-style",
+			"reverse": "r", "recursive": "R", "help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "ls", err)
+	}
+	o := lsOptions{showOwner: true, showGroup: true}
+	if honeyos.IsTerminal(sys.Out()) {
+		o.format = 'C'
 	} else {
-		path = sys.Getcwd()
+		o.format = '1'
+	}
+	for _, opt := range opts {
+		switch opt.name {
+		case "a":
+			o.all = true
+		case "A":
+			o.almostAll = true
+		case "C", "1":
+			o.format, o.long = opt.name[0], false
+		case "color":
+			switch opt.value {
+			case "", "always", "yes", "force":
+				o.color = true
+			case "auto", "tty", "if-tty":
+				o.color = honeyos.IsTerminal(sys.Out())
+			case "never", "no", "none":
+				o.color = false
+			default:
+				fmt.Fprintf(sys.Err(), "ls: invalid argument %v for '--color'\n", quote(opt.value))
+				fmt.Fprintln(sys.Err(), "Valid arguments are:\n  - 'always', 'yes', 'force'\n  - 'never', 'no', 'none'\n  - 'auto', 'tty', 'if-tty'")
+				fmt.Fprintln(sys.Err(), "Try 'ls --help' for more information.")
+				return 2
+			}
+		case "d":
+			o.dirOnly = true
+		case "f":
+			o.all, o.sortBy, o.color, o.long = true, 'U', false, false
+		case "F":
+			o.indicator = 'F'
+		case "p":
+			o.indicator = 'p'
+		case "indicator-style":
+			switch opt.value {
+			case "none":
+				o.indicator = 0
+			case "slash":
+				o.indicator = 'p'
+			case "classify":
+				o.indicator = 'F'
+			}
+		case "g":
+			o.long, o.showOwner = true, false
+		case "G":
+			o.showGroup = false
+		case "o":
+			o.long, o.showGroup = true, false
+		case "n":
+			o.long, o.numeric = true, true
+		case "h":
+			o.human = true
+		case "si":
+			o.human, o.si = true, true
+		case "l":
+			o.long = true
+		case "r":
+			o.reverse = true
+		case "R":
+			o.recursive = true
+		case "S", "t", "U":
+			o.sortBy = opt.name[0]
+		case "group-directories-first":
+			o.dirsFirst = true
+		case "help":
+			fmt.Fprint(sys.Out(), cmd.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("ls", "Richard M. Stallman and David MacKenzie"))
+			return 0
+		}
+	}
+	if len(operands) == 0 {
+		operands = []string{"."}
 	}
 
-	dir, err := sys.FSys().Open(path)
+	status := 0
+	var files, dirs []lsEntry
+	for _, name := range operands {
+		e, err := lsStat(sys, name, fullPath(sys, name))
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "ls: cannot access %v: %v\n", quote(name), honeyos.ErrnoString(err))
+			status = 2
+			continue
+		}
+		// Symbolic links given in command line are followed unless they are
+		// listed themselves
+		isDir := e.fi.IsDir() || !o.long && o.indicator != 'F' && e.tfi != nil && e.tfi.IsDir()
+		if isDir && !o.dirOnly {
+			if !e.fi.IsDir() {
+				e.path = e.resolved
+			}
+			dirs = append(dirs, e)
+		} else {
+			files = append(files, e)
+		}
+	}
+	o.sort(files)
+	o.sort(dirs)
+
+	var out bytes.Buffer
+	w := &lsWriter{buf: &out, fs: sys.FSys(), opts: o, width: sys.Width()}
+	if len(files) > 0 {
+		w.list(files)
+	}
+	showHeader := len(operands) > 1 || o.recursive
+	for _, d := range dirs {
+		if s := w.listDir(sys, d, showHeader, out.Len() > 0); s > status {
+			status = s
+		}
+	}
+	if w.colored {
+		out.WriteString("\x1b[m")
+	}
+	sys.Out().Write(out.Bytes())
+	return status
+}
+
+// lsStat returns the entry of the file, with symbolic links resolved
+func lsStat(sys honeyos.Sys, name, p string) (lsEntry, error) {
+	fi, err := sys.FSys().Stat(p)
 	if err != nil {
-		fmt.Fprintf(sys.Out(), "ls: cannot access %v: No such file or directory\n", path)
-		return 1
+		return lsEntry{}, err
 	}
-	if *lMode {
-		dir, err := dir.Readdir(-1)
-		sortDir := lsFileInfoSort(dir)
+	e := lsEntry{name: name, path: p, fi: fi}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		e.target, _ = honeyos.Readlink(sys.FSys(), p)
+		e.tfi, e.resolved, _ = statFollow(sys, p)
+	}
+	return e, nil
+}
+
+// statFollow returns the file info and the path of the file, following
+// symbolic links
+func statFollow(sys honeyos.Sys, p string) (os.FileInfo, string, error) {
+	for i := 0; i < 40; i++ {
+		fi, err := sys.FSys().Stat(p)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			return fi, p, err
+		}
+		target, err := honeyos.Readlink(sys.FSys(), p)
 		if err != nil {
-			fmt.Fprintf(sys.Out(), "ls: cannot access %v: No such file or directory\n", path)
-			return 1
+			return nil, p, err
 		}
-		sort.Sort(sortDir)
-		for _, dir := range sortDir {
-			fmt.Fprintln(sys.Out(), getLsString(dir))
+		if len(target) == 0 {
+			return nil, p, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
 		}
-	} else {
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+		p = target
+	}
+	return nil, p, &os.PathError{Op: "stat", Path: p, Err: syscall.ELOOP}
+}
+
+// sort sorts the entries in the order given by the options
+func (o lsOptions) sort(entries []lsEntry) {
+	if o.sortBy == 'U' {
+		return
+	}
+	less := func(a, b lsEntry) bool {
+		switch o.sortBy {
+		case 't':
+			if !a.fi.ModTime().Equal(b.fi.ModTime()) {
+				return a.fi.ModTime().After(b.fi.ModTime())
+			}
+		case 'S':
+			if lsSize(a) != lsSize(b) {
+				return lsSize(a) > lsSize(b)
+			}
+		}
+		return a.name < b.name
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if o.dirsFirst && entries[i].isDir() != entries[j].isDir() {
+			return entries[i].isDir()
+		}
+		if o.reverse {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+}
+
+func (e lsEntry) isDir() bool {
+	return e.fi.IsDir() || e.tfi != nil && e.tfi.IsDir()
+}
 
-		// Sort directory list
-		dirName, err := dir.Readdirnames(-1)
+// lsSize returns the size shown in the long format
+func lsSize(e lsEntry) int64 {
+	switch {
+	case e.fi.IsDir():
+		return 4096
+	case e.fi.Mode()&os.ModeSymlink != 0:
+		return int64(len(e.target))
+	}
+	return e.fi.Size()
+}
+
+// lsWriter formats the listing into the buffer
+type lsWriter struct {
+	buf     *bytes.Buffer
+	fs      afero.Fs
+	opts    lsOptions
+	width   int
+	colored bool
+}
+
+// listDir lists the content of the directory, and those of subdirectories
+// with -R
+func (w *lsWriter) listDir(sys honeyos.Sys, d lsEntry, header, blank bool) int {
+	if blank {
+		w.buf.WriteString("\n")
+	}
+	if header {
+		fmt.Fprintf(w.buf, "%v:\n", d.name)
+	}
+	dir, err := sys.FSys().Open(d.path)
+	var names []string
+	if err == nil {
+		names, err = dir.Readdirnames(-1)
+		dir.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "ls: cannot open directory %v: %v\n", quote(d.name), honeyos.ErrnoString(err))
+		return 2
+	}
+	var entries []lsEntry
+	if w.opts.all {
+		names = append(names, ".", "..")
+	}
+	status := 0
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") && !w.opts.all && !w.opts.almostAll {
+			continue
+		}
+		p := path.Join(d.path, name)
+		if name == "." || name == ".." {
+			p = path.Clean(d.path + "/" + name)
+		}
+		e, err := lsStat(sys, name, p)
 		if err != nil {
-			fmt.Fprintf(sys.Out(), "ls: cannot access %v: No such file or directory\n", path)
-			return 1
+			fmt.Fprintf(sys.Err(), "ls: cannot access %v: %v\n", quote(path.Join(d.name, name)), honeyos.ErrnoString(err))
+			status = 1
+			continue
+		}
+		entries = append(entries, e)
+	}
+	w.opts.sort(entries)
+	if w.opts.long {
+		var blocks int64
+		for _, e := range entries {
+			blocks += lsBlocks(e)
+		}
+		if w.opts.human {
+			fmt.Fprintf(w.buf, "total %v\n", humanSize(blocks*1024, w.opts.si))
+		} else {
+			fmt.Fprintf(w.buf, "total %v\n", blocks)
 		}
-		maxlen := 0
-		for _, d := range dirName {
-			if len(d) > maxlen {
-				maxlen = len(d)
+	}
+	w.list(entries)
+	if !w.opts.recursive {
+		return status
+	}
+	for _, e := range entries {
+		if !e.fi.IsDir() || e.name == "." || e.name == ".." {
+			continue
+		}
+		sub := e
+		sub.name = path.Join(d.name, e.name)
+		if d.name == "/" || strings.HasSuffix(d.name, "/") {
+			sub.name = d.name + e.name
+		}
+		if s := w.listDir(sys, sub, true, true); s > status {
+			status = s
+		}
+	}
+	return status
+}
+
+// lsBlocks returns the disk usage of the file in 1K blocks, as the image
+// keeps no block counts
+func lsBlocks(e lsEntry) int64 {
+	if e.fi.IsDir() {
+		return 4
+	}
+	if e.fi.Mode()&os.ModeSymlink != 0 {
+		return 0
+	}
+	return (e.fi.Size() + 4095) / 4096 * 4
+}
+
+// list writes the entries in the format given by the options
+func (w *lsWriter) list(entries []lsEntry) {
+	switch {
+	case len(entries) == 0:
+	case w.opts.long:
+		w.long(entries)
+	case w.opts.format == 'C':
+		w.columns(entries)
+	default:
+		for _, e := range entries {
+			w.buf.WriteString(w.name(e))
+			w.buf.WriteString("\n")
+		}
+	}
+}
+
+// long writes the entries in the long format, with the columns aligned
+func (w *lsWriter) long(entries []lsEntry) {
+	rows := make([][]string, len(entries))
+	var widths [4]int
+	for i, e := range entries {
+		uid, gid, _, _ := virtualfs.GetExtraInfo(e.fi)
+		owner, group := strconv.Itoa(uid), strconv.Itoa(gid)
+		if !w.opts.numeric {
+			if u := honeyos.GetUserByID(uid).Name; len(u) > 0 {
+				owner = u
+			}
+			if g := honeyos.GetGroupByID(gid).Name; len(g) > 0 {
+				group = g
 			}
 		}
-		sort.Strings(dirName)
+		size := strconv.FormatInt(lsSize(e), 10)
+		if w.opts.human {
+			size = humanSize(lsSize(e), w.opts.si)
+		}
+		// Devices show their numbers in place of the size
+		if info, ok := e.fi.Sys().(virtualfs.ZipExtraInfo); ok && e.fi.Mode()&os.ModeDevice != 0 {
+			major, minor := info.Rdev()
+			size = fmt.Sprintf("%d, %3d", major, minor)
+		}
+		rows[i] = []string{strconv.Itoa(w.links(e)), owner, group, size}
+		for j, col := range rows[i] {
+			widths[j] = maxInt(widths[j], len(col))
+		}
+	}
+	now := time.Now()
+	for i, e := range entries {
+		row := rows[i]
+		fmt.Fprintf(w.buf, "%v%v %*v ", lsType(e.fi.Mode()), modeString(unixMode(e.fi.Mode())), widths[0], row[0])
+		if w.opts.showOwner {
+			fmt.Fprintf(w.buf, "%-*v ", widths[1], row[1])
+		}
+		if w.opts.showGroup {
+			fmt.Fprintf(w.buf, "%-*v ", widths[2], row[2])
+		}
+		mtime := e.fi.ModTime()
+		layout := "Jan _2 15:04"
+		if mtime.After(now) || now.Sub(mtime) > 6*30*24*time.Hour {
+			layout = "Jan _2  2006"
+		}
+		fmt.Fprintf(w.buf, "%*v %v %v", widths[3], row[3], mtime.Format(layout), w.name(e))
+		if e.fi.Mode()&os.ModeSymlink != 0 {
+			w.buf.WriteString(" -> ")
+			switch {
+			case e.tfi == nil && w.opts.color:
+				w.buf.WriteString(w.paint(lsColors["orphan"], e.target))
+			case e.tfi == nil:
+				w.buf.WriteString(e.target)
+			default:
+				w.buf.WriteString(w.name(lsEntry{name: e.target, fi: e.tfi}))
+			}
+		}
+		w.buf.WriteString("\n")
+	}
+}
 
-		itemPerRow := int(sys.Width()/(maxlen+1) - 1)
+// links returns the link count, which for directories is two plus the
+// number of subdirectories
+func (w *lsWriter) links(e lsEntry) int {
+	if !e.fi.IsDir() {
+		return 1
+	}
+	links := 2
+	dir, err := w.fs.Open(e.path)
+	if err != nil {
+		return links
+	}
+	defer dir.Close()
+	infos, _ := dir.Readdir(-1)
+	for _, fi := range infos {
+		if fi.IsDir() {
+			links++
+		}
+	}
+	return links
+}
 
-		for i := 0; i < len(dirName); i++ {
-			if (i+1)%itemPerRow == 0 {
-				fmt.Fprint(sys.Out(), "\n")
+// columns writes the entries in columns sorted vertically, fitting as many
+// columns as the terminal width allows
+func (w *lsWriter) columns(entries []lsEntry) {
+	names := make([]string, len(entries))
+	lengths := make([]int, len(entries))
+	for i, e := range entries {
+		names[i] = w.name(e)
+		lengths[i] = len(e.name)
+		if w.opts.indicator != 0 && len(lsIndicator(e, w.opts.indicator)) > 0 {
+			lengths[i]++
+		}
+	}
+	width := w.width
+	if width <= 0 {
+		width = 80
+	}
+	cols, rows := 1, len(entries)
+	var colWidths []int
+	for c := minInt(len(entries), maxInt(width/3, 1)); c >= 1; c-- {
+		r := (len(entries) + c - 1) / c
+		widths := make([]int, c)
+		total := 0
+		for i, l := range lengths {
+			col := i / r
+			if col >= c {
+				break
 			}
-			fmt.Fprintf(sys.Out(), "%v%v  ", dirName[i], strings.Repeat(" ", maxlen-len(dirName[i])))
+			widths[col] = maxInt(widths[col], l+2)
+		}
+		for i, cw := range widths {
+			if i == len(widths)-1 {
+				cw -= 2
+			}
+			total += cw
+		}
+		if total < width || c == 1 {
+			cols, rows, colWidths = c, r, widths
+			break
 		}
-		fmt.Fprint(sys.Out(), "\n")
 	}
-	return 0
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			i := c*rows + r
+			if i >= len(entries) {
+				break
+			}
+			w.buf.WriteString(names[i])
+			if c < cols-1 && i+rows < len(entries) {
+				w.buf.WriteString(strings.Repeat(" ", colWidths[c]-lengths[i]))
+			}
+		}
+		w.buf.WriteString("\n")
+	}
 }
 
-func (fi lsFileInfoSort) Len() int { return len(fi) }
+// name returns the name of the entry, colored and with the indicator as
+// given by the options
+func (w *lsWriter) name(e lsEntry) string {
+	name := e.name
+	if w.opts.color {
+		if color := lsColor(e); len(color) > 0 {
+			name = w.paint(color, name)
+		}
+	}
+	if w.opts.indicator != 0 && !(w.opts.long && e.fi.Mode()&os.ModeSymlink != 0) {
+		name += lsIndicator(e, w.opts.indicator)
+	}
+	return name
+}
 
-func (fi lsFileInfoSort) Swap(i, j int) { fi[i], fi[j] = fi[j], fi[i] }
+// paint wraps the text in the escape sequences of the color
+func (w *lsWriter) paint(color, text string) string {
+	prefix := ""
+	if !w.colored {
+		prefix = "\x1b[0m"
+		w.colored = true
+	}
+	return prefix + "\x1b[" + color + "m" + text + "\x1b[0m"
+}
 
-func (fi lsFileInfoSort) Less(i, j int) bool { return fi[i].Name() < fi[j].Name() }
+// lsColor returns the color of the file by its type and mode
+func lsColor(e lsEntry) string {
+	m := e.fi.Mode()
+	switch {
+	case m&os.ModeSymlink != 0:
+		if e.tfi == nil {
+			return lsColors["orphan"]
+		}
+		return lsColors["link"]
+	case m.IsDir():
+		switch {
+		case m&os.ModeSticky != 0 && m&02 != 0:
+			return lsColors["stickyOtherWritable"]
+		case m&02 != 0:
+			return lsColors["otherWritable"]
+		case m&os.ModeSticky != 0:
+			return lsColors["sticky"]
+		}
+		return lsColors["dir"]
+	case m&os.ModeNamedPipe != 0:
+		return lsColors["fifo"]
+	case m&os.ModeSocket != 0:
+		return lsColors["socket"]
+	case m&os.ModeDevice != 0:
+		return lsColors["device"]
+	case m&os.ModeSetuid != 0:
+		return lsColors["setuid"]
+	case m&os.ModeSetgid != 0:
+		return lsColors["setgid"]
+	case m&0111 != 0:
+		return lsColors["exec"]
+	}
+	return ""
+}
+
+// lsIndicator returns the character -F or -p appends to the name
+func lsIndicator(e lsEntry, style byte) string {
+	m := e.fi.Mode()
+	switch {
+	case m.IsDir():
+		return "/"
+	case style != 'F':
+	case m&os.ModeSymlink != 0:
+		return "@"
+	case m&os.ModeNamedPipe != 0:
+		return "|"
+	case m&os.ModeSocket != 0:
+		return "="
+	case m&0111 != 0:
+		return "*"
+	}
+	return ""
+}
 
-func getLsString(fi os.FileInfo) string {
-	uid, gid, _, _ := virtualfs.GetExtraInfo(fi)
-	uName := honeyos.GetUserByID(uid).Name
-	gName := honeyos.GetGroupByID(gid).Name
+// lsType returns the file type character of the long format
+func lsType(m os.FileMode) string {
+	switch {
+	case m.IsDir():
+		return "d"
+	case m&os.ModeSymlink != 0:
+		return "l"
+	case m&os.ModeNamedPipe != 0:
+		return "p"
+	case m&os.ModeSocket != 0:
+		return "s"
+	case m&os.ModeCharDevice != 0:
+		return "c"
+	case m&os.ModeDevice != 0:
+		return "b"
+	}
+	return "-"
+}
 
-	size := fi.Size()
-	if fi.IsDir() {
-		size = 4096
+// humanSize formats the size like -h, with one decimal below 10 and
+// rounding up
+func humanSize(size int64, si bool) string {
+	base, units := 1024.0, "KMGTPEZY"
+	if si {
+		base, units = 1000.0, "kMGTPEZY"
+	}
+	if float64(size) < base {
+		return strconv.FormatInt(size, 10)
+	}
+	v := float64(size)
+	unit := -1
+	for v >= base && unit < len(units)-1 {
+		v /= base
+		unit++
+	}
+	if v < 10 {
+		v = float64(int64(v*10+0.9999)) / 10
+		if v < 10 {
+			return fmt.Sprintf("%.1f%c", v, units[unit])
+		}
+	}
+	v = float64(int64(v + 0.9999))
+	if v >= base && unit < len(units)-1 {
+		return fmt.Sprintf("1.0%c", units[unit+1])
 	}
-	return fmt.Sprintf("%v    1 %-8s %-8s %8d %v %v", strings.ToLower(fi.Mode().String()), uName, gName,
-		size, fi.ModTime().Format("Jan 02 15:04"), fi.Name())
+	return fmt.Sprintf("%.0f%c", v, units[unit])
 }
@@ -0,0 +1,144 @@
+package command
+
+import (
+	"fmt"
+	"path"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+)
+
+type mkdir struct{}
+
+func init() {
+	honeyos.RegisterCommand("mkdir", mkdir{})
+}
+
+func (mkdir) GetHelp() string {
+	return `Usage: mkdir [OPTION]... DIRECTORY...
+Create the DIRECTORY(ies), if they do not already exist.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -m, --mode=MODE   set file mode (as in chmod), not a=rwx - umask
+  -p, --parents     no error if existing, make parent directories as needed
+  -v, --verbose     print a message for each created directory
+  -Z                   set SELinux security context of each created directory
+                         to the default type
+      --context[=CTX]  like -Z, or if CTX is specified then set the SELinux
+                         or SMACK security context to CTX
+      --help     display this help and exit
+      --version  output version information and exit
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/mkdir>
+or available locally via: info '(coreutils) mkdir invocation'
+`
+}
+
+func (m mkdir) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "m:pvZ",
+		long: map[string]string{
+			"mode=": "m", "parents": "p", "verbose": "v", "context?": "Z",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "mkdir", err)
+	}
+	parents, verbose := false, false
+	mode := uint32(0777 &^ defaultUmask)
+	for _, opt := range opts {
+		switch opt.name {
+		case "m":
+			bits, ok := parseMode(opt.value, 0777, true)
+			if !ok {
+				fmt.Fprintln(sys.Err(), "mkdir: invalid mode", quote(opt.value))
+				return 1
+			}
+			mode = bits
+		case "p":
+			parents = true
+		case "v":
+			verbose = true
+		case "help":
+			fmt.Fprint(sys.Out(), m.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("mkdir", "David MacKenzie"))
+			return 0
+		}
+	}
+	if len(operands) == 0 {
+		return usageError(sys, "mkdir", "missing operand")
+	}
+	status := 0
+	for _, name := range operands {
+		p := fullPath(sys, name)
+		if parents {
+			// Parents are created with the default mode, only the last
+			// directory gets the mode given
+			var missing []string
+			for dir := p; dir != "/"; dir = path.Dir(dir) {
+				if _, err := sys.FSys().Stat(dir); err == nil {
+					break
+				}
+				missing = append([]string{dir}, missing...)
+			}
+			for i, dir := range missing {
+				bits := uint32(0777 &^ defaultUmask)
+				if i == len(missing)-1 {
+					bits = mode
+				}
+				display := name
+				for j := i; j < len(missing)-1; j++ {
+					display = path.Join(display, "..")
+				}
+				if !m.create(sys, dir, display, bits, verbose) {
+					status = 1
+					break
+				}
+			}
+			if fi, err := sys.FSys().Stat(p); err == nil && !fi.IsDir() {
+				fmt.Fprintf(sys.Err(), "mkdir: cannot create directory %v: File exists\n", quote(name))
+				status = 1
+			}
+			continue
+		}
+		if _, err := sys.FSys().Stat(p); err == nil {
+			fmt.Fprintf(sys.Err(), "mkdir: cannot create directory %v: File exists\n", quote(name))
+			status = 1
+			continue
+		}
+		parent, err := sys.FSys().Stat(path.Dir(p))
+		switch {
+		case err != nil:
+			fmt.Fprintf(sys.Err(), "mkdir: cannot create directory %v: %v\n", quote(name), honeyos.ErrnoString(err))
+			status = 1
+		case !parent.IsDir():
+			fmt.Fprintf(sys.Err(), "mkdir: cannot create directory %v: Not a directory\n", quote(name))
+			status = 1
+		case !m.create(sys, p, name, mode, verbose):
+			status = 1
+		}
+	}
+	return status
+}
+
+// create makes the directory whose parent exists
+func (mkdir) create(sys honeyos.Sys, p, name string, mode uint32, verbose bool) bool {
+	if err := sys.FSys().Mkdir(p, fileMode(mode)); err != nil {
+		fmt.Fprintf(sys.Err(), "mkdir: cannot create directory %v: %v\n", quote(name), honeyos.ErrnoString(err))
+		return false
+	}
+	sys.FSys().Chmod(p, fileMode(mode))
+	sys.FsEvent("mkdir", p, log.Fields{"cmd": "mkdir", "mode": fmt.Sprintf("%04o", mode)})
+	if verbose {
+		fmt.Fprintf(sys.Out(), "mkdir: created directory %v\n", quote(name))
+	}
+	return true
+}
+
+func (mkdir) Where() string {
+	return "/bin/mkdir"
+}
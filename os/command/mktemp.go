@@ -0,0 +1,93 @@
+package command
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+
+	"github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+type mktemp struct{}
+
+const mktempChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func init() {
+	os.RegisterCommand("mktemp", mktemp{})
+}
+
+func (mktemp) GetHelp() string {
+	return ""
+}
+
+func (mktemp) Exec(args []string, sys os.Sys) int {
+	flag := pflag.NewFlagSet("arg", pflag.ContinueOnError)
+	flag.SetOutput(sys.Err())
+	dir := flag.BoolP("directory", "d", false, "create a directory, not a file")
+	dryRun := flag.BoolP("dry-run", "u", false, "do not create anything; merely print a name (unsafe)")
+	quiet := flag.BoolP("quiet", "q", false, "suppress diagnostics about file/dir-creation failure")
+	tmpDir := flag.StringP("tmpdir", "p", "", "interpret TEMPLATE relative to DIR")
+	useTmpDir := flag.BoolP("t", "t", false, "interpret TEMPLATE as a single file name component")
+	if err := flag.Parse(args); err != nil {
+		return 1
+	}
+	template := "tmp.XXXXXXXXXX"
+	relative := true
+	if flag.NArg() > 0 {
+		template = flag.Arg(0)
+		relative = *useTmpDir || len(*tmpDir) > 0
+	}
+	if !strings.HasSuffix(template, "XXX") {
+		if !*quiet {
+			fmt.Fprintf(sys.Err(), "mktemp: too few X's in template '%v'\n", template)
+		}
+		return 1
+	}
+	name := strings.TrimRight(template, "X")
+	for i := len(name); i < len(template); i++ {
+		name += string(mktempChars[rand.Intn(len(mktempChars))])
+	}
+	if relative {
+		if len(*tmpDir) == 0 {
+			*tmpDir = "/tmp"
+		}
+		name = path.Join(*tmpDir, name)
+	}
+	if !path.IsAbs(name) {
+		name = path.Join(sys.Getcwd(), name)
+	}
+	if !*dryRun {
+		fs := afero.Afero{Fs: sys.FSys()}
+		kind := "file"
+		if *dir {
+			kind = "directory"
+		}
+		err := afero.ErrFileNotFound
+		if isDir, _ := fs.IsDir(path.Dir(name)); isDir && *dir {
+			err = fs.Mkdir(name, 0700)
+		} else if isDir {
+			err = fs.WriteFile(name, nil, 0600)
+		}
+		if err != nil {
+			if !*quiet {
+				fmt.Fprintf(sys.Err(), "mktemp: failed to create %v via template '%v': No such file or directory\n", kind, name)
+			}
+			return 1
+		}
+		op := "create"
+		if *dir {
+			op = "mkdir"
+		}
+		sys.FsEvent(op, name, log.Fields{"cmd": "mktemp"})
+	}
+	fmt.Fprintln(sys.Out(), name)
+	return 0
+}
+
+func (mktemp) Where() string {
+	return "/bin/mktemp"
+}
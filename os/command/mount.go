@@ -0,0 +1,129 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+// mount lists the mount table. Nothing can be mounted
+type mount struct{}
+
+func init() {
+	honeyos.RegisterCommand("mount", mount{})
+}
+
+func (mount) GetHelp() string {
+	return `
+Usage:
+ mount [-lhV]
+ mount -a [options]
+ mount [options] [--source] <source> | [--target] <directory>
+ mount [options] <source> <directory>
+ mount <operation> <mountpoint> [<target>]
+
+Mount a filesystem.
+
+Options:
+ -a, --all               mount all filesystems mentioned in fstab
+ -c, --no-canonicalize   don't canonicalize paths
+ -f, --fake              dry run; skip the mount(2) syscall
+ -F, --fork              fork off for each device (use with -a)
+ -T, --fstab <path>      alternative file to /etc/fstab
+ -i, --internal-only     don't call the mount.<type> helpers
+ -l, --show-labels       show also filesystem labels
+ -n, --no-mtab           don't write to /etc/mtab
+ -o, --options <list>    comma-separated list of mount options
+ -O, --test-opts <list>  limit the set of filesystems (use with -a)
+ -r, --read-only         mount the filesystem read-only (same as -o ro)
+ -t, --types <list>      limit the set of filesystem types
+     --source <src>      explicitly specifies source (path, label, uuid)
+     --target <target>   explicitly specifies mountpoint
+ -v, --verbose           say what is being done
+ -w, --rw, --read-write  mount the filesystem read-write (default)
+
+ -h, --help     display this help and exit
+ -V, --version  output version information and exit
+
+For more details see mount(8).
+`
+}
+
+func (mount) Where() string {
+	return "/bin/mount"
+}
+
+func (m mount) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "acfFT:ilno:O:rt:vwhV",
+		long: map[string]string{
+			"all": "a", "no-canonicalize": "c", "fake": "f", "fork": "F", "fstab=": "T", "internal-only": "i",
+			"show-labels": "l", "no-mtab": "n", "options=": "o", "test-opts=": "O", "read-only": "r",
+			"types=": "t", "source=": "source", "target=": "target", "verbose": "v", "rw": "w",
+			"read-write": "w", "help": "h", "version": "V",
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "mount: %v\n", err)
+		fmt.Fprint(sys.Err(), m.GetHelp())
+		return 1
+	}
+	types, all := "", false
+	for _, opt := range opts {
+		switch opt.name {
+		case "h":
+			fmt.Fprint(sys.Out(), m.GetHelp())
+			return 0
+		case "V":
+			fmt.Fprintln(sys.Out(), "mount from util-linux 2.27.1 (libmount 2.27.0: selinux, assert, debug)")
+			return 0
+		case "t":
+			types = opt.value
+		case "a":
+			all = true
+		case "source", "target":
+			operands = append(operands, opt.value)
+		}
+	}
+	if len(operands) == 0 && !all {
+		for _, mnt := range sys.Mounts() {
+			if matchFsType(types, mnt.Type) {
+				fmt.Fprintf(sys.Out(), "%v on %v type %v (%v)\n", mnt.Source, mnt.Dir, mnt.Type, mnt.Options)
+			}
+		}
+		return 0
+	}
+	if sys.CurrentUser() != 0 {
+		fmt.Fprintln(sys.Err(), "mount: only root can do that")
+		return 1
+	}
+	switch {
+	case all:
+		// Everything in fstab is mounted already
+		return 0
+	case len(operands) == 1:
+		fmt.Fprintf(sys.Err(), "mount: can't find %v in /etc/fstab\n", operands[0])
+		return 1
+	}
+	fmt.Fprintf(sys.Err(), "mount: special device %v does not exist\n", operands[0])
+	return 32
+}
+
+// matchFsType tells if the filesystem type is in the comma separated list
+// of -t, where a list starting with no excludes the types
+func matchFsType(types, typ string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	exclude := strings.HasPrefix(types, "no")
+	for _, t := range strings.Split(types, ",") {
+		if exclude {
+			t = strings.TrimPrefix(t, "no")
+		}
+		if t == typ {
+			return !exclude
+		}
+	}
+	return exclude
+}
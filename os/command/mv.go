@@ -0,0 +1,186 @@
+package command
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+type mv struct{}
+
+func init() {
+	honeyos.RegisterCommand("mv", mv{})
+}
+
+func (mv) GetHelp() string {
+	return `Usage: mv [OPTION]... [-T] SOURCE DEST
+  or:  mv [OPTION]... SOURCE... DIRECTORY
+  or:  mv [OPTION]... -t DIRECTORY SOURCE...
+Rename SOURCE to DEST, or move SOURCE(s) to DIRECTORY.
+
+Mandatory arguments to long options are mandatory for short options too.
+      --backup[=CONTROL]       make a backup of each existing destination file
+  -b                           like --backup but does not accept an argument
+  -f, --force                  do not prompt before overwriting
+  -i, --interactive            prompt before overwrite
+  -n, --no-clobber             do not overwrite an existing file
+If you specify more than one of -i, -f, -n, only the final one takes effect.
+      --strip-trailing-slashes  remove any trailing slashes from each SOURCE
+                                 argument
+  -S, --suffix=SUFFIX          override the usual backup suffix
+  -t, --target-directory=DIRECTORY  move all SOURCE arguments into DIRECTORY
+  -T, --no-target-directory    treat DEST as a normal file
+  -u, --update                 move only when the SOURCE file is newer
+                                 than the destination file or when the
+                                 destination file is missing
+  -v, --verbose                explain what is being done
+  -Z, --context                set SELinux security context of destination
+                                 file to default type
+      --help     display this help and exit
+      --version  output version information and exit
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/mv>
+or available locally via: info '(coreutils) mv invocation'
+`
+}
+
+func (m mv) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "fint:TuvZ",
+		long: map[string]string{
+			"force": "f", "interactive": "i", "no-clobber": "n", "target-directory=": "t",
+			"no-target-directory": "T", "update": "u", "verbose": "v", "context": "Z",
+			"strip-trailing-slashes": "strip-trailing-slashes", "help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "mv", err)
+	}
+	interactive, noClobber, update, verbose := false, false, false, false
+	target, noTarget := "", false
+	for _, opt := range opts {
+		switch opt.name {
+		case "f":
+			interactive, noClobber = false, false
+		case "i":
+			interactive, noClobber = true, false
+		case "n":
+			interactive, noClobber = false, true
+		case "t":
+			target = opt.value
+		case "T":
+			noTarget = true
+		case "u":
+			update = true
+		case "v":
+			verbose = true
+		case "help":
+			fmt.Fprint(sys.Out(), m.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("mv", "Mike Parker, David MacKenzie, and Jim Meyering"))
+			return 0
+		}
+	}
+	sources, dest, ok := targetOperands(sys, "mv", operands, target, noTarget)
+	if !ok {
+		return 1
+	}
+	fs := sys.FSys()
+	status := 0
+	for _, srcName := range sources {
+		dstName := dest
+		if len(target) > 0 || !noTarget && isDir(fs, fullPath(sys, dest)) {
+			dstName = path.Join(dest, path.Base(srcName))
+		}
+		src, dst := fullPath(sys, srcName), fullPath(sys, dstName)
+		fi, err := fs.Stat(src)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "mv: cannot stat %v: %v\n", quote(srcName), honeyos.ErrnoString(err))
+			status = 1
+			continue
+		}
+		if src == dst {
+			fmt.Fprintf(sys.Err(), "mv: %v and %v are the same file\n", quote(srcName), quote(dstName))
+			status = 1
+			continue
+		}
+		if fi.IsDir() && strings.HasPrefix(dst, src+"/") {
+			fmt.Fprintf(sys.Err(), "mv: cannot move %v to a subdirectory of itself, %v\n", quote(srcName), quote(dstName))
+			status = 1
+			continue
+		}
+		if dfi, err := fs.Stat(dst); err == nil {
+			switch {
+			case dfi.IsDir() && !fi.IsDir():
+				fmt.Fprintf(sys.Err(), "mv: cannot overwrite directory %v with non-directory\n", quote(dstName))
+				status = 1
+				continue
+			case !dfi.IsDir() && fi.IsDir():
+				fmt.Fprintf(sys.Err(), "mv: cannot overwrite non-directory %v with directory %v\n", quote(dstName), quote(srcName))
+				status = 1
+				continue
+			case noClobber || update && !fi.ModTime().After(dfi.ModTime()):
+				continue
+			case interactive && !confirm(sys, fmt.Sprintf("mv: overwrite %v? ", quote(dstName))):
+				continue
+			}
+			if dfi.IsDir() {
+				if entries, _ := afero.ReadDir(fs, dst); len(entries) > 0 {
+					fmt.Fprintf(sys.Err(), "mv: cannot move %v to %v: Directory not empty\n", quote(srcName), quote(dstName))
+					status = 1
+					continue
+				}
+			}
+		}
+		if !m.move(sys, src, dst, srcName, dstName) {
+			status = 1
+			continue
+		}
+		sys.FsEvent("rename", dst, log.Fields{"cmd": "mv", "source": src})
+		if verbose {
+			fmt.Fprintf(sys.Out(), "%v -> %v\n", quote(srcName), quote(dstName))
+		}
+	}
+	return status
+}
+
+// move renames the file. Files that cannot be renamed, like those in the
+// read only image, are copied and then removed like moving across devices
+func (mv) move(sys honeyos.Sys, src, dst, srcName, dstName string) bool {
+	fs := sys.FSys()
+	if err := fs.Rename(src, dst); err == nil {
+		return true
+	}
+	cpy := copier{sys: sys, cmd: "mv", recursive: true, preserve: true, force: true}
+	if !cpy.copy(src, dst, srcName, dstName) {
+		return false
+	}
+	var remove func(p, name string) bool
+	remove = func(p, name string) bool {
+		if isDir(fs, p) {
+			entries, _ := afero.ReadDir(fs, p)
+			for _, entry := range entries {
+				if !remove(path.Join(p, entry.Name()), path.Join(name, entry.Name())) {
+					return false
+				}
+			}
+		}
+		if err := removeFile(fs, p); err != nil {
+			fmt.Fprintf(sys.Err(), "mv: cannot remove %v: %v\n", quote(name), honeyos.ErrnoString(err))
+			return false
+		}
+		sys.FsEvent("remove", p, log.Fields{"cmd": "mv"})
+		return true
+	}
+	return remove(src, srcName)
+}
+
+func (mv) Where() string {
+	return "/bin/mv"
+}
@@ -0,0 +1,191 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Download policies. Live fetches from the Internet, offline never connects
+// and answers with an emulated transfer, allowlisted fetches live only the
+// hosts in the allowlist
+const (
+	policyLive        = "live"
+	policyOffline     = "offline"
+	policyAllowlisted = "allowlisted"
+)
+
+// offlineTypes are the content types of the emulated responses by file
+// extension
+var offlineTypes = map[string]string{
+	"":      "text/html",
+	".html": "text/html",
+	".htm":  "text/html",
+	".php":  "text/html",
+	".txt":  "text/plain",
+	".sh":   "application/x-sh",
+	".pl":   "application/x-perl",
+	".py":   "text/x-python",
+	".gz":   "application/x-gzip",
+	".tgz":  "application/x-gzip",
+	".tar":  "application/x-tar",
+	".zip":  "application/zip",
+	".exe":  "application/x-msdos-program",
+}
+
+// publicNets are the first octets the fake addresses of hosts are picked
+// from, so that they look like ordinary hosting providers
+var publicNets = []byte{23, 34, 45, 50, 52, 64, 69, 81, 93, 104, 107, 138, 151, 159, 162, 176, 178, 185, 188, 198, 209, 212}
+
+// downloadPolicy returns the policy applied to the host
+func downloadPolicy(host string) string {
+	switch viper.GetString("download.policy") {
+	case policyOffline:
+		return policyOffline
+	case policyAllowlisted:
+		if allowlisted(host) {
+			return policyLive
+		}
+		return policyOffline
+	}
+	return policyLive
+}
+
+// allowlisted checks if the host matches the allowlist, given as host names,
+// *.domain wildcards, IP addresses or CIDR blocks
+func allowlisted(host string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range viper.GetStringSlice("download.allowlist") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(host, entry[1:]) || host == entry[2:] {
+				return true
+			}
+		case strings.Contains(entry, "/"):
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && ip != nil && cidr.Contains(ip) {
+				return true
+			}
+		case host == entry:
+			return true
+		}
+	}
+	return false
+}
+
+// fakeAddr returns the address the host appears to resolve to, which is
+// the same every time for the host
+func fakeAddr(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	h := fnv.New32a()
+	h.Write([]byte(host))
+	sum := h.Sum32()
+	return net.IPv4(publicNets[sum%uint32(len(publicNets))], byte(sum>>8), byte(sum>>16), byte(sum>>24)%253+1)
+}
+
+// fetchOffline emulates the transfer without connecting to the host. The
+// body is the file of the same name in the payload directory if any, or
+// filler of the configured size
+func fetchOffline(sys honeyos.Sys, req *downloadRequest) (*download, error) {
+	host := req.url.Hostname()
+	ip := fakeAddr(host)
+	d := &download{
+		url:     req.url,
+		addrs:   []net.IP{ip},
+		remote:  net.JoinHostPort(ip.String(), urlPort(req.url)),
+		offline: true,
+	}
+	name := path.Base(req.url.Path)
+	contentType := offlineTypes[strings.ToLower(path.Ext(strings.TrimSuffix(req.url.Path, "/")))]
+	served := ""
+	if dir := viper.GetString("download.offline.payloadDir"); len(dir) > 0 && name != "/" && name != "." {
+		// Only the base name is used so that the URL cannot leave the directory
+		if b, err := ioutil.ReadFile(path.Join(dir, name)); err == nil {
+			d.body, served = b, path.Join(dir, name)
+			if len(contentType) == 0 {
+				contentType = http.DetectContentType(b)
+			}
+		}
+	}
+	if len(contentType) == 0 {
+		contentType = viper.GetString("download.offline.contentType")
+	}
+	if d.body == nil {
+		d.body = offlineBody(req.url.String(), contentType, viper.GetInt("download.offline.size"))
+	}
+	// The transfer takes the time it would at the configured speed
+	if speed := viper.GetInt("download.offline.speed"); speed > 0 {
+		delay := time.Duration(len(d.body)) * time.Second / time.Duration(speed*1024)
+		if max := viper.GetDuration("download.offline.maxDelay"); max > 0 && delay > max {
+			delay = max
+		}
+		time.Sleep(delay)
+	}
+	if req.method == "HEAD" {
+		d.body = nil
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(d.body)))
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	header.Set("Server", "Apache/2.4.18 (Ubuntu)")
+	header.Set("Last-Modified", time.Now().Add(-72*time.Hour).UTC().Format(http.TimeFormat))
+	d.resp = &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(d.body)),
+	}
+	fields := log.Fields{
+		"cmd":    req.cmd,
+		"url":    req.url.String(),
+		"method": req.method,
+		"policy": policyOffline,
+		"size":   len(d.body),
+	}
+	if len(served) > 0 {
+		fields["payload"] = served
+	}
+	sys.LogEvent("File download emulated", fields)
+	return d, nil
+}
+
+// offlineBody returns filler content of the size, an HTML page for pages
+// and random bytes seeded by the URL for the others
+func offlineBody(url, contentType string, size int) []byte {
+	if size <= 0 {
+		size = 16384
+	}
+	if strings.HasPrefix(contentType, "text/html") {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html>\n<head><title>Index</title></head>\n<body>\n")
+		for buf.Len() < size-20 {
+			buf.WriteString("<p></p>\n")
+		}
+		buf.WriteString("</body>\n</html>\n")
+		return buf.Bytes()
+	}
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	body := make([]byte, size)
+	rand.New(rand.NewSource(int64(h.Sum64()))).Read(body)
+	return body
+}
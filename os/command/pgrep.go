@@ -0,0 +1,260 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+// pgrep finds processes by name, and pkill sends signal to them
+type pgrep struct {
+	name string
+	kill bool
+}
+
+func init() {
+	honeyos.RegisterCommand("pgrep", pgrep{"pgrep", false})
+	honeyos.RegisterCommand("pkill", pgrep{"pkill", true})
+}
+
+func (p pgrep) GetHelp() string {
+	opts := ` -d, --delimiter <string>  specify output delimiter
+ -l, --list-name           list PID and process name
+ -a, --list-full           list PID and full command line
+ -v, --inverse             negates the matching
+ -w, --lightweight         list all TID
+`
+	if p.kill {
+		opts = ` -<sig>, --signal <sig>    signal to send (either number or name)
+`
+	}
+	return fmt.Sprintf(`
+Usage:
+ %v [options] <pattern>
+
+Options:
+%v -c, --count               count of matching processes
+ -f, --full                use full process name to match
+ -g, --pgroup <PGID,...>   match listed process group IDs
+ -G, --group <GID,...>     match real group IDs
+ -n, --newest              select most recently started
+ -o, --oldest              select least recently started
+ -P, --parent <PPID,...>   match only child processes of the given parent
+ -s, --session <SID,...>   match session IDs
+ -t, --terminal <tty,...>  match by controlling terminal
+ -u, --euid <ID,...>       match by effective IDs
+ -U, --uid <ID,...>        match by real IDs
+ -x, --exact               match exactly with the command name
+ -F, --pidfile <file>      read PIDs from file
+ -L, --logpidfile          fail if PID file is not locked
+ --ns <PID>                match the processes that belong to the same
+                           namespace as <pid>
+ --nslist <ns,...>         list which namespaces will be considered for
+                           the --ns option.
+                           Available namespaces: ipc, mnt, net, pid, user, uts
+
+ -h, --help     display this help and exit
+ -V, --version  output version information and exit
+
+For more details see pgrep(1).
+`, p.name, opts)
+}
+
+func (p pgrep) Exec(args []string, sys honeyos.Sys) int {
+	sig := syscall.SIGTERM
+	full, exact, inverse, count, newest, oldest := false, false, false, false, false, false
+	listName, listFull := false, false
+	delim := "\n"
+	var users, parents []int
+	var pattern *string
+	usage := func(msg string) int {
+		fmt.Fprintf(sys.Err(), "%v: %v\n", p.name, msg)
+		fmt.Fprintf(sys.Err(), "Try `%v --help' for more information.\n", p.name)
+		return 2
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || len(arg) == 1 {
+			if pattern != nil {
+				return usage("only one pattern can be provided")
+			}
+			pattern = &args[i]
+			continue
+		}
+		if p.kill && i == 0 {
+			if s, ok := parseSignal(arg[1:]); ok {
+				sig = s
+				continue
+			}
+		}
+		// value returns the argument of an option
+		value := func(attached string) (string, bool) {
+			if len(attached) > 0 {
+				return strings.TrimPrefix(attached, "="), true
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i], true
+			}
+			return "", false
+		}
+		long := map[string]string{
+			"--full": "f", "--exact": "x", "--inverse": "v", "--count": "c", "--newest": "n",
+			"--oldest": "o", "--list-name": "l", "--list-full": "a", "--help": "h", "--version": "V",
+			"--euid": "u", "--uid": "U", "--parent": "P", "--delimiter": "d", "--signal": "s",
+		}
+		flags := arg[1:]
+		if strings.HasPrefix(arg, "--") {
+			name := arg
+			attached := ""
+			if eq := strings.IndexByte(arg, '='); eq >= 0 {
+				name, attached = arg[:eq], arg[eq:]
+			}
+			short, exists := long[name]
+			if !exists {
+				return usage(fmt.Sprintf("unrecognized option '%v'", arg))
+			}
+			flags = short + attached
+		}
+		for j := 0; j < len(flags); j++ {
+			switch c := flags[j]; c {
+			case 'f':
+				full = true
+			case 'x':
+				exact = true
+			case 'v':
+				inverse = true
+			case 'c':
+				count = true
+			case 'n':
+				newest = true
+			case 'o':
+				oldest = true
+			case 'l':
+				listName = true
+			case 'a':
+				listFull = true
+			case 'h':
+				fmt.Fprint(sys.Out(), p.GetHelp())
+				return 0
+			case 'V':
+				fmt.Fprintf(sys.Out(), "%v from procps-ng 3.3.10\n", p.name)
+				return 0
+			case 'u', 'U', 'P', 'd', 's', 'g', 'G', 't':
+				v, ok := value(flags[j+1:])
+				if !ok {
+					return usage(fmt.Sprintf("option requires an argument -- '%c'", c))
+				}
+				j = len(flags)
+				switch c {
+				case 'u', 'U':
+					for _, name := range strings.Split(v, ",") {
+						uid, err := strconv.Atoi(name)
+						if err != nil {
+							u := honeyos.GetUser(name)
+							if len(u.Name) == 0 {
+								return usage(fmt.Sprintf("invalid user name: %v", name))
+							}
+							uid = u.UID
+						}
+						users = append(users, uid)
+					}
+				case 'P':
+					for _, s := range strings.Split(v, ",") {
+						ppid, err := strconv.Atoi(s)
+						if err != nil {
+							return usage(fmt.Sprintf("invalid argument: '%v'", s))
+						}
+						parents = append(parents, ppid)
+					}
+				case 'd':
+					delim = v
+				case 's':
+					s, ok := parseSignal(v)
+					if !p.kill || !ok {
+						return usage(fmt.Sprintf("invalid argument: '%v'", v))
+					}
+					sig = s
+				}
+			default:
+				return usage(fmt.Sprintf("invalid option -- '%c'", c))
+			}
+		}
+	}
+	if pattern == nil && len(users) == 0 && len(parents) == 0 {
+		return usage("no matching criteria specified")
+	}
+	var re *regexp.Regexp
+	if pattern != nil {
+		expr := *pattern
+		if exact {
+			expr = "^(?:" + expr + ")$"
+		}
+		var err error
+		if re, err = regexp.Compile(expr); err != nil {
+			fmt.Fprintf(sys.Err(), "%v: invalid regular expression\n", p.name)
+			return 2
+		}
+	}
+	var matched []honeyos.Process
+	for _, proc := range sys.Processes().List() {
+		if proc.PID == sys.Getpid() {
+			continue
+		}
+		target := proc.Name
+		if full {
+			target = proc.Cmdline()
+			if len(proc.Args) == 0 {
+				target = proc.Name
+			}
+		}
+		match := (re == nil || re.MatchString(target)) &&
+			(len(users) == 0 || containsInt(users, proc.UID)) &&
+			(len(parents) == 0 || containsInt(parents, proc.PPID))
+		if match != inverse {
+			matched = append(matched, proc)
+		}
+	}
+	if len(matched) > 0 && (newest || oldest) {
+		sel := matched[0]
+		for _, proc := range matched[1:] {
+			if newest && !proc.Start.Before(sel.Start) || oldest && proc.Start.Before(sel.Start) {
+				sel = proc
+			}
+		}
+		matched = []honeyos.Process{sel}
+	}
+	var out []string
+	for _, proc := range matched {
+		switch {
+		case p.kill:
+			if err := sys.Processes().Signal(proc.PID, sys.CurrentUser(), sig); err != nil {
+				fmt.Fprintf(sys.Err(), "%v: killing pid %d failed: %v\n", p.name, proc.PID, errorString(err))
+			}
+		case listFull:
+			out = append(out, fmt.Sprintf("%d %v", proc.PID, proc.Cmdline()))
+		case listName:
+			out = append(out, fmt.Sprintf("%d %v", proc.PID, proc.Name))
+		default:
+			out = append(out, strconv.Itoa(proc.PID))
+		}
+	}
+	switch {
+	case count:
+		fmt.Fprintln(sys.Out(), len(matched))
+	case len(out) > 0:
+		fmt.Fprint(sys.Out(), strings.Join(out, delim)+"\n")
+	}
+	if len(matched) == 0 {
+		return 1
+	}
+	return 0
+}
+
+func (p pgrep) Where() string {
+	return "/usr/bin/" + p.name
+}
@@ -0,0 +1,243 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type printf struct{}
+
+func init() {
+	honeyos.RegisterCommand("printf", printf{})
+}
+
+func (p printf) GetHelp() string {
+	return "printf: usage: printf [-v var] format [arguments]\n"
+}
+
+// printfState is the state of the formatting of one printf invocation
+type printfState struct {
+	sys    honeyos.Sys
+	args   []string
+	used   int
+	status int
+	out    bytes.Buffer
+}
+
+func (p printf) Exec(args []string, sys honeyos.Sys) int {
+	variable := ""
+	if len(args) > 0 && args[0] == "-v" {
+		if len(args) < 2 {
+			fmt.Fprintln(sys.Err(), "printf: -v: option requires an argument")
+			fmt.Fprint(sys.Err(), p.GetHelp())
+			return 2
+		}
+		variable = args[1]
+		args = args[2:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprint(sys.Err(), p.GetHelp())
+		return 2
+	}
+	s := &printfState{sys: sys, args: args[1:]}
+	// The format is reused until all arguments are consumed
+	for {
+		used := s.used
+		if !s.format(args[0]) {
+			break
+		}
+		if s.used >= len(s.args) || s.used == used {
+			break
+		}
+	}
+	if len(variable) > 0 {
+		sys.SetEnv(variable, s.out.String())
+	} else {
+		sys.Out().Write(s.out.Bytes())
+	}
+	return s.status
+}
+
+func (p printf) Where() string {
+	return "/usr/bin/printf"
+}
+
+// format writes the output of one pass of the format string. It returns
+// false when the output should stop
+func (s *printfState) format(f string) bool {
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			end := strings.IndexByte(f[i:], '%')
+			if end < 0 {
+				end = len(f)
+			} else {
+				end += i
+			}
+			b, stop := unescape(f[i:end], false)
+			s.out.Write(b)
+			if stop {
+				return false
+			}
+			i = end - 1
+			continue
+		}
+		if i+1 < len(f) && f[i+1] == '%' {
+			s.out.WriteByte('%')
+			i++
+			continue
+		}
+		// Parse flags, width and precision of the conversion
+		spec := []byte{'%'}
+		j := i + 1
+		for j < len(f) && strings.IndexByte("-+ #0", f[j]) >= 0 {
+			spec = append(spec, f[j])
+			j++
+		}
+		if j < len(f) && f[j] == '*' {
+			spec = strconv.AppendInt(spec, s.nextInt(), 10)
+			j++
+		} else {
+			for j < len(f) && f[j] >= '0' && f[j] <= '9' {
+				spec = append(spec, f[j])
+				j++
+			}
+		}
+		if j < len(f) && f[j] == '.' {
+			spec = append(spec, '.')
+			j++
+			if j < len(f) && f[j] == '*' {
+				spec = strconv.AppendInt(spec, s.nextInt(), 10)
+				j++
+			} else {
+				for j < len(f) && f[j] >= '0' && f[j] <= '9' {
+					spec = append(spec, f[j])
+					j++
+				}
+			}
+		}
+		// Length modifiers are accepted and ignored
+		for j < len(f) && strings.IndexByte("hlLqjzt", f[j]) >= 0 {
+			j++
+		}
+		if j >= len(f) {
+			fmt.Fprintln(s.sys.Err(), "printf: `%': missing format character")
+			s.status = 1
+			return false
+		}
+		if !s.convert(string(spec), f[j]) {
+			return false
+		}
+		i = j
+	}
+	return true
+}
+
+// convert writes one argument formatted by the conversion character c
+func (s *printfState) convert(spec string, c byte) bool {
+	switch c {
+	case 's':
+		fmt.Fprintf(&s.out, spec+"s", s.next())
+	case 'b':
+		b, stop := unescape(s.next(), true)
+		fmt.Fprintf(&s.out, spec+"s", b)
+		if stop {
+			return false
+		}
+	case 'q':
+		fmt.Fprintf(&s.out, spec+"s", shellQuote(s.next()))
+	case 'c':
+		arg := s.next()
+		if len(arg) > 0 {
+			arg = arg[:1]
+		}
+		fmt.Fprintf(&s.out, spec+"s", arg)
+	case 'd', 'i':
+		fmt.Fprintf(&s.out, spec+"d", s.nextInt())
+	case 'u':
+		fmt.Fprintf(&s.out, spec+"d", uint64(s.nextInt()))
+	case 'o', 'x', 'X':
+		fmt.Fprintf(&s.out, spec+string(c), uint64(s.nextInt()))
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		fmt.Fprintf(&s.out, spec+strings.ToLower(string(c)), s.nextFloat())
+	default:
+		fmt.Fprintf(s.sys.Err(), "printf: `%c': invalid format character\n", c)
+		s.status = 1
+		return false
+	}
+	return true
+}
+
+// next returns the next argument, or empty string when there is none
+func (s *printfState) next() string {
+	if s.used >= len(s.args) {
+		return ""
+	}
+	s.used++
+	return s.args[s.used-1]
+}
+
+// nextInt returns the next argument as an integer. Like bash, a leading
+// quote gives the character code of the following character
+func (s *printfState) nextInt() int64 {
+	arg := s.next()
+	if len(arg) == 0 {
+		return 0
+	}
+	if arg[0] == '\'' || arg[0] == '"' {
+		if len(arg) > 1 {
+			return int64(arg[1])
+		}
+		return 0
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(arg), 0, 64)
+	if err != nil {
+		if u, uerr := strconv.ParseUint(strings.TrimSpace(arg), 0, 64); uerr == nil {
+			return int64(u)
+		}
+		fmt.Fprintf(s.sys.Err(), "printf: %v: invalid number\n", arg)
+		s.status = 1
+	}
+	return v
+}
+
+// nextFloat returns the next argument as a floating point number
+func (s *printfState) nextFloat() float64 {
+	arg := s.next()
+	if len(arg) == 0 {
+		return 0
+	}
+	if arg[0] == '\'' || arg[0] == '"' {
+		if len(arg) > 1 {
+			return float64(arg[1])
+		}
+		return 0
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+	if err != nil {
+		fmt.Fprintf(s.sys.Err(), "printf: %v: invalid number\n", arg)
+		s.status = 1
+	}
+	return v
+}
+
+// shellQuote escapes the string so that it can be reused as shell input
+func shellQuote(s string) string {
+	if len(s) == 0 {
+		return "''"
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(" \t\n|&;()<>{}[]*?!$`'\"\\#~=%,^", s[i]) >= 0 {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
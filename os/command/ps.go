@@ -0,0 +1,372 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type ps struct{}
+
+func init() {
+	honeyos.RegisterCommand("ps", ps{})
+}
+
+func (p ps) GetHelp() string {
+	return `
+Usage:
+ ps [options]
+
+ Try 'ps --help <simple|list|output|threads|misc|all>'
+  or 'ps --help <s|l|o|t|m|a>'
+ for additional help text.
+
+For more details see ps(1).
+`
+}
+
+// psColumn is a column of ps output
+type psColumn struct {
+	header string
+	width  int
+	left   bool
+	value  func(p honeyos.Process, now time.Time) string
+}
+
+var psColumns = map[string]psColumn{
+	"pid":     {"PID", 5, false, func(p honeyos.Process, now time.Time) string { return strconv.Itoa(p.PID) }},
+	"ppid":    {"PPID", 5, false, func(p honeyos.Process, now time.Time) string { return strconv.Itoa(p.PPID) }},
+	"uid":     {"UID", 5, false, func(p honeyos.Process, now time.Time) string { return strconv.Itoa(p.UID) }},
+	"user":    {"USER", 8, true, func(p honeyos.Process, now time.Time) string { return procUser(p.UID) }},
+	"ruser":   {"UID", 8, true, func(p honeyos.Process, now time.Time) string { return procUser(p.UID) }},
+	"comm":    {"COMMAND", 15, true, func(p honeyos.Process, now time.Time) string { return p.Name }},
+	"ucmd":    {"CMD", 15, true, func(p honeyos.Process, now time.Time) string { return p.Name }},
+	"args":    {"COMMAND", 0, true, func(p honeyos.Process, now time.Time) string { return p.Cmdline() }},
+	"cmd":     {"CMD", 0, true, func(p honeyos.Process, now time.Time) string { return p.Cmdline() }},
+	"%cpu":    {"%CPU", 4, false, func(p honeyos.Process, now time.Time) string { return fmt.Sprintf("%.1f", p.CPU) }},
+	"%mem":    {"%MEM", 4, false, func(p honeyos.Process, now time.Time) string { return fmt.Sprintf("%.1f", memPercent(p)) }},
+	"c":       {"C", 2, false, func(p honeyos.Process, now time.Time) string { return strconv.Itoa(int(p.CPU)) }},
+	"vsz":     {"VSZ", 6, false, func(p honeyos.Process, now time.Time) string { return strconv.Itoa(p.VSZ) }},
+	"rss":     {"RSS", 5, false, func(p honeyos.Process, now time.Time) string { return strconv.Itoa(p.RSS) }},
+	"tty":     {"TTY", 8, true, func(p honeyos.Process, now time.Time) string { return p.TTY }},
+	"tt":      {"TT", 8, true, func(p honeyos.Process, now time.Time) string { return p.TTY }},
+	"stat":    {"STAT", 4, true, func(p honeyos.Process, now time.Time) string { return p.State }},
+	"s":       {"S", 1, true, func(p honeyos.Process, now time.Time) string { return p.State[:1] }},
+	"start":   {"START", 5, false, func(p honeyos.Process, now time.Time) string { return startTime(p.Start, now) }},
+	"stime":   {"STIME", 5, true, func(p honeyos.Process, now time.Time) string { return startTime(p.Start, now) }},
+	"bsdtime": {"TIME", 6, false, bsdTime},
+	"time":    {"TIME", 8, false, cpuTime},
+	"etime":   {"ELAPSED", 11, false, elapsedTime},
+	"ni":      {"NI", 3, false, func(p honeyos.Process, now time.Time) string { return "0" }},
+	"pri":     {"PRI", 3, false, func(p honeyos.Process, now time.Time) string { return "19" }},
+	"sid":     {"SID", 5, false, func(p honeyos.Process, now time.Time) string { return strconv.Itoa(p.SID) }},
+}
+
+// psAliases are other names of the columns accepted by -o
+var psAliases = map[string]string{
+	"command": "args", "pcpu": "%cpu", "pmem": "%mem", "cputime": "time",
+	"start_time": "stime", "euser": "user", "euid": "uid", "state": "s",
+	"nice": "ni", "vsize": "vsz", "rssize": "rss", "sess": "sid", "session": "sid",
+	"lstart": "start", "fname": "comm",
+}
+
+// Formats of ps output
+var (
+	psDefault = []string{"pid", "tty", "time", "ucmd"}
+	psFull    = []string{"ruser", "pid", "ppid", "c", "stime", "tty", "time", "cmd"}
+	psUser    = []string{"user", "pid", "%cpu", "%mem", "vsz", "rss", "tty", "stat", "start", "bsdtime", "args"}
+	psBSD     = []string{"pid", "tty", "stat", "bsdtime", "args"}
+)
+
+func (p ps) Exec(args []string, sys honeyos.Sys) int {
+	format := psDefault
+	all, noTTY, allTTY := false, false, false
+	bsd, userFormat, fullFormat := false, false, false
+	var users []int
+	var pids []int
+	var custom []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// Options taking a value may have it attached or as next argument
+		value := func(opt, what string) (string, bool) {
+			if len(arg) > len(opt) {
+				return strings.TrimPrefix(arg[len(opt):], "="), true
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i], true
+			}
+			fmt.Fprintf(sys.Err(), "error: %v must follow %v\n", what, strings.TrimPrefix(opt, "--"))
+			fmt.Fprint(sys.Err(), p.GetHelp())
+			return "", false
+		}
+		switch {
+		case arg == "--help":
+			fmt.Fprint(sys.Out(), p.GetHelp())
+			return 0
+		case arg == "-V" || arg == "V" || arg == "--version":
+			fmt.Fprintln(sys.Out(), "procps-ng version 3.3.10")
+			return 0
+		case strings.HasPrefix(arg, "-p") || strings.HasPrefix(arg, "--pid"):
+			opt := "-p"
+			if strings.HasPrefix(arg, "--pid") {
+				opt = "--pid"
+			}
+			v, ok := value(opt, "list of process IDs")
+			if !ok {
+				return 1
+			}
+			for _, s := range strings.Split(v, ",") {
+				pid, err := strconv.Atoi(s)
+				if err != nil {
+					fmt.Fprintln(sys.Err(), "error: process ID list syntax error")
+					fmt.Fprint(sys.Err(), p.GetHelp())
+					return 1
+				}
+				pids = append(pids, pid)
+			}
+		case strings.HasPrefix(arg, "-u") || strings.HasPrefix(arg, "-U") || strings.HasPrefix(arg, "--user"):
+			opt := arg[:2]
+			if strings.HasPrefix(arg, "--user") {
+				opt = "--user"
+			}
+			v, ok := value(opt, "list of users")
+			if !ok {
+				return 1
+			}
+			for _, name := range strings.Split(v, ",") {
+				uid, err := strconv.Atoi(name)
+				if err != nil {
+					u := honeyos.GetUser(name)
+					if len(u.Name) == 0 {
+						fmt.Fprintln(sys.Err(), "error: user name does not exist")
+						fmt.Fprint(sys.Err(), p.GetHelp())
+						return 1
+					}
+					uid = u.UID
+				}
+				users = append(users, uid)
+			}
+		case strings.HasPrefix(arg, "-o") || strings.HasPrefix(arg, "--format") || arg == "o":
+			opt := arg
+			if strings.HasPrefix(arg, "-o") {
+				opt = "-o"
+			} else if strings.HasPrefix(arg, "--format") {
+				opt = "--format"
+			}
+			v, ok := value(opt, "format specification")
+			if !ok {
+				return 1
+			}
+			for _, f := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+				name := strings.ToLower(strings.TrimSuffix(f, "="))
+				if alias, exists := psAliases[name]; exists {
+					name = alias
+				}
+				if _, exists := psColumns[name]; !exists {
+					fmt.Fprintln(sys.Err(), "error: unknown user-defined format specifier \""+f+"\"")
+					fmt.Fprint(sys.Err(), p.GetHelp())
+					return 1
+				}
+				if strings.HasSuffix(f, "=") {
+					name += "="
+				}
+				custom = append(custom, name)
+			}
+		case strings.HasPrefix(arg, "--"):
+			// --forest, --sort, --cols and the like only change the layout
+		case strings.HasPrefix(arg, "-") && arg != "-aux":
+			for _, c := range arg[1:] {
+				switch c {
+				case 'e', 'A':
+					all = true
+				case 'f', 'F':
+					fullFormat = true
+				case 'a', 'd':
+					allTTY = true
+				case 'x':
+					noTTY = true
+				}
+			}
+		default:
+			// BSD options without dash, procps accepts ps -aux the same way
+			bsd = true
+			for _, c := range strings.TrimPrefix(arg, "-") {
+				switch c {
+				case 'a':
+					allTTY = true
+				case 'x':
+					noTTY = true
+				case 'u':
+					userFormat = true
+				case 'e', 'f', 'w':
+				}
+			}
+		}
+	}
+	switch {
+	case len(custom) > 0:
+		format = custom
+	case userFormat:
+		format = psUser
+	case fullFormat:
+		format = psFull
+	case bsd:
+		format = psBSD
+	}
+
+	uid := sys.CurrentUser()
+	procs := sys.Processes().List()
+	self, _ := sys.Processes().Get(sys.Getpid())
+	var selected []honeyos.Process
+	for _, proc := range procs {
+		if proc.PID == self.PID {
+			// ps is the one running
+			proc.State = "R" + strings.TrimPrefix(proc.State, "S")
+		}
+		var match bool
+		switch {
+		case len(pids) > 0 || len(users) > 0:
+			match = containsInt(pids, proc.PID) || containsInt(users, proc.UID)
+		case all || allTTY && noTTY:
+			match = true
+		case allTTY && bsd:
+			match = proc.TTY != "?"
+		case allTTY:
+			// ps -a excludes session leaders and processes without tty
+			match = proc.TTY != "?" && proc.SID != proc.PID
+		case noTTY:
+			match = proc.UID == uid
+		default:
+			match = proc.UID == uid && proc.TTY == self.TTY
+		}
+		if match {
+			selected = append(selected, proc)
+		}
+	}
+	printPs(sys, format, selected)
+	if len(selected) == 0 {
+		return 1
+	}
+	return 0
+}
+
+func (p ps) Where() string {
+	return "/bin/ps"
+}
+
+// printPs prints the processes in columns of the format
+func printPs(sys honeyos.Sys, format []string, procs []honeyos.Process) {
+	now := time.Now()
+	header := false
+	var cols []psColumn
+	for _, name := range format {
+		col := psColumns[strings.TrimSuffix(name, "=")]
+		if strings.HasSuffix(name, "=") {
+			col.header = ""
+		}
+		header = header || len(col.header) > 0
+		cols = append(cols, col)
+	}
+	rows := [][]string{}
+	if header {
+		row := []string{}
+		for _, col := range cols {
+			row = append(row, col.header)
+		}
+		rows = append(rows, row)
+	}
+	for _, proc := range procs {
+		row := []string{}
+		for _, col := range cols {
+			row = append(row, col.value(proc, now))
+		}
+		rows = append(rows, row)
+	}
+	for _, row := range rows {
+		var line []string
+		for i, col := range cols {
+			v := row[i]
+			switch {
+			case i == len(cols)-1 && col.left:
+				// Last column is not padded
+			case col.left:
+				v = fmt.Sprintf("%-*s", col.width, v)
+			default:
+				v = fmt.Sprintf("%*s", col.width, v)
+			}
+			line = append(line, v)
+		}
+		fmt.Fprintln(sys.Out(), strings.Join(line, " "))
+	}
+}
+
+// procUser returns the name of the user as shown by ps, which is cut to 8
+// characters
+func procUser(uid int) string {
+	name := honeyos.GetUserByID(uid).Name
+	if len(name) == 0 {
+		return strconv.Itoa(uid)
+	}
+	if len(name) > 8 {
+		name = name[:7] + "+"
+	}
+	return name
+}
+
+func memPercent(p honeyos.Process) float64 {
+	return float64(p.RSS) * 100 / float64(honeyos.CurrentPersona().MemTotal)
+}
+
+// startTime returns the time the process started, or the date if it is
+// not started today
+func startTime(start, now time.Time) string {
+	switch {
+	case now.Sub(start) < 24*time.Hour && start.Day() == now.Day():
+		return start.Format("15:04")
+	case start.Year() == now.Year():
+		return start.Format("Jan02")
+	}
+	return start.Format("2006")
+}
+
+// cpuSeconds returns the CPU time used by the process
+func cpuSeconds(p honeyos.Process, now time.Time) int {
+	return int(now.Sub(p.Start).Seconds() * p.CPU / 100)
+}
+
+func bsdTime(p honeyos.Process, now time.Time) string {
+	s := cpuSeconds(p, now)
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+func cpuTime(p honeyos.Process, now time.Time) string {
+	s := cpuSeconds(p, now)
+	if s >= 86400 {
+		return fmt.Sprintf("%d-%02d:%02d:%02d", s/86400, s/3600%24, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+func elapsedTime(p honeyos.Process, now time.Time) string {
+	s := int(now.Sub(p.Start).Seconds())
+	switch {
+	case s >= 86400:
+		return fmt.Sprintf("%d-%02d:%02d:%02d", s/86400, s/3600%24, s/60%60, s%60)
+	case s >= 3600:
+		return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
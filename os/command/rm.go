@@ -0,0 +1,220 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+type rm struct{}
+
+// rmOptions are the options given to rm
+type rmOptions struct {
+	force, recursive, dir, verbose bool
+	interactive, once              bool
+}
+
+func init() {
+	honeyos.RegisterCommand("rm", rm{})
+}
+
+func (rm) GetHelp() string {
+	return `Usage: rm [OPTION]... FILE...
+Remove (unlink) the FILE(s).
+
+  -f, --force           ignore nonexistent files and arguments, never prompt
+  -i                    prompt before every removal
+  -I                    prompt once before removing more than three files, or
+                          when removing recursively; less intrusive than -i,
+                          while still giving protection against most mistakes
+      --interactive[=WHEN]  prompt according to WHEN: never, once (-I), or
+                          always (-i); without WHEN, prompt always
+      --one-file-system  when removing a hierarchy recursively, skip any
+                          directory that is on a file system different from
+                          that of the corresponding command line argument
+      --no-preserve-root  do not treat '/' specially
+      --preserve-root   do not remove '/' (default)
+  -r, -R, --recursive   remove directories and their contents recursively
+  -d, --dir             remove empty directories
+  -v, --verbose         explain what is being done
+      --help     display this help and exit
+      --version  output version information and exit
+
+By default, rm does not remove directories.  Use the --recursive (-r or -R)
+option to remove each listed directory, too, along with all of its contents.
+
+To remove a file whose name starts with a '-', for example '-foo',
+use one of these commands:
+  rm -- -foo
+
+  rm ./-foo
+
+Note that if you use rm to remove a file, it might be possible to recover
+some of its contents, given sufficient expertise and/or time.  For greater
+assurance that the contents are truly unrecoverable, consider using shred.
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/rm>
+or available locally via: info '(coreutils) rm invocation'
+`
+}
+
+func (r rm) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "fiIrRdv",
+		long: map[string]string{
+			"force": "f", "interactive?": "interactive", "recursive": "r", "dir": "d", "verbose": "v",
+			"one-file-system": "one-file-system", "no-preserve-root": "no-preserve-root",
+			"preserve-root": "preserve-root", "help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "rm", err)
+	}
+	var o rmOptions
+	preserveRoot := true
+	for _, opt := range opts {
+		switch opt.name {
+		case "f":
+			o.force, o.interactive, o.once = true, false, false
+		case "i":
+			o.force, o.interactive, o.once = false, true, false
+		case "I":
+			o.force, o.interactive, o.once = false, false, true
+		case "interactive":
+			switch opt.value {
+			case "", "always", "yes":
+				o.force, o.interactive, o.once = false, true, false
+			case "once":
+				o.force, o.interactive, o.once = false, false, true
+			case "never", "no", "none":
+				o.interactive, o.once = false, false
+			default:
+				fmt.Fprintf(sys.Err(), "rm: invalid argument %v for '--interactive'\n", quote(opt.value))
+				fmt.Fprintln(sys.Err(), "Valid arguments are:\n  - 'never', 'no', 'none'\n  - 'once'\n  - 'always', 'yes'")
+				fmt.Fprintln(sys.Err(), "Try 'rm --help' for more information.")
+				return 1
+			}
+		case "r", "R":
+			o.recursive = true
+		case "d":
+			o.dir = true
+		case "v":
+			o.verbose = true
+		case "no-preserve-root":
+			preserveRoot = false
+		case "preserve-root":
+			preserveRoot = true
+		case "help":
+			fmt.Fprint(sys.Out(), r.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("rm", "Paul Rubin, David MacKenzie, Richard M. Stallman,\nand Jim Meyering"))
+			return 0
+		}
+	}
+	if len(operands) == 0 {
+		if o.force {
+			return 0
+		}
+		return usageError(sys, "rm", "missing operand")
+	}
+	if o.once && (o.recursive || len(operands) > 3) {
+		prompt := fmt.Sprintf("rm: remove %d argument%v", len(operands), plural(len(operands)))
+		if o.recursive {
+			prompt += " recursively"
+		}
+		if !confirm(sys, prompt+"? ") {
+			return 0
+		}
+	}
+	status := 0
+	for _, name := range operands {
+		if base := path.Base(name); base == "." || base == ".." {
+			fmt.Fprintf(sys.Err(), "rm: refusing to remove '.' or '..' directory: skipping %v\n", quote(name))
+			status = 1
+			continue
+		}
+		p := fullPath(sys, name)
+		if o.recursive && preserveRoot && p == "/" {
+			fmt.Fprintln(sys.Err(), "rm: it is dangerous to operate recursively on '/'")
+			fmt.Fprintln(sys.Err(), "rm: use --no-preserve-root to override this failsafe")
+			status = 1
+			continue
+		}
+		if !r.remove(sys, p, name, o) {
+			status = 1
+		}
+	}
+	return status
+}
+
+// remove deletes the file, or the directory with its content when
+// recursive, and reports if everything has been removed
+func (r rm) remove(sys honeyos.Sys, p, name string, o rmOptions) bool {
+	fs := sys.FSys()
+	// Stat does not follow the last link, so links to directories are
+	// removed rather than descended into
+	fi, err := fs.Stat(p)
+	if err != nil {
+		if o.force && os.IsNotExist(err) {
+			return true
+		}
+		fmt.Fprintf(sys.Err(), "rm: cannot remove %v: %v\n", quote(name), honeyos.ErrnoString(err))
+		return false
+	}
+	kind := "regular file"
+	switch {
+	case fi.IsDir():
+		kind = "directory"
+	case fi.Size() == 0:
+		kind = "regular empty file"
+	}
+	if fi.IsDir() {
+		if !o.recursive && !o.dir {
+			fmt.Fprintf(sys.Err(), "rm: cannot remove %v: Is a directory\n", quote(name))
+			return false
+		}
+		if o.recursive {
+			entries, err := afero.ReadDir(fs, p)
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "rm: cannot remove %v: %v\n", quote(name), honeyos.ErrnoString(err))
+				return false
+			}
+			if len(entries) > 0 && o.interactive && !confirm(sys, fmt.Sprintf("rm: descend into directory %v? ", quote(name))) {
+				return false
+			}
+			ok := true
+			for _, entry := range entries {
+				ok = r.remove(sys, path.Join(p, entry.Name()), path.Join(name, entry.Name()), o) && ok
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+	if o.interactive && !confirm(sys, fmt.Sprintf("rm: remove %v %v? ", kind, quote(name))) {
+		return false
+	}
+	if err := removeFile(fs, p); err != nil {
+		fmt.Fprintf(sys.Err(), "rm: cannot remove %v: %v\n", quote(name), honeyos.ErrnoString(err))
+		return false
+	}
+	sys.FsEvent("remove", p, log.Fields{"cmd": "rm", "type": kind})
+	if o.verbose {
+		if fi.IsDir() {
+			fmt.Fprintf(sys.Out(), "removed directory: %v\n", quote(name))
+		} else {
+			fmt.Fprintf(sys.Out(), "removed %v\n", quote(name))
+		}
+	}
+	return true
+}
+
+func (rm) Where() string {
+	return "/bin/rm"
+}
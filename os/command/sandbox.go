@@ -0,0 +1,328 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	urllib "net/url"
+	"strconv"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Limits of live transfers when not configured
+const (
+	defaultMaxSize        = 10 << 20
+	defaultConnectTimeout = 10 * time.Second
+	defaultMaxRedirects   = 5
+)
+
+// defaultDenylist are the destinations never connected to unless the
+// denylist is configured: the loopback, private, link-local, shared,
+// multicast and reserved networks
+var defaultDenylist = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4",
+	"240.0.0.0/4", "::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+}
+
+// errDenied is the error of connecting to a host in the denylist, which
+// the downloaders report as a refused connection
+var errDenied = errors.New("connection refused")
+
+// downloadLimits are the limits applied to live transfers of all the
+// downloaders, read from the download section of the configuration
+type downloadLimits struct {
+	// maxSize is the largest body read, in bytes
+	maxSize        int64
+	timeout        time.Duration
+	connectTimeout time.Duration
+	maxRedirects   int
+	denylist       []*net.IPNet
+	// proxy is the http or socks5 proxy connections are made
+	// through, if any
+	proxy *urllib.URL
+}
+
+// currentLimits returns the limits in the configuration
+func currentLimits() downloadLimits {
+	lim := downloadLimits{
+		maxSize:        viper.GetInt64("download.maxSize"),
+		timeout:        viper.GetDuration("download.timeout"),
+		connectTimeout: viper.GetDuration("download.connectTimeout"),
+		maxRedirects:   defaultMaxRedirects,
+	}
+	if lim.maxSize <= 0 {
+		lim.maxSize = defaultMaxSize
+	}
+	if lim.timeout <= 0 {
+		lim.timeout = downloadTimeout
+	}
+	if lim.connectTimeout <= 0 || lim.connectTimeout > lim.timeout {
+		lim.connectTimeout = minDuration(defaultConnectTimeout, lim.timeout)
+	}
+	if viper.IsSet("download.maxRedirects") {
+		lim.maxRedirects = viper.GetInt("download.maxRedirects")
+	}
+	denylist := defaultDenylist
+	if viper.IsSet("download.denylist") {
+		denylist = viper.GetStringSlice("download.denylist")
+	}
+	for _, entry := range denylist {
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			lim.denylist = append(lim.denylist, cidr)
+		} else if ip := net.ParseIP(entry); ip != nil {
+			lim.denylist = append(lim.denylist, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		} else {
+			log.WithField("entry", entry).Warning("Invalid download denylist entry")
+		}
+	}
+	if proxy := viper.GetString("download.proxy"); len(proxy) > 0 {
+		u, err := urllib.Parse(proxy)
+		if err == nil && (u.Scheme == "http" || u.Scheme == "socks5") {
+			lim.proxy = u
+		} else {
+			log.WithField("proxy", proxy).Warning("Invalid download proxy, connecting directly")
+		}
+	}
+	return lim
+}
+
+// requestTimeout returns the time allowed for the transfer, which is the
+// one given by the command but never longer than the limit
+func (lim downloadLimits) requestTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 || timeout > lim.timeout {
+		return lim.timeout
+	}
+	return timeout
+}
+
+// denied checks if the address is in the denylist
+func (lim downloadLimits) denied(ip net.IP) bool {
+	for _, cidr := range lim.denylist {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTarget looks up the host and returns the addresses it resolves to
+// with the first one allowed by the denylist. A host with no allowed
+// address is logged and fails with errDenied
+func resolveTarget(ctx context.Context, sys honeyos.Sys, cmd string, lim downloadLimits, host string) (addrs []net.IP, target net.IP, err error) {
+	if ip := net.ParseIP(host); ip != nil {
+		addrs = []net.IP{ip}
+	} else {
+		ipAddrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, a := range ipAddrs {
+			addrs = append(addrs, a.IP)
+		}
+	}
+	for _, ip := range addrs {
+		if !lim.denied(ip) {
+			return addrs, ip, nil
+		}
+	}
+	sys.LogEvent("Download blocked", log.Fields{
+		"cmd":   cmd,
+		"host":  host,
+		"addrs": fmt.Sprint(addrs),
+	})
+	return addrs, nil, errDenied
+}
+
+// dialTarget connects to the port of the host over TCP, directly or
+// through the proxy. The address connected to is the one checked against
+// the denylist, so that names changing their records between lookups
+// cannot reach internal hosts
+func dialTarget(ctx context.Context, sys honeyos.Sys, cmd string, lim downloadLimits, host, port string) (net.Conn, error) {
+	_, ip, err := resolveTarget(ctx, sys, cmd, lim, host)
+	if err != nil {
+		return nil, err
+	}
+	return dialAddr(ctx, lim, net.JoinHostPort(ip.String(), port))
+}
+
+// dialAddr connects to the address, which is already checked against the
+// denylist
+func dialAddr(ctx context.Context, lim downloadLimits, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: lim.connectTimeout}
+	if lim.proxy == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	proxyAddr := lim.proxy.Host
+	if len(lim.proxy.Port()) == 0 {
+		proxyAddr = net.JoinHostPort(lim.proxy.Hostname(), map[string]string{"http": "80", "socks5": "1080"}[lim.proxy.Scheme])
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tunnel := conn
+	if lim.proxy.Scheme == "socks5" {
+		err = socksConnect(conn, lim.proxy.User, addr)
+	} else {
+		tunnel, err = httpConnect(conn, lim.proxy.User, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// bufferedConn is a connection whose first bytes were read ahead into the
+// reader
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// httpConnect opens a tunnel to the address with the CONNECT method of
+// the HTTP proxy
+func httpConnect(conn net.Conn, user *urllib.Userinfo, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &urllib.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		pass, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+pass)))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy refused connection: %v", resp.Status)
+	}
+	return &bufferedConn{conn, r}, nil
+}
+
+// socksConnect opens a connection to the address through the SOCKS5 proxy
+// as described in RFC 1928, with the username and password authentication
+// of RFC 1929 if the user is given
+func socksConnect(conn net.Conn, user *urllib.Userinfo, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+	method := byte(0)
+	if user != nil {
+		method = 2
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return errors.New("proxy refused authentication method")
+	}
+	if user != nil {
+		pass, _ := user.Password()
+		auth := []byte{1, byte(len(user.Username()))}
+		auth = append(auth, user.Username()...)
+		auth = append(auth, byte(len(pass)))
+		auth = append(auth, pass...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("proxy authentication failed")
+		}
+	}
+	req := []byte{5, 1, 0}
+	ip := net.ParseIP(host)
+	if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 1), ip4...)
+	} else if ip != nil {
+		req = append(append(req, 4), ip.To16()...)
+	} else {
+		req = append(append(req, 3, byte(len(host))), host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("proxy refused connection: code %v", head[1])
+	}
+	// Skip the bound address
+	n := 0
+	switch head[3] {
+	case 1:
+		n = net.IPv4len
+	case 4:
+		n = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(conn, head[:1]); err != nil {
+			return err
+		}
+		n = int(head[0])
+	}
+	_, err = io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
+
+// errTooLargeBody is the error of a body exceeding the size limit, which
+// the downloaders report as a reset connection
+var errTooLargeBody = errors.New("connection reset by peer")
+
+// readLimited reads the body up to the size limit. A larger body is cut at
+// the limit and returned with errTooLargeBody
+func readLimited(r io.Reader, lim downloadLimits) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, lim.maxSize+1))
+	if int64(len(b)) > lim.maxSize {
+		return b[:lim.maxSize], errTooLargeBody
+	}
+	return b, err
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -2,6 +2,7 @@ package command
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/mkishere/sshsyrup/util/capture"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
 	"github.com/spf13/pflag"
@@ -108,7 +110,8 @@ func (scp *SCP) sinkMode(path string, isRecursive bool) int {
 			}
 
 			scp.sendReply(scp_OK)
-			n, err := io.CopyN(f, scp.buf, int64(size))
+			var content bytes.Buffer
+			n, err := io.CopyN(io.MultiWriter(f, &content), scp.buf, int64(size))
 			scp.log.WithFields(log.Fields{
 				"path": realPath,
 				"size": n,
@@ -124,6 +127,7 @@ func (scp *SCP) sinkMode(path string, isRecursive bool) int {
 			}
 			scp.sendReply(scp_OK)
 			f.Close()
+			capture.Capture(scp.log, content.Bytes(), capture.Source{Method: "scp", Path: realPath})
 		case 'D':
 			args := strings.Split(cmd[:len(cmd)-1], " ")
 			if len(args) < 3 {
@@ -160,7 +164,7 @@ func (scp *SCP) sourceMode(path string, isRecursive bool) int {
 	cwd := path
 	dirLevel := 0
 	if isRecursive {
-		fs := afero.Afero{scp.Fs}
+		fs := afero.Afero{Fs: scp.Fs}
 		fs.Walk(path, func(p string, info os.FileInfo, err error) error {
 			p = strings.Replace(p, "\\", "/", -1)
 			if !strings.HasPrefix(p, cwd) {
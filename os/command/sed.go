@@ -0,0 +1,791 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+)
+
+type sed struct{}
+
+// sedAddr is an address of a sed command, a line number, the last line or
+// the lines matching a regular expression
+type sedAddr struct {
+	line int
+	last bool
+	re   *regexp.Regexp
+}
+
+// sedCmd is one parsed command of the script
+type sedCmd struct {
+	addr1, addr2 *sedAddr
+	negate       bool
+	inRange      bool
+	name         byte
+	re           *regexp.Regexp
+	repl         string
+	global       bool
+	nth          int
+	print        bool
+	text         string
+	exitCode     int
+	from, to     []rune
+	block        []*sedCmd
+}
+
+// sedError is an error in the script, reported with the position
+type sedError struct {
+	expr, char int
+	msg        string
+}
+
+// sedParser parses one -e expression of the script
+type sedParser struct {
+	src      string
+	pos      int
+	expr     int
+	extended bool
+}
+
+// sedState is the state of the execution over the input lines
+type sedState struct {
+	sys      honeyos.Sys
+	quiet    bool
+	lines    []string
+	index    int
+	lineNo   int
+	last     bool
+	space    string
+	hold     string
+	appended []string
+	out      *bytes.Buffer
+	lastRe   *regexp.Regexp
+	quit     bool
+	exitCode int
+}
+
+func init() {
+	honeyos.RegisterCommand("sed", sed{})
+}
+
+func (sed) GetHelp() string {
+	return `Usage: sed [OPTION]... {script-only-if-no-other-script} [input-file]...
+
+  -n, --quiet, --silent
+                 suppress automatic printing of pattern space
+  -e script, --expression=script
+                 add the script to the commands to be executed
+  -f script-file, --file=script-file
+                 add the contents of script-file to the commands to be executed
+  --follow-symlinks
+                 follow symlinks when processing in place
+  -i[SUFFIX], --in-place[=SUFFIX]
+                 edit files in place (makes backup if SUFFIX supplied)
+  -l N, --line-length=N
+                 specify the desired line-wrap length for the 'l' command
+  --posix
+                 disable all GNU extensions.
+  -r, --regexp-extended
+                 use extended regular expressions in the script.
+  -s, --separate
+                 consider files as separate rather than as a single
+                 continuous long stream.
+  -u, --unbuffered
+                 load minimal amounts of data from the input files and flush
+                 the output buffers more often
+  -z, --null-data
+                 separate lines by NUL characters
+      --help     display this help and exit
+      --version  output version information and exit
+
+If no -e, --expression, -f, or --file option is given, then the first
+non-option argument is taken as the sed script to interpret.  All
+remaining arguments are names of input files; if no input files are
+specified, then the standard input is read.
+
+GNU sed home page: <http://www.gnu.org/software/sed/>.
+General help using GNU software: <http://www.gnu.org/gethelp/>.
+`
+}
+
+func (s sed) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "ne:f:i?l:rEsuz",
+		long: map[string]string{
+			"quiet": "n", "silent": "n", "expression=": "e", "file=": "f", "follow-symlinks": "follow-symlinks",
+			"in-place?": "i", "line-length=": "l", "posix": "posix", "regexp-extended": "r", "separate": "s",
+			"unbuffered": "u", "null-data": "z", "help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "sed: %v\n", err)
+		fmt.Fprint(sys.Err(), s.GetHelp())
+		return 1
+	}
+	quiet, extended, separate, inPlace := false, false, false, false
+	suffix := ""
+	var exprs []string
+	for _, opt := range opts {
+		switch opt.name {
+		case "n":
+			quiet = true
+		case "e":
+			exprs = append(exprs, opt.value)
+		case "f":
+			f, err := openInput(sys, opt.value)
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "sed: couldn't open file %v: %v\n", opt.value, honeyos.ErrnoString(err))
+				return 1
+			}
+			content, _ := ioutil.ReadAll(f)
+			f.Close()
+			exprs = append(exprs, strings.TrimSuffix(string(content), "\n"))
+		case "i":
+			inPlace, separate, suffix = true, true, opt.value
+		case "r", "E":
+			extended = true
+		case "s":
+			separate = true
+		case "help":
+			fmt.Fprint(sys.Out(), s.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), "sed (GNU sed) 4.2.2\nCopyright (C) 2012 Free Software Foundation, Inc.\n"+
+				"License GPLv3+: GNU GPL version 3 or later <http://gnu.org/licenses/gpl.html>.\n"+
+				"This is free software: you are free to change and redistribute it.\n"+
+				"There is NO WARRANTY, to the extent permitted by law.\n\n"+
+				"Written by Jay Fenlason, Tom Lord, Ken Pizzini,\nand Paolo Bonzini.\n"+
+				"GNU sed home page: <http://www.gnu.org/software/sed/>.\n"+
+				"General help using GNU software: <http://www.gnu.org/gethelp/>.\n"+
+				"E-mail bug reports to: <bug-sed@gnu.org>.\n"+
+				"Be sure to include the word ``sed'' somewhere in the ``Subject:'' field.\n")
+			return 0
+		}
+	}
+	if len(exprs) == 0 {
+		if len(operands) == 0 {
+			fmt.Fprint(sys.Err(), s.GetHelp())
+			return 1
+		}
+		exprs, operands = operands[:1], operands[1:]
+	}
+	var cmds []*sedCmd
+	for i, expr := range exprs {
+		p := &sedParser{src: expr, expr: i + 1, extended: extended}
+		parsed, err := p.parse()
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "sed: -e expression #%v, char %v: %v\n", err.expr, err.char, err.msg)
+			return 1
+		}
+		cmds = append(cmds, parsed...)
+	}
+	if inPlace && len(operands) == 0 {
+		fmt.Fprintln(sys.Err(), "sed: no input files")
+		return 4
+	}
+	if len(operands) == 0 {
+		operands = []string{"-"}
+	}
+	st := &sedState{sys: sys, quiet: quiet}
+	status := 0
+	// The files are one stream unless they are edited in place or -s
+	groups := [][]string{operands}
+	if separate {
+		groups = nil
+		for _, name := range operands {
+			groups = append(groups, []string{name})
+		}
+	}
+	var stdout bytes.Buffer
+	for _, group := range groups {
+		var lines []string
+		failed := false
+		for _, name := range group {
+			f, err := openInput(sys, name)
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "sed: can't read %v: %v\n", name, honeyos.ErrnoString(err))
+				status, failed = 2, true
+				continue
+			}
+			l, _ := readLines(f)
+			f.Close()
+			lines = append(lines, l...)
+		}
+		if inPlace && failed {
+			continue
+		}
+		if separate {
+			st.lineNo = 0
+		}
+		out := &stdout
+		if inPlace {
+			out = &bytes.Buffer{}
+		}
+		st.out = out
+		st.run(cmds, lines)
+		if inPlace {
+			name := group[0]
+			p := fullPath(sys, name)
+			if len(suffix) > 0 {
+				// A '*' in the suffix is replaced with the file name, and the
+				// backup goes in the same directory unless it has a slash
+				backup := p + suffix
+				if strings.Contains(suffix, "*") {
+					backup = strings.Replace(suffix, "*", path.Base(p), -1)
+					if !strings.Contains(backup, "/") {
+						backup = path.Join(path.Dir(p), backup)
+					}
+					backup = fullPath(sys, backup)
+				}
+				if err := writeWhole(sys, backup, []byte(strings.Join(lines, "\n")+"\n")); err == nil {
+					sys.FsEvent("write", backup, log.Fields{"cmd": "sed"})
+				}
+			}
+			if err := writeWhole(sys, p, out.Bytes()); err != nil {
+				fmt.Fprintf(sys.Err(), "sed: couldn't open file %v: %v\n", name, honeyos.ErrnoString(err))
+				status = 4
+			} else {
+				sys.FsEvent("write", p, log.Fields{"cmd": "sed"})
+			}
+		}
+		if st.quit {
+			break
+		}
+	}
+	sys.Out().Write(stdout.Bytes())
+	if st.quit {
+		return st.exitCode
+	}
+	return status
+}
+
+func (sed) Where() string {
+	return "/bin/sed"
+}
+
+// writeWhole replaces the content of the file
+func writeWhole(sys honeyos.Sys, p string, content []byte) error {
+	f, err := createFile(sys.FSys(), p, os.O_WRONLY|os.O_TRUNC, 0666&^defaultUmask)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(content)
+	return err
+}
+
+func (p *sedParser) fail(msg string) {
+	panic(&sedError{p.expr, p.pos, msg})
+}
+
+func (p *sedParser) parse() (cmds []*sedCmd, err *sedError) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*sedError)
+			if !ok {
+				panic(r)
+			}
+			cmds, err = nil, e
+		}
+	}()
+	cmds = p.commands(false)
+	return cmds, nil
+}
+
+func (p *sedParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *sedParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// commands parses the commands up to the end of the expression or the
+// closing brace of the block
+func (p *sedParser) commands(inBlock bool) []*sedCmd {
+	var cmds []*sedCmd
+	for {
+		for p.pos < len(p.src) && strings.IndexByte(" \t\n;", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			if inBlock {
+				p.fail("unmatched `{'")
+			}
+			return cmds
+		}
+		if p.peek() == '}' {
+			if !inBlock {
+				p.pos++
+				p.fail("unexpected `}'")
+			}
+			p.pos++
+			return cmds
+		}
+		if p.peek() == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		cmds = append(cmds, p.command())
+	}
+}
+
+func (p *sedParser) command() *sedCmd {
+	c := &sedCmd{}
+	c.addr1 = p.address()
+	if c.addr1 != nil && p.peek() == ',' {
+		p.pos++
+		p.skipSpace()
+		if c.addr2 = p.address(); c.addr2 == nil {
+			p.fail("unexpected `,'")
+		}
+	}
+	p.skipSpace()
+	for p.peek() == '!' {
+		c.negate = true
+		p.pos++
+		p.skipSpace()
+	}
+	if p.pos >= len(p.src) {
+		p.fail("missing command")
+	}
+	c.name = p.src[p.pos]
+	p.pos++
+	switch c.name {
+	case '{':
+		c.block = p.commands(true)
+		return c
+	case 's':
+		p.substitute(c)
+	case 'y':
+		p.transliterate(c)
+	case 'a', 'i', 'c':
+		p.skipSpace()
+		if p.peek() == '\\' {
+			p.pos++
+			if p.peek() == '\n' {
+				p.pos++
+			}
+		}
+		end := strings.IndexByte(p.src[p.pos:], '\n')
+		if end < 0 {
+			end = len(p.src) - p.pos
+		}
+		if end == 0 {
+			p.fail("expected \\ after `a', `c' or `i'")
+		}
+		c.text = string(bytes.Replace([]byte(p.src[p.pos:p.pos+end]), []byte(`\`), nil, -1))
+		p.pos += end
+		return c
+	case 'q', 'Q':
+		if c.addr2 != nil {
+			p.fail("command only uses one address")
+		}
+		p.skipSpace()
+		start := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		c.exitCode, _ = strconv.Atoi(p.src[start:p.pos])
+	case 'd', 'D', 'p', 'P', '=', 'h', 'H', 'g', 'G', 'x', 'n', 'N':
+	default:
+		p.fail(fmt.Sprintf("unknown command: `%c'", c.name))
+	}
+	p.end()
+	return c
+}
+
+// end checks nothing but a separator follows the command
+func (p *sedParser) end() {
+	p.skipSpace()
+	switch p.peek() {
+	case 0, ';', '\n', '}', '#':
+		return
+	}
+	p.pos++
+	p.fail("extra characters after command")
+}
+
+func (p *sedParser) address() *sedAddr {
+	switch c := p.peek(); {
+	case isDigit(c):
+		start := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		n, _ := strconv.Atoi(p.src[start:p.pos])
+		if n == 0 {
+			p.fail("invalid usage of line address 0")
+		}
+		return &sedAddr{line: n}
+	case c == '$':
+		p.pos++
+		return &sedAddr{last: true}
+	case c == '/' || c == '\\':
+		if c == '\\' {
+			p.pos++
+		}
+		delim := p.peek()
+		p.pos++
+		expr, ok := p.delimited(delim, true)
+		if !ok {
+			p.fail("unterminated address regex")
+		}
+		icase := false
+		for p.peek() == 'I' || p.peek() == 'M' {
+			icase = icase || p.peek() == 'I'
+			p.pos++
+		}
+		return &sedAddr{re: p.compile(expr, icase)}
+	}
+	return nil
+}
+
+// delimited reads up to the unescaped delimiter, removing the escape of
+// the delimiter itself
+func (p *sedParser) delimited(delim byte, regex bool) (string, bool) {
+	var buf bytes.Buffer
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == delim:
+			p.pos++
+			return buf.String(), true
+		case c == '\\' && p.pos+1 < len(p.src):
+			p.pos++
+			n := p.src[p.pos]
+			switch {
+			case n == delim:
+				buf.WriteByte(n)
+			case n == 'n' && !regex:
+				buf.WriteByte('\n')
+			case n == '\n':
+				buf.WriteByte('\n')
+			default:
+				buf.WriteByte('\\')
+				buf.WriteByte(n)
+			}
+		case c == '\n' && regex:
+			return "", false
+		default:
+			buf.WriteByte(c)
+		}
+		p.pos++
+	}
+	return "", false
+}
+
+// compile compiles the regular expression, nil standing for the empty
+// regular expression which reuses the last one
+func (p *sedParser) compile(expr string, icase bool) *regexp.Regexp {
+	if len(expr) == 0 {
+		return nil
+	}
+	re, err := compileRegexp(expr, p.extended, icase)
+	if err != nil {
+		p.fail(regexpError(err))
+	}
+	return re
+}
+
+func (p *sedParser) substitute(c *sedCmd) {
+	delim := p.peek()
+	if delim == 0 || delim == '\n' || delim == '\\' {
+		p.fail("unterminated `s' command")
+	}
+	p.pos++
+	expr, ok := p.delimited(delim, true)
+	if !ok {
+		p.fail("unterminated `s' command")
+	}
+	if c.repl, ok = p.delimited(delim, false); !ok {
+		p.fail("unterminated `s' command")
+	}
+	icase := false
+	for p.pos < len(p.src) {
+		f := p.src[p.pos]
+		switch {
+		case f == 'g':
+			c.global = true
+		case f == 'p':
+			c.print = true
+		case f == 'i' || f == 'I':
+			icase = true
+		case f == 'm' || f == 'M' || f == 'e':
+		case isDigit(f):
+			start := p.pos
+			for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+				p.pos++
+			}
+			c.nth, _ = strconv.Atoi(p.src[start:p.pos])
+			if c.nth == 0 {
+				p.fail("number option to `s' command may not be zero")
+			}
+			continue
+		case f == 'w':
+			p.fail("missing filename in r/R/w/W commands")
+		case strings.IndexByte(" \t;\n}#", f) >= 0:
+			c.re = p.compile(expr, icase)
+			return
+		default:
+			p.pos++
+			p.fail("unknown option to `s'")
+		}
+		p.pos++
+	}
+	c.re = p.compile(expr, icase)
+}
+
+func (p *sedParser) transliterate(c *sedCmd) {
+	delim := p.peek()
+	p.pos++
+	from, ok := p.delimited(delim, false)
+	if !ok {
+		p.fail("unterminated `y' command")
+	}
+	to, ok := p.delimited(delim, false)
+	if !ok {
+		p.fail("unterminated `y' command")
+	}
+	unescape := strings.NewReplacer(`\\`, `\`, `\t`, "\t")
+	c.from, c.to = []rune(unescape.Replace(from)), []rune(unescape.Replace(to))
+	if len(c.from) != len(c.to) {
+		p.fail("strings for `y' command are different lengths")
+	}
+}
+
+// run runs the script over the lines of one stream
+func (st *sedState) run(cmds []*sedCmd, lines []string) {
+	st.lines, st.index = lines, 0
+	for !st.quit && st.next() {
+		deleted := st.exec(cmds)
+		if !deleted && !st.quiet {
+			st.out.WriteString(st.space + "\n")
+		}
+		st.flushAppended()
+	}
+}
+
+// next reads the next line into the pattern space
+func (st *sedState) next() bool {
+	if st.index >= len(st.lines) {
+		return false
+	}
+	st.space = st.lines[st.index]
+	st.index++
+	st.lineNo++
+	st.last = st.index == len(st.lines)
+	return true
+}
+
+func (st *sedState) flushAppended() {
+	for _, text := range st.appended {
+		st.out.WriteString(text + "\n")
+	}
+	st.appended = nil
+}
+
+func (st *sedState) matchAddr(a *sedAddr) bool {
+	switch {
+	case a.last:
+		return st.last
+	case a.re != nil:
+		st.lastRe = a.re
+		return a.re.MatchString(st.space)
+	case a.line > 0:
+		return st.lineNo == a.line
+	}
+	// The empty regular expression matches with the last one used
+	return st.lastRe != nil && st.lastRe.MatchString(st.space)
+}
+
+func (st *sedState) selected(c *sedCmd) bool {
+	var ok bool
+	switch {
+	case c.addr1 == nil:
+		ok = true
+	case c.addr2 == nil:
+		ok = st.matchAddr(c.addr1)
+	case c.inRange:
+		ok = true
+		if c.addr2.line > 0 && c.addr2.re == nil {
+			c.inRange = st.lineNo < c.addr2.line
+		} else if st.matchAddr(c.addr2) {
+			c.inRange = false
+		}
+	case st.matchAddr(c.addr1):
+		ok = true
+		// A line number end which is already passed ends the range at once
+		c.inRange = !(c.addr2.line > 0 && c.addr2.re == nil && c.addr2.line <= st.lineNo) &&
+			!(c.addr2.last && st.last)
+	}
+	return ok != c.negate
+}
+
+// exec runs the commands on the pattern space, reporting if it was
+// deleted so that it is not printed
+func (st *sedState) exec(cmds []*sedCmd) bool {
+	for _, c := range cmds {
+		if st.quit || !st.selected(c) {
+			continue
+		}
+		switch c.name {
+		case '{':
+			if st.exec(c.block) {
+				return true
+			}
+		case 's':
+			re := c.re
+			if re == nil {
+				re = st.lastRe
+			}
+			if re == nil {
+				fmt.Fprintln(st.sys.Err(), "sed: no previous regular expression")
+				st.quit, st.exitCode = true, 1
+				return true
+			}
+			st.lastRe = re
+			if replaced, ok := sedSubstitute(re, st.space, c.repl, c.global, c.nth); ok {
+				st.space = replaced
+				if c.print {
+					st.out.WriteString(st.space + "\n")
+				}
+			}
+		case 'y':
+			st.space = strings.Map(func(r rune) rune {
+				for i, f := range c.from {
+					if f == r {
+						return c.to[i]
+					}
+				}
+				return r
+			}, st.space)
+		case 'd':
+			return true
+		case 'D':
+			if i := strings.IndexByte(st.space, '\n'); i >= 0 {
+				st.space = st.space[i+1:]
+				st.index--
+				st.lineNo--
+				st.lines[st.index] = st.space
+			}
+			return true
+		case 'p':
+			st.out.WriteString(st.space + "\n")
+		case 'P':
+			first := st.space
+			if i := strings.IndexByte(first, '\n'); i >= 0 {
+				first = first[:i]
+			}
+			st.out.WriteString(first + "\n")
+		case '=':
+			fmt.Fprintf(st.out, "%v\n", st.lineNo)
+		case 'a':
+			st.appended = append(st.appended, c.text)
+		case 'i':
+			st.out.WriteString(c.text + "\n")
+		case 'c':
+			if c.addr2 == nil || !c.inRange {
+				st.out.WriteString(c.text + "\n")
+			}
+			return true
+		case 'h':
+			st.hold = st.space
+		case 'H':
+			st.hold += "\n" + st.space
+		case 'g':
+			st.space = st.hold
+		case 'G':
+			st.space += "\n" + st.hold
+		case 'x':
+			st.space, st.hold = st.hold, st.space
+		case 'n':
+			if !st.quiet {
+				st.out.WriteString(st.space + "\n")
+			}
+			st.flushAppended()
+			if !st.next() {
+				st.quit = true
+				return true
+			}
+		case 'N':
+			current := st.space
+			if !st.next() {
+				st.space = current
+				st.quit = true
+				return false
+			}
+			st.space = current + "\n" + st.space
+		case 'q':
+			st.quit, st.exitCode = true, c.exitCode
+			return false
+		case 'Q':
+			st.quit, st.exitCode = true, c.exitCode
+			return true
+		}
+	}
+	return false
+}
+
+// sedSubstitute replaces the matches of the s command, & and \1 to \9 in
+// the replacement standing for the match and its groups
+func sedSubstitute(re *regexp.Regexp, s, repl string, global bool, nth int) (string, bool) {
+	if nth == 0 {
+		nth = 1
+	}
+	var buf bytes.Buffer
+	count, pos, replaced := 0, 0, false
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		count++
+		if count < nth || !global && count > nth {
+			continue
+		}
+		buf.WriteString(s[pos:m[0]])
+		for i := 0; i < len(repl); i++ {
+			c := repl[i]
+			switch {
+			case c == '&':
+				buf.WriteString(s[m[0]:m[1]])
+			case c == '\\' && i+1 < len(repl):
+				i++
+				switch n := repl[i]; {
+				case isDigit(n):
+					g := int(n - '0')
+					if 2*g+1 < len(m) && m[2*g] >= 0 {
+						buf.WriteString(s[m[2*g]:m[2*g+1]])
+					}
+				case n == 'n':
+					buf.WriteByte('\n')
+				case n == 't':
+					buf.WriteByte('\t')
+				default:
+					buf.WriteByte(n)
+				}
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		pos = m[1]
+		replaced = true
+	}
+	if !replaced {
+		return s, false
+	}
+	buf.WriteString(s[pos:])
+	return buf.String(), true
+}
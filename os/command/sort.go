@@ -0,0 +1,376 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+)
+
+// sortCmd is named not to collide with the sort package
+type sortCmd struct{}
+
+// sortKey is a key given with -k, the fields and characters being counted
+// from 1 and an end field of 0 meaning the end of line
+type sortKey struct {
+	startField, startChar, endField, endChar int
+	numeric, reverse, foldCase, skipBlanks   bool
+}
+
+func init() {
+	honeyos.RegisterCommand("sort", sortCmd{})
+}
+
+func (sortCmd) GetHelp() string {
+	return `Usage: sort [OPTION]... [FILE]...
+  or:  sort [OPTION]... --files0-from=F
+Write sorted concatenation of all FILE(s) to standard output.
+
+With no FILE, or when FILE is -, read standard input.
+
+Mandatory arguments to long options are mandatory for short options too.
+Ordering options:
+
+  -b, --ignore-leading-blanks  ignore leading blanks
+  -d, --dictionary-order      consider only blanks and alphanumeric characters
+  -f, --ignore-case           fold lower case to upper case characters
+  -g, --general-numeric-sort  compare according to general numerical value
+  -n, --numeric-sort          compare according to string numerical value
+  -r, --reverse               reverse the result of comparisons
+
+Other options:
+
+  -c, --check, --check=diagnose-first  check for sorted input; do not sort
+  -k, --key=KEYDEF          sort via a key; KEYDEF gives location and type
+  -o, --output=FILE         write result to FILE instead of standard output
+  -s, --stable              stabilize sort by disabling last-resort comparison
+  -t, --field-separator=SEP  use SEP instead of non-blank to blank transition
+  -u, --unique              with -c, check for strict ordering;
+                              without -c, output only the first of an equal run
+      --help     display this help and exit
+      --version  output version information and exit
+
+KEYDEF is F[.C][OPTS][,F[.C][OPTS]] for start and stop position, where F is a
+field number and C a character position in the field; both are origin 1, and
+the stop position defaults to the line's end.  If neither -t nor -b is in
+effect, characters in a field are counted from the beginning of the preceding
+whitespace.  OPTS is one or more single-letter ordering options [bdfgiMhnRrV],
+which override global ordering options for that key.  If no key is given, use
+the entire line as the key.
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/sort>
+or available locally via: info '(coreutils) sort invocation'
+`
+}
+
+func (s sortCmd) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "bdfgnrck:o:st:uhMV",
+		long: map[string]string{
+			"ignore-leading-blanks": "b", "dictionary-order": "d", "ignore-case": "f",
+			"general-numeric-sort": "g", "numeric-sort": "n", "reverse": "r", "check?": "c",
+			"key=": "k", "output=": "o", "stable": "s", "field-separator=": "t", "unique": "u",
+			"human-numeric-sort": "h", "month-sort": "M", "version-sort": "V",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "sort", err)
+	}
+	var global sortKey
+	var keys []sortKey
+	check, stable, unique := false, false, false
+	output, sep := "", ""
+	for _, opt := range opts {
+		switch opt.name {
+		case "b":
+			global.skipBlanks = true
+		case "f":
+			global.foldCase = true
+		case "g", "n", "h":
+			global.numeric = true
+		case "r":
+			global.reverse = true
+		case "c":
+			check = true
+		case "k":
+			k, ok := parseSortKey(opt.value)
+			if !ok {
+				fmt.Fprintf(sys.Err(), "sort: invalid number at field start: invalid count at start of %v\n", quote(opt.value))
+				return 2
+			}
+			keys = append(keys, k)
+		case "o":
+			output = opt.value
+		case "s":
+			stable = true
+		case "t":
+			if len(opt.value) != 1 {
+				if len(opt.value) == 0 {
+					fmt.Fprintln(sys.Err(), "sort: empty tab")
+				} else {
+					fmt.Fprintf(sys.Err(), "sort: multi-character tab %v\n", quote(opt.value))
+				}
+				return 2
+			}
+			sep = opt.value
+		case "u":
+			unique = true
+		case "help":
+			fmt.Fprint(sys.Out(), s.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("sort", "Mike Haertel and Paul Eggert"))
+			return 0
+		}
+	}
+	// Keys without ordering options inherit the global ones
+	for i, k := range keys {
+		if !k.numeric && !k.reverse && !k.foldCase && !k.skipBlanks {
+			keys[i].numeric, keys[i].reverse = global.numeric, global.reverse
+			keys[i].foldCase, keys[i].skipBlanks = global.foldCase, global.skipBlanks
+		}
+	}
+	if len(operands) == 0 {
+		operands = []string{"-"}
+	}
+	var lines []string
+	for _, name := range operands {
+		f, err := openInput(sys, name)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "sort: cannot read: %v: %v\n", name, honeyos.ErrnoString(err))
+			return 2
+		}
+		l, _ := readLines(f)
+		f.Close()
+		lines = append(lines, l...)
+	}
+	compare := func(a, b string) int {
+		if len(keys) == 0 {
+			return compareKey(a, b, global)
+		}
+		for _, k := range keys {
+			if c := compareKey(extractKey(a, k, sep), extractKey(b, k, sep), k); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	// The whole lines in byte order are the last resort unless -s or -u
+	fullCompare := func(a, b string) int {
+		c := compare(a, b)
+		if c == 0 && !stable && !unique {
+			c = strings.Compare(a, b)
+			if global.reverse {
+				c = -c
+			}
+		}
+		return c
+	}
+	if check {
+		for i := 1; i < len(lines); i++ {
+			if c := fullCompare(lines[i-1], lines[i]); c > 0 || unique && c == 0 {
+				fmt.Fprintf(sys.Err(), "sort: %v:%v: disorder: %v\n", operands[0], i+1, lines[i])
+				return 1
+			}
+		}
+		return 0
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return fullCompare(lines[i], lines[j]) < 0
+	})
+	var buf bytes.Buffer
+	for i, l := range lines {
+		if unique && i > 0 && compare(lines[i-1], l) == 0 {
+			continue
+		}
+		buf.WriteString(l + "\n")
+	}
+	if len(output) == 0 {
+		sys.Out().Write(buf.Bytes())
+		return 0
+	}
+	p := fullPath(sys, output)
+	f, err := createFile(sys.FSys(), p, os.O_WRONLY|os.O_TRUNC, 0666&^defaultUmask)
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "sort: open failed: %v: %v\n", output, honeyos.ErrnoString(err))
+		return 2
+	}
+	defer f.Close()
+	f.Write(buf.Bytes())
+	sys.FsEvent("write", p, log.Fields{"cmd": "sort"})
+	return 0
+}
+
+// parseSortKey parses the KEYDEF of -k
+func parseSortKey(def string) (sortKey, bool) {
+	var k sortKey
+	parsePos := func(pos string) (field, char int, ok bool) {
+		end := strings.IndexAny(pos, "bdfgiMhnRrV")
+		flags := ""
+		if end >= 0 {
+			pos, flags = pos[:end], pos[end:]
+		}
+		for _, f := range flags {
+			switch f {
+			case 'b':
+				k.skipBlanks = true
+			case 'f':
+				k.foldCase = true
+			case 'g', 'n', 'h':
+				k.numeric = true
+			case 'r':
+				k.reverse = true
+			}
+		}
+		fieldStr, charStr := pos, ""
+		if dot := strings.IndexByte(pos, '.'); dot >= 0 {
+			fieldStr, charStr = pos[:dot], pos[dot+1:]
+		}
+		var err error
+		if field, err = strconv.Atoi(fieldStr); err != nil {
+			return 0, 0, false
+		}
+		if len(charStr) > 0 {
+			if char, err = strconv.Atoi(charStr); err != nil {
+				return 0, 0, false
+			}
+		}
+		return field, char, true
+	}
+	start, end := def, ""
+	if comma := strings.IndexByte(def, ','); comma >= 0 {
+		start, end = def[:comma], def[comma+1:]
+	}
+	var ok bool
+	if k.startField, k.startChar, ok = parsePos(start); !ok || k.startField < 1 {
+		return k, false
+	}
+	if len(end) > 0 {
+		if k.endField, k.endChar, ok = parsePos(end); !ok || k.endField < 1 {
+			return k, false
+		}
+	}
+	return k, true
+}
+
+// sortFields returns the start offsets of the fields of the line, with
+// the leading blanks belonging to the field when there is no separator
+func sortFields(line, sep string) []int {
+	starts := []int{0}
+	if len(sep) > 0 {
+		for i := 0; i < len(line); i++ {
+			if line[i] == sep[0] {
+				starts = append(starts, i+1)
+			}
+		}
+		return starts
+	}
+	for i := 1; i < len(line); i++ {
+		if isBlank(line[i]) && !isBlank(line[i-1]) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// extractKey returns the part of the line the key refers to
+func extractKey(line string, k sortKey, sep string) string {
+	starts := sortFields(line, sep)
+	fieldEnd := func(n int) int {
+		if n < len(starts) {
+			end := starts[n]
+			if len(sep) > 0 {
+				end--
+			}
+			return end
+		}
+		return len(line)
+	}
+	if k.startField > len(starts) {
+		return ""
+	}
+	begin := starts[k.startField-1]
+	if k.skipBlanks {
+		for begin < len(line) && isBlank(line[begin]) {
+			begin++
+		}
+	}
+	if k.startChar > 0 {
+		begin = minInt(begin+k.startChar-1, fieldEnd(k.startField))
+	}
+	end := len(line)
+	if k.endField > 0 {
+		end = fieldEnd(k.endField)
+		if k.endChar > 0 && k.endField <= len(starts) {
+			fieldStart := starts[k.endField-1]
+			if k.skipBlanks {
+				for fieldStart < end && isBlank(line[fieldStart]) {
+					fieldStart++
+				}
+			}
+			end = minInt(fieldStart+k.endChar, end)
+		}
+	}
+	if begin >= end {
+		return ""
+	}
+	return line[begin:end]
+}
+
+// compareKey compares the keys with the ordering options of the key
+func compareKey(a, b string, k sortKey) int {
+	if k.skipBlanks {
+		a, b = strings.TrimLeft(a, " \t"), strings.TrimLeft(b, " \t")
+	}
+	var c int
+	switch {
+	case k.numeric:
+		na, nb := leadingNumber(a), leadingNumber(b)
+		switch {
+		case na < nb:
+			c = -1
+		case na > nb:
+			c = 1
+		}
+	case k.foldCase:
+		c = strings.Compare(strings.ToUpper(a), strings.ToUpper(b))
+	default:
+		c = strings.Compare(a, b)
+	}
+	if k.reverse {
+		c = -c
+	}
+	return c
+}
+
+// leadingNumber parses the number at the start of the string like sort -n,
+// the strings not starting with a number being zero
+func leadingNumber(s string) float64 {
+	s = strings.TrimLeft(s, " \t")
+	end := 0
+	if end < len(s) && s[end] == '-' {
+		end++
+	}
+	dot := false
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' && !dot) {
+		dot = dot || s[end] == '.'
+		end++
+	}
+	n, _ := strconv.ParseFloat(s[:end], 64)
+	return n
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func (sortCmd) Where() string {
+	return "/usr/bin/sort"
+}
@@ -0,0 +1,114 @@
+package command
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"syscall"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+// openInput opens the file given to a text processing command, "-" being
+// the standard input
+func openInput(sys honeyos.Sys, name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return ioutil.NopCloser(sys.In()), nil
+	}
+	p := fullPath(sys, name)
+	fi, err := sys.FSys().Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, syscall.EISDIR
+	}
+	return sys.FSys().Open(p)
+}
+
+// readLines reads the whole input and splits it into lines without the
+// line terminator
+func readLines(r io.Reader) ([]string, error) {
+	content, err := ioutil.ReadAll(r)
+	if len(content) == 0 {
+		return nil, err
+	}
+	content = bytes.TrimSuffix(content, []byte{'\n'})
+	return strings.Split(string(content), "\n"), err
+}
+
+// compileRegexp compiles the basic or extended regular expression of POSIX
+// tools into a leftmost-longest Go regexp
+func compileRegexp(expr string, extended, ignoreCase bool) (*regexp.Regexp, error) {
+	if !extended {
+		expr = breToERE(expr)
+	} else {
+		expr = strings.NewReplacer(`\<`, `\b`, `\>`, `\b`).Replace(expr)
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	re.Longest()
+	return re, nil
+}
+
+// breToERE converts the basic regular expression, where the operators
+// are escaped and the bare characters are literal, to the extended syntax
+func breToERE(expr string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == '\\' && i+1 < len(expr):
+			i++
+			switch n := expr[i]; n {
+			case '|', '+', '?', '(', ')', '{', '}':
+				buf.WriteByte(n)
+			case '<', '>':
+				buf.WriteString(`\b`)
+			default:
+				buf.WriteByte('\\')
+				buf.WriteByte(n)
+			}
+		case c == '[':
+			// Bracket expressions are copied as is, a ] right after the
+			// opening bracket is part of the list
+			j := i + 1
+			if j < len(expr) && expr[j] == '^' {
+				j++
+			}
+			if j < len(expr) && expr[j] == ']' {
+				j++
+			}
+			for j < len(expr) && expr[j] != ']' {
+				if expr[j] == '[' && j+1 < len(expr) && (expr[j+1] == ':' || expr[j+1] == '.' || expr[j+1] == '=') {
+					if end := strings.Index(expr[j+2:], string(expr[j+1])+"]"); end >= 0 {
+						j += end + 4
+						continue
+					}
+				}
+				j++
+			}
+			if j >= len(expr) {
+				buf.WriteString(`\[`)
+				continue
+			}
+			buf.WriteString(expr[i : j+1])
+			i = j
+		case c == '*' && (i == 0 || expr[:i] == "^" || strings.HasSuffix(expr[:i], `\(`)):
+			buf.WriteString(`\*`)
+		case strings.IndexByte("|+?(){}", c) >= 0:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
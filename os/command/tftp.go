@@ -0,0 +1,304 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	urllib "net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+)
+
+// TFTP opcodes of RFC 1350 and RFC 2347
+const (
+	tftpRRQ   = 1
+	tftpDATA  = 3
+	tftpACK   = 4
+	tftpERROR = 5
+	tftpOACK  = 6
+)
+
+const (
+	tftpBlockSize = 512
+	// tftpRetries is the number of times a packet is sent before giving up,
+	// waiting tftpRetryTimeout for the reply each time
+	tftpRetries      = 5
+	tftpRetryTimeout = 3 * time.Second
+)
+
+const tftpUsage = `Usage: tftp [OPTIONS] HOST [PORT]
+
+Transfer a file from/to tftp server
+
+	-l FILE	Local FILE
+	-r FILE	Remote FILE
+	-g	Get file
+	-p	Put file
+	-b SIZE	Transfer blocks of SIZE octets
+`
+
+type tftp struct{}
+
+func init() {
+	honeyos.RegisterCommand("tftp", tftp{})
+}
+
+func (tftp) GetHelp() string {
+	return busyboxBanner + tftpUsage
+}
+
+func (tftp) Where() string {
+	return "/usr/bin/tftp"
+}
+
+func (t tftp) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{short: "l:r:gpb:", long: map[string]string{"help": "help"}})
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "tftp: %v\n", err)
+		fmt.Fprint(sys.Err(), t.GetHelp())
+		return 1
+	}
+	var local, remote string
+	get, put, blksize := false, false, 0
+	for _, opt := range opts {
+		switch opt.name {
+		case "l":
+			local = opt.value
+		case "r":
+			remote = opt.value
+		case "g":
+			get = true
+		case "p":
+			put = true
+		case "b":
+			blksize, err = strconv.Atoi(opt.value)
+			if err != nil || blksize < 8 || blksize > 65464 {
+				fmt.Fprintf(sys.Err(), "tftp: bad blocksize '%v'\n", opt.value)
+				return 1
+			}
+		case "help":
+			fmt.Fprint(sys.Out(), t.GetHelp())
+			return 0
+		}
+	}
+	if len(remote) == 0 {
+		remote = local
+	}
+	if len(local) == 0 {
+		local = path.Base(strings.TrimRight(remote, "/"))
+	}
+	if get == put || len(remote) == 0 || len(operands) < 1 || len(operands) > 2 {
+		fmt.Fprint(sys.Err(), t.GetHelp())
+		return 1
+	}
+	host, port := operands[0], "69"
+	if len(operands) > 1 {
+		port = operands[1]
+	}
+	if put {
+		// Uploads are never sent out, the server appears not to answer
+		b, err := readInput(sys, local)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "tftp: can't open '%v': %v\n", local, honeyos.ErrnoString(err))
+			return 1
+		}
+		sys.LogEvent("File upload attempted", log.Fields{
+			"cmd":    "tftp",
+			"host":   host,
+			"port":   port,
+			"remote": remote,
+			"local":  local,
+			"size":   len(b),
+		})
+		time.Sleep(tftpRetryTimeout)
+		fmt.Fprintln(sys.Err(), "tftp: timeout")
+		return 1
+	}
+	u := &urllib.URL{Scheme: "tftp", Host: net.JoinHostPort(host, port), Path: "/" + remote}
+	if blksize > 0 {
+		u.RawQuery = "blksize=" + strconv.Itoa(blksize)
+	}
+	d, err := fetch(sys, &downloadRequest{cmd: "tftp", method: "RRQ", url: u})
+	if err != nil {
+		de, _ := err.(*downloadError)
+		switch {
+		case de == nil:
+			fmt.Fprintf(sys.Err(), "tftp: %v\n", err)
+		case de.kind == errResolve:
+			fmt.Fprintf(sys.Err(), "tftp: bad address '%v'\n", host)
+		case de.kind == errTimeout:
+			fmt.Fprintln(sys.Err(), "tftp: timeout")
+		default:
+			if te, ok := de.err.(*tftpError); ok {
+				fmt.Fprintf(sys.Err(), "tftp: server error: (%v) %v\n", te.code, te.msg)
+			} else {
+				fmt.Fprintln(sys.Err(), "tftp: read error: Connection refused")
+			}
+		}
+		return 1
+	}
+	if local == "-" {
+		sys.Out().Write(d.body)
+		captureDownload(sys, "tftp", "", d)
+		return 0
+	}
+	if err := saveDownload(sys, "tftp", fullPath(sys, local), d); err != nil {
+		fmt.Fprintf(sys.Err(), "tftp: can't open '%v': %v\n", local, honeyos.ErrnoString(err))
+		return 1
+	}
+	return 0
+}
+
+// readInput reads the file, or the standard input for "-"
+func readInput(sys honeyos.Sys, name string) ([]byte, error) {
+	var buf bytes.Buffer
+	if name == "-" {
+		_, err := buf.ReadFrom(sys.In())
+		return buf.Bytes(), err
+	}
+	f, err := sys.FSys().Open(fullPath(sys, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	_, err = buf.ReadFrom(f)
+	return buf.Bytes(), err
+}
+
+// tftpError is the ERROR packet sent by the server
+type tftpError struct {
+	code int
+	msg  string
+}
+
+func (e *tftpError) Error() string {
+	return fmt.Sprintf("server error: (%v) %v", e.code, e.msg)
+}
+
+// fetchTFTP reads the file of the URL in octet mode, asking for the block
+// size in the blksize query parameter if any. The transfer is refused when
+// a proxy is configured, as UDP cannot go through it
+func fetchTFTP(ctx context.Context, sys honeyos.Sys, req *downloadRequest, lim downloadLimits) (*download, error) {
+	host, port := req.url.Hostname(), urlPort(req.url)
+	addrs, ip, err := resolveTarget(ctx, sys, req.cmd, lim, host)
+	if err != nil {
+		return nil, err
+	}
+	if lim.proxy != nil {
+		return nil, &downloadError{kind: errTimeout, host: host, port: port, err: fmt.Errorf("tftp cannot use the proxy")}
+	}
+	pc, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+	server := &net.UDPAddr{IP: ip, Port: portNum}
+	d := &download{url: req.url, addrs: addrs, remote: server.String()}
+
+	blksize := tftpBlockSize
+	rrq := []byte{0, tftpRRQ}
+	rrq = append(append(rrq, strings.TrimPrefix(req.url.Path, "/")...), 0)
+	rrq = append(rrq, "octet\x00"...)
+	if size := req.url.Query().Get("blksize"); len(size) > 0 {
+		rrq = append(rrq, "blksize\x00"+size+"\x00"...)
+	}
+	var body bytes.Buffer
+	packet, last := rrq, uint16(0)
+	buf := make([]byte, 65536)
+	for {
+		n, err := tftpExchange(ctx, pc, server, packet, buf)
+		if err != nil {
+			return nil, err
+		}
+		reply := buf[:n]
+		switch binary.BigEndian.Uint16(reply) {
+		case tftpOACK:
+			opts := bytes.Split(reply[2:], []byte{0})
+			for i := 0; i+1 < len(opts); i += 2 {
+				if strings.EqualFold(string(opts[i]), "blksize") {
+					if size, err := strconv.Atoi(string(opts[i+1])); err == nil && size > 0 {
+						blksize = size
+					}
+				}
+			}
+			packet = tftpAck(0)
+		case tftpDATA:
+			block := binary.BigEndian.Uint16(reply[2:])
+			if block != last+1 {
+				// A duplicate, acknowledge again
+				packet = tftpAck(last)
+				continue
+			}
+			body.Write(reply[4:])
+			last = block
+			packet = tftpAck(last)
+			if int64(body.Len()) > lim.maxSize {
+				pc.WriteTo(append([]byte{0, tftpERROR, 0, 3}, "Disk full or allocation exceeded\x00"...), server)
+				return nil, errTooLargeBody
+			}
+			if len(reply)-4 < blksize {
+				pc.WriteTo(packet, server)
+				d.body = body.Bytes()
+				return d, nil
+			}
+		case tftpERROR:
+			return nil, &downloadError{kind: errDownload, host: host, port: port, err: &tftpError{
+				code: int(binary.BigEndian.Uint16(reply[2:])),
+				msg:  string(bytes.TrimRight(reply[4:], "\x00")),
+			}}
+		default:
+			return nil, fmt.Errorf("unexpected tftp opcode")
+		}
+	}
+}
+
+// tftpExchange sends the packet until a reply comes from the address of
+// the server, whose port is updated to the one replying as the transfer
+// continues from there
+func tftpExchange(ctx context.Context, pc net.PacketConn, server *net.UDPAddr, packet, buf []byte) (int, error) {
+	for i := 0; i < tftpRetries; i++ {
+		if _, err := pc.WriteTo(packet, server); err != nil {
+			return 0, err
+		}
+		deadline := time.Now().Add(tftpRetryTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		pc.SetReadDeadline(deadline)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if ctx.Err() != nil {
+					return 0, ctx.Err()
+				}
+				break
+			}
+			if err != nil {
+				return 0, err
+			}
+			from, ok := addr.(*net.UDPAddr)
+			if !ok || !from.IP.Equal(server.IP) || n < 4 {
+				continue
+			}
+			server.Port = from.Port
+			return n, nil
+		}
+	}
+	return 0, context.DeadlineExceeded
+}
+
+// tftpAck returns the ACK packet of the block
+func tftpAck(block uint16) []byte {
+	return []byte{0, tftpACK, byte(block >> 8), byte(block)}
+}
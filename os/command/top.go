@@ -0,0 +1,240 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type top struct{}
+
+func init() {
+	honeyos.RegisterCommand("top", top{})
+}
+
+func (t top) GetHelp() string {
+	return "Usage:\n  top -hv | -bcHiOSs -d secs -n max -u|U user -p pid(s) -o field -w [cols]\n"
+}
+
+func (t top) Exec(args []string, sys honeyos.Sys) int {
+	delay := 3 * time.Second
+	iterations := -1
+	batch := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			fmt.Fprintf(sys.Err(), "top: unknown option '%v'\n", arg)
+			fmt.Fprint(sys.Err(), t.GetHelp())
+			return 1
+		}
+		for j := 1; j < len(arg); j++ {
+			switch c := arg[j]; c {
+			case 'h', 'v':
+				fmt.Fprintln(sys.Out(), "  procps-ng version 3.3.10")
+				fmt.Fprint(sys.Out(), t.GetHelp())
+				return 0
+			case 'b':
+				batch = true
+			case 'd', 'n', 'u', 'U', 'p', 'o', 'w':
+				v := arg[j+1:]
+				if len(v) == 0 && i+1 < len(args) {
+					i++
+					v = args[i]
+				}
+				j = len(arg)
+				switch c {
+				case 'd':
+					secs, err := strconv.ParseFloat(v, 64)
+					if err != nil || secs < 0 {
+						fmt.Fprintf(sys.Err(), "top: bad delay interval '%v'\n", v)
+						return 1
+					}
+					delay = time.Duration(secs * float64(time.Second))
+				case 'n':
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						fmt.Fprintf(sys.Err(), "top: bad iterations argument '%v'\n", v)
+						return 1
+					}
+					iterations = n
+				}
+			}
+		}
+	}
+	var mu sync.Mutex
+	frames := 0
+	// draw prints one screen and reports if more should be drawn
+	draw := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		var buf bytes.Buffer
+		if !batch {
+			buf.WriteString("\x1b[H\x1b[2J")
+		}
+		topFrame(&buf, sys, batch)
+		if _, err := sys.Out().Write(buf.Bytes()); err != nil {
+			return false
+		}
+		frames++
+		return iterations < 0 || frames < iterations
+	}
+	if batch || iterations > 0 {
+		for draw() {
+			time.Sleep(delay)
+		}
+		return 0
+	}
+	// Screen is refreshed periodically until q is pressed. The input is
+	// read here so that no key is consumed after top exits
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(delay):
+				draw()
+			}
+		}
+	}()
+	draw()
+	key := make([]byte, 1)
+	for {
+		n, err := sys.In().Read(key)
+		if err != nil || n > 0 && (key[0] == 'q' || key[0] == 0x03) {
+			break
+		}
+		if n > 0 {
+			draw()
+		}
+	}
+	close(done)
+	mu.Lock()
+	defer mu.Unlock()
+	fmt.Fprintln(sys.Out())
+	return 0
+}
+
+func (t top) Where() string {
+	return "/usr/bin/top"
+}
+
+// topFrame writes the summary and the process list fitting the terminal
+func topFrame(buf *bytes.Buffer, sys honeyos.Sys, batch bool) {
+	now := time.Now()
+	pt := sys.Processes()
+	procs := pt.List()
+	self := sys.Getpid()
+	running, sleeping, stopped, users := 0, 0, 0, loggedInUsers(procs)
+	cpu := 0.0
+	for i := range procs {
+		p := &procs[i]
+		if p.PID == self {
+			p.State = "R" + strings.TrimPrefix(p.State, "S")
+		}
+		switch p.State[0] {
+		case 'R':
+			running++
+		case 'T':
+			stopped++
+		default:
+			sleeping++
+		}
+		cpu += p.CPU
+	}
+	if cpu > 100 {
+		cpu = 100
+	}
+	load1, load5, load15 := pt.LoadAvg()
+	var lines []string
+	lines = append(lines,
+		fmt.Sprintf("top - %v up %v, %2d user%v,  load average: %.2f, %.2f, %.2f",
+			now.Format("15:04:05"), uptimeString(now.Sub(pt.Boot())), users, plural(users), load1, load5, load15),
+		fmt.Sprintf("Tasks: %3d total, %3d running, %3d sleeping, %3d stopped,   0 zombie", len(procs), running, sleeping, stopped),
+		fmt.Sprintf("%%Cpu(s): %4.1f us,  0.3 sy,  0.0 ni, %4.1f id,  0.0 wa,  0.0 hi,  0.0 si,  0.0 st", cpu, 99.7-cpu*0.997))
+	used, cache := pt.MemUsage()
+	total := honeyos.CurrentPersona().MemTotal
+	lines = append(lines,
+		fmt.Sprintf("KiB Mem : %8d total, %8d free, %8d used, %8d buff/cache", total, total-used-cache, used, cache),
+		fmt.Sprintf("KiB Swap:        0 total,        0 free,        0 used. %8d avail Mem ", total-used-cache/4),
+		"")
+	header := fmt.Sprintf("%5s %-8s %3s %3s %7s %6s %6s %1s %5s %4s %9s %v",
+		"PID", "USER", "PR", "NI", "VIRT", "RES", "SHR", "S", "%CPU", "%MEM", "TIME+", "COMMAND")
+	if !batch {
+		header = "\x1b[7m" + header + strings.Repeat(" ", maxInt(sys.Width()-len(header), 0)) + "\x1b[m"
+	}
+	lines = append(lines, header)
+	sort.SliceStable(procs, func(i, j int) bool { return procs[i].CPU > procs[j].CPU })
+	for _, p := range procs {
+		if !batch && len(lines) >= sys.Height()-1 {
+			break
+		}
+		pr, ni := "20", "0"
+		switch {
+		case strings.HasPrefix(p.Name, "migration/") || strings.HasPrefix(p.Name, "watchdog/"):
+			pr = "rt"
+		case strings.HasSuffix(p.Name, "H") && len(p.Args) == 0:
+			pr, ni = "0", "-20"
+		}
+		secs := now.Sub(p.Start).Seconds() * p.CPU / 100
+		line := fmt.Sprintf("%5d %-8s %3s %3s %7d %6d %6d %1s %5.1f %4.1f %9s %v",
+			p.PID, procUser(p.UID), pr, ni, p.VSZ, p.RSS, p.RSS*6/10, p.State[:1], p.CPU, memPercent(p),
+			fmt.Sprintf("%d:%02d.%02d", int(secs)/60, int(secs)%60, int(secs*100)%100), p.Name)
+		lines = append(lines, line)
+	}
+	for _, line := range lines {
+		if !batch && len(line) > sys.Width() && !strings.HasPrefix(line, "\x1b") {
+			line = line[:sys.Width()]
+		}
+		buf.WriteString(line + "\n")
+	}
+	if batch {
+		buf.WriteString("\n")
+	}
+}
+
+// loggedInUsers counts the sessions of the logged in users, which are those
+// of sshd with a terminal
+func loggedInUsers(procs []honeyos.Process) int {
+	users := 0
+	for _, p := range procs {
+		if len(p.Args) > 0 && strings.HasPrefix(p.Args[0], "sshd: ") && strings.Contains(p.Args[0], "@") {
+			users++
+		}
+	}
+	return users
+}
+
+// uptimeString formats the time since boot like uptime and top
+func uptimeString(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours, mins := int(d.Hours())%24, int(d.Minutes())%60
+	res := ""
+	if days > 0 {
+		res = fmt.Sprintf("%d day%v, ", days, plural(days))
+	}
+	if hours > 0 {
+		return res + fmt.Sprintf("%2d:%02d", hours, mins)
+	}
+	return res + fmt.Sprintf("%d min", mins)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,238 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+)
+
+type touch struct{}
+
+func init() {
+	honeyos.RegisterCommand("touch", touch{})
+}
+
+// touchDateLayouts are the formats of the date accepted by touch -d
+var touchDateLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+	"Mon Jan _2 15:04:05 MST 2006",
+	"Mon, 02 Jan 2006 15:04:05 -0700",
+	"Jan _2 2006",
+	"_2 Jan 2006",
+	"15:04:05",
+	"15:04",
+}
+
+func (touch) GetHelp() string {
+	return `Usage: touch [OPTION]... FILE...
+Update the access and modification times of each FILE to the current time.
+
+A FILE argument that does not exist is created empty, unless -c or -h
+is supplied.
+
+A FILE argument string of - is handled specially and causes touch to
+change the times of the file associated with standard output.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -a                     change only the access time
+  -c, --no-create        do not create any files
+  -d, --date=STRING      parse STRING and use it instead of current time
+  -f                     (ignored)
+  -h, --no-dereference   affect each symbolic link instead of any referenced
+                         file (useful only on systems that can change the
+                         timestamps of a symlink)
+  -m                     change only the modification time
+  -r, --reference=FILE   use this file's times instead of current time
+  -t STAMP               use [[CC]YY]MMDDhhmm[.ss] instead of current time
+      --time=WORD        change the specified time:
+                           WORD is access, atime, or use: equivalent to -a
+                           WORD is modify or mtime: equivalent to -m
+      --help     display this help and exit
+      --version  output version information and exit
+
+Note that the -d and -t options accept different time-date formats.
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/touch>
+or available locally via: info '(coreutils) touch invocation'
+`
+}
+
+func (t touch) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "acd:fhmr:t:",
+		long: map[string]string{
+			"no-create": "c", "date=": "d", "no-dereference": "h", "reference=": "r",
+			"time=": "time", "help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "touch", err)
+	}
+	noCreate, onlyAtime, onlyMtime := false, false, false
+	stamp := time.Now()
+	explicit := false
+	for _, opt := range opts {
+		switch opt.name {
+		case "a":
+			onlyAtime = true
+		case "m":
+			onlyMtime = true
+		case "c", "h":
+			noCreate = true
+		case "d":
+			d, ok := parseDate(opt.value)
+			if !ok {
+				fmt.Fprintf(sys.Err(), "touch: invalid date format %v\n", quote(opt.value))
+				return 1
+			}
+			stamp, explicit = d, true
+		case "t":
+			d, ok := parseTouchStamp(opt.value)
+			if !ok {
+				fmt.Fprintf(sys.Err(), "touch: invalid date format %v\n", quote(opt.value))
+				return 1
+			}
+			stamp, explicit = d, true
+		case "r":
+			fi, err := sys.FSys().Stat(fullPath(sys, opt.value))
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "touch: failed to get attributes of %v: %v\n", quote(opt.value), honeyos.ErrnoString(err))
+				return 1
+			}
+			stamp, explicit = fi.ModTime(), true
+		case "time":
+			switch opt.value {
+			case "access", "atime", "use":
+				onlyAtime = true
+			case "modify", "mtime":
+				onlyMtime = true
+			default:
+				fmt.Fprintf(sys.Err(), "touch: invalid argument %v for '--time'\n", quote(opt.value))
+				fmt.Fprintln(sys.Err(), "Valid arguments are:\n  - 'atime', 'access', 'use'\n  - 'mtime', 'modify'")
+				fmt.Fprintln(sys.Err(), "Try 'touch --help' for more information.")
+				return 1
+			}
+		case "help":
+			fmt.Fprint(sys.Out(), t.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("touch", "Paul Rubin, Arnold Robbins, Jim Kingdon,\nDavid MacKenzie, and Randy Smith"))
+			return 0
+		}
+	}
+	if len(operands) == 0 {
+		return usageError(sys, "touch", "missing file operand")
+	}
+	status := 0
+	for _, name := range operands {
+		if name == "-" {
+			continue
+		}
+		p := fullPath(sys, name)
+		fi, err := sys.FSys().Stat(p)
+		if err != nil {
+			if noCreate {
+				continue
+			}
+			f, err := createFile(sys.FSys(), p, os.O_WRONLY, 0666&^defaultUmask)
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "touch: cannot touch %v: %v\n", quote(name), honeyos.ErrnoString(err))
+				status = 1
+				continue
+			}
+			f.Close()
+			sys.FsEvent("create", p, log.Fields{"cmd": "touch"})
+			if !explicit {
+				continue
+			}
+		}
+		// Access time is not kept by the filesystem, so the time that is
+		// not changed is taken from the modification time
+		atime, mtime := stamp, stamp
+		if fi != nil {
+			switch {
+			case onlyAtime && !onlyMtime:
+				mtime = fi.ModTime()
+			case onlyMtime && !onlyAtime:
+				atime = fi.ModTime()
+			}
+		}
+		if err := sys.FSys().Chtimes(p, atime, mtime); err != nil {
+			fmt.Fprintf(sys.Err(), "touch: setting times of %v: %v\n", quote(name), honeyos.ErrnoString(err))
+			status = 1
+			continue
+		}
+		sys.FsEvent("chtimes", p, log.Fields{"cmd": "touch", "atime": atime, "mtime": mtime})
+	}
+	return status
+}
+
+func (touch) Where() string {
+	return "/bin/touch"
+}
+
+// parseDate parses the date string given to -d of touch and date
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	now := time.Now()
+	switch strings.ToLower(s) {
+	case "", "now", "today":
+		return now, true
+	case "yesterday":
+		return now.AddDate(0, 0, -1), true
+	case "tomorrow":
+		return now.AddDate(0, 0, 1), true
+	}
+	if strings.HasPrefix(s, "@") {
+		secs, err := strconv.ParseInt(s[1:], 10, 64)
+		return time.Unix(secs, 0), err == nil
+	}
+	for _, layout := range touchDateLayouts {
+		d, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if d.Year() == 0 {
+			d = time.Date(now.Year(), now.Month(), now.Day(), d.Hour(), d.Minute(), d.Second(), 0, time.Local)
+		}
+		return d, true
+	}
+	return time.Time{}, false
+}
+
+// parseTouchStamp parses the [[CC]YY]MMDDhhmm[.ss] time of touch -t
+func parseTouchStamp(s string) (time.Time, bool) {
+	secs := "00"
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		s, secs = s[:dot], s[dot+1:]
+	}
+	if len(secs) != 2 || strings.Trim(s+secs, "0123456789") != "" {
+		return time.Time{}, false
+	}
+	switch len(s) {
+	case 8:
+		s = strconv.Itoa(time.Now().Year()) + s
+	case 10:
+		// Two digit years 69-99 are in the 20th century like POSIX says
+		if s[:2] >= "69" {
+			s = "19" + s
+		} else {
+			s = "20" + s
+		}
+	case 12:
+	default:
+		return time.Time{}, false
+	}
+	d, err := time.ParseInLocation("200601021504.05", s+"."+secs, time.Local)
+	return d, err == nil
+}
@@ -0,0 +1,304 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type tr struct{}
+
+// trClasses are the character classes of tr sets
+var trClasses = map[string]func(c byte) bool{
+	"alnum":  func(c byte) bool { return isAlpha(c) || isDigit(c) },
+	"alpha":  isAlpha,
+	"blank":  func(c byte) bool { return c == ' ' || c == '\t' },
+	"cntrl":  func(c byte) bool { return c < 32 || c == 127 },
+	"digit":  isDigit,
+	"graph":  func(c byte) bool { return c > 32 && c < 127 },
+	"lower":  func(c byte) bool { return c >= 'a' && c <= 'z' },
+	"print":  func(c byte) bool { return c >= 32 && c < 127 },
+	"punct":  func(c byte) bool { return c > 32 && c < 127 && !isAlpha(c) && !isDigit(c) },
+	"space":  func(c byte) bool { return c == ' ' || c >= '\t' && c <= '\r' },
+	"upper":  func(c byte) bool { return c >= 'A' && c <= 'Z' },
+	"xdigit": func(c byte) bool { return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' },
+}
+
+func init() {
+	honeyos.RegisterCommand("tr", tr{})
+}
+
+func (tr) GetHelp() string {
+	return `Usage: tr [OPTION]... SET1 [SET2]
+Translate, squeeze, and/or delete characters from standard input,
+writing to standard output.
+
+  -c, -C, --complement    use the complement of SET1
+  -d, --delete            delete characters in SET1, do not translate
+  -s, --squeeze-repeats   replace each sequence of a repeated character
+                            that is listed in the last specified SET,
+                            with a single occurrence of that character
+  -t, --truncate-set1     first truncate SET1 to length of SET2
+      --help     display this help and exit
+      --version  output version information and exit
+
+SETs are specified as strings of characters.  Most represent themselves.
+Interpreted sequences are:
+
+  \NNN            character with octal value NNN (1 to 3 octal digits)
+  \\              backslash
+  \a              audible BEL
+  \b              backspace
+  \f              form feed
+  \n              new line
+  \r              return
+  \t              horizontal tab
+  \v              vertical tab
+  CHAR1-CHAR2     all characters from CHAR1 to CHAR2 in ascending order
+  [CHAR*]         in SET2, copies of CHAR until length of SET1
+  [CHAR*REPEAT]   REPEAT copies of CHAR, REPEAT octal if starting with 0
+  [:alnum:]       all letters and digits
+  [:alpha:]       all letters
+  [:blank:]       all horizontal whitespace
+  [:cntrl:]       all control characters
+  [:digit:]       all digits
+  [:graph:]       all printable characters, not including space
+  [:lower:]       all lower case letters
+  [:print:]       all printable characters, including space
+  [:punct:]       all punctuation characters
+  [:space:]       all horizontal or vertical whitespace
+  [:upper:]       all upper case letters
+  [:xdigit:]      all hexadecimal digits
+  [=CHAR=]        all characters which are equivalent to CHAR
+
+Translation occurs if -d is not given and both SET1 and SET2 appear.
+-t may be used only when translating.  SET2 is extended to length of
+SET1 by repeating its last character as necessary.  Excess characters
+of SET2 are ignored.  Only [:lower:] and [:upper:] are guaranteed to
+expand in ascending order; used in SET2 while translating, they may
+only be used in pairs to specify case conversion.  -s uses the last
+specified SET, and occurs after translation or deletion.
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/tr>
+or available locally via: info '(coreutils) tr invocation'
+`
+}
+
+func (t tr) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "cCdst",
+		long: map[string]string{
+			"complement": "c", "delete": "d", "squeeze-repeats": "s", "truncate-set1": "t",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "tr", err)
+	}
+	complement, del, squeeze, truncate := false, false, false, false
+	for _, opt := range opts {
+		switch opt.name {
+		case "c", "C":
+			complement = true
+		case "d":
+			del = true
+		case "s":
+			squeeze = true
+		case "t":
+			truncate = true
+		case "help":
+			fmt.Fprint(sys.Out(), t.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("tr", "Jim Meyering"))
+			return 0
+		}
+	}
+	translate := !del && len(operands) > 1
+	switch {
+	case len(operands) == 0:
+		return usageError(sys, "tr", "missing operand")
+	case len(operands) == 1 && !del && !squeeze:
+		return usageError(sys, "tr", fmt.Sprintf("missing operand after %v\nTwo strings must be given when translating.", quote(operands[0])))
+	case len(operands) == 1 && del && squeeze:
+		return usageError(sys, "tr", fmt.Sprintf("missing operand after %v\nTwo strings must be given when both deleting and squeezing repeats.", quote(operands[0])))
+	case len(operands) > 2 || len(operands) == 2 && del && !squeeze:
+		msg := fmt.Sprintf("extra operand %v", quote(operands[len(operands)-1]))
+		if del && !squeeze {
+			msg += "\nOnly one string may be given when deleting without squeezing repeats."
+		}
+		return usageError(sys, "tr", msg)
+	}
+	set1, msg := expandTrSet(operands[0], 0)
+	if len(msg) > 0 {
+		fmt.Fprintf(sys.Err(), "tr: %v\n", msg)
+		return 1
+	}
+	if complement {
+		var in [256]bool
+		for _, c := range set1 {
+			in[c] = true
+		}
+		set1 = set1[:0]
+		for c := 0; c < 256; c++ {
+			if !in[c] {
+				set1 = append(set1, byte(c))
+			}
+		}
+	}
+	var set2 []byte
+	if len(operands) > 1 {
+		if set2, msg = expandTrSet(operands[1], len(set1)); len(msg) > 0 {
+			fmt.Fprintf(sys.Err(), "tr: %v\n", msg)
+			return 1
+		}
+		if translate && len(set2) == 0 && len(set1) > 0 {
+			fmt.Fprintln(sys.Err(), "tr: when not truncating set1, string2 must be non-empty")
+			return 1
+		}
+	}
+	var mapping [256]byte
+	for c := range mapping {
+		mapping[c] = byte(c)
+	}
+	var inSet1, squeezeSet [256]bool
+	for _, c := range set1 {
+		inSet1[c] = true
+	}
+	if translate {
+		if truncate && len(set1) > len(set2) {
+			set1 = set1[:len(set2)]
+		}
+		for i, c := range set1 {
+			mapping[c] = set2[minInt(i, len(set2)-1)]
+		}
+	}
+	last := set1
+	if len(operands) > 1 {
+		last = set2
+	}
+	for _, c := range last {
+		squeezeSet[c] = true
+	}
+	input, _ := ioutil.ReadAll(sys.In())
+	var out bytes.Buffer
+	for _, c := range input {
+		if del && inSet1[c] {
+			continue
+		}
+		c = mapping[c]
+		if squeeze && squeezeSet[c] && out.Len() > 0 && out.Bytes()[out.Len()-1] == c {
+			continue
+		}
+		out.WriteByte(c)
+	}
+	sys.Out().Write(out.Bytes())
+	return 0
+}
+
+// expandTrSet expands the escapes, ranges, classes and repeats of the set,
+// [c*] filling up to the length of set1
+func expandTrSet(set string, fill int) ([]byte, string) {
+	var out []byte
+	// next returns the character at i with the escapes interpreted
+	next := func(i int) (byte, int) {
+		if set[i] != '\\' || i+1 == len(set) {
+			return set[i], i + 1
+		}
+		i++
+		if set[i] >= '0' && set[i] <= '7' {
+			n, j := 0, i
+			for j < len(set) && j < i+3 && set[j] >= '0' && set[j] <= '7' && n*8+int(set[j]-'0') < 256 {
+				n = n*8 + int(set[j]-'0')
+				j++
+			}
+			return byte(n), j
+		}
+		if c, ok := map[byte]byte{'a': 7, 'b': 8, 'f': 12, 'n': 10, 'r': 13, 't': 9, 'v': 11}[set[i]]; ok {
+			return c, i + 1
+		}
+		return set[i], i + 1
+	}
+	fillAt := -1
+	for i := 0; i < len(set); {
+		if set[i] == '[' && i+1 < len(set) {
+			if set[i+1] == ':' {
+				if end := strings.Index(set[i+2:], ":]"); end >= 0 {
+					name := set[i+2 : i+2+end]
+					class, ok := trClasses[name]
+					if !ok {
+						return nil, fmt.Sprintf("invalid character class %v", quote(name))
+					}
+					for c := 0; c < 256; c++ {
+						if class(byte(c)) {
+							out = append(out, byte(c))
+						}
+					}
+					i += end + 4
+					continue
+				}
+			}
+			if set[i+1] == '=' && i+4 < len(set) && set[i+3] == '=' && set[i+4] == ']' {
+				out = append(out, set[i+2])
+				i += 5
+				continue
+			}
+			if c, j := next(i + 1); j < len(set) && set[j] == '*' {
+				if end := strings.IndexByte(set[j:], ']'); end >= 0 {
+					repeat := set[j+1 : j+end]
+					if len(repeat) == 0 {
+						fillAt = len(out)
+						out = append(out, c)
+					} else {
+						n, err := strconv.ParseInt(repeat, 0, 32)
+						if err != nil {
+							return nil, fmt.Sprintf("invalid repeat count %v in [c*n] construct", quote(repeat))
+						}
+						for k := int64(0); k < n; k++ {
+							out = append(out, c)
+						}
+					}
+					i = j + end + 1
+					continue
+				}
+			}
+		}
+		c, j := next(i)
+		if j+1 < len(set) && set[j] == '-' {
+			end, k := next(j + 1)
+			if end < c {
+				return nil, fmt.Sprintf("range-endpoints of '%v-%v' are in reverse collating sequence order", string(c), string(end))
+			}
+			for x := int(c); x <= int(end); x++ {
+				out = append(out, byte(x))
+			}
+			i = k
+			continue
+		}
+		out = append(out, c)
+		i = j
+	}
+	if fillAt >= 0 && len(out) < fill {
+		c := out[fillAt]
+		extra := bytes.Repeat([]byte{c}, fill-len(out))
+		out = append(out[:fillAt], append(extra, out[fillAt:]...)...)
+	}
+	return out, ""
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (tr) Where() string {
+	return "/usr/bin/tr"
+}
@@ -1,7 +1,6 @@
 package command
 
 import (
-	"bytes"
 	"fmt"
 	"strings"
 
@@ -13,11 +12,9 @@ type uname struct{}
 
 const (
 	unameKName  = "Linux"
-	unameKRel   = "4.4.0-43-generic"
-	unameKVer   = "#129-Ubuntu SMP Thu Mar 17 20:17:14 UTC 2017"
-	unameMach   = "x86-64"
-	unameProc   = "x86-64"
-	unameHWPlat = "x86-64"
+	unameMach   = "x86_64"
+	unameProc   = "x86_64"
+	unameHWPlat = "x86_64"
 	unameOS     = "GNU/Linux"
 )
 
@@ -30,6 +27,9 @@ func (un uname) GetHelp() string {
 }
 
 func (un uname) Exec(args []string, sys os.Sys) int {
+	// The kernel is that of the persona, as in /proc/version
+	persona := os.CurrentPersona()
+	unameKRel, unameKVer := persona.KernelRelease, persona.KernelVersion
 	flag := pflag.NewFlagSet("arg", pflag.ContinueOnError)
 	all := flag.BoolP("all", "a", false,
 		"print all information, in the following order,\n                              except omit -p and -i if unknown:")
@@ -67,33 +67,28 @@ func (un uname) Exec(args []string, sys os.Sys) int {
 	} else if *help {
 		flag.Usage()
 	} else {
-		var uNameStr bytes.Buffer
-		switch {
-		case *kName:
-			uNameStr.WriteString(unameKName)
-			fallthrough
-		case *nName:
-			uNameStr.WriteString(" " + sys.Hostname())
-			fallthrough
-		case *kRel:
-			uNameStr.WriteString(" " + unameKRel)
-			fallthrough
-		case *kVer:
-			uNameStr.WriteString(" " + unameKVer)
-			fallthrough
-		case *mach:
-			uNameStr.WriteString(" " + unameMach)
-			fallthrough
-		case *proc:
-			uNameStr.WriteString(" " + unameProc)
-			fallthrough
-		case *hwPlat:
-			uNameStr.WriteString(" " + unameHWPlat)
-			fallthrough
-		case *os:
-			uNameStr.WriteString(" " + unameOS)
+		// Fields are always printed in the same order regardless of the
+		// order of flags
+		fields := []struct {
+			set bool
+			val string
+		}{
+			{*kName, unameKName},
+			{*nName, sys.Hostname()},
+			{*kRel, unameKRel},
+			{*kVer, unameKVer},
+			{*mach, unameMach},
+			{*proc, unameProc},
+			{*hwPlat, unameHWPlat},
+			{*os, unameOS},
 		}
-		fmt.Fprintln(sys.Out(), strings.TrimSpace(uNameStr.String()))
+		var uNameStr []string
+		for _, f := range fields {
+			if f.set {
+				uNameStr = append(uNameStr, f.val)
+			}
+		}
+		fmt.Fprintln(sys.Out(), strings.Join(uNameStr, " "))
 	}
 	return 0
 }
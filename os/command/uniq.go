@@ -0,0 +1,182 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
+)
+
+type uniq struct{}
+
+func init() {
+	honeyos.RegisterCommand("uniq", uniq{})
+}
+
+func (uniq) GetHelp() string {
+	return `Usage: uniq [OPTION]... [INPUT [OUTPUT]]
+Filter adjacent matching lines from INPUT (or standard input),
+writing to OUTPUT (or standard output).
+
+With no options, matching lines are merged to the first occurrence.
+
+Mandatory arguments to long options are mandatory for short options too.
+  -c, --count           prefix lines by the number of occurrences
+  -d, --repeated        only print duplicate lines, one for each group
+  -D, --all-repeated[=METHOD]  print all duplicate lines
+                          groups can be delimited with an empty line
+                          METHOD={none(default),prepend,separate}
+  -f, --skip-fields=N   avoid comparing the first N fields
+      --group[=METHOD]  show all items, separating groups with an empty line
+                          METHOD={separate(default),prepend,append,both}
+  -i, --ignore-case     ignore differences in case when comparing
+  -s, --skip-chars=N    avoid comparing the first N characters
+  -u, --unique          only print unique lines
+  -z, --zero-terminated     line delimiter is NUL, not newline
+  -w, --check-chars=N   compare no more than N characters in lines
+      --help     display this help and exit
+      --version  output version information and exit
+
+A field is a run of blanks (usually spaces and/or TABs), then non-blank
+characters.  Fields are skipped before chars.
+
+Note: 'uniq' does not detect repeated lines unless they are adjacent.
+You may want to sort the input first, or use 'sort -u' without 'uniq'.
+Also, comparisons honor the rules specified by 'LC_COLLATE'.
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/uniq>
+or available locally via: info '(coreutils) uniq invocation'
+`
+}
+
+func (u uniq) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "cdDf:is:uzw:",
+		long: map[string]string{
+			"count": "c", "repeated": "d", "all-repeated?": "D", "skip-fields=": "f",
+			"ignore-case": "i", "skip-chars=": "s", "unique": "u", "zero-terminated": "z",
+			"check-chars=": "w", "help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "uniq", err)
+	}
+	count, repeated, allRepeated, unique, ignoreCase := false, false, false, false, false
+	skipFields, skipChars, checkChars := 0, 0, -1
+	for _, opt := range opts {
+		var n *int
+		switch opt.name {
+		case "c":
+			count = true
+		case "d":
+			repeated = true
+		case "D":
+			allRepeated = true
+		case "i":
+			ignoreCase = true
+		case "u":
+			unique = true
+		case "f":
+			n = &skipFields
+		case "s":
+			n = &skipChars
+		case "w":
+			n = &checkChars
+		case "help":
+			fmt.Fprint(sys.Out(), u.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("uniq", "Richard M. Stallman and David MacKenzie"))
+			return 0
+		}
+		if n != nil {
+			v, err := strconv.Atoi(opt.value)
+			if err != nil || v < 0 {
+				kind := map[string]string{"f": "fields to skip", "s": "bytes to skip", "w": "bytes to compare"}[opt.name]
+				fmt.Fprintf(sys.Err(), "uniq: %v: invalid number of %v\n", opt.value, kind)
+				return 1
+			}
+			*n = v
+		}
+	}
+	if count && allRepeated {
+		return usageError(sys, "uniq", "printing all duplicated lines and repeat counts is meaningless")
+	}
+	if len(operands) > 2 {
+		return usageError(sys, "uniq", fmt.Sprintf("extra operand %v", quote(operands[2])))
+	}
+	input := "-"
+	if len(operands) > 0 {
+		input = operands[0]
+	}
+	f, err := openInput(sys, input)
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "uniq: %v: %v\n", input, honeyos.ErrnoString(err))
+		return 1
+	}
+	lines, _ := readLines(f)
+	f.Close()
+	key := func(l string) string {
+		for i := 0; i < skipFields; i++ {
+			l = strings.TrimLeft(l, " \t")
+			if end := strings.IndexAny(l, " \t"); end >= 0 {
+				l = l[end:]
+			} else {
+				l = ""
+			}
+		}
+		l = l[minInt(skipChars, len(l)):]
+		if checkChars >= 0 {
+			l = l[:minInt(checkChars, len(l))]
+		}
+		if ignoreCase {
+			l = strings.ToLower(l)
+		}
+		return l
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && key(lines[j]) == key(lines[i]) {
+			j++
+		}
+		n := j - i
+		switch {
+		case allRepeated:
+			if n > 1 {
+				for _, l := range lines[i:j] {
+					buf.WriteString(l + "\n")
+				}
+			}
+		case repeated && n == 1, unique && n > 1:
+		case count:
+			fmt.Fprintf(&buf, "%7d %v\n", n, lines[i])
+		default:
+			buf.WriteString(lines[i] + "\n")
+		}
+		i = j
+	}
+	if len(operands) < 2 || operands[1] == "-" {
+		sys.Out().Write(buf.Bytes())
+		return 0
+	}
+	p := fullPath(sys, operands[1])
+	out, err := createFile(sys.FSys(), p, os.O_WRONLY|os.O_TRUNC, 0666&^defaultUmask)
+	if err != nil {
+		fmt.Fprintf(sys.Err(), "uniq: %v: %v\n", operands[1], honeyos.ErrnoString(err))
+		return 1
+	}
+	defer out.Close()
+	out.Write(buf.Bytes())
+	sys.FsEvent("write", p, log.Fields{"cmd": "uniq"})
+	return 0
+}
+
+func (uniq) Where() string {
+	return "/usr/bin/uniq"
+}
@@ -2,7 +2,6 @@ package command
 
 import (
 	"fmt"
-	"math/rand"
 	"time"
 
 	"github.com/mkishere/sshsyrup/os"
@@ -19,11 +18,12 @@ func (uptime) GetHelp() string {
 }
 
 func (uptime) Exec(args []string, sys os.Sys) int {
-	currTime := time.Now()
-	last5 := rand.Float32() + 9
-	last10 := rand.Float32() + 9
-	last15 := rand.Float32() + 9
-	fmt.Fprintf(sys.Out(), "%v up 3 days,  3 users,  load average: %.2f, %.2f, %.2f\n", currTime.Format("03:04:05"), last5, last10, last15)
+	now := time.Now()
+	pt := sys.Processes()
+	users := loggedInUsers(pt.List())
+	load1, load5, load15 := pt.LoadAvg()
+	fmt.Fprintf(sys.Out(), " %v up %v, %2d user%v,  load average: %.2f, %.2f, %.2f\n",
+		now.Format("15:04:05"), uptimeString(now.Sub(pt.Boot())), users, plural(users), load1, load5, load15)
 	return 0
 }
 
@@ -0,0 +1,190 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	honeyos "github.com/mkishere/sshsyrup/os"
+)
+
+type wc struct{}
+
+// wcCounts are the counts of a file printed by wc
+type wcCounts struct {
+	lines, words, chars, bytes, maxLine int
+}
+
+func init() {
+	honeyos.RegisterCommand("wc", wc{})
+}
+
+func (wc) GetHelp() string {
+	return `Usage: wc [OPTION]... [FILE]...
+  or:  wc [OPTION]... --files0-from=F
+Print newline, word, and byte counts for each FILE, and a total line if
+more than one FILE is specified.  A word is a non-zero-length sequence of
+characters delimited by white space.
+
+With no FILE, or when FILE is -, read standard input.
+
+The options below may be used to select which counts are printed, always in
+the following order: newline, word, character, byte, maximum line length.
+  -c, --bytes            print the byte counts
+  -m, --chars            print the character counts
+  -l, --lines            print the newline counts
+      --files0-from=F    read input from the files specified by
+                           NUL-terminated names in file F;
+                           If F is - then read names from standard input
+  -L, --max-line-length  print the maximum display width
+  -w, --words            print the word counts
+      --help     display this help and exit
+      --version  output version information and exit
+
+GNU coreutils online help: <http://www.gnu.org/software/coreutils/>
+Full documentation at: <http://www.gnu.org/software/coreutils/wc>
+or available locally via: info '(coreutils) wc invocation'
+`
+}
+
+func (w wc) Exec(args []string, sys honeyos.Sys) int {
+	opts, operands, err := getopt(args, optionSpec{
+		short: "cmlLw",
+		long: map[string]string{
+			"bytes": "c", "chars": "m", "lines": "l", "max-line-length": "L", "words": "w",
+			"help": "help", "version": "version",
+		},
+	})
+	if err != nil {
+		return usageError(sys, "wc", err)
+	}
+	var show wcCounts
+	selected := false
+	for _, opt := range opts {
+		switch opt.name {
+		case "c":
+			show.bytes, selected = 1, true
+		case "m":
+			show.chars, selected = 1, true
+		case "l":
+			show.lines, selected = 1, true
+		case "L":
+			show.maxLine, selected = 1, true
+		case "w":
+			show.words, selected = 1, true
+		case "help":
+			fmt.Fprint(sys.Out(), w.GetHelp())
+			return 0
+		case "version":
+			fmt.Fprint(sys.Out(), coreutilsVersion("wc", "Paul Rubin and David MacKenzie"))
+			return 0
+		}
+	}
+	if !selected {
+		show = wcCounts{lines: 1, words: 1, bytes: 1}
+	}
+	stdin := len(operands) == 0
+	if stdin {
+		operands = []string{"-"}
+	}
+	status := 0
+	var results []wcCounts
+	var names []string
+	var total wcCounts
+	for _, name := range operands {
+		f, err := openInput(sys, name)
+		if err != nil {
+			fmt.Fprintf(sys.Err(), "wc: %v: %v\n", name, honeyos.ErrnoString(err))
+			status = 1
+			continue
+		}
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		c := wcCount(content)
+		results = append(results, c)
+		names = append(names, name)
+		total.lines += c.lines
+		total.words += c.words
+		total.chars += c.chars
+		total.bytes += c.bytes
+		total.maxLine = maxInt(total.maxLine, c.maxLine)
+		if stdin {
+			names[len(names)-1] = ""
+		}
+	}
+	// Like coreutils the width fits the total size of the files, a single
+	// count is not padded and stdin of unknown size gets the default width
+	width := len(strconv.Itoa(total.bytes))
+	switch {
+	case len(operands) == 1 && show.lines+show.words+show.chars+show.bytes+show.maxLine == 1:
+		width = 1
+	case stdin:
+		width = 7
+	}
+	for i, c := range results {
+		w.print(sys, c, show, width, names[i])
+	}
+	if len(operands) > 1 {
+		w.print(sys, total, show, width, "total")
+	}
+	return status
+}
+
+// print prints the selected counts in the order of wc
+func (wc) print(sys honeyos.Sys, c, show wcCounts, width int, name string) {
+	var buf bytes.Buffer
+	for _, v := range []struct{ show, n int }{
+		{show.lines, c.lines}, {show.words, c.words}, {show.chars, c.chars},
+		{show.bytes, c.bytes}, {show.maxLine, c.maxLine},
+	} {
+		if v.show == 0 {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "%*d", width, v.n)
+	}
+	if len(name) > 0 {
+		buf.WriteString(" " + name)
+	}
+	buf.WriteByte('\n')
+	sys.Out().Write(buf.Bytes())
+}
+
+// wcCount counts the lines, words, characters and bytes of the content
+func wcCount(content []byte) wcCounts {
+	c := wcCounts{bytes: len(content)}
+	inWord := false
+	lineLen := 0
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		content = content[size:]
+		c.chars++
+		switch {
+		case r == '\n':
+			c.lines++
+			c.maxLine = maxInt(c.maxLine, lineLen)
+			lineLen = 0
+		case r == '\t':
+			lineLen += 8 - lineLen%8
+		case unicode.IsPrint(r):
+			lineLen++
+		}
+		if unicode.IsSpace(r) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			c.words++
+		}
+	}
+	c.maxLine = maxInt(c.maxLine, lineLen)
+	return c
+}
+
+func (wc) Where() string {
+	return "/usr/bin/wc"
+}
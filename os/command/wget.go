@@ -1,7 +1,10 @@
 package command
 
 import (
+	"bytes"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -11,121 +14,740 @@ import (
 	"strings"
 	"time"
 
-	"github.com/mkishere/sshsyrup/os"
+	honeyos "github.com/mkishere/sshsyrup/os"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
-	"github.com/spf13/pflag"
 )
 
+// Exit statuses of wget. Except 0 and 1, lower ones take precedence when
+// several URLs fail
+const (
+	wgetOK          = 0
+	wgetGeneric     = 1
+	wgetParse       = 2
+	wgetIO          = 3
+	wgetNetwork     = 4
+	wgetSSL         = 5
+	wgetAuth        = 6
+	wgetServerError = 8
+)
+
+const wgetMaxRedirect = 20
+
+const wgetUsage = "Usage: wget [OPTION]... [URL]...\n"
+
+const wgetHelp = `GNU Wget 1.17.1, a non-interactive network retriever.
+Usage: wget [OPTION]... [URL]...
+
+Mandatory arguments to long options are mandatory for short options too.
+
+Startup:
+  -V,  --version                   display the version of Wget and exit
+  -h,  --help                      print this help
+
+Logging and input file:
+  -q,  --quiet                     quiet (no output)
+  -v,  --verbose                   be verbose (this is the default)
+  -nv, --no-verbose                turn off verboseness, without being quiet
+
+Download:
+  -t,  --tries=NUMBER              set number of retries to NUMBER (0 unlimits)
+  -O,  --output-document=FILE      write documents to FILE
+  -nc, --no-clobber                skip downloads that would download to
+                                     existing files (overwriting them)
+  -c,  --continue                  resume getting a partially-downloaded file
+  -T,  --timeout=SECONDS           set all timeout values to SECONDS
+
+Directories:
+  -P,  --directory-prefix=PREFIX   save files to PREFIX/..
+
+HTTP options:
+       --header=STRING             insert STRING among the headers
+       --max-redirect              maximum redirections allowed per page
+  -U,  --user-agent=AGENT          identify as AGENT instead of Wget/VERSION
+
+HTTPS (SSL/TLS) options:
+       --no-check-certificate      don't validate the server's certificate
+
+Mail bug reports and suggestions to <bug-wget@gnu.org>
+`
+
+const wgetVersion = `GNU Wget 1.17.1 built on linux-gnu.
+
+-cares +digest -gpgme +https +ipv6 +iri +large-file -metalink +nls
++ntlm +opie -psl +ssl/openssl
+
+Wgetrc:
+    /etc/wgetrc (system)
+Locale:
+    /usr/share/locale
+Compile:
+    gcc -DHAVE_CONFIG_H -DSYSTEM_WGETRC="/etc/wgetrc"
+    -DLOCALEDIR="/usr/share/locale" -I. -I../../src -I../lib
+    -I../../lib -Wdate-time -D_FORTIFY_SOURCE=2 -I/usr/include
+    -DHAVE_LIBSSL -DNDEBUG -g -O2 -fPIE -fstack-protector-strong
+    -Wformat -Werror=format-security -DNO_SSLv2 -D_FILE_OFFSET_BITS=64
+    -O2 -g -Wall
+Link:
+    gcc -DHAVE_LIBSSL -DNDEBUG -g -O2 -fPIE -fstack-protector-strong
+    -Wformat -Werror=format-security -DNO_SSLv2 -D_FILE_OFFSET_BITS=64
+    -O2 -g -Wall -Wl,-Bsymbolic-functions -fPIE -pie -Wl,-z,relro
+    -Wl,-z,now -lpcre -luuid -lssl -lcrypto -lz -lidn ftp-opie.o
+    openssl.o http-ntlm.o ../gnulib/lib/libgnu.a
+
+Copyright (C) 2015 Free Software Foundation, Inc.
+License GPLv3+: GNU GPL version 3 or later
+<http://www.gnu.org/licenses/gpl.html>.
+This is free software: you are free to change and redistribute it.
+There is NO WARRANTY, to the extent permitted by law.
+
+Originally written by Hrvoje Niksic <hniksic@xemacs.org>.
+Please send bug reports and questions to <bug-wget@gnu.org>.
+`
+
 type wget struct{}
 
-func init() {
-	os.RegisterCommand("wget", wget{})
+// wgetOptions are the options of wget. Messages are written to log, which
+// discards them when quiet
+type wgetOptions struct {
+	output      string
+	prefix      string
+	resume      bool
+	noClobber   bool
+	quiet       bool
+	nonVerbose  bool
+	insecure    bool
+	agent       string
+	headers     []string
+	timeout     time.Duration
+	maxRedirect int
+	log         io.Writer
+}
 
+// wgetResult is the outcome of retrieving a URL
+type wgetResult struct {
+	status int
+	size   int
 }
+
+func init() {
+	honeyos.RegisterCommand("wget", wget{})
+}
+
 func (wg wget) GetHelp() string {
-	return ""
+	return wgetHelp
 }
 
-func printTs() string {
-	return time.Now().Format("2006-01-02 03:04:05")
+func (wg wget) Where() string {
+	return "/usr/bin/wget"
 }
 
-func (wg wget) Exec(args []string, sys os.Sys) int {
-	flag := pflag.NewFlagSet("arg", pflag.ContinueOnError)
-	out := flag.String("O", "", "write documents to FILE.")
-	quiet := flag.BoolP("quiet", "q", false, "quiet (no output).")
-	flag.SetOutput(sys.Out())
-	err := flag.Parse(args)
-	f := flag.Args()
-	if len(args) == 0 {
-		fmt.Fprintln(sys.Out(), "wget: missing URL\nUsage: wget [OPTION]... [URL]...\n\nTry `wget --help' for more options.")
-		return 1
-	}
-	url := strings.TrimSpace(f[0])
-	if !strings.Contains(url, "://") {
-		url = "http://" + url
+func (wg wget) Exec(args []string, sys honeyos.Sys) int {
+	// -nv and -nc are single options despite their look
+	for i, arg := range args {
+		switch arg {
+		case "-nv":
+			args[i] = "--no-verbose"
+		case "-nc":
+			args[i] = "--no-clobber"
+		}
 	}
-	urlobj, err := urllib.Parse(url)
+	opts, urls, err := getopt(args, optionSpec{
+		short: "O:P:cqvU:T:t:hV",
+		long: map[string]string{
+			"output-document=": "O", "directory-prefix=": "P", "continue": "c", "quiet": "q",
+			"verbose": "v", "no-verbose": "nv", "user-agent=": "U", "timeout=": "T", "tries=": "t",
+			"header=": "header", "no-check-certificate": "no-check-certificate", "max-redirect=": "max-redirect",
+			"no-clobber": "nc", "help": "h", "version": "V",
+		},
+	})
 	if err != nil {
-		fmt.Fprintln(sys.Out(), "Malformed URL")
-		return 1
+		fmt.Fprintf(sys.Err(), "wget: %v\n%v\nTry `wget --help' for more options.\n", err, wgetUsage)
+		return wgetParse
 	}
-	if !*quiet {
-		if urlobj.Scheme != "http" && urlobj.Scheme != "https" {
-			fmt.Fprintf(sys.Out(), "Resolving %v (%v)... failed: Name or service not known.\n", urlobj.Scheme, urlobj.Scheme)
-			fmt.Fprintf(sys.Out(), "wget: unable to resolve host address ‘%v’\n", urlobj.Scheme)
-			return 1
+	o := wgetOptions{agent: "Wget/1.17.1 (linux-gnu)", maxRedirect: wgetMaxRedirect, log: sys.Err()}
+	for _, opt := range opts {
+		switch opt.name {
+		case "O":
+			o.output = opt.value
+		case "P":
+			o.prefix = opt.value
+		case "c":
+			o.resume = true
+		case "nc":
+			o.noClobber = true
+		case "q":
+			o.quiet = true
+		case "v":
+			o.nonVerbose = false
+		case "nv":
+			o.nonVerbose = true
+		case "U":
+			o.agent = opt.value
+		case "T":
+			secs, err := strconv.ParseFloat(opt.value, 64)
+			if err != nil {
+				fmt.Fprintf(sys.Err(), "wget: --timeout: Invalid time period ‘%v’\n", opt.value)
+				return wgetParse
+			}
+			o.timeout = time.Duration(secs * float64(time.Second))
+		case "header":
+			o.headers = append(o.headers, opt.value)
+		case "no-check-certificate":
+			o.insecure = true
+		case "max-redirect":
+			if o.maxRedirect, err = strconv.Atoi(opt.value); err != nil {
+				fmt.Fprintf(sys.Err(), "wget: --max-redirect: Invalid number ‘%v’.\n", opt.value)
+				return wgetParse
+			}
+		case "h":
+			fmt.Fprint(sys.Out(), wgetHelp)
+			return wgetOK
+		case "V":
+			fmt.Fprint(sys.Out(), wgetVersion)
+			return wgetOK
 		}
-		fmt.Fprintf(sys.Out(), "--%v--  %v\n", printTs(), url)
 	}
-	ip, err := net.LookupIP(urlobj.Hostname())
-	if err != nil {
-		// handle error
-		fmt.Fprintln(sys.Err(), err)
+	if len(urls) == 0 {
+		fmt.Fprintf(sys.Err(), "wget: missing URL\n%v\nTry `wget --help' for more options.\n", wgetUsage)
+		return wgetGeneric
 	}
-	if !*quiet {
-		fmt.Fprintf(sys.Out(), "Resolving %v (%v)... %v\n", urlobj.Hostname(), urlobj.Hostname(), ip)
+	if o.quiet {
+		o.log = ioutil.Discard
 	}
-	resp, err := http.Get(url)
-	if err != nil {
-		// handle error
-		fmt.Fprintln(sys.Err(), err)
-		return 1
-	}
-	if !*quiet {
-		fmt.Fprintf(sys.Out(), "Connecting to %v (%v)|%v|:80... connected\n", urlobj.Hostname(), urlobj.Hostname(), ip[0])
-		mimeType := resp.Header.Get("Content-Type")
-		fmt.Fprintln(sys.Out(), "HTTP request sent, awaiting response... 200 OK")
-		fmt.Fprintf(sys.Out(), "Length: unspecified [%v]\n", mimeType[:strings.LastIndex(mimeType, ";")])
-	}
-	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		//handle
-		fmt.Fprintln(sys.Err(), err)
-		return 1
+
+	start := time.Now()
+	status, files, total := wgetOK, 0, 0
+	for _, rawurl := range urls {
+		res := o.retrieve(sys, rawurl)
+		if res.status == wgetOK {
+			files++
+			total += res.size
+		} else if status == wgetOK || status == wgetGeneric || (res.status != wgetGeneric && res.status < status) {
+			status = res.status
+		}
+	}
+	if len(urls) > 1 && files > 0 && !o.nonVerbose {
+		elapsed := time.Since(start)
+		fmt.Fprintf(o.log, "FINISHED --%v--\n", wgetTime())
+		fmt.Fprintf(o.log, "Total wall clock time: %v\n", wgetDuration(elapsed))
+		fmt.Fprintf(o.log, "Downloaded: %v files, %v in %v (%v)\n", files, wgetHumanReadable(int64(total), 10, 1),
+			wgetDuration(elapsed), wgetRate(total, elapsed))
+	}
+	return status
+}
+
+// verbose returns where the messages of the default verbosity go
+func (o *wgetOptions) verbose() io.Writer {
+	if o.nonVerbose {
+		return ioutil.Discard
+	}
+	return o.log
+}
+
+// localName returns the file the URL is saved to, numbering it when a
+// file of the name exists unless continuing
+func (o *wgetOptions) localName(sys honeyos.Sys, u *urllib.URL) string {
+	if len(o.output) > 0 {
+		return o.output
+	}
+	name := path.Base(u.Path)
+	if strings.HasSuffix(u.Path, "/") || name == "/" || name == "." {
+		name = "index.html"
+	}
+	if len(u.RawQuery) > 0 {
+		name += "?" + u.RawQuery
+	}
+	if len(o.prefix) > 0 {
+		name = path.Join(o.prefix, name)
+	}
+	if o.resume || o.noClobber {
+		return name
+	}
+	for i, candidate := 1, name; ; i++ {
+		if _, err := sys.FSys().Stat(fullPath(sys, candidate)); err != nil {
+			return candidate
+		}
+		candidate = name + "." + strconv.Itoa(i)
+	}
+}
+
+// retrieve downloads the URL, following the redirects
+func (o *wgetOptions) retrieve(sys honeyos.Sys, rawurl string) wgetResult {
+	req, err := newDownloadRequest("wget", strings.TrimSpace(rawurl))
+	if err != nil || len(req.url.Hostname()) == 0 {
+		fmt.Fprintf(o.log, "%v: Invalid URL %v: Invalid host name\n", rawurl, rawurl)
+		return wgetResult{status: wgetGeneric}
+	}
+	switch req.url.Scheme {
+	case "http", "https", "ftp":
+	default:
+		fmt.Fprintf(o.log, "%v: Unsupported scheme ‘%v’.\n", rawurl, req.url.Scheme)
+		return wgetResult{status: wgetGeneric}
+	}
+	local := o.localName(sys, req.url)
+	if o.noClobber && len(o.output) == 0 {
+		if _, err := sys.FSys().Stat(fullPath(sys, local)); err == nil {
+			fmt.Fprintf(o.verbose(), "File ‘%v’ already there; not retrieving.\n\n", local)
+			return wgetResult{status: wgetOK}
+		}
+	}
+	if req.url.Scheme == "ftp" {
+		return o.retrieveFTP(sys, req, local)
+	}
+	req.header.Set("User-Agent", o.agent)
+	req.header.Set("Accept", "*/*")
+	req.header.Set("Accept-Encoding", "identity")
+	for _, h := range o.headers {
+		if kv := strings.SplitN(h, ":", 2); len(kv) == 2 {
+			req.header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+	req.insecure = o.insecure
+	req.timeout = o.timeout
+	var prior []byte
+	if o.resume && local != "-" {
+		if b, err := afero.ReadFile(sys.FSys(), fullPath(sys, local)); err == nil && len(b) > 0 {
+			prior = b
+			req.header.Set("Range", fmt.Sprintf("bytes=%v-", len(b)))
+		}
+	}
+
+	lastHost := ""
+	for redirects := 0; ; redirects++ {
+		v := o.verbose()
+		fmt.Fprintf(v, "--%v--  %v\n", wgetTime(), req.url)
+		hostPort := req.url.Hostname() + ":" + urlPort(req.url)
+		start := time.Now()
+		d, err := fetch(sys, req)
+		if err != nil {
+			return o.fetchFailed(sys, req, err)
+		}
+		if hostPort == lastHost {
+			fmt.Fprintf(v, "Reusing existing connection to %v.\n", hostPort)
+		} else {
+			wgetConnecting(v, req.url, d.addrs, "connected.")
+		}
+		lastHost = hostPort
+		elapsed := time.Since(start)
+		resp := d.resp
+		fmt.Fprintf(v, "HTTP request sent, awaiting response... %v\n", resp.Status)
+		statusText := strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)))
+
+		if location := resp.Header.Get("Location"); resp.StatusCode/100 == 3 && len(location) > 0 {
+			next, err := req.url.Parse(location)
+			if err != nil {
+				fmt.Fprintf(o.log, "%v: Invalid URL %v: Unsupported scheme\n", location, location)
+				return wgetResult{status: wgetGeneric}
+			}
+			fmt.Fprintf(v, "Location: %v [following]\n", location)
+			if redirects >= minInt(o.maxRedirect, currentLimits().maxRedirects) {
+				fmt.Fprintf(o.log, "%v redirections exceeded.\n", o.maxRedirect)
+				return wgetResult{status: wgetServerError}
+			}
+			req.url = next
+			if req.method != "HEAD" {
+				req.method, req.body = "GET", nil
+			}
+			continue
+		}
+		switch {
+		case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && prior != nil:
+			fmt.Fprint(v, "\n    The file is already fully retrieved; nothing to do.\n\n")
+			return wgetResult{status: wgetOK}
+		case resp.StatusCode >= 400 || resp.StatusCode/100 == 3:
+			if o.nonVerbose {
+				fmt.Fprintf(o.log, "%v:\n", req.url)
+			}
+			fmt.Fprintf(o.log, "%v ERROR %v: %v.\n\n", wgetTime(), resp.StatusCode, statusText)
+			return wgetResult{status: wgetServerError}
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			prior = nil
+		}
+		return o.save(sys, d, local, prior, elapsed)
+	}
+}
+
+// save writes the downloaded file after the part retrieved before if any,
+// printing the length and progress of the transfer
+func (o *wgetOptions) save(sys honeyos.Sys, d *download, local string, prior []byte, elapsed time.Duration) wgetResult {
+	v := o.verbose()
+	length, total := int64(len(d.body)), int64(-1)
+	if d.resp != nil {
+		if d.resp.ContentLength >= 0 {
+			total = d.resp.ContentLength + int64(len(prior))
+		}
+		fmt.Fprint(v, "Length: ")
+		if total < 0 {
+			fmt.Fprint(v, "unspecified")
+		} else {
+			fmt.Fprint(v, total)
+			if total >= 1024 {
+				fmt.Fprintf(v, " (%v)", wgetHumanReadable(total, 10, 1))
+			}
+			if len(prior) > 0 {
+				if length >= 1024 {
+					fmt.Fprintf(v, ", %v (%v) remaining", length, wgetHumanReadable(length, 10, 1))
+				} else {
+					fmt.Fprintf(v, ", %v remaining", length)
+				}
+			}
+		}
+		if contentType := d.resp.Header.Get("Content-Type"); len(contentType) > 0 {
+			if i := strings.IndexByte(contentType, ';'); i >= 0 {
+				contentType = contentType[:i]
+			}
+			fmt.Fprintf(v, " [%v]", strings.TrimSpace(contentType))
+		}
+		fmt.Fprintln(v)
+	} else {
+		total = length
+		fmt.Fprintf(v, "Length: %v", length)
+		if length >= 1024 {
+			fmt.Fprintf(v, " (%v)", wgetHumanReadable(length, 10, 1))
+		}
+		fmt.Fprintln(v, " (unauthoritative)")
+	}
+
+	saved := *d
+	if len(prior) > 0 {
+		saved.body = append(append([]byte{}, prior...), d.body...)
 	}
-	if *out == "" {
-		*out = "index.html"
+	size := len(saved.body)
+	if local == "-" {
+		fmt.Fprint(v, "Saving to: ‘STDOUT’\n\n")
+		sys.Out().Write(d.body)
+		captureDownload(sys, "wget", "", &saved)
+	} else {
+		// The directories of the prefix are created as needed
+		if dir := fullPath(sys, path.Dir(local)); len(o.prefix) > 0 {
+			if _, err := sys.FSys().Stat(dir); err != nil && sys.FSys().MkdirAll(dir, 0777&^defaultUmask) == nil {
+				sys.FsEvent("mkdir", dir, log.Fields{"cmd": "wget", "mode": fmt.Sprintf("%04o", 0777&^defaultUmask)})
+			}
+		}
+		if err := saveDownload(sys, "wget", fullPath(sys, local), &saved); err != nil {
+			fmt.Fprintf(o.log, "%v: %v\n\nCannot write to ‘%v’ (%v).\n", local, honeyos.ErrnoString(err), local, honeyos.ErrnoString(err))
+			return wgetResult{status: wgetIO}
+		}
+		if !o.nonVerbose {
+			fmt.Fprintf(v, "Saving to: ‘%v’\n\n", local)
+		}
+	}
+	wgetProgress(sys, v, path.Base(local), len(prior), size, total, elapsed)
+
+	sizes := strconv.Itoa(size)
+	if total >= 0 && d.resp != nil {
+		sizes += "/" + strconv.FormatInt(total, 10)
+	}
+	if o.nonVerbose {
+		name := local
+		if local == "-" {
+			name = "-"
+		}
+		fmt.Fprintf(o.log, "%v URL:%v [%v] -> \"%v\" [1]\n", wgetTime(), d.url, sizes, name)
+	} else if local == "-" {
+		fmt.Fprintf(v, "%v (%v) - written to stdout [%v]\n\n", wgetTime(), wgetRate(len(d.body), elapsed), sizes)
+	} else {
+		fmt.Fprintf(v, "%v (%v) - ‘%v’ saved [%v]\n\n", wgetTime(), wgetRate(len(d.body), elapsed), local, sizes)
+	}
+	return wgetResult{status: wgetOK, size: len(d.body)}
+}
+
+// fetchFailed reports the failed transfer the way wget does at the stage
+// it failed
+func (o *wgetOptions) fetchFailed(sys honeyos.Sys, req *downloadRequest, err error) wgetResult {
+	v := o.verbose()
+	de, _ := err.(*downloadError)
+	if de == nil {
+		fmt.Fprint(v, "Read error (Connection reset by peer) in headers.\nGiving up.\n\n")
+		return wgetResult{status: wgetNetwork}
 	}
-	if !*quiet {
-		fmt.Fprintf(sys.Out(), "Saving to: ‘%v’\n\n", *out)
-		fmt.Fprintf(sys.Out(), "[ <=>%v ] %v       --.-K/s   in 0.1s\n", strings.Repeat(" ", sys.Width()-38), format(len(b)))
+	host := req.url.Hostname()
+	switch de.kind {
+	case errResolve:
+		fmt.Fprintf(v, "Resolving %v (%v)... failed: Name or service not known.\n", host, host)
+		fmt.Fprintf(o.log, "wget: unable to resolve host address ‘%v’\n", host)
+	case errConnect:
+		wgetConnecting(v, req.url, de.addrs, "failed: Connection refused.")
+	case errTimeout:
+		wgetConnecting(v, req.url, de.addrs, "failed: Connection timed out.")
+		fmt.Fprint(v, "Giving up.\n\n")
+	case errTLS:
+		wgetConnecting(v, req.url, de.addrs, "connected.")
+		fmt.Fprint(o.log, wgetCertError(host, de.err))
+		fmt.Fprintf(o.log, "To connect to %v insecurely, use `--no-check-certificate'.\n", host)
+		return wgetResult{status: wgetSSL}
+	default:
+		wgetConnecting(v, req.url, de.addrs, "connected.")
+		fmt.Fprint(v, "HTTP request sent, awaiting response... Read error (Connection reset by peer) in headers.\nGiving up.\n\n")
 	}
-	af := afero.Afero{sys.FSys()}
+	return wgetResult{status: wgetNetwork}
+}
 
-	p := *out
-	if !path.IsAbs(p) {
-		p = path.Join(sys.Getcwd(), p)
+// retrieveFTP downloads the file of the ftp URL
+func (o *wgetOptions) retrieveFTP(sys honeyos.Sys, req *downloadRequest, local string) wgetResult {
+	v := o.verbose()
+	fmt.Fprintf(v, "--%v--  %v\n", wgetTime(), req.url)
+	fmt.Fprintf(v, "           => ‘%v’\n", map[bool]string{true: "STDOUT", false: local}[local == "-"])
+	user := "anonymous"
+	if req.url.User == nil {
+		req.url.User = urllib.UserPassword(user, "-wget@")
+	} else {
+		user = req.url.User.Username()
+	}
+	req.method = "RETR"
+	req.timeout = o.timeout
+	dir, file := path.Split(req.url.Path)
+	start := time.Now()
+	d, err := fetch(sys, req)
+	elapsed := time.Since(start)
+	de, _ := err.(*downloadError)
+	if de != nil && de.kind != errDownload {
+		return o.fetchFailed(sys, req, err)
+	}
+	if de != nil {
+		wgetConnecting(v, req.url, de.addrs, "connected.")
+	} else {
+		wgetConnecting(v, req.url, d.addrs, "connected.")
+	}
+	fmt.Fprintf(v, "Logging in as %v ... ", user)
+	var fe *ftpError
+	if de != nil {
+		fe, _ = de.err.(*ftpError)
+	}
+	if fe != nil && (fe.cmd == "USER" || fe.cmd == "PASS" || len(fe.cmd) == 0) {
+		fmt.Fprint(v, "\n")
+		fmt.Fprint(o.log, "Login incorrect.\n")
+		return wgetResult{status: wgetAuth}
+	}
+	fmt.Fprint(v, "Logged in!\n==> SYST ... done.    ==> PWD ... done.\n")
+	if dir == "/" {
+		fmt.Fprint(v, "==> TYPE I ... done.  ==> CWD not needed.\n")
+	} else {
+		fmt.Fprintf(v, "==> TYPE I ... done.  ==> CWD (1) %v ... done.\n", strings.TrimSuffix(dir, "/"))
 	}
-	err = af.WriteFile(p, b, 0666)
 	if err != nil {
-		fmt.Fprintln(sys.Err(), err)
-		return 1
+		fmt.Fprintf(v, "==> SIZE %v ... done.\n\n==> PASV ... done.    ==> RETR %v ... \n", file, file)
+		fmt.Fprintf(o.log, "No such file ‘%v’.\n\n", file)
+		return wgetResult{status: wgetServerError}
 	}
-	if !*quiet {
-		fmt.Fprintf(sys.Out(), "%v (0.5 KB/s) - ‘%v’ saved[%v]\n", printTs(), *out, format(len(b)))
+	fmt.Fprintf(v, "==> SIZE %v ... %v\n", file, len(d.body))
+	fmt.Fprintf(v, "==> PASV ... done.    ==> RETR %v ... done.\n", file)
+	d.resp = nil
+	return o.save(sys, d, local, nil, elapsed)
+}
+
+// wgetConnecting prints the resolution of the host, unless given as an
+// address, and the connection to it with the result
+func wgetConnecting(w io.Writer, u *urllib.URL, addrs []net.IP, result string) {
+	host, port := u.Hostname(), urlPort(u)
+	if net.ParseIP(host) != nil {
+		fmt.Fprintf(w, "Connecting to %v:%v... %v\n", host, port, result)
+		return
 	}
-	return 0
+	ips := make([]string, len(addrs))
+	for i, ip := range addrs {
+		ips[i] = ip.String()
+	}
+	fmt.Fprintf(w, "Resolving %v (%v)... %v\n", host, host, strings.Join(ips, ", "))
+	addr := host
+	if len(addrs) > 0 {
+		addr = addrs[0].String()
+	}
+	fmt.Fprintf(w, "Connecting to %v (%v)|%v|:%v... %v\n", host, host, addr, port, result)
 }
 
-func (wg wget) Where() string {
-	return "/usr/bin/wget"
+// wgetCertError returns the message of the certificate verification error
+// in the words of wget built with OpenSSL
+func wgetCertError(host string, err error) string {
+	if ue, ok := err.(*urllib.Error); ok {
+		err = ue.Err
+	}
+	switch e := err.(type) {
+	case x509.UnknownAuthorityError:
+		if e.Cert != nil {
+			return fmt.Sprintf("ERROR: cannot verify %v's certificate, issued by ‘%v’:\n  Unable to locally verify the issuer's authority.\n",
+				host, wgetIssuer(e.Cert))
+		}
+	case x509.HostnameError:
+		return fmt.Sprintf("ERROR: no certificate subject alternative name matches\n\trequested host name ‘%v’.\n", host)
+	case x509.CertificateInvalidError:
+		if e.Reason == x509.Expired && e.Cert != nil {
+			return fmt.Sprintf("ERROR: cannot verify %v's certificate, issued by ‘%v’:\n  Issued certificate has expired.\n",
+				host, wgetIssuer(e.Cert))
+		}
+	}
+	return fmt.Sprintf("ERROR: cannot verify %v's certificate:\n  Unable to locally verify the issuer's authority.\n", host)
 }
 
-// Idea from https://stackoverflow.com/a/31046325
-func format(n int) string {
-	in := strconv.Itoa(n)
-	out := make([]byte, len(in)+len(in)/3)
+// wgetIssuer formats the issuer of the certificate like OpenSSL's
+// X509_NAME_oneline
+func wgetIssuer(cert *x509.Certificate) string {
+	var buf bytes.Buffer
+	add := func(key string, values []string) {
+		for _, v := range values {
+			fmt.Fprintf(&buf, "/%v=%v", key, v)
+		}
+	}
+	issuer := cert.Issuer
+	add("C", issuer.Country)
+	add("ST", issuer.Province)
+	add("L", issuer.Locality)
+	add("O", issuer.Organization)
+	add("OU", issuer.OrganizationalUnit)
+	if len(issuer.CommonName) > 0 {
+		add("CN", []string{issuer.CommonName})
+	}
+	return buf.String()
+}
 
-	for i, j, k := len(in)-1, len(out)-1, 0; ; i, j = i-1, j-1 {
-		out[j] = in[i]
-		if i == 0 {
-			return string(out)
+// wgetProgress prints the final state of the progress bar, or of the dot
+// display when the messages do not go to a terminal. Prior is the size of
+// the part retrieved before
+func wgetProgress(sys honeyos.Sys, w io.Writer, name string, prior, size int, total int64, elapsed time.Duration) {
+	if w == ioutil.Discard {
+		return
+	}
+	if !honeyos.IsTerminal(sys.Err()) {
+		wgetDots(w, prior, size, total, elapsed)
+		return
+	}
+	fmt.Fprintf(w, "%v\n\n", wgetBar(sys.Width(), name, prior, size, total, elapsed))
+}
+
+// wgetBar returns the progress bar fitting the terminal width. The columns
+// are the name, percentage, bar, size, speed and time
+func wgetBar(termWidth int, name string, prior, size int, total int64, elapsed time.Duration) string {
+	width := maxInt(termWidth-1, 60)
+	barWidth := width - (20 + 4 + 2 + 8 + 10 + 15)
+	if len(name) > 19 {
+		name = name[:19]
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%-20v", name)
+	if total > 0 {
+		filled := int(int64(size) * int64(barWidth) / total)
+		plus := int(int64(prior) * int64(barWidth) / total)
+		fmt.Fprintf(&buf, "%3d%%[", int64(size)*100/total)
+		buf.WriteString(strings.Repeat("+", plus))
+		if filled > plus {
+			buf.WriteString(strings.Repeat("=", filled-plus-1) + ">")
 		}
-		if k++; k == 3 {
-			j, k = j-1, 0
-			out[j] = ','
+		buf.WriteString(strings.Repeat(" ", maxInt(barWidth-maxInt(filled, plus), 0)) + "]")
+	} else {
+		pos := size / 1024 % maxInt(barWidth-3, 1)
+		fmt.Fprintf(&buf, "    [%v<=>%v]", strings.Repeat(" ", pos), strings.Repeat(" ", barWidth-3-pos))
+	}
+	fmt.Fprintf(&buf, "%8v", wgetHumanReadable(int64(size), 1000, 2))
+	if elapsed < 5*time.Millisecond {
+		buf.WriteString("  --.-KB/s")
+	} else {
+		buf.WriteString(fmt.Sprintf("  %8v", wgetSpeed(size-prior, elapsed, []string{"B/s", "KB/s", "MB/s", "GB/s"})))
+	}
+	fmt.Fprintf(&buf, "%-15v", "    in "+wgetDuration(elapsed))
+	return buf.String()
+}
+
+// wgetDots prints the dot display, a dot for each kilobyte in rows of 50
+// with the percentage and speed at the end of each
+func wgetDots(w io.Writer, prior, size int, total int64, elapsed time.Duration) {
+	const rowBytes = 50 * 1024
+	speed := wgetSpeed(size-prior, elapsed, []string{"", "K", "M", "G"})
+	row := prior / rowBytes * rowBytes
+	for ; ; row += rowBytes {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%6dK", row/1024)
+		end := minInt(row+rowBytes, size)
+		for off := row; off < row+rowBytes; off += 1024 {
+			if (off-row)%(10*1024) == 0 {
+				buf.WriteByte(' ')
+			}
+			switch {
+			case off+1024 > end:
+				buf.WriteByte(' ')
+			case off < prior:
+				buf.WriteByte(',')
+			default:
+				buf.WriteByte('.')
+			}
 		}
+		last := end >= size
+		if total > 0 {
+			fmt.Fprintf(&buf, " %3d%%", int64(end)*100/total)
+		}
+		if last {
+			fmt.Fprintf(&buf, " %v=%v", speed, wgetDuration(elapsed))
+			fmt.Fprintf(w, "%v\n\n", buf.String())
+			return
+		}
+		fmt.Fprintf(&buf, " %v 0s", speed)
+		fmt.Fprintln(w, buf.String())
+	}
+}
+
+// wgetTime returns the time in the format of the wget messages
+func wgetTime() string {
+	return time.Now().Format("2006-01-02 15:04:05")
+}
+
+// wgetHumanReadable formats the size in powers of 1024, with the decimals
+// for values below acc
+func wgetHumanReadable(n int64, acc float64, decimals int) string {
+	if n < 1024 {
+		return strconv.FormatInt(n, 10)
+	}
+	val := float64(n)
+	for _, unit := range "KMGTPEZY" {
+		val /= 1024
+		if val < 1024 || unit == 'Y' {
+			if val >= acc {
+				decimals = 0
+			}
+			return fmt.Sprintf("%.*f%c", decimals, val, unit)
+		}
+	}
+	return ""
+}
+
+// wgetSpeed formats the transfer speed with the units, in powers of 1024
+func wgetSpeed(n int, elapsed time.Duration, units []string) string {
+	if elapsed < 100*time.Microsecond {
+		elapsed = 100 * time.Microsecond
+	}
+	speed := float64(n) / elapsed.Seconds()
+	unit := 0
+	for speed >= 1024 && unit < len(units)-1 {
+		speed /= 1024
+		unit++
+	}
+	precision := 2
+	if speed >= 99.95 {
+		precision = 0
+	} else if speed >= 9.995 {
+		precision = 1
+	}
+	return fmt.Sprintf("%.*f%v", precision, speed, units[unit])
+}
+
+// wgetRate returns the average speed shown after the transfer
+func wgetRate(n int, elapsed time.Duration) string {
+	return wgetSpeed(n, elapsed, []string{" B/s", " KB/s", " MB/s", " GB/s"})
+}
+
+// wgetDuration formats the time taken like wget, with decimals for the
+// short ones
+func wgetDuration(d time.Duration) string {
+	secs := d.Seconds()
+	switch {
+	case secs < 0.005:
+		return "0s"
+	case secs < 1:
+		return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", secs), "0"), ".") + "s"
+	case secs < 10:
+		return fmt.Sprintf("%.1fs", secs)
+	case secs < 60:
+		return fmt.Sprintf("%.0fs", secs)
 	}
+	return fmt.Sprintf("%dm %ds", int(secs)/60, int(secs)%60)
 }
@@ -0,0 +1,169 @@
+package os
+
+import (
+	"bytes"
+	"os"
+	pathlib "path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// wordBreaks are the characters that separate the words being completed
+const wordBreaks = " \t|;&<>()`"
+
+// complete is the AutoCompleteCallback of the terminal. When Tab is pressed
+// it completes command names at the start of a command and paths in the
+// filesystem elsewhere. Pressing Tab again lists the candidates when the
+// word cannot be extended
+func (sh *Shell) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		sh.tabPressed = false
+		return "", 0, false
+	}
+	start := pos
+	for start > 0 && strings.IndexByte(wordBreaks, line[start-1]) < 0 {
+		start--
+	}
+	word := line[start:pos]
+	// Candidates only include the part after the last slash
+	prefix, base := "", word
+	var candidates []string
+	before := strings.TrimRight(line[:start], " \t")
+	if (len(before) == 0 || strings.IndexByte("|;&(`", before[len(before)-1]) >= 0) &&
+		!strings.Contains(word, "/") {
+		candidates = completeCommand(word)
+	} else {
+		if i := strings.LastIndexByte(word, '/'); i >= 0 {
+			prefix, base = word[:i+1], word[i+1:]
+		}
+		candidates = sh.completePath(prefix, base)
+	}
+	if len(candidates) == 0 {
+		return line, pos, true
+	}
+	completion := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "/") {
+		completion += " "
+	}
+	if len(completion) == len(base) && len(candidates) > 1 {
+		if sh.tabPressed {
+			sh.listCandidates(line, candidates)
+		}
+		sh.tabPressed = true
+		return line, pos, true
+	}
+	newLine := line[:start] + prefix + completion + line[pos:]
+	return newLine, start + len(prefix) + len(completion), true
+}
+
+// completeCommand returns the builtins and commands starting with prefix
+func completeCommand(prefix string) []string {
+	names := map[string]bool{}
+	for name := range builtins {
+		names[name] = true
+	}
+	for name := range funcMap {
+		names[name] = true
+	}
+	for name := range fakeFuncList {
+		names[name] = true
+	}
+	var res []string
+	for name := range names {
+		if strings.HasPrefix(name, prefix) && !strings.Contains(name, "/") {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// completePath returns the names in directory dir starting with base.
+// Directories have a trailing slash
+func (sh *Shell) completePath(dir, base string) []string {
+	lookup := dir
+	if strings.HasPrefix(dir, "~") {
+		if home, n := sh.expandTilde(dir); n > 0 {
+			lookup = home + dir[n:]
+		}
+	}
+	if len(lookup) == 0 {
+		lookup = "."
+	}
+	lookup = absPath(sh.sys.Getcwd(), lookup)
+	f, err := sh.sys.FSys().Open(lookup)
+	if err != nil {
+		return nil
+	}
+	infos, _ := f.Readdir(-1)
+	f.Close()
+	var res []string
+	for _, fi := range infos {
+		name := fi.Name()
+		// Hidden files are only completed when asked for
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if fi.IsDir() {
+			name += "/"
+		} else if fi.Mode()&os.ModeSymlink != 0 {
+			// Follow symlinks pointing to directories
+			if isDir, _ := afero.IsDir(sh.sys.FSys(), pathlib.Join(lookup, name)); isDir {
+				name += "/"
+			}
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// listCandidates prints the candidates in columns below the current line,
+// after which the terminal redraws the prompt
+func (sh *Shell) listCandidates(line string, candidates []string) {
+	if sh.terminal == nil {
+		return
+	}
+	width := 0
+	for _, c := range candidates {
+		if len(c) > width {
+			width = len(c)
+		}
+	}
+	width += 2
+	cols := sh.sys.Width() / width
+	if cols < 1 {
+		cols = 1
+	}
+	rows := (len(candidates) + cols - 1) / cols
+	var buf bytes.Buffer
+	buf.WriteString(sh.prompt + line + "\n")
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			// Candidates are sorted down the columns like bash
+			i := c*rows + r
+			if i >= len(candidates) {
+				break
+			}
+			buf.WriteString(candidates[i])
+			if c < cols-1 && i+rows < len(candidates) {
+				buf.WriteString(strings.Repeat(" ", width-len(candidates[i])))
+			}
+		}
+		buf.WriteString("\n")
+	}
+	sh.terminal.Write(buf.Bytes())
+}
+
+// commonPrefix returns the longest common prefix of the strings
+func commonPrefix(strs []string) string {
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
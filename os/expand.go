@@ -0,0 +1,409 @@
+package os
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const ifsChars = " \t\n"
+
+// expander turns a raw word into fields by performing tilde expansion,
+// parameter expansion, field splitting, pathname expansion and quote
+// removal
+type expander struct {
+	sh       *Shell
+	stdio    *procIO
+	noSplit  bool
+	fields   []string
+	cur      bytes.Buffer
+	hasField bool
+	// pattern is the current field with quoted glob characters escaped
+	pattern bytes.Buffer
+	glob    bool
+}
+
+// expandWord expands the raw word into zero or more arguments. Command
+// substitutions read from and report errors to stdio
+func (sh *Shell) expandWord(raw string, stdio *procIO) []string {
+	e := &expander{sh: sh, stdio: stdio}
+	e.expand(raw)
+	e.endField()
+	return e.fields
+}
+
+// expandWords expands all words of a command, including brace expansion
+func (sh *Shell) expandWords(words []string, stdio *procIO) (args []string) {
+	for _, w := range words {
+		for _, bw := range braceExpand(w) {
+			args = append(args, sh.expandWord(bw, stdio)...)
+		}
+	}
+	return
+}
+
+// expandString expands the raw word without field splitting, as done for
+// assignments and the word in ${var:-word}
+func (sh *Shell) expandString(raw string, stdio *procIO) string {
+	e := &expander{sh: sh, stdio: stdio, noSplit: true}
+	e.expand(raw)
+	return e.cur.String()
+}
+
+// write appends the string to current field. Glob characters in quoted
+// strings are taken literally
+func (e *expander) write(s string, quoted bool) {
+	e.cur.WriteString(s)
+	e.hasField = true
+	if !quoted {
+		e.pattern.WriteString(s)
+		e.glob = e.glob || strings.ContainsAny(s, "*?[")
+		return
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte("*?[]\\", s[i]) >= 0 {
+			e.pattern.WriteByte('\\')
+		}
+		e.pattern.WriteByte(s[i])
+	}
+}
+
+func (e *expander) endField() {
+	if !e.hasField {
+		return
+	}
+	var matches []string
+	if e.glob && !e.noSplit {
+		matches = globFS(e.sh.sys.FSys(), e.sh.sys.Getcwd(), e.pattern.String())
+	}
+	if len(matches) > 0 {
+		e.fields = append(e.fields, matches...)
+	} else {
+		e.fields = append(e.fields, e.cur.String())
+	}
+	e.cur.Reset()
+	e.pattern.Reset()
+	e.hasField = false
+	e.glob = false
+}
+
+// writeSplit appends the result of an unquoted expansion, splitting it
+// into fields on whitespace
+func (e *expander) writeSplit(val string) {
+	if e.noSplit {
+		e.write(val, false)
+		return
+	}
+	for len(val) > 0 {
+		i := strings.IndexAny(val, ifsChars)
+		if i < 0 {
+			e.write(val, false)
+			return
+		}
+		if i > 0 {
+			e.write(val[:i], false)
+		}
+		e.endField()
+		val = strings.TrimLeft(val[i:], ifsChars)
+	}
+}
+
+func (e *expander) expand(raw string) {
+	if strings.HasPrefix(raw, "~") {
+		home, n := e.sh.expandTilde(raw)
+		if n > 0 {
+			e.write(home, true)
+			raw = raw[n:]
+		}
+	}
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch c {
+		case '\\':
+			if i+1 < len(raw) {
+				i++
+				e.write(raw[i:i+1], true)
+			}
+		case '\'':
+			end := strings.IndexByte(raw[i+1:], '\'')
+			if end < 0 {
+				e.syntaxError("unexpected EOF while looking for matching `''")
+				return
+			}
+			e.write(raw[i+1:i+1+end], true)
+			i += end + 1
+		case '"':
+			e.hasField = true
+			for i++; i < len(raw) && raw[i] != '"'; i++ {
+				switch {
+				case raw[i] == '\\' && i+1 < len(raw) && strings.IndexByte("$`\"\\\n", raw[i+1]) >= 0:
+					i++
+					e.write(raw[i:i+1], true)
+				case isSubst(raw, i):
+					val, n := e.subst(raw[i:])
+					e.write(val, true)
+					i += n - 1
+				case raw[i] == '$':
+					val, n := e.expandParam(raw[i:])
+					e.write(val, true)
+					i += n - 1
+				default:
+					e.write(raw[i:i+1], true)
+				}
+			}
+		case '$', '`':
+			if isSubst(raw, i) {
+				val, n := e.subst(raw[i:])
+				e.writeSplit(val)
+				i += n - 1
+				continue
+			}
+			val, n := e.expandParam(raw[i:])
+			if n == 1 {
+				e.write("$", false)
+			} else {
+				e.writeSplit(val)
+			}
+			i += n - 1
+		default:
+			e.write(raw[i:i+1], false)
+		}
+	}
+}
+
+// syntaxError reports the word that cannot be expanded, like an
+// unterminated quote. The rest of the word is dropped
+func (e *expander) syntaxError(msg string) {
+	if e.stdio != nil {
+		fmt.Fprintf(e.stdio.err, "%v%v\n", e.sh.errPrefix(), msg)
+	}
+}
+
+// expandHeredoc performs parameter expansion and command substitution on
+// the body of a here-document. Quotes are taken literally and backslash
+// only escapes $, ` and itself
+func (sh *Shell) expandHeredoc(body string, stdio *procIO) string {
+	e := &expander{sh: sh, stdio: stdio, noSplit: true}
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && i+1 < len(body) && strings.IndexByte("$`\\", body[i+1]) >= 0:
+			i++
+			e.write(body[i:i+1], true)
+		case body[i] == '\\' && i+1 < len(body) && body[i+1] == '\n':
+			i++
+		case isSubst(body, i):
+			val, n := e.subst(body[i:])
+			e.write(val, true)
+			i += n - 1
+		case body[i] == '$':
+			val, n := e.expandParam(body[i:])
+			e.write(val, true)
+			i += n - 1
+		default:
+			e.write(body[i:i+1], true)
+		}
+	}
+	return e.cur.String()
+}
+
+// subst runs the command substitution at the beginning of s. It returns
+// the output and the number of bytes consumed
+func (e *expander) subst(s string) (string, int) {
+	end := matchSubst(s, 0)
+	if end < 0 {
+		return s, len(s)
+	}
+	if s[0] == '$' {
+		return e.sh.commandSubst(s[2:end], e.stdio), end + 1
+	}
+	// Backslash only escapes $, ` and \ inside backquotes
+	var src bytes.Buffer
+	for i := 1; i < end; i++ {
+		if s[i] == '\\' && i+1 < end && strings.IndexByte("$`\\", s[i+1]) >= 0 {
+			i++
+		}
+		src.WriteByte(s[i])
+	}
+	return e.sh.commandSubst(src.String(), e.stdio), end + 1
+}
+
+// expandTilde expands ~ and ~user at the beginning of the word. It returns
+// the home directory and the number of bytes consumed, or 0 if the prefix
+// is not expandable
+func (sh *Shell) expandTilde(raw string) (string, int) {
+	end := strings.IndexByte(raw, '/')
+	if end < 0 {
+		end = len(raw)
+	}
+	name := raw[1:end]
+	switch {
+	case len(name) == 0:
+		if home, set := sh.sys.envVars["HOME"]; set {
+			return home, end
+		}
+		return GetUserByID(sh.sys.CurrentUser()).Homedir, end
+	case name == "+":
+		return sh.sys.Getcwd(), end
+	case name == "-":
+		if oldPwd, set := sh.sys.envVars["OLDPWD"]; set {
+			return oldPwd, end
+		}
+	default:
+		if u, exists := usernameMapping[name]; exists {
+			return u.Homedir, end
+		}
+	}
+	return "", 0
+}
+
+// expandParam expands the parameter at the beginning of s, which starts
+// with $. It returns the value and the number of bytes consumed
+func (e *expander) expandParam(s string) (string, int) {
+	sh := e.sh
+	if len(s) < 2 {
+		return "$", 1
+	}
+	c := s[1]
+	switch {
+	case c == '{':
+		end := matchBrace(s, 1)
+		if end < 0 {
+			return s, len(s)
+		}
+		return e.expandBraceParam(s[2:end]), end + 1
+	case strings.IndexByte("?$#!@*-0123456789", c) >= 0:
+		val, _ := sh.lookupVar(s[1:2])
+		return val, 2
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		n := 2
+		for n < len(s) && isName(s[1:n+1]) {
+			n++
+		}
+		val, _ := sh.lookupVar(s[1:n])
+		return val, n
+	}
+	return "$", 1
+}
+
+// expandBraceParam handles ${NAME}, ${#NAME} and the default/alternate
+// value forms ${NAME:-word}, ${NAME:=word} and ${NAME:+word}, with or
+// without the colon
+func (e *expander) expandBraceParam(expr string) string {
+	sh := e.sh
+	if strings.HasPrefix(expr, "#") && len(expr) > 1 {
+		val, _ := sh.lookupVar(expr[1:])
+		return strconv.Itoa(len(val))
+	}
+	n := 1
+	if len(expr) > 0 && strings.IndexByte("?$#!@*-0123456789", expr[0]) < 0 {
+		for n < len(expr) && isName(expr[:n+1]) {
+			n++
+		}
+	}
+	if n > len(expr) {
+		return ""
+	}
+	name, op := expr[:n], expr[n:]
+	val, set := sh.lookupVar(name)
+	if len(op) == 0 {
+		return val
+	}
+	checkEmpty := op[0] == ':'
+	if checkEmpty {
+		op = op[1:]
+	}
+	if len(op) == 0 {
+		return val
+	}
+	useAlt := !set || checkEmpty && len(val) == 0
+	word := op[1:]
+	switch op[0] {
+	case '-':
+		if useAlt {
+			return sh.expandString(word, e.stdio)
+		}
+	case '=':
+		if useAlt {
+			val = sh.expandString(word, e.stdio)
+			sh.sys.SetEnv(name, val)
+		}
+	case '+':
+		if !useAlt {
+			return sh.expandString(word, e.stdio)
+		}
+		return ""
+	}
+	return val
+}
+
+// lookupVar returns the value of shell special parameters or variables
+func (sh *Shell) lookupVar(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(sh.lastStatus), true
+	case "$":
+		return strconv.Itoa(sh.pid), true
+	case "!":
+		if sh.lastBg == 0 {
+			return "", false
+		}
+		return strconv.Itoa(sh.lastBg), true
+	case "#":
+		return strconv.Itoa(len(sh.args)), true
+	case "0":
+		return sh.name, true
+	case "@", "*":
+		return strings.Join(sh.args, " "), true
+	case "-":
+		return "himBH", true
+	case "RANDOM":
+		return strconv.Itoa(rand.Intn(32768)), true
+	case "UID", "EUID":
+		return strconv.Itoa(sh.sys.CurrentUser()), true
+	}
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		if n > len(sh.args) {
+			return "", false
+		}
+		return sh.args[n-1], true
+	}
+	val, ok := sh.sys.envVars[name]
+	return val, ok
+}
+
+// matchBrace returns the position of the } matching the { at pos, or -1
+// if it is not terminated. Braces quoted, escaped or in command
+// substitutions are skipped
+func matchBrace(s string, pos int) int {
+	depth := 0
+	for i := pos; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return -1
+			}
+			i += end + 1
+		case c == '"':
+			if i = matchDquote(s, i); i < 0 {
+				return -1
+			}
+		case isSubst(s, i):
+			if i = matchSubst(s, i); i < 0 {
+				return -1
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,100 @@
+package os
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/mkishere/sshsyrup/virtualfs"
+	"github.com/spf13/afero"
+)
+
+// Symlinker is implemented by filesystems that can create symbolic links
+type Symlinker interface {
+	Symlink(oldname, newname string) error
+}
+
+// Chowner is implemented by filesystems that keep the ownership of files
+type Chowner interface {
+	Chown(name string, uid, gid int) error
+}
+
+// baseFs returns the filesystem wrapped by afero.Afero, so that the optional
+// interfaces of it can be checked
+func baseFs(fs afero.Fs) afero.Fs {
+	switch a := fs.(type) {
+	case afero.Afero:
+		return a.Fs
+	case *afero.Afero:
+		return a.Fs
+	}
+	return fs
+}
+
+// Symlink creates newname as a symbolic link to oldname if the filesystem
+// supports it
+func Symlink(fs afero.Fs, oldname, newname string) error {
+	if s, ok := baseFs(fs).(Symlinker); ok {
+		return s.Symlink(oldname, newname)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EPERM}
+}
+
+// Chown changes the owner of the file. Filesystems that do not keep the
+// ownership silently accept the change so that it looks successful
+func Chown(fs afero.Fs, name string, uid, gid int) error {
+	if c, ok := baseFs(fs).(Chowner); ok {
+		return c.Chown(name, uid, gid)
+	}
+	if _, err := fs.Stat(name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Readlinker is implemented by filesystems that can read symbolic links
+type Readlinker interface {
+	Readlink(name string) (string, error)
+}
+
+// Readlink returns the target of the symbolic link. Files opened from
+// the image may carry the target themselves, which is used when the
+// filesystem does not support it
+func Readlink(fs afero.Fs, name string) (string, error) {
+	if r, ok := baseFs(fs).(Readlinker); ok {
+		return r.Readlink(name)
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if r, ok := f.(interface {
+		Readlink() (string, error)
+	}); ok {
+		return r.Readlink()
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+}
+
+// Accesser is implemented by filesystems that check the permission of the
+// user accessing them
+type Accesser interface {
+	Access(name string, access uint32) error
+}
+
+// Access checks if the user can read, write or execute the file as given by
+// the access bits of virtualfs. Without the support of the filesystem only
+// executing files without any execute bit is refused
+func Access(fs afero.Fs, name string, access uint32) error {
+	if a, ok := baseFs(fs).(Accesser); ok {
+		return a.Access(name, access)
+	}
+	fi, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+	if access&virtualfs.AccessExec != 0 && !fi.IsDir() && fi.Mode()&0111 == 0 {
+		return &os.PathError{Op: "access", Path: name, Err: syscall.EACCES}
+	}
+	return nil
+}
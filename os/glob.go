@@ -0,0 +1,266 @@
+package os
+
+import (
+	"fmt"
+	pathlib "path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// maxBraceItems limits the number of words a brace sequence expands to
+const maxBraceItems = 65536
+
+var braceSeqRegex = regexp.MustCompile(`^(-?[0-9]+|[a-zA-Z])\.\.(-?[0-9]+|[a-zA-Z])(\.\.(-?[0-9]+))?$`)
+
+// skipQuoted returns the position of the last byte of the quoted string,
+// escape sequence, ${...} or command substitution starting at pos, or pos
+// itself if there is none
+func skipQuoted(raw string, pos int) int {
+	switch raw[pos] {
+	case '\\':
+		if pos+1 < len(raw) {
+			return pos + 1
+		}
+	case '\'':
+		if end := strings.IndexByte(raw[pos+1:], '\''); end >= 0 {
+			return pos + end + 1
+		}
+	case '"':
+		if end := matchDquote(raw, pos); end >= 0 {
+			return end
+		}
+	case '`':
+		if end := matchSubst(raw, pos); end >= 0 {
+			return end
+		}
+	case '$':
+		if pos+1 < len(raw) && raw[pos+1] == '{' {
+			if end := matchBrace(raw, pos+1); end >= 0 {
+				return end
+			}
+		}
+		if isSubst(raw, pos) {
+			if end := matchSubst(raw, pos); end >= 0 {
+				return end
+			}
+		}
+	}
+	return pos
+}
+
+// braceExpand performs brace expansion like {a,b} and {1..5} on a raw word
+func braceExpand(raw string) []string {
+	for i := 0; i < len(raw); i++ {
+		if j := skipQuoted(raw, i); j != i {
+			i = j
+			continue
+		}
+		if raw[i] != '{' {
+			continue
+		}
+		end, alts := braceAlternatives(raw, i)
+		if alts == nil {
+			continue
+		}
+		var res []string
+		for _, alt := range alts {
+			res = append(res, braceExpand(raw[:i]+alt+raw[end+1:])...)
+		}
+		return res
+	}
+	return []string{raw}
+}
+
+// braceAlternatives returns the position of the closing brace and the
+// alternatives inside the braces starting at open. nil is returned if
+// the braces do not form a valid expression
+func braceAlternatives(raw string, open int) (int, []string) {
+	depth := 0
+	var commas []int
+	for i := open; i < len(raw); i++ {
+		if j := skipQuoted(raw, i); j != i {
+			i = j
+			continue
+		}
+		switch raw[i] {
+		case '{':
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if len(commas) > 0 {
+				var alts []string
+				start := open + 1
+				for _, c := range append(commas, i) {
+					alts = append(alts, raw[start:c])
+					start = c + 1
+				}
+				return i, alts
+			}
+			return i, braceSequence(raw[open+1 : i])
+		}
+	}
+	return -1, nil
+}
+
+// braceSequence expands the sequence expression x..y[..incr]
+func braceSequence(expr string) []string {
+	m := braceSeqRegex.FindStringSubmatch(expr)
+	if m == nil {
+		return nil
+	}
+	incr := 1
+	if len(m[4]) > 0 {
+		incr, _ = strconv.Atoi(m[4])
+		if incr < 0 {
+			incr = -incr
+		}
+		if incr == 0 {
+			incr = 1
+		}
+	}
+	start, err1 := strconv.Atoi(m[1])
+	end, err2 := strconv.Atoi(m[2])
+	isChar := false
+	switch {
+	case err1 != nil && err2 != nil:
+		start, end, isChar = int(m[1][0]), int(m[2][0]), true
+	case err1 != nil || err2 != nil:
+		return nil
+	}
+	if (end-start)/incr >= maxBraceItems || (start-end)/incr >= maxBraceItems {
+		return nil
+	}
+	if start > end {
+		incr = -incr
+	}
+	width := 0
+	// Zero padding is kept if either number has leading zero
+	for _, n := range m[1:3] {
+		n = strings.TrimPrefix(n, "-")
+		if len(n) > 1 && n[0] == '0' && len(n) > width {
+			width = len(n)
+		}
+	}
+	var seq []string
+	for i := start; incr > 0 && i <= end || incr < 0 && i >= end; i += incr {
+		switch {
+		case isChar:
+			seq = append(seq, string(rune(i)))
+		case width > 0:
+			seq = append(seq, fmt.Sprintf("%0*d", width, i))
+		default:
+			seq = append(seq, strconv.Itoa(i))
+		}
+	}
+	return seq
+}
+
+// hasGlobMeta checks if the pattern contains unescaped glob characters
+func hasGlobMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// globFS returns the sorted list of paths matching the pattern. Relative
+// patterns are matched against cwd and the results stay relative
+func globFS(fs afero.Fs, cwd, pattern string) []string {
+	type match struct{ display, real string }
+	matches := []match{{"", cwd}}
+	if strings.HasPrefix(pattern, "/") {
+		matches = []match{{"/", "/"}}
+	}
+	components := strings.Split(strings.Trim(pattern, "/"), "/")
+	for i, comp := range components {
+		if len(comp) == 0 {
+			continue
+		}
+		last := i == len(components)-1
+		var next []match
+		for _, m := range matches {
+			join := func(name string) match {
+				display := name
+				if len(m.display) > 0 {
+					display = strings.TrimSuffix(m.display, "/") + "/" + name
+				}
+				return match{display, pathlib.Join(m.real, name)}
+			}
+			if !hasGlobMeta(comp) {
+				name := unescapeGlob(comp)
+				n := join(name)
+				if exists, _ := afero.Exists(fs, n.real); exists {
+					next = append(next, n)
+				}
+				continue
+			}
+			if isDir, _ := afero.IsDir(fs, m.real); !isDir {
+				continue
+			}
+			dir, err := fs.Open(m.real)
+			if err != nil {
+				continue
+			}
+			names, _ := dir.Readdirnames(-1)
+			dir.Close()
+			sort.Strings(names)
+			pat := strings.Replace(comp, "[!", "[^", -1)
+			for _, name := range names {
+				// Hidden files are only matched by pattern with leading dot
+				if strings.HasPrefix(name, ".") && !strings.HasPrefix(comp, ".") {
+					continue
+				}
+				if ok, _ := pathlib.Match(pat, name); !ok {
+					continue
+				}
+				n := join(name)
+				if !last {
+					if isDir, _ := afero.IsDir(fs, n.real); !isDir {
+						continue
+					}
+				}
+				next = append(next, n)
+			}
+		}
+		matches = next
+	}
+	var res []string
+	for _, m := range matches {
+		if strings.HasSuffix(pattern, "/") {
+			m.display += "/"
+		}
+		res = append(res, m.display)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func unescapeGlob(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
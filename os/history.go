@@ -0,0 +1,275 @@
+package os
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	pathlib "path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// histFileName is the history file in home directory of the user
+const histFileName = ".bash_history"
+
+// Defaults of HISTSIZE, as set by the .bashrc of Ubuntu, and of the number
+// of entries the line editor keeps for the arrow keys
+const (
+	defaultHistSize = 1000
+	editorHistSize  = 100
+)
+
+// historyFile returns the path of the history file given by HISTFILE,
+// which is not saved when unset or empty
+func (sh *Shell) historyFile() (string, bool) {
+	name, ok := sh.lookupVar("HISTFILE")
+	return name, ok && len(name) > 0
+}
+
+// histSize returns the number of entries kept as given by HISTSIZE.
+// Negative sizes keep every entry
+func (sh *Shell) histSize() int {
+	val, ok := sh.lookupVar("HISTSIZE")
+	if !ok {
+		return defaultHistSize
+	}
+	n, err := strconv.Atoi(val)
+	switch {
+	case err != nil:
+		return defaultHistSize
+	case n < 0:
+		return int(^uint(0) >> 1)
+	}
+	return n
+}
+
+// trimHistory drops the oldest entries beyond HISTSIZE
+func (sh *Shell) trimHistory() {
+	if size := sh.histSize(); len(sh.history) > size {
+		sh.history = append([]string(nil), sh.history[len(sh.history)-size:]...)
+	}
+}
+
+// initHistory sets HISTFILE and HISTSIZE of the interactive shell unless
+// given by the client, and reads the commands left in the history file by
+// previous sessions
+func (sh *Shell) initHistory() {
+	if _, ok := sh.lookupVar("HISTFILE"); !ok {
+		home := sh.sys.Getenv("HOME")
+		if len(home) == 0 {
+			home = GetUserByID(sh.sys.CurrentUser()).Homedir
+		}
+		sh.sys.SetEnv("HISTFILE", pathlib.Join(home, histFileName))
+	}
+	if _, ok := sh.lookupVar("HISTSIZE"); !ok {
+		sh.sys.SetEnv("HISTSIZE", strconv.Itoa(defaultHistSize))
+	}
+	sh.loadHistory()
+}
+
+// loadHistory reads the commands left in the history file by previous
+// sessions
+func (sh *Shell) loadHistory() {
+	name, ok := sh.historyFile()
+	if !ok {
+		return
+	}
+	f, err := sh.sys.FSys().OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Text()) > 0 {
+			sh.history = append(sh.history, scanner.Text())
+		}
+	}
+	sh.trimHistory()
+}
+
+// saveHistory writes the history to the history file, like bash does when
+// the shell exits
+func (sh *Shell) saveHistory() error {
+	name, ok := sh.historyFile()
+	if !ok {
+		return nil
+	}
+	var content bytes.Buffer
+	for _, line := range sh.history {
+		content.WriteString(line + "\n")
+	}
+	f, err := sh.sys.FSys().OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(content.Bytes())
+	return err
+}
+
+// addHistory records the command line in the history, which is written to
+// the history file on exit. Like HISTCONTROL=ignoreboth, lines starting with
+// space and duplicates of the previous line are not recorded
+func (sh *Shell) addHistory(line string) {
+	if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, " ") ||
+		len(sh.history) > 0 && sh.history[len(sh.history)-1] == line {
+		return
+	}
+	sh.history = append(sh.history, line)
+	sh.trimHistory()
+}
+
+// newTerminal returns the line editor over the streams, with the latest
+// entries of the history reachable by the arrow keys. The editor only adds
+// to its history the lines it reads, so the entries are fed to it first
+// with the output discarded
+func (sh *Shell) newTerminal(in io.Reader, out io.Writer) *terminal.Terminal {
+	var seed bytes.Buffer
+	n := 0
+	start := len(sh.history) - editorHistSize
+	if start < 0 {
+		start = 0
+	}
+	for _, line := range sh.history[start:] {
+		// Control characters would be taken as keys
+		if strings.IndexFunc(line, unicode.IsControl) < 0 {
+			seed.WriteString(line + "\r")
+			n++
+		}
+	}
+	w := &switchWriter{Writer: ioutil.Discard}
+	t := terminal.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{io.MultiReader(&seed, in), w}, "")
+	for i := 0; i < n; i++ {
+		t.ReadLine()
+	}
+	w.Writer = out
+	return t
+}
+
+// switchWriter writes to the writer it is set to
+type switchWriter struct {
+	io.Writer
+}
+
+// expandHistory replaces the history references !!, !n, !-n, !prefix and
+// !$ in the command line
+func (sh *Shell) expandHistory(line string) (string, error) {
+	if strings.IndexByte(line, '!') < 0 {
+		return line, nil
+	}
+	var res []byte
+	inDquote := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			res = append(res, line[i:i+2]...)
+			i++
+			continue
+		case c == '\'' && !inDquote:
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				end = len(line) - i - 1
+			}
+			res = append(res, line[i:i+end+1]...)
+			i += end
+			continue
+		case c == '"':
+			inDquote = !inDquote
+		}
+		if c != '!' || i+1 >= len(line) || strings.IndexByte(" \t\n=(\"", line[i+1]) >= 0 {
+			res = append(res, c)
+			continue
+		}
+		end := i + 2
+		if strings.IndexByte("!$", line[i+1]) < 0 {
+			for end < len(line) && strings.IndexByte(" \t\n;&|()<>\"'`", line[end]) < 0 {
+				end++
+			}
+		}
+		event := line[i:end]
+		val, ok := sh.historyEvent(event[1:])
+		if !ok {
+			return line, fmt.Errorf("%v: event not found", event)
+		}
+		res = append(res, val...)
+		i = end - 1
+	}
+	return string(res), nil
+}
+
+// historyEvent returns the history entry referred by the event designator
+func (sh *Shell) historyEvent(event string) (string, bool) {
+	if len(sh.history) == 0 {
+		return "", false
+	}
+	last := sh.history[len(sh.history)-1]
+	switch event {
+	case "!":
+		return last, true
+	case "$":
+		fields := strings.Fields(last)
+		if len(fields) == 0 {
+			return "", false
+		}
+		return fields[len(fields)-1], true
+	}
+	if n, err := strconv.Atoi(event); err == nil {
+		if n < 0 {
+			n += len(sh.history) + 1
+		}
+		if n < 1 || n > len(sh.history) {
+			return "", false
+		}
+		return sh.history[n-1], true
+	}
+	for i := len(sh.history) - 1; i >= 0; i-- {
+		if strings.HasPrefix(sh.history[i], event) {
+			return sh.history[i], true
+		}
+	}
+	return "", false
+}
+
+func builtinHistory(sh *Shell, args []string, stdio *procIO) int {
+	start := 0
+	for _, arg := range args {
+		switch {
+		case arg == "-c":
+			sh.history = nil
+			return 0
+		case arg == "-w":
+			if err := sh.saveHistory(); err != nil {
+				name, _ := sh.historyFile()
+				fmt.Fprintf(stdio.err, "%vhistory: %v: %v\n", sh.errPrefix(), name, ErrnoString(err))
+				return 1
+			}
+			return 0
+		case strings.HasPrefix(arg, "-"):
+			continue
+		default:
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Fprintf(stdio.err, "%vhistory: %v: numeric argument required\n", sh.errPrefix(), arg)
+				return 1
+			}
+			if n < len(sh.history) {
+				start = len(sh.history) - n
+			}
+		}
+	}
+	for i := start; i < len(sh.history); i++ {
+		fmt.Fprintf(stdio.out, "%5d  %v\n", i+1, sh.history[i])
+	}
+	return 0
+}
@@ -0,0 +1,541 @@
+package os
+
+import (
+	"fmt"
+	"io"
+	"os"
+	pathlib "path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/mkishere/sshsyrup/util/termlogger"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// job is a command list started in background with &
+type job struct {
+	n    int
+	pid  int
+	text string
+}
+
+// startSession adds the shell of the connection and the sshd processes
+// serving it to the process table
+func (sh *Shell) startSession(args []string, tty bool) {
+	pid, _, err := sh.sys.Processes().NewSession(sh.sys.CurrentUser(), sh.userName(), args, tty)
+	if err != nil {
+		sh.log.WithError(err).Warn("No PID left for the session")
+	}
+	sh.pid, sh.sys.pid = pid, pid
+}
+
+// endSession ends the processes of the session when the user logs out.
+// Interactive shells hang up their jobs, while those started by an exec
+// request keep running like after bash -c
+func (sh *Shell) endSession(hangup bool) {
+	switch {
+	case sh.pid == 0:
+	case hangup:
+		sh.sys.Processes().Hangup(sh.pid)
+	default:
+		sh.sys.Processes().Logout(sh.pid)
+	}
+}
+
+// startProcess adds the process running the command line. In a background
+// job the process of the job runs the command, like fork followed by exec.
+// It fails like fork when the shell is nested too deep or no PID is free
+func (sh *Shell) startProcess(args []string) (int, error) {
+	procs := sh.sys.Processes()
+	pid := sh.execPid
+	if pid > 0 {
+		sh.execPid = 0
+		procs.Exec(pid, args)
+	} else {
+		if sh.depth >= maxShellDepth {
+			return 0, syscall.EAGAIN
+		}
+		var err error
+		if pid, err = procs.Spawn(sh.sys.pid, sh.sys.CurrentUser(), args); err != nil {
+			return 0, err
+		}
+	}
+	exe := sh.lookPath(args[0])
+	procs.Update(pid, func(p *Process) {
+		p.Exe = exe
+		if sh.noHup {
+			p.NoHup = true
+		}
+		if sh.setsid {
+			p.SID, p.TTY = p.PID, "?"
+		}
+		if p.TTY != "?" && !sh.background {
+			// Foreground process group of the terminal
+			p.State = "S+"
+		}
+	})
+	sh.noHup, sh.setsid = false, false
+	return pid, nil
+}
+
+// runBackground starts the and-or list in a subshell without waiting for
+// it, printing the job number and PID like interactive bash
+func (sh *Shell) runBackground(ao *andOrList, stdio *procIO) int {
+	procs := sh.sys.Processes()
+	// The job is a fork of the shell until it executes a command
+	args, exe := []string{"bash"}, ""
+	if p, exists := procs.Get(sh.sys.pid); exists && len(p.Args) > 0 {
+		args, exe = p.Args, p.Exe
+	}
+	pid, err := procs.Spawn(sh.sys.pid, sh.sys.CurrentUser(), args)
+	if err != nil {
+		return sh.forkFailed(stdio)
+	}
+	procs.Update(pid, func(p *Process) { p.Exe = exe })
+	sub := sh.newSubshell()
+	sub.sys.pid, sub.background = pid, true
+	if len(ao.pipelines) == 1 && len(ao.pipelines[0].cmds) == 1 {
+		if c, simple := ao.pipelines[0].cmds[0].(*simpleCommand); simple {
+			sub.execPid = pid
+			// nohup and setsid apply to the job at once, so that it is not
+			// hung up if the session ends before the job runs
+			procs.Update(pid, func(p *Process) {
+				switch jobLauncher(c) {
+				case "nohup":
+					p.NoHup = true
+				case "setsid":
+					p.SID, p.TTY = p.PID, "?"
+				}
+			})
+		}
+	}
+	sh.lastBg = pid
+	n := 1
+	for _, j := range sh.jobs {
+		if j.n >= n {
+			n = j.n + 1
+		}
+	}
+	sh.jobs = append(sh.jobs, &job{n, pid, ao.String()})
+	if !sh.inSubshell {
+		fmt.Fprintf(stdio.err, "[%d] %d\n", n, pid)
+	}
+	// Background jobs cannot read from the terminal
+	var in io.Reader = eofReader{}
+	if _, isTTY := stdio.in.(ttyReader); isTTY {
+		in = ttyReader{eofReader{}}
+	}
+	sh.bg.Add(1)
+	go func() {
+		defer sh.bg.Done()
+		sub.runAndOr(ao, &procIO{in: in, out: stdio.out, err: stdio.err})
+		procs.Exit(pid)
+	}()
+	return 0
+}
+
+// jobLauncher returns the name of the command run by the simple command
+// before it is expanded, e.g. nohup
+func jobLauncher(c *simpleCommand) string {
+	for _, w := range c.words {
+		if !isAssignment(w) {
+			return pathlib.Base(w)
+		}
+	}
+	return ""
+}
+
+// jobStatus returns the state of the job as shown by jobs
+func (sh *Shell) jobStatus(j *job) string {
+	if _, running := sh.sys.Processes().Get(j.pid); running {
+		return "Running"
+	}
+	return "Done"
+}
+
+// printJob prints the job in the format of jobs. + marks the current job
+// and - the previous one
+func (sh *Shell) printJob(w io.Writer, i int, showPid bool) {
+	j := sh.jobs[i]
+	mark := " "
+	switch i {
+	case len(sh.jobs) - 1:
+		mark = "+"
+	case len(sh.jobs) - 2:
+		mark = "-"
+	}
+	status := sh.jobStatus(j)
+	text := j.text
+	if status == "Running" {
+		text += " &"
+	}
+	if showPid {
+		fmt.Fprintf(w, "[%d]%v %d %-24v%v\n", j.n, mark, j.pid, status, text)
+	} else {
+		fmt.Fprintf(w, "[%d]%v  %-24v%v\n", j.n, mark, status, text)
+	}
+}
+
+// reportJobs prints the jobs finished since the last prompt and removes
+// them from the job list
+func (sh *Shell) reportJobs(w io.Writer) {
+	for i := 0; i < len(sh.jobs); i++ {
+		if sh.jobStatus(sh.jobs[i]) == "Done" {
+			sh.printJob(w, i, false)
+			sh.jobs = append(sh.jobs[:i], sh.jobs[i+1:]...)
+			i--
+		}
+	}
+}
+
+// findJob returns the index of the job referred by %n, %% or %+
+func (sh *Shell) findJob(spec string) int {
+	if len(sh.jobs) == 0 {
+		return -1
+	}
+	switch spec {
+	case "", "%", "%%", "%+":
+		return len(sh.jobs) - 1
+	case "%-":
+		if len(sh.jobs) > 1 {
+			return len(sh.jobs) - 2
+		}
+		return len(sh.jobs) - 1
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(spec, "%"))
+	if err != nil {
+		return -1
+	}
+	for i, j := range sh.jobs {
+		if j.n == n {
+			return i
+		}
+	}
+	return -1
+}
+
+func builtinJobs(sh *Shell, args []string, stdio *procIO) int {
+	showPid, pidOnly := false, false
+	for _, arg := range args {
+		switch arg {
+		case "-l":
+			showPid = true
+		case "-p":
+			pidOnly = true
+		}
+	}
+	for i, j := range sh.jobs {
+		if pidOnly {
+			fmt.Fprintln(stdio.out, j.pid)
+		} else {
+			sh.printJob(stdio.out, i, showPid)
+		}
+	}
+	return 0
+}
+
+func builtinWait(sh *Shell, args []string, stdio *procIO) int {
+	sh.bg.Wait()
+	return 0
+}
+
+func builtinDisown(sh *Shell, args []string, stdio *procIO) int {
+	keep := false
+	var specs []string
+	for _, arg := range args {
+		switch arg {
+		case "-h":
+			keep = true
+		case "-a":
+			for _, j := range sh.jobs {
+				specs = append(specs, "%"+strconv.Itoa(j.n))
+			}
+		default:
+			specs = append(specs, arg)
+		}
+	}
+	if len(specs) == 0 {
+		if len(sh.jobs) == 0 {
+			fmt.Fprintf(stdio.err, "%vdisown: current: no such job\n", sh.errPrefix())
+			return 1
+		}
+		specs = []string{"%+"}
+	}
+	for _, spec := range specs {
+		i := sh.findJob(spec)
+		if i < 0 {
+			fmt.Fprintf(stdio.err, "%vdisown: %v: no such job\n", sh.errPrefix(), spec)
+			return 1
+		}
+		// Disowned jobs do not receive SIGHUP when the shell exits
+		sh.sys.Processes().Update(sh.jobs[i].pid, func(p *Process) { p.NoHup = true })
+		if !keep {
+			sh.jobs = append(sh.jobs[:i], sh.jobs[i+1:]...)
+		}
+	}
+	return 0
+}
+
+// IsTerminal checks if the stream is connected to the terminal of the
+// session
+func IsTerminal(stream interface{}) bool {
+	switch stream.(type) {
+	case ttyReader, stdoutWrapper:
+		return true
+	}
+	return false
+}
+
+// lookPath returns the absolute path of the program the command name runs,
+// relative to the working directory if it has a slash or else found in
+// PATH. Commands not in the filesystem are where they are registered
+func (sh *Shell) lookPath(name string) string {
+	if strings.Contains(name, "/") {
+		return absPath(sh.sys.Getcwd(), name)
+	}
+	for _, dir := range strings.Split(sh.sys.Getenv("PATH"), ":") {
+		p := absPath(sh.sys.Getcwd(), pathlib.Join(dir, name))
+		if fi, err := sh.sys.FSys().Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p
+		}
+	}
+	if cmd, exists := funcMap[name]; exists {
+		return cmd.Where()
+	}
+	return ""
+}
+
+// commandExists checks if the command can be executed by nohup and setsid
+func (sh *Shell) commandExists(name string) bool {
+	if strings.Contains(name, "/") {
+		exists, _ := afero.Exists(sh.sys.FSys(), absPath(sh.sys.Getcwd(), name))
+		return exists
+	}
+	_, registered := funcMap[name]
+	_, fake := fakeFuncList[name]
+	_, builtin := builtins[name]
+	return registered || fake || builtin
+}
+
+func builtinNohup(sh *Shell, args []string, stdio *procIO) int {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(stdio.err, "nohup: missing operand")
+		fmt.Fprintln(stdio.err, "Try 'nohup --help' for more information.")
+		return 125
+	}
+	cmdIO := &procIO{in: stdio.in, out: stdio.out, err: stdio.err}
+	ignoreInput := IsTerminal(stdio.in)
+	if ignoreInput {
+		cmdIO.in = eofReader{}
+	}
+	if IsTerminal(stdio.out) {
+		name, p := "nohup.out", absPath(sh.sys.Getcwd(), "nohup.out")
+		f, err := sh.sys.FSys().OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			name = pathlib.Join(sh.sys.Getenv("HOME"), "nohup.out")
+			p = name
+			f, err = sh.sys.FSys().OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		}
+		if err != nil {
+			fmt.Fprintf(stdio.err, "nohup: failed to open '%v': %v\n", name, ErrnoString(err))
+			return 125
+		}
+		sh.sys.FsEvent("append", p, log.Fields{"cmd": "nohup"})
+		defer f.Close()
+		if ignoreInput {
+			fmt.Fprintf(stdio.err, "nohup: ignoring input and appending output to '%v'\n", name)
+		} else {
+			fmt.Fprintf(stdio.err, "nohup: appending output to '%v'\n", name)
+		}
+		cmdIO.out = f
+		if IsTerminal(stdio.err) {
+			cmdIO.err = f
+		}
+	} else if ignoreInput {
+		fmt.Fprintln(stdio.err, "nohup: ignoring input")
+	}
+	if !sh.commandExists(args[0]) {
+		fmt.Fprintf(cmdIO.err, "nohup: failed to run command '%v': No such file or directory\n", args[0])
+		return 127
+	}
+	sh.noHup = true
+	defer func() { sh.noHup = false }()
+	return sh.execArgs(args, cmdIO)
+}
+
+func builtinSetsid(sh *Shell, args []string, stdio *procIO) int {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-V", "--version":
+			fmt.Fprintln(stdio.out, "setsid from util-linux 2.27.1")
+			return 0
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(stdio.err, "\nUsage:\n setsid [options] <program> [arguments ...]")
+		fmt.Fprintln(stdio.err, "\nRun a program in a new session.")
+		fmt.Fprintln(stdio.err, "\nOptions:\n -c, --ctty     set the controlling terminal to the current one")
+		fmt.Fprintln(stdio.err, " -w, --wait     wait program to exit, and use the same return")
+		fmt.Fprintln(stdio.err, "\n -h, --help     display this help and exit\n -V, --version  output version information and exit")
+		return 1
+	}
+	if !sh.commandExists(args[0]) {
+		fmt.Fprintf(stdio.err, "setsid: failed to execute %v: No such file or directory\n", args[0])
+		return 1
+	}
+	sh.setsid = true
+	defer func() { sh.setsid = false }()
+	return sh.execArgs(args, stdio)
+}
+
+// screenVersion is the version of GNU screen in Ubuntu 16.04
+const screenVersion = "Screen version 4.03.01 (GNU) 28-Jun-15"
+
+func builtinScreen(sh *Shell, args []string, stdio *procIO) int {
+	detach, list, resume := false, false, false
+	name := ""
+	i := 0
+options:
+	for ; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-ls" || arg == "-list" || arg == "-wipe":
+			list = true
+		case arg == "-v" || arg == "--version":
+			fmt.Fprintln(stdio.out, screenVersion)
+			return 0
+		case arg == "-S" && i+1 < len(args):
+			i++
+			name = args[i]
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for j := 1; j < len(arg); j++ {
+				switch arg[j] {
+				case 'd', 'D':
+					detach = true
+				case 'r', 'R', 'x':
+					resume = true
+				case 'S':
+					if j+1 < len(arg) {
+						name = arg[j+1:]
+					} else if i+1 < len(args) {
+						i++
+						name = args[i]
+					}
+					j = len(arg)
+				}
+			}
+		default:
+			break options
+		}
+	}
+	procs := sh.sys.Processes()
+	uid := sh.sys.CurrentUser()
+	var screens []Process
+	for _, p := range procs.List() {
+		if p.UID == uid && len(p.Args) > 0 && p.Args[0] == "SCREEN" {
+			screens = append(screens, p)
+		}
+	}
+	socketDir := "/var/run/screen/S-" + sh.userName()
+	switch {
+	case list:
+		if len(screens) == 0 {
+			fmt.Fprintf(stdio.out, "No Sockets found in %v.\n\n", socketDir)
+			return 1
+		}
+		if len(screens) == 1 {
+			fmt.Fprintln(stdio.out, "There is a screen on:")
+		} else {
+			fmt.Fprintln(stdio.out, "There are screens on:")
+		}
+		for _, p := range screens {
+			fmt.Fprintf(stdio.out, "\t%d.%v\t(%v)\t(Detached)\n", p.PID, screenName(p.Args), p.Start.Format("01/02/2006 03:04:05 PM"))
+		}
+		if len(screens) == 1 {
+			fmt.Fprintf(stdio.out, "1 Socket in %v.\n\n", socketDir)
+		} else {
+			fmt.Fprintf(stdio.out, "%d Sockets in %v.\n\n", len(screens), socketDir)
+		}
+		return 1
+	case !detach && !IsTerminal(stdio.in):
+		fmt.Fprintln(stdio.err, "Must be connected to a terminal.")
+		return 1
+	case resume && len(screens) == 0:
+		fmt.Fprintln(stdio.out, "There is no screen to be resumed.")
+		return 1
+	case !detach:
+		fmt.Fprintf(stdio.out, "Cannot open your terminal '/dev/%v' - please check.\n", procTTY(procs, sh.pid))
+		return 1
+	}
+	// Start a detached session running the command, or the shell of the
+	// user if none is given
+	cmd := args[i:]
+	if len(cmd) == 0 {
+		cmd = []string{pathlib.Base(sh.sys.Getenv("SHELL"))}
+	}
+	if len(name) == 0 {
+		args = append([]string{"-S", strings.Replace(procTTY(procs, sh.pid), "/", "-", -1) + "." + sh.sys.Hostname()}, args...)
+	}
+	pid, err := procs.Spawn(sh.sys.pid, uid, append([]string{"SCREEN"}, args...))
+	if err != nil {
+		fmt.Fprintln(stdio.out, "fork: Resource temporarily unavailable")
+		return 1
+	}
+	procs.Update(pid, func(p *Process) {
+		p.SID, p.TTY, p.NoHup, p.State = pid, "?", true, "Ss"
+	})
+	sub := sh.newSubshell()
+	sub.sys.pid, sub.background = pid, true
+	null := &procIO{in: eofReader{}, out: termlogger.DummyWriter{}, err: termlogger.DummyWriter{}}
+	sh.bg.Add(1)
+	go func() {
+		defer sh.bg.Done()
+		if !isShellName(cmd[0]) {
+			sub.execArgs(cmd, null)
+		} else {
+			// The shell in the window waits for the user to attach
+			if child, err := procs.Spawn(pid, uid, cmd); err == nil {
+				procs.Update(child, func(p *Process) { p.State, p.detached = "Ss+", true })
+			}
+		}
+		// screen terminates when its last window is closed
+		for _, p := range procs.List() {
+			if p.PPID == pid {
+				return
+			}
+		}
+		procs.Exit(pid)
+	}()
+	return 0
+}
+
+// screenName returns the session name given to screen with -S
+func screenName(args []string) string {
+	for i, arg := range args {
+		if arg == "-S" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "-") && strings.Contains(arg, "S") {
+			if pos := strings.IndexByte(arg, 'S'); pos+1 < len(arg) {
+				return arg[pos+1:]
+			} else if i+1 < len(args) {
+				return args[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// procTTY returns the terminal of the process
+func procTTY(procs *ProcessTable, pid int) string {
+	if p, exists := procs.Get(pid); exists && p.TTY != "?" {
+		return p.TTY
+	}
+	return "pts/0"
+}
@@ -0,0 +1,195 @@
+package os
+
+import (
+	"fmt"
+	"io"
+	"os"
+	pathlib "path"
+	"strconv"
+	"strings"
+
+	"github.com/mkishere/sshsyrup/virtualfs"
+	"github.com/spf13/afero"
+)
+
+// DefaultMounts is the mount table of an Ubuntu 16.04 virtual machine. The
+// sources, types, options and sizes left out are filled by kind
+var DefaultMounts = []virtualfs.Mount{
+	{Dir: "/sys", Kind: virtualfs.FsSys},
+	{Dir: "/proc", Kind: virtualfs.FsProc},
+	{Dir: "/dev", Kind: virtualfs.FsDev},
+	{Dir: "/run", Kind: virtualfs.FsTmpfs, Options: "rw,nosuid,noexec,relatime,mode=755"},
+	{Dir: "/", Kind: virtualfs.FsImage},
+	{Dir: "/dev/shm", Kind: virtualfs.FsTmpfs, Options: "rw,nosuid,nodev"},
+}
+
+// mountTable is the mount table of the hosts, or nil for DefaultMounts
+var mountTable []virtualfs.Mount
+
+// SetMounts changes the mount table of the hosts. The image is mounted at
+// / if no other filesystem is
+func SetMounts(mounts []virtualfs.Mount) error {
+	table := make([]virtualfs.Mount, 0, len(mounts)+1)
+	root := false
+	for _, mnt := range mounts {
+		mnt.Dir = pathlib.Clean("/" + mnt.Dir)
+		switch mnt.Kind {
+		case virtualfs.FsImage:
+			if mnt.Dir != "/" {
+				return fmt.Errorf("image can only be mounted at /, not %v", mnt.Dir)
+			}
+		case virtualfs.FsHost:
+			if fi, err := os.Stat(mnt.Path); err != nil || !fi.IsDir() {
+				return fmt.Errorf("cannot mount %v at %v: not a directory", mnt.Path, mnt.Dir)
+			}
+		case virtualfs.FsTmpfs, virtualfs.FsProc, virtualfs.FsSys, virtualfs.FsDev:
+		default:
+			return fmt.Errorf("unknown filesystem %q mounted at %v", mnt.Kind, mnt.Dir)
+		}
+		root = root || mnt.Dir == "/"
+		table = append(table, mnt)
+	}
+	if !root {
+		table = append([]virtualfs.Mount{{Dir: "/", Kind: virtualfs.FsImage}}, table...)
+	}
+	mountTable = table
+	return nil
+}
+
+// mounts returns the mount table with the sources, types, options and
+// sizes not set filled by kind
+func mounts() []virtualfs.Mount {
+	table := mountTable
+	if table == nil {
+		table = DefaultMounts
+	}
+	mem := CurrentPersona().MemTotal
+	res := make([]virtualfs.Mount, len(table))
+	for i, mnt := range table {
+		def := virtualfs.Mount{Source: mnt.Kind, Type: mnt.Kind, Options: "rw,nosuid,nodev,noexec,relatime"}
+		switch mnt.Kind {
+		case virtualfs.FsImage:
+			def = virtualfs.Mount{Source: "/dev/xvda1", Type: "ext4", Options: "rw,relatime,discard,data=ordered",
+				Size: 8065444, Used: 1679792}
+		case virtualfs.FsHost:
+			def = virtualfs.Mount{Source: "/dev/xvdf", Type: "ext4", Options: "ro,relatime,data=ordered",
+				Size: 10190136, Used: 36888}
+		case virtualfs.FsTmpfs:
+			def = virtualfs.Mount{Source: "tmpfs", Type: "tmpfs", Options: "rw,nosuid,nodev", Size: mem / 2}
+			if mnt.Dir == "/run" {
+				def.Size = mem / 10
+			}
+		case virtualfs.FsDev:
+			def = virtualfs.Mount{Source: "udev", Type: "devtmpfs", Size: mem / 2,
+				Options: fmt.Sprintf("rw,nosuid,relatime,size=%dk,nr_inodes=%d,mode=755", mem/2, mem/8)}
+		}
+		if len(mnt.Source) == 0 {
+			mnt.Source = def.Source
+		}
+		if len(mnt.Type) == 0 {
+			mnt.Type = def.Type
+		}
+		if len(mnt.Options) == 0 {
+			mnt.Options = def.Options
+		}
+		if mnt.Size == 0 {
+			mnt.Size, mnt.Used = def.Size, def.Used
+		}
+		switch mnt.Kind {
+		case virtualfs.FsHost:
+			// Directories of the host are never written
+			if !mnt.ReadOnly() {
+				mnt.Options = "ro," + strings.TrimPrefix(mnt.Options, "rw,")
+			}
+		case virtualfs.FsTmpfs:
+			if !strings.Contains(mnt.Options, "size=") {
+				mnt.Options += fmt.Sprintf(",size=%dk", mnt.Size)
+			}
+		}
+		res[i] = mnt
+	}
+	return res
+}
+
+// tmpfsMode returns the mode of the root of tmpfs from the mode option,
+// which is 1777 by default like /tmp
+func tmpfsMode(options string) os.FileMode {
+	for _, opt := range strings.Split(options, ",") {
+		if strings.HasPrefix(opt, "mode=") {
+			if m, err := strconv.ParseUint(opt[5:], 8, 32); err == nil {
+				mode := os.FileMode(m & 0777)
+				if m&01000 != 0 {
+					mode |= os.ModeSticky
+				}
+				return mode
+			}
+		}
+	}
+	return 0777 | os.ModeSticky
+}
+
+// sessionMounts returns the filesystems mounted for a session, other than
+// the image and those generated for each process
+func sessionMounts() map[string]afero.Fs {
+	res := make(map[string]afero.Fs)
+	for _, mnt := range mounts() {
+		switch mnt.Kind {
+		case virtualfs.FsTmpfs:
+			res[mnt.Dir] = virtualfs.NewTmpFs(tmpfsMode(mnt.Options))
+		case virtualfs.FsHost:
+			res[mnt.Dir] = virtualfs.NewHostFs(mnt.Path)
+		}
+	}
+	return res
+}
+
+// mountFs returns the filesystem of the session with the filesystems of
+// the mount table mounted
+func (sys *System) mountFs() *virtualfs.MountFs {
+	var m *virtualfs.MountFs
+	table := mounts()
+	for i, mnt := range table {
+		switch mnt.Kind {
+		case virtualfs.FsImage:
+			mnt.Fs = sys.fSys
+		case virtualfs.FsProc:
+			mnt.Fs = newProcFs(sys, func() []virtualfs.Mount { return m.Mounts() })
+		case virtualfs.FsSys:
+			mnt.Fs = newSysFs()
+		case virtualfs.FsDev:
+			mnt.Fs = virtualfs.NewDevFs(sys.terminal())
+		default:
+			mnt.Fs = sys.mounts[mnt.Dir]
+		}
+		// Filesystems missing in the session, e.g. mounted after it started,
+		// are empty
+		if mnt.Fs == nil {
+			mnt.Fs = virtualfs.NewReadOnlyFs(afero.NewMemMapFs())
+		}
+		table[i] = mnt
+	}
+	m = virtualfs.NewMountFs(sys.fSys, table...)
+	return m
+}
+
+// Mounts returns the filesystems mounted, in the order they are mounted
+func (sys *System) Mounts() []virtualfs.Mount {
+	return sys.mountFs().Mounts()
+}
+
+// terminal returns the terminal of the current process, if any
+func (sys *System) terminal() *virtualfs.Terminal {
+	p, exists := sys.Processes().Get(sys.pid)
+	if !exists || sys.sshChan == nil || !strings.HasPrefix(p.TTY, "pts/") {
+		return nil
+	}
+	pts, _ := strconv.Atoi(strings.TrimPrefix(p.TTY, "pts/"))
+	return &virtualfs.Terminal{
+		ReadWriter: struct {
+			io.Reader
+			io.Writer
+		}{sys.In(), sys.Out()},
+		Pts: pts,
+		UID: p.UID,
+	}
+}
@@ -0,0 +1,86 @@
+package os
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mkishere/sshsyrup/virtualfs"
+	"github.com/spf13/afero"
+)
+
+func TestSetMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Chmod(dir, 0755)
+	ioutil.WriteFile(dir+"/index.html", []byte("hello\n"), 0644)
+	if err := SetMounts([]virtualfs.Mount{{Dir: "/srv", Kind: "nfs"}}); err == nil {
+		t.Error("Unknown filesystem mounted")
+	}
+	if err := SetMounts([]virtualfs.Mount{{Dir: "/srv", Kind: virtualfs.FsHost, Path: dir + "/index.html"}}); err == nil {
+		t.Error("File of the host mounted")
+	}
+	err = SetMounts([]virtualfs.Mount{
+		{Dir: "/proc", Kind: virtualfs.FsProc},
+		{Dir: "/tmp", Kind: virtualfs.FsTmpfs},
+		{Dir: "/srv", Kind: virtualfs.FsHost, Path: dir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { mountTable = nil }()
+
+	sh := newTestShell(t)
+	fs := sh.sys.FSys()
+	mounts := sh.sys.Mounts()
+	if len(mounts) != 4 || mounts[0].Dir != "/" || mounts[0].Type != "ext4" {
+		t.Fatalf("Mount table without the image at /: %+v", mounts)
+	}
+	if mounts[3].Options != "ro,relatime,data=ordered" {
+		t.Errorf("Directory of the host mounted %v", mounts[3].Options)
+	}
+	if content, err := afero.ReadFile(fs, "/srv/index.html"); err != nil || string(content) != "hello\n" {
+		t.Errorf("Reading from the host: %q, %v", content, err)
+	}
+	sh.sys.userId = 0
+	if err := afero.WriteFile(sh.sys.FSys(), "/srv/index.html", nil, 0644); err == nil || ErrnoString(err) != "Read-only file system" {
+		t.Errorf("Writing to the host as root: %v", err)
+	}
+	if fi, err := fs.Stat("/tmp"); err != nil || fi.Mode() != os.ModeDir|os.ModeSticky|0777 {
+		t.Errorf("/tmp mounted with mode %v, %v", fi.Mode(), err)
+	}
+	for _, mnt := range mounts {
+		if mnt.Dir == "/dev" {
+			t.Error("/dev mounted without being in the table")
+		}
+	}
+	sh.sys.pid, _ = sh.sys.Processes().Spawn(1, sh.sys.CurrentUser(), []string{"cat"})
+	defer sh.sys.Processes().Exit(sh.sys.pid)
+	if content, _ := afero.ReadFile(fs, "/proc/mounts"); !strings.Contains(string(content), "tmpfs /tmp tmpfs rw,") {
+		t.Errorf("/tmp missing in /proc/mounts:\n%s", content)
+	}
+}
+
+func TestTmpInLayer(t *testing.T) {
+	vfs, err := virtualfs.NewVirtualFS("../filesystem.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := afero.NewMemMapFs()
+	sh := newTestShell(t)
+	sys := NewSystem("mk", "spr1139", "tmp-test", virtualfs.NewOwnerFs(virtualfs.NewLayerFs(vfs, layer)), nil, 80, 24, sh.sys.log)
+	if fi, err := sys.FSys().Stat("/tmp"); err != nil || fi.Mode() != os.ModeDir|os.ModeSticky|0777 {
+		t.Fatalf("/tmp is %v, %v", fi, err)
+	}
+	if err := afero.WriteFile(sys.FSys(), "/tmp/bot.sh", []byte("echo\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Dropped files are kept with the layer
+	if b, err := afero.ReadFile(layer, "/tmp/bot.sh"); string(b) != "echo\n" {
+		t.Errorf("/tmp/bot.sh in the layer: %q, %v", b, err)
+	}
+}
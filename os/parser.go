@@ -0,0 +1,723 @@
+package os
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tokWord tokenType = iota
+	tokPipe
+	tokSeparator
+	tokAndOr
+	tokRedirect
+	tokLParen
+	tokRParen
+	// tokHeredoc is the body of a here-document, placed after the
+	// delimiter word
+	tokHeredoc
+)
+
+type token struct {
+	typ tokenType
+	val string
+}
+
+// redirect describes a single I/O redirection attached to a command,
+// e.g. 2>&1 is {fd: 2, op: ">&", target: "1"}. For here-documents the
+// target is the delimiter and body holds the lines read
+type redirect struct {
+	fd     int
+	op     string
+	target string
+	body   string
+}
+
+// command is an element of a pipeline, which is one of *simpleCommand,
+// *subshell or *group
+type command interface{}
+
+// simpleCommand is a command name with its arguments and redirections.
+// Words are kept raw (quotes included) so that they can be expanded
+// right before execution
+type simpleCommand struct {
+	words  []string
+	redirs []redirect
+}
+
+// subshell is a list in parentheses, run in a copy of the shell
+type subshell struct {
+	list   cmdList
+	redirs []redirect
+}
+
+// group is a list in braces, run in the current shell
+type group struct {
+	list   cmdList
+	redirs []redirect
+}
+
+// pipeline is a list of commands connected with |
+type pipeline struct {
+	cmds   []command
+	negate bool
+}
+
+// andOrList is a chain of pipelines joined by && or ||. ops[i] is the
+// operator between pipelines[i] and pipelines[i+1]. background is set if
+// the list is terminated by &
+type andOrList struct {
+	pipelines  []*pipeline
+	ops        []string
+	background bool
+}
+
+// cmdList is a list of and-or lists separated by ;, & or newline
+type cmdList []*andOrList
+
+// errIncomplete is returned when the input ends in the middle of a
+// quoted string, so that the caller may read more lines
+var errIncomplete = errors.New("unexpected end of input")
+
+type syntaxError struct {
+	token string
+}
+
+func (e syntaxError) Error() string {
+	return fmt.Sprintf("syntax error near unexpected token `%v'", e.token)
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// lex splits the command line into words and operators. Quotes and
+// escapes are validated but preserved in the word tokens.
+func lex(line string) ([]token, error) {
+	var tokens []token
+	var word bytes.Buffer
+	inWord := false
+	// heredocs are the positions of the delimiters of here-documents
+	// waiting for their body
+	var heredocs []int
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, token{tokWord, word.String()})
+			word.Reset()
+			inWord = false
+		}
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case isBlank(c):
+			flush()
+		case c == '#' && !inWord:
+			for i < len(line) && line[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '\\':
+			if i+1 >= len(line) {
+				return nil, errIncomplete
+			}
+			if line[i+1] == '\n' {
+				// Line continuation
+				if i+2 >= len(line) {
+					return nil, errIncomplete
+				}
+				i++
+				continue
+			}
+			word.WriteString(line[i : i+2])
+			inWord = true
+			i++
+		case c == '$' && i+1 < len(line) && line[i+1] == '{':
+			end := matchBrace(line, i+1)
+			if end < 0 {
+				return nil, errIncomplete
+			}
+			word.WriteString(line[i : end+1])
+			inWord = true
+			i = end
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errIncomplete
+			}
+			word.WriteString(line[i : i+end+2])
+			inWord = true
+			i += end + 1
+		case c == '$' && i+1 < len(line) && line[i+1] == '(' || c == '`':
+			end := matchSubst(line, i)
+			if end < 0 {
+				return nil, errIncomplete
+			}
+			word.WriteString(line[i : end+1])
+			inWord = true
+			i = end
+		case c == '"':
+			end := matchDquote(line, i)
+			if end < 0 {
+				return nil, errIncomplete
+			}
+			word.WriteString(line[i : end+1])
+			inWord = true
+			i = end
+		case c == '<' || c == '>':
+			fd := -1
+			if inWord && isDigits(word.String()) {
+				fd, _ = strconv.Atoi(word.String())
+				word.Reset()
+				inWord = false
+			}
+			flush()
+			op := string(c)
+			switch {
+			case strings.HasPrefix(line[i:], "<<<"):
+				op = "<<<"
+				i += 2
+			case strings.HasPrefix(line[i:], "<<-"):
+				op = "<<-"
+				i += 2
+				heredocs = append(heredocs, len(tokens)+1)
+			case strings.HasPrefix(line[i:], "<<"):
+				op = "<<"
+				i++
+				// The body is read after the end of line, and put after
+				// the delimiter which is the next token
+				heredocs = append(heredocs, len(tokens)+1)
+			case i+1 < len(line) && (line[i+1] == '>' && c == '>' || line[i+1] == '&'):
+				op += string(line[i+1])
+				i++
+			}
+			if fd < 0 {
+				fd = 1
+				if c == '<' {
+					fd = 0
+				}
+			}
+			tokens = append(tokens, token{tokRedirect, strconv.Itoa(fd) + op})
+		case c == '&' && i+1 < len(line) && line[i+1] == '>':
+			// &> and &>> redirect both stdout and stderr
+			flush()
+			op := "&>"
+			i++
+			if i+1 < len(line) && line[i+1] == '>' {
+				op += ">"
+				i++
+			}
+			tokens = append(tokens, token{tokRedirect, op})
+		case c == '|':
+			flush()
+			if i+1 < len(line) && line[i+1] == '|' {
+				tokens = append(tokens, token{tokAndOr, "||"})
+				i++
+			} else {
+				tokens = append(tokens, token{tokPipe, "|"})
+			}
+		case c == '&':
+			flush()
+			if i+1 < len(line) && line[i+1] == '&' {
+				tokens = append(tokens, token{tokAndOr, "&&"})
+				i++
+			} else {
+				tokens = append(tokens, token{tokSeparator, "&"})
+			}
+		case c == ';' || c == '\n':
+			flush()
+			tokens = append(tokens, token{tokSeparator, string(c)})
+			if c == '\n' && len(heredocs) > 0 {
+				var next int
+				var err error
+				if tokens, next, err = readHeredocs(line, i+1, tokens, heredocs); err != nil {
+					return nil, err
+				}
+				heredocs = nil
+				i = next - 1
+			}
+		case c == '(':
+			flush()
+			tokens = append(tokens, token{tokLParen, "("})
+		case c == ')':
+			flush()
+			tokens = append(tokens, token{tokRParen, ")"})
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flush()
+	if len(heredocs) > 0 {
+		return nil, errIncomplete
+	}
+	return tokens, nil
+}
+
+// readHeredocs reads the bodies of the here-documents from the lines
+// starting at pos. delims are the positions of the delimiter tokens, after
+// each of which the body is inserted. It returns the position after the
+// last body
+func readHeredocs(line string, pos int, tokens []token, delims []int) ([]token, int, error) {
+	for n, idx := range delims {
+		// Each body inserted shifts the following tokens
+		idx += n
+		if idx >= len(tokens) || tokens[idx].typ != tokWord {
+			return nil, 0, syntaxError{"newline"}
+		}
+		delim := unquoteDelim(tokens[idx].val)
+		stripTabs := strings.HasSuffix(tokens[idx-1].val, "<<-")
+		var body bytes.Buffer
+		found := false
+		for !found && pos < len(line) {
+			l := line[pos:]
+			if end := strings.IndexByte(l, '\n'); end >= 0 {
+				l = l[:end]
+			}
+			pos += len(l) + 1
+			if stripTabs {
+				l = strings.TrimLeft(l, "\t")
+			}
+			if l == delim {
+				found = true
+			} else {
+				body.WriteString(l + "\n")
+			}
+		}
+		if !found {
+			return nil, 0, errIncomplete
+		}
+		tokens = append(tokens[:idx+1], append([]token{{tokHeredoc, body.String()}}, tokens[idx+1:]...)...)
+	}
+	if pos > len(line) {
+		pos = len(line)
+	}
+	return tokens, pos, nil
+}
+
+// unquoteDelim removes the quotes in the delimiter of a here-document
+func unquoteDelim(raw string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			if i+1 < len(raw) {
+				i++
+				b.WriteByte(raw[i])
+			}
+		case '\'', '"':
+		default:
+			b.WriteByte(raw[i])
+		}
+	}
+	return b.String()
+}
+
+// isSubst checks if a command substitution starts at pos
+func isSubst(s string, pos int) bool {
+	return s[pos] == '`' || s[pos] == '$' && pos+1 < len(s) && s[pos+1] == '('
+}
+
+// matchSubst returns the position of the end of the command substitution
+// $(...) or `...` starting at pos, or -1 if it is not terminated
+func matchSubst(s string, pos int) int {
+	if s[pos] == '`' {
+		for i := pos + 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '`':
+				return i
+			}
+		}
+		return -1
+	}
+	depth := 0
+	for i := pos + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return -1
+			}
+			i += end + 1
+		case c == '"':
+			if i = matchDquote(s, i); i < 0 {
+				return -1
+			}
+		case isSubst(s, i):
+			if i = matchSubst(s, i); i < 0 {
+				return -1
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// matchDquote returns the position of the double quote closing the one
+// at pos, or -1 if it is not terminated
+func matchDquote(s string, pos int) int {
+	for i := pos + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			return i
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			if i = matchBrace(s, i+1); i < 0 {
+				return -1
+			}
+		case isSubst(s, i):
+			if i = matchSubst(s, i); i < 0 {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse turns the command line into a list of commands
+func parse(line string) (cmdList, error) {
+	tokens, err := lex(line)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, syntaxError{t.val}
+	}
+	return list, nil
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *parser) next() *token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) skipNewlines() {
+	for t := p.peek(); t != nil && t.typ == tokSeparator && t.val == "\n"; t = p.peek() {
+		p.pos++
+	}
+}
+
+// atListEnd checks if the next token closes the enclosing subshell or group
+func (p *parser) atListEnd() bool {
+	t := p.peek()
+	return t == nil || t.typ == tokRParen || t.typ == tokWord && t.val == "}"
+}
+
+// parseList parses and-or lists until end of input or the closing
+// token of a subshell/group
+func (p *parser) parseList() (cmdList, error) {
+	var list cmdList
+	for {
+		p.skipNewlines()
+		if p.atListEnd() {
+			return list, nil
+		}
+		ao, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ao)
+		t := p.peek()
+		if t == nil || t.typ != tokSeparator {
+			return list, nil
+		}
+		ao.background = t.val == "&"
+		p.pos++
+	}
+}
+
+func (p *parser) parseAndOr() (*andOrList, error) {
+	ao := &andOrList{}
+	for {
+		pl, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		ao.pipelines = append(ao.pipelines, pl)
+		t := p.peek()
+		if t == nil || t.typ != tokAndOr {
+			return ao, nil
+		}
+		ao.ops = append(ao.ops, t.val)
+		p.pos++
+		p.skipNewlines()
+	}
+}
+
+func (p *parser) parsePipeline() (*pipeline, error) {
+	pl := &pipeline{}
+	if t := p.peek(); t != nil && t.typ == tokWord && t.val == "!" {
+		pl.negate = true
+		p.pos++
+	}
+	for {
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pl.cmds = append(pl.cmds, cmd)
+		t := p.peek()
+		if t == nil || t.typ != tokPipe {
+			return pl, nil
+		}
+		p.pos++
+		p.skipNewlines()
+	}
+}
+
+func (p *parser) parseCommand() (command, error) {
+	t := p.peek()
+	switch {
+	case t == nil:
+		return nil, errIncomplete
+	case t.typ == tokLParen:
+		p.pos++
+		list, err := p.parseCompound(tokRParen, ")")
+		if err != nil {
+			return nil, err
+		}
+		sub := &subshell{list: list}
+		sub.redirs, err = p.parseRedirects()
+		return sub, err
+	case t.typ == tokWord && t.val == "{":
+		p.pos++
+		list, err := p.parseCompound(tokWord, "}")
+		if err != nil {
+			return nil, err
+		}
+		grp := &group{list: list}
+		grp.redirs, err = p.parseRedirects()
+		return grp, err
+	}
+	cmd := &simpleCommand{}
+	for t := p.peek(); t != nil; t = p.peek() {
+		switch t.typ {
+		case tokWord:
+			cmd.words = append(cmd.words, t.val)
+			p.pos++
+		case tokRedirect:
+			r, err := p.parseRedirect()
+			if err != nil {
+				return nil, err
+			}
+			cmd.redirs = append(cmd.redirs, r)
+		case tokLParen:
+			return nil, syntaxError{t.val}
+		default:
+			if cmd.empty() {
+				return nil, syntaxError{t.val}
+			}
+			return cmd, nil
+		}
+	}
+	if cmd.empty() {
+		return nil, errIncomplete
+	}
+	return cmd, nil
+}
+
+// parseCompound parses the body of a subshell or group up to the
+// closing token
+func (p *parser) parseCompound(closeType tokenType, closeVal string) (cmdList, error) {
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	switch {
+	case t == nil:
+		return nil, errIncomplete
+	case t.typ != closeType || t.val != closeVal:
+		return nil, syntaxError{t.val}
+	case len(list) == 0:
+		return nil, syntaxError{t.val}
+	}
+	return list, nil
+}
+
+func (p *parser) parseRedirects() (redirs []redirect, err error) {
+	for t := p.peek(); t != nil && t.typ == tokRedirect; t = p.peek() {
+		r, err := p.parseRedirect()
+		if err != nil {
+			return nil, err
+		}
+		redirs = append(redirs, r)
+	}
+	return
+}
+
+func (p *parser) parseRedirect() (redirect, error) {
+	op := p.next()
+	t := p.next()
+	if t == nil {
+		return redirect{}, syntaxError{"newline"}
+	}
+	if t.typ != tokWord {
+		return redirect{}, syntaxError{t.val}
+	}
+	r, err := newRedirect(op.val, t.val)
+	if r.op == "<<" || r.op == "<<-" {
+		if body := p.peek(); body != nil && body.typ == tokHeredoc {
+			r.body = p.next().val
+		}
+	}
+	return r, err
+}
+
+func newRedirect(op, target string) (redirect, error) {
+	r := redirect{target: target}
+	if strings.HasPrefix(op, "&") {
+		r.fd = -1
+		r.op = op[1:]
+		return r, nil
+	}
+	pos := strings.IndexAny(op, "<>")
+	r.fd, _ = strconv.Atoi(op[:pos])
+	r.op = op[pos:]
+	if strings.HasSuffix(r.op, "&") && target != "-" && !isDigits(target) {
+		if r.op == "<&" {
+			return r, fmt.Errorf("%v: ambiguous redirect", target)
+		}
+		// >&file is the same as &>file
+		r.fd = -1
+		r.op = ">"
+	}
+	return r, nil
+}
+
+// isName checks if the string is a valid variable name
+func isName(s string) bool {
+	if len(s) == 0 || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// isAssignment checks if the raw word is in the form of NAME=value
+func isAssignment(raw string) bool {
+	pos := strings.IndexByte(raw, '=')
+	return pos > 0 && isName(raw[:pos])
+}
+
+func (cmd *simpleCommand) empty() bool {
+	return len(cmd.words) == 0 && len(cmd.redirs) == 0
+}
+
+// String returns the command list as shell input, which is shown by jobs
+func (list cmdList) String() string {
+	var buf bytes.Buffer
+	for i, ao := range list {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(ao.String())
+		if ao.background {
+			buf.WriteString(" &")
+		} else if i < len(list)-1 {
+			buf.WriteString(";")
+		}
+	}
+	return buf.String()
+}
+
+func (ao *andOrList) String() string {
+	var buf bytes.Buffer
+	for i, pl := range ao.pipelines {
+		if i > 0 {
+			buf.WriteString(" " + ao.ops[i-1] + " ")
+		}
+		if pl.negate {
+			buf.WriteString("! ")
+		}
+		for j, cmd := range pl.cmds {
+			if j > 0 {
+				buf.WriteString(" | ")
+			}
+			buf.WriteString(commandString(cmd))
+		}
+	}
+	return buf.String()
+}
+
+// commandString returns the command with its redirections as shell input
+func commandString(cmd command) string {
+	var words []string
+	var redirs []redirect
+	switch c := cmd.(type) {
+	case *simpleCommand:
+		words, redirs = append(words, c.words...), c.redirs
+	case *subshell:
+		words, redirs = []string{"( " + c.list.String() + " )"}, c.redirs
+	case *group:
+		words, redirs = []string{"{ " + c.list.String() + "; }"}, c.redirs
+	}
+	for _, r := range redirs {
+		fd := ""
+		switch {
+		case r.fd == -1:
+			fd = "&"
+		case r.op[0] == '<' && r.fd != 0 || r.op[0] == '>' && r.fd != 1:
+			fd = strconv.Itoa(r.fd)
+		}
+		if strings.HasSuffix(r.op, "&") {
+			words = append(words, fd+r.op+r.target)
+		} else {
+			words = append(words, fd+r.op+" "+r.target)
+		}
+	}
+	return strings.Join(words, " ")
+}
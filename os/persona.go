@@ -0,0 +1,99 @@
+package os
+
+import (
+	"net"
+	"time"
+)
+
+// Persona describes the machine the honeypot pretends to be, shared by
+// commands and the files of /proc so that they agree with each other
+type Persona struct {
+	CPUModel string
+	CPUs     int
+	CPUMHz   float64
+	// MemTotal is the memory size in KiB
+	MemTotal      int
+	KernelRelease string
+	KernelVersion string
+	// Uptime is the time the host has been up when the server starts
+	Uptime time.Duration
+	// Interface is the network interface of the host with the MAC and the
+	// address in CIDR notation
+	Interface string
+	MAC       string
+	Address   string
+	Gateway   string
+}
+
+// DefaultPersona is an Ubuntu 16.04 virtual machine in the cloud
+var DefaultPersona = Persona{
+	CPUModel:      "Intel(R) Xeon(R) CPU E5-2676 v3 @ 2.40GHz",
+	CPUs:          1,
+	CPUMHz:        2400.016,
+	MemTotal:      1015720,
+	KernelRelease: "4.4.0-43-generic",
+	KernelVersion: "#129-Ubuntu SMP Thu Mar 17 20:17:14 UTC 2017",
+	Uptime:        75*time.Hour + 13*time.Minute,
+	Interface:     "eth0",
+	MAC:           "0a:6f:3c:91:d2:4e",
+	Address:       "172.31.18.93/20",
+	Gateway:       "172.31.16.1",
+}
+
+var (
+	persona = DefaultPersona
+	// serverStart is when the server started, from which the uptime of
+	// the hosts is counted
+	serverStart = time.Now()
+)
+
+// SetPersona changes the persona of the hosts. Fields not set keep their
+// default
+func SetPersona(p Persona) {
+	d := DefaultPersona
+	if len(p.CPUModel) == 0 {
+		p.CPUModel = d.CPUModel
+	}
+	if p.CPUs <= 0 {
+		p.CPUs = d.CPUs
+	}
+	if p.CPUMHz <= 0 {
+		p.CPUMHz = d.CPUMHz
+	}
+	if p.MemTotal <= 0 {
+		p.MemTotal = d.MemTotal
+	}
+	if len(p.KernelRelease) == 0 {
+		p.KernelRelease = d.KernelRelease
+	}
+	if len(p.KernelVersion) == 0 {
+		p.KernelVersion = d.KernelVersion
+	}
+	if p.Uptime <= 0 {
+		p.Uptime = d.Uptime
+	}
+	if len(p.Interface) == 0 {
+		p.Interface = d.Interface
+	}
+	if _, err := net.ParseMAC(p.MAC); err != nil {
+		p.MAC = d.MAC
+	}
+	if _, _, err := net.ParseCIDR(p.Address); err != nil {
+		p.Address = d.Address
+	}
+	if net.ParseIP(p.Gateway) == nil {
+		p.Gateway = d.Gateway
+	}
+	persona = p
+}
+
+// CurrentPersona returns the persona of the hosts
+func CurrentPersona() Persona {
+	return persona
+}
+
+// IP returns the address of the host and its network
+func (p Persona) IP() (net.IP, *net.IPNet) {
+	ip, ipNet, _ := net.ParseCIDR(p.Address)
+	return ip, ipNet
+}
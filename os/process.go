@@ -0,0 +1,414 @@
+package os
+
+import (
+	"math/rand"
+	pathlib "path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Process is an entry of the simulated process table
+type Process struct {
+	PID, PPID int
+	// SID is the session of the process. Processes in the session of a
+	// login shell are hung up when the user logs out unless NoHup is set
+	SID   int
+	UID   int
+	TTY   string
+	Start time.Time
+	// Args is the command line. Kernel threads have no command line and
+	// are shown with Name in brackets
+	Args  []string
+	Name  string
+	State string
+	// Exe is the absolute path of the program, resolved when it is run
+	Exe string
+	// VSZ and RSS are the virtual and resident memory size in KiB
+	VSZ, RSS int
+	CPU      float64
+	NoHup    bool
+	// detached processes keep running after the simulated command
+	// returns, e.g. binaries executed by the attacker
+	detached bool
+}
+
+// Cmdline returns the command line as shown by ps
+func (p Process) Cmdline() string {
+	if len(p.Args) == 0 {
+		return "[" + p.Name + "]"
+	}
+	return strings.Join(p.Args, " ")
+}
+
+// ProcessTable holds the processes running in a host. It is shared by the
+// sessions on the same writable layer of the filesystem, so that processes
+// started by the attacker are still there when they come back to it, but
+// never seen by the other clients
+type ProcessTable struct {
+	mu    sync.Mutex
+	procs map[int]*Process
+	last  int
+	boot  time.Time
+}
+
+var (
+	processTables   = make(map[string]*ProcessTable)
+	processTablesMu sync.Mutex
+)
+
+// layerProcesses returns the process table of the sessions on the layer,
+// creating it with the system daemons when the layer is first used
+func layerProcesses(layer string) *ProcessTable {
+	processTablesMu.Lock()
+	defer processTablesMu.Unlock()
+	pt, exists := processTables[layer]
+	if !exists {
+		pt = newProcessTable(serverStart.Add(-CurrentPersona().Uptime))
+		processTables[layer] = pt
+	}
+	return pt
+}
+
+// DropProcesses removes the process table of the layer once the layer is
+// gone
+func DropProcesses(layer string) {
+	processTablesMu.Lock()
+	defer processTablesMu.Unlock()
+	delete(processTables, layer)
+}
+
+// kernelThreads are the kernel threads of an idle Ubuntu 16.04 server
+var kernelThreads = []string{
+	"kthreadd", "ksoftirqd/0", "", "kworker/0:0H", "", "rcu_sched", "rcu_bh",
+	"migration/0", "watchdog/0", "kdevtmpfs", "netns", "perf", "khungtaskd",
+	"writeback", "ksmd", "khugepaged", "crypto", "kintegrityd", "bioset",
+	"kblockd", "ata_sff", "md", "devfreq_wq", "", "", "", "watchdogd",
+	"kswapd0", "vmstat", "fsnotify_mark", "ecryptfs-kthrea",
+}
+
+// daemon is a process started at boot
+type daemon struct {
+	uid      int
+	tty      string
+	vsz, rss int
+	state    string
+	args     string
+}
+
+// daemons are the services running in the host, in the order started
+var daemons = []daemon{
+	{0, "?", 35276, 3348, "Ss", "/lib/systemd/systemd-journald"},
+	{0, "?", 102968, 1528, "Ss", "/sbin/lvmetad -f"},
+	{0, "?", 44540, 3904, "Ss", "/lib/systemd/systemd-udevd"},
+	{0, "?", 5220, 144, "Ss", "/sbin/iscsid"},
+	{0, "?", 5720, 3520, "S<Ls", "/sbin/iscsid"},
+	{0, "?", 27728, 2924, "Ss", "/usr/sbin/cron -f"},
+	{101, "?", 256396, 3136, "Ssl", "/usr/sbin/rsyslogd -n"},
+	{0, "?", 4396, 1288, "Ss", "/usr/sbin/acpid"},
+	{0, "?", 28548, 2972, "Ss", "/lib/systemd/systemd-logind"},
+	{102, "?", 42900, 3764, "Ss", "/usr/bin/dbus-daemon --system --address=systemd: --nofork --nopidfile --systemd-activation"},
+	{0, "?", 275872, 6212, "Ssl", "/usr/lib/accountsservice/accounts-daemon"},
+	{1, "?", 26044, 2100, "Ss", "/usr/sbin/atd -f"},
+	{0, "?", 629900, 9024, "Ssl", "/usr/bin/lxcfs /var/lib/lxcfs/"},
+	{0, "?", 260244, 14328, "Ssl", "/usr/lib/snapd/snapd"},
+	{0, "?", 13372, 164, "Ss", "/sbin/mdadm --monitor --pid-file /run/mdadm/monitor.pid --daemonise --scan --syslog"},
+	{0, "?", 19472, 148, "Ss", "/usr/sbin/irqbalance --pid=/var/run/irqbalance.pid"},
+	{0, "?", 277176, 6108, "Ssl", "/usr/lib/policykit-1/polkitd --no-debug"},
+	{0, "?", 65508, 6196, "Ss", "/usr/sbin/sshd -D"},
+	{0, "tty1", 15932, 1824, "Ss+", "/sbin/agetty --noclear tty1 linux"},
+}
+
+// newProcessTable creates the process table of a host booted at boot
+func newProcessTable(boot time.Time) *ProcessTable {
+	pt := &ProcessTable{procs: make(map[int]*Process), boot: boot}
+	pt.procs[1] = &Process{PID: 1, SID: 1, TTY: "?", Start: boot, Args: []string{"/sbin/init"},
+		Name: "systemd", State: "Ss", VSZ: 37808, RSS: 5888}
+	for i, name := range kernelThreads {
+		if len(name) == 0 {
+			continue
+		}
+		ppid := 2
+		if i == 0 {
+			ppid = 0
+		}
+		pt.procs[i+2] = &Process{PID: i + 2, PPID: ppid, TTY: "?", Start: boot, Name: name, State: "S"}
+	}
+	pt.last = 340
+	for i, d := range daemons {
+		pid, _ := pt.nextPid()
+		args := strings.Fields(d.args)
+		pt.procs[pid] = &Process{PID: pid, PPID: 1, SID: pid, UID: d.uid, TTY: d.tty,
+			Start: boot.Add(time.Duration(2+i) * time.Second), Args: args,
+			Name: pathlib.Base(args[0]), State: d.state, VSZ: d.vsz, RSS: d.rss}
+		pt.last += rand.Intn(40)
+	}
+	pt.last += 200 + rand.Intn(1000)
+	return pt
+}
+
+// PIDs are allocated from minPid to maxPid, wrapping around like Linux
+const (
+	minPid = 300
+	maxPid = 32768
+)
+
+// nextPid allocates the next PID. Other activities of the system are
+// simulated by skipping some numbers. When all PIDs are used it fails with
+// EAGAIN like fork
+func (pt *ProcessTable) nextPid() (int, error) {
+	pid := pt.last + 1 + rand.Intn(3)
+	for i := minPid; i < maxPid; i++ {
+		if pid >= maxPid {
+			pid = minPid
+		}
+		if _, used := pt.procs[pid]; !used {
+			pt.last = pid
+			return pid, nil
+		}
+		pid++
+	}
+	return 0, syscall.EAGAIN
+}
+
+// Boot returns the time the host was booted
+func (pt *ProcessTable) Boot() time.Time {
+	return pt.boot
+}
+
+// MemUsage returns the memory in KiB used by the processes and the
+// kernel, and used for buffers and cache
+func (pt *ProcessTable) MemUsage() (used, cache int) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	used = 120000
+	for _, p := range pt.procs {
+		used += p.RSS
+	}
+	return used, 480000
+}
+
+// LoadAvg returns the load averages of the last 1, 5 and 15 minutes,
+// derived from the CPU usage of the processes
+func (pt *ProcessTable) LoadAvg() (float64, float64, float64) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	cpu := 0.0
+	for _, p := range pt.procs {
+		cpu += p.CPU
+	}
+	if cpu > 100 {
+		cpu = 100
+	}
+	load := cpu / 100
+	return load, load*0.9 + 0.01, load*0.8 + 0.05
+}
+
+// Spawn adds a process with the command line args as a child of ppid and
+// returns its PID. The session, terminal and hang up behaviour are
+// inherited from the parent. It fails when no PID is free
+func (pt *ProcessTable) Spawn(ppid, uid int, args []string) (int, error) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pid, err := pt.nextPid()
+	if err != nil {
+		return 0, err
+	}
+	p := &Process{PID: pid, PPID: ppid, UID: uid, TTY: "?", Start: time.Now(), State: "S",
+		VSZ: 4000 + rand.Intn(20000), RSS: 700 + rand.Intn(3000)}
+	if parent, exists := pt.procs[ppid]; exists {
+		p.SID, p.TTY, p.NoHup = parent.SID, parent.TTY, parent.NoHup
+	}
+	p.setArgs(args)
+	pt.procs[p.PID] = p
+	return p.PID, nil
+}
+
+func (p *Process) setArgs(args []string) {
+	p.Args, p.Exe = args, ""
+	if len(args) > 0 {
+		p.Name = pathlib.Base(args[0])
+	}
+	if len(p.Name) > 15 {
+		p.Name = p.Name[:15]
+	}
+}
+
+// Exec replaces the command line of the process, as if it executed
+// another program
+func (pt *ProcessTable) Exec(pid int, args []string) {
+	pt.Update(pid, func(p *Process) { p.setArgs(args) })
+}
+
+// Update calls f with the process to modify it. It reports if the process
+// exists
+func (pt *ProcessTable) Update(pid int, f func(p *Process)) bool {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	p, exists := pt.procs[pid]
+	if exists {
+		f(p)
+	}
+	return exists
+}
+
+// Get returns a copy of the process
+func (pt *ProcessTable) Get(pid int) (Process, bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if p, exists := pt.procs[pid]; exists {
+		return *p, true
+	}
+	return Process{}, false
+}
+
+// List returns a copy of all processes ordered by PID
+func (pt *ProcessTable) List() []Process {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	res := make([]Process, 0, len(pt.procs))
+	for _, p := range pt.procs {
+		res = append(res, *p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].PID < res[j].PID })
+	return res
+}
+
+// Exit removes the process after the simulated command returns, unless
+// the process is detached and keeps running
+func (pt *ProcessTable) Exit(pid int) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if p, exists := pt.procs[pid]; exists && !p.detached {
+		pt.remove(pid)
+	}
+}
+
+// Signal sends the signal to the process on behalf of user uid. Signal 0
+// only checks if the process exists. Processes are stopped and continued
+// by the job control signals, ignore those not terminating by default and
+// are removed by the others. init and kernel threads ignore all signals
+func (pt *ProcessTable) Signal(pid, uid int, sig syscall.Signal) error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	p, exists := pt.procs[pid]
+	switch {
+	case !exists:
+		return syscall.ESRCH
+	case uid != 0 && p.UID != uid:
+		return syscall.EPERM
+	case sig == 0 || pid == 1 || len(p.Args) == 0:
+		return nil
+	}
+	switch sig {
+	case syscall.SIGSTOP, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU:
+		p.State = "T" + strings.TrimLeft(p.State, "RSDT")
+	case syscall.SIGCONT:
+		if strings.HasPrefix(p.State, "T") {
+			p.State = "S" + p.State[1:]
+		}
+	case syscall.SIGCHLD, syscall.SIGWINCH, syscall.SIGURG:
+	default:
+		pt.remove(pid)
+	}
+	return nil
+}
+
+// Hangup removes the processes of the session when the user logs out,
+// except those ignoring the hang up signal
+func (pt *ProcessTable) Hangup(sid int) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	for pid, p := range pt.procs {
+		if p.SID == sid && (!p.NoHup || pid == sid) {
+			pt.remove(pid)
+		}
+	}
+}
+
+// Logout removes the shell leading the session and the sshd processes
+// serving it, without hanging up the other processes of the session
+func (pt *ProcessTable) Logout(sid int) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	for pid := sid; pid > 1; {
+		p, exists := pt.procs[pid]
+		if !exists || p.SID != sid {
+			break
+		}
+		pt.remove(pid)
+		pid = p.PPID
+	}
+}
+
+// remove deletes the process and hands its children over to init
+func (pt *ProcessTable) remove(pid int) {
+	delete(pt.procs, pid)
+	for _, p := range pt.procs {
+		if p.PPID == pid {
+			p.PPID = 1
+		}
+	}
+}
+
+// NewSession adds the sshd processes serving a connection of the user and
+// the shell started by them. The shell is the leader of a new session on
+// a pseudo terminal if tty is set. It returns the PID of the shell and
+// the terminal, or fails when no PID is free
+func (pt *ProcessTable) NewSession(uid int, user string, shell []string, tty bool) (int, string, error) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	sshd := 1
+	for _, p := range pt.procs {
+		if p.Name == "sshd" && p.PPID == 1 {
+			sshd = p.PID
+		}
+	}
+	term, label := "?", user+"@notty"
+	if tty {
+		// Pick the lowest free pseudo terminal like the kernel does
+		used := map[string]bool{}
+		for _, p := range pt.procs {
+			used[p.TTY] = true
+		}
+		n := 0
+		for used["pts/"+strconv.Itoa(n)] {
+			n++
+		}
+		term = "pts/" + strconv.Itoa(n)
+		label = user + "@" + term
+	}
+	var pids [3]int
+	for i := range pids {
+		pid, err := pt.nextPid()
+		if err != nil {
+			for _, pid := range pids[:i] {
+				delete(pt.procs, pid)
+			}
+			return 0, "", err
+		}
+		// The PID is held until the processes are added
+		pt.procs[pid] = nil
+		pids[i] = pid
+	}
+	now := time.Now()
+	priv := &Process{PID: pids[0], PPID: sshd, TTY: "?", Start: now, Args: []string{"sshd: " + user + " [priv]"},
+		Name: "sshd", State: "Ss", VSZ: 95368 + rand.Intn(200), RSS: 6700 + rand.Intn(300)}
+	conn := &Process{PID: pids[1], PPID: priv.PID, UID: uid, TTY: "?", Start: now, Args: []string{"sshd: " + label},
+		Name: "sshd", State: "S", VSZ: 95368 + rand.Intn(200), RSS: 3300 + rand.Intn(300)}
+	sh := &Process{PID: pids[2], PPID: conn.PID, UID: uid, TTY: term, Start: now, State: "Ss",
+		VSZ: 22000 + rand.Intn(1000), RSS: 5000 + rand.Intn(300)}
+	if tty {
+		sh.State = "Ss+"
+	}
+	sh.setArgs(shell)
+	sh.Name = strings.TrimPrefix(sh.Name, "-")
+	priv.SID, conn.SID, sh.SID = sh.PID, sh.PID, sh.PID
+	for _, p := range []*Process{priv, conn, sh} {
+		pt.procs[p.PID] = p
+	}
+	return sh.PID, term, nil
+}
@@ -0,0 +1,548 @@
+package os
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	pathlib "path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkishere/sshsyrup/virtualfs"
+	"github.com/spf13/afero"
+)
+
+// cpuFlags are the flags of the Xeon of the persona in /proc/cpuinfo
+const cpuFlags = "fpu vme de pse tsc msr pae mce cx8 apic sep mtrr pge mca cmov pat pse36 clflush mmx fxsr sse sse2 " +
+	"ht syscall nx rdtscp lm constant_tsc rep_good nopl xtopology cpuid pni pclmulqdq ssse3 fma cx16 pcid sse4_1 " +
+	"sse4_2 x2apic movbe popcnt tsc_deadline_timer aes xsave avx f16c rdrand hypervisor lahf_lm abm cpuid_fault " +
+	"invpcid_single pti fsgsbase bmi1 avx2 smep bmi2 erms invpcid xsaveopt"
+
+// procFs generates /proc of the host as seen by the current process of the
+// system. Contents are made from the persona and the process table when
+// the files are opened
+type procFs struct {
+	sys    *System
+	mounts func() []virtualfs.Mount
+}
+
+// newProcFs returns /proc of the system, listing the mounts given
+func newProcFs(sys *System, mounts func() []virtualfs.Mount) afero.Fs {
+	p := &procFs{sys: sys, mounts: mounts}
+	return virtualfs.NewSynthFs("proc", p.lookup)
+}
+
+// procFiles are the files at the top of /proc
+var procFiles = map[string]func(p *procFs) []byte{
+	"cpuinfo": (*procFs).cpuinfo,
+	"meminfo": (*procFs).meminfo,
+	"version": (*procFs).version,
+	"uptime":  (*procFs).uptime,
+	"loadavg": (*procFs).loadavg,
+	"cmdline": (*procFs).cmdline,
+}
+
+// procLinks are the symbolic links at the top of /proc
+var procLinks = map[string]string{
+	"mounts": "self/mounts",
+	"net":    "self/net",
+}
+
+// pidFiles are the files in the directory of a process
+var pidFiles = map[string]func(p *procFs, proc Process) []byte{
+	"cmdline": (*procFs).pidCmdline,
+	"comm":    (*procFs).pidComm,
+	"status":  (*procFs).pidStatus,
+	"stat":    (*procFs).pidStat,
+	"mounts":  (*procFs).pidMounts,
+}
+
+// netFiles are the files in /proc/net
+var netFiles = map[string]func(p *procFs) []byte{
+	"dev":   (*procFs).netDev,
+	"route": (*procFs).netRoute,
+	"arp":   (*procFs).netArp,
+	"tcp":   (*procFs).netTCP,
+	"udp":   (*procFs).netUDP,
+}
+
+// sysctlFiles are the files in /proc/sys/kernel
+var sysctlFiles = map[string]func(p *procFs) string{
+	"hostname":  func(p *procFs) string { return p.sys.Hostname() },
+	"ostype":    func(p *procFs) string { return "Linux" },
+	"osrelease": func(p *procFs) string { return CurrentPersona().KernelRelease },
+	"version":   func(p *procFs) string { return CurrentPersona().KernelVersion },
+}
+
+func (p *procFs) dir(uid int, entries func() []string) *virtualfs.Node {
+	return &virtualfs.Node{Mode: os.ModeDir | 0555, UID: uid, GID: GetUserByID(uid).GID,
+		ModTime: p.sys.Processes().Boot(), Entries: entries}
+}
+
+func (p *procFs) file(uid int, mode os.FileMode, data func() []byte) *virtualfs.Node {
+	return &virtualfs.Node{Mode: mode, UID: uid, GID: GetUserByID(uid).GID, ModTime: time.Now(), Data: data}
+}
+
+func (p *procFs) link(uid int, target string) *virtualfs.Node {
+	return &virtualfs.Node{Mode: os.ModeSymlink | 0777, UID: uid, GID: GetUserByID(uid).GID,
+		ModTime: time.Now(), Target: target}
+}
+
+func keys(m interface{}) []string {
+	var res []string
+	switch m := m.(type) {
+	case map[string]func(p *procFs) []byte:
+		for k := range m {
+			res = append(res, k)
+		}
+	case map[string]func(p *procFs, proc Process) []byte:
+		for k := range m {
+			res = append(res, k)
+		}
+	case map[string]func(p *procFs) string:
+		for k := range m {
+			res = append(res, k)
+		}
+	case map[string]string:
+		for k := range m {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// lookup returns the node of the path in /proc
+func (p *procFs) lookup(name string) (*virtualfs.Node, bool) {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	switch {
+	case len(parts[0]) == 0:
+		return p.dir(0, p.rootEntries), true
+	case parts[0] == "self":
+		if _, exists := p.sys.Processes().Get(p.sys.Getpid()); len(parts) == 1 && exists {
+			return p.link(0, strconv.Itoa(p.sys.Getpid())), true
+		}
+	case parts[0] == "net" || procLinks[parts[0]] != "":
+		if len(parts) == 1 {
+			return p.link(0, procLinks[parts[0]]), true
+		}
+	case parts[0] == "sys":
+		return p.lookupSysctl(parts[1:])
+	case procFiles[parts[0]] != nil:
+		if len(parts) == 1 {
+			gen := procFiles[parts[0]]
+			return p.file(0, 0444, func() []byte { return gen(p) }), true
+		}
+	default:
+		pid, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, false
+		}
+		proc, exists := p.sys.Processes().Get(pid)
+		if !exists {
+			return nil, false
+		}
+		return p.lookupPid(proc, parts[1:])
+	}
+	return nil, false
+}
+
+func (p *procFs) rootEntries() []string {
+	names := append(keys(procFiles), keys(procLinks)...)
+	names = append(names, "sys")
+	if _, exists := p.sys.Processes().Get(p.sys.Getpid()); exists {
+		names = append(names, "self")
+	}
+	for _, proc := range p.sys.Processes().List() {
+		names = append(names, strconv.Itoa(proc.PID))
+	}
+	return names
+}
+
+func (p *procFs) lookupSysctl(parts []string) (*virtualfs.Node, bool) {
+	switch {
+	case len(parts) == 0:
+		return p.dir(0, func() []string { return []string{"kernel"} }), true
+	case parts[0] != "kernel":
+	case len(parts) == 1:
+		return p.dir(0, func() []string { return keys(sysctlFiles) }), true
+	case len(parts) == 2 && sysctlFiles[parts[1]] != nil:
+		gen := sysctlFiles[parts[1]]
+		return p.file(0, 0444, func() []byte { return []byte(gen(p) + "\n") }), true
+	}
+	return nil, false
+}
+
+// lookupPid returns the node in the directory of the process
+func (p *procFs) lookupPid(proc Process, parts []string) (*virtualfs.Node, bool) {
+	if len(parts) == 0 {
+		return p.dir(proc.UID, func() []string {
+			names := append(keys(pidFiles), "cwd", "environ", "fd", "net", "root")
+			if len(proc.Args) > 0 {
+				names = append(names, "exe")
+			}
+			return names
+		}), true
+	}
+	switch name := parts[0]; {
+	case name == "fd":
+		// The standard streams of the processes are their terminals
+		if len(parts) == 1 {
+			n := p.dir(proc.UID, func() []string { return []string{"0", "1", "2"} })
+			n.Mode = os.ModeDir | 0500
+			return n, true
+		}
+		if len(parts) == 2 && (parts[1] == "0" || parts[1] == "1" || parts[1] == "2") {
+			tty := "/dev/null"
+			if strings.HasPrefix(proc.TTY, "pts/") {
+				tty = "/dev/" + proc.TTY
+			}
+			n := p.link(proc.UID, tty)
+			n.Mode = os.ModeSymlink | 0700
+			return n, true
+		}
+	case name == "net":
+		if len(parts) == 1 {
+			return p.dir(proc.UID, func() []string { return keys(netFiles) }), true
+		}
+		if gen := netFiles[parts[1]]; gen != nil && len(parts) == 2 {
+			return p.file(0, 0444, func() []byte { return gen(p) }), true
+		}
+	case len(parts) > 1:
+	case pidFiles[name] != nil:
+		gen := pidFiles[name]
+		mode := os.FileMode(0444)
+		if name == "comm" {
+			mode = 0644
+		}
+		return p.file(proc.UID, mode, func() []byte { return gen(p, proc) }), true
+	case name == "environ":
+		// Only the owner can read the environment, which is kept empty but
+		// for the current process
+		return p.file(proc.UID, 0400, func() []byte { return p.pidEnviron(proc) }), true
+	case name == "exe" && len(proc.Args) > 0:
+		return p.link(proc.UID, exePath(proc)), true
+	case name == "cwd":
+		cwd := "/"
+		if proc.PID == p.sys.Getpid() {
+			cwd = p.sys.Getcwd()
+		}
+		return p.link(proc.UID, cwd), true
+	case name == "root":
+		return p.link(proc.UID, "/"), true
+	}
+	return nil, false
+}
+
+// exePath returns the path of the program run by the process
+func exePath(proc Process) string {
+	name := strings.TrimPrefix(proc.Args[0], "-")
+	switch {
+	case len(proc.Exe) > 0:
+		return proc.Exe
+	case pathlib.IsAbs(name):
+		return name
+	case strings.HasPrefix(name, "sshd:"):
+		return "/usr/sbin/sshd"
+	case name == "bash" || name == "sh":
+		return "/bin/" + name
+	}
+	if cmd, exists := funcMap[name]; exists {
+		return cmd.Where()
+	}
+	return "/usr/bin/" + name
+}
+
+func (p *procFs) cpuinfo() []byte {
+	persona := CurrentPersona()
+	vendor := "GenuineIntel"
+	if strings.Contains(persona.CPUModel, "AMD") {
+		vendor = "AuthenticAMD"
+	}
+	var buf bytes.Buffer
+	for i := 0; i < persona.CPUs; i++ {
+		fmt.Fprintf(&buf, "processor\t: %d\n", i)
+		fmt.Fprintf(&buf, "vendor_id\t: %v\n", vendor)
+		buf.WriteString("cpu family\t: 6\nmodel\t\t: 63\n")
+		fmt.Fprintf(&buf, "model name\t: %v\n", persona.CPUModel)
+		buf.WriteString("stepping\t: 2\nmicrocode\t: 0x25\n")
+		fmt.Fprintf(&buf, "cpu MHz\t\t: %.3f\n", persona.CPUMHz)
+		buf.WriteString("cache size\t: 30720 KB\nphysical id\t: 0\n")
+		fmt.Fprintf(&buf, "siblings\t: %d\ncore id\t\t: %d\ncpu cores\t: %d\n", persona.CPUs, i, persona.CPUs)
+		fmt.Fprintf(&buf, "apicid\t\t: %d\ninitial apicid\t: %d\n", i*2, i*2)
+		buf.WriteString("fpu\t\t: yes\nfpu_exception\t: yes\ncpuid level\t: 13\nwp\t\t: yes\n")
+		fmt.Fprintf(&buf, "flags\t\t: %v\n", cpuFlags)
+		buf.WriteString("bugs\t\t: cpu_meltdown spectre_v1 spectre_v2\n")
+		fmt.Fprintf(&buf, "bogomips\t: %.2f\n", persona.CPUMHz*2)
+		buf.WriteString("clflush size\t: 64\ncache_alignment\t: 64\n")
+		buf.WriteString("address sizes\t: 46 bits physical, 48 bits virtual\npower management:\n\n")
+	}
+	return buf.Bytes()
+}
+
+func (p *procFs) meminfo() []byte {
+	total := CurrentPersona().MemTotal
+	used, cache := p.sys.Processes().MemUsage()
+	buffers := cache / 8
+	var buf bytes.Buffer
+	for _, f := range []struct {
+		name string
+		kb   int
+	}{
+		{"MemTotal", total},
+		{"MemFree", total - used - cache},
+		{"MemAvailable", total - used - cache/4},
+		{"Buffers", buffers},
+		{"Cached", cache - buffers},
+		{"SwapCached", 0},
+		{"Active", used/2 + cache/3},
+		{"Inactive", cache / 2},
+		{"SwapTotal", 0},
+		{"SwapFree", 0},
+		{"Dirty", 24},
+		{"Writeback", 0},
+		{"AnonPages", used / 2},
+		{"Mapped", used / 5},
+		{"Shmem", 3204},
+		{"Slab", 64512},
+		{"SReclaimable", 40372},
+		{"SUnreclaim", 24140},
+		{"KernelStack", 2288},
+		{"PageTables", 4604},
+		{"CommitLimit", total / 2},
+		{"Committed_AS", used * 3},
+		{"VmallocTotal", 34359738367},
+		{"VmallocUsed", 0},
+		{"VmallocChunk", 0},
+		{"HardwareCorrupted", 0},
+		{"AnonHugePages", 0},
+		{"CmaTotal", 0},
+		{"CmaFree", 0},
+	} {
+		fmt.Fprintf(&buf, "%-16s%8d kB\n", f.name+":", f.kb)
+	}
+	buf.WriteString("HugePages_Total:       0\nHugePages_Free:        0\nHugePages_Rsvd:        0\nHugePages_Surp:        0\n")
+	fmt.Fprintf(&buf, "%-16s%8d kB\n", "Hugepagesize:", 2048)
+	fmt.Fprintf(&buf, "%-16s%8d kB\n", "DirectMap4k:", 61440)
+	fmt.Fprintf(&buf, "%-16s%8d kB\n", "DirectMap2M:", total+(1<<20)-total%2048)
+	return buf.Bytes()
+}
+
+func (p *procFs) version() []byte {
+	persona := CurrentPersona()
+	return []byte(fmt.Sprintf("Linux version %v (buildd@lgw01-56) (gcc version 5.4.0 20160609 (Ubuntu 5.4.0-6ubuntu1~16.04.2) ) %v\n",
+		persona.KernelRelease, persona.KernelVersion))
+}
+
+func (p *procFs) uptime() []byte {
+	up := time.Since(p.sys.Processes().Boot()).Seconds()
+	return []byte(fmt.Sprintf("%.2f %.2f\n", up, up*float64(CurrentPersona().CPUs)*0.97))
+}
+
+func (p *procFs) loadavg() []byte {
+	procs := p.sys.Processes().List()
+	l1, l5, l15 := p.sys.Processes().LoadAvg()
+	last := 0
+	for _, proc := range procs {
+		if proc.PID > last {
+			last = proc.PID
+		}
+	}
+	return []byte(fmt.Sprintf("%.2f %.2f %.2f 1/%d %d\n", l1, l5, l15, len(procs)+60, last))
+}
+
+func (p *procFs) cmdline() []byte {
+	return []byte(fmt.Sprintf("BOOT_IMAGE=/boot/vmlinuz-%v root=UUID=f4f8f5c7-d9ff-4cd6-a4b8-2e7c4f5e1c6a ro console=tty1 console=ttyS0\n",
+		CurrentPersona().KernelRelease))
+}
+
+func (p *procFs) pidCmdline(proc Process) []byte {
+	if len(proc.Args) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(proc.Args, "\x00") + "\x00")
+}
+
+func (p *procFs) pidComm(proc Process) []byte {
+	return []byte(proc.Name + "\n")
+}
+
+func (p *procFs) pidEnviron(proc Process) []byte {
+	if proc.PID != p.sys.Getpid() {
+		return nil
+	}
+	return []byte(strings.Join(p.sys.Environ(), "\x00") + "\x00")
+}
+
+// procState returns the state of the process as shown in /proc
+func procState(proc Process) (string, string) {
+	if proc.PID == 0 || len(proc.State) == 0 {
+		return "S", "sleeping"
+	}
+	switch proc.State[0] {
+	case 'R':
+		return "R", "running"
+	case 'T':
+		return "T", "stopped"
+	case 'D':
+		return "D", "disk sleep"
+	case 'Z':
+		return "Z", "zombie"
+	}
+	return "S", "sleeping"
+}
+
+func (p *procFs) pidStatus(proc Process) []byte {
+	state, desc := procState(proc)
+	if proc.PID == p.sys.Getpid() {
+		state, desc = "R", "running"
+	}
+	gid := GetUserByID(proc.UID).GID
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Name:\t%v\nState:\t%v (%v)\nTgid:\t%d\nNgid:\t0\nPid:\t%d\nPPid:\t%d\nTracerPid:\t0\n",
+		proc.Name, state, desc, proc.PID, proc.PID, proc.PPID)
+	fmt.Fprintf(&buf, "Uid:\t%d\t%d\t%d\t%d\nGid:\t%d\t%d\t%d\t%d\nFDSize:\t64\nGroups:\t\n",
+		proc.UID, proc.UID, proc.UID, proc.UID, gid, gid, gid, gid)
+	fmt.Fprintf(&buf, "NStgid:\t%d\nNSpid:\t%d\nNSpgid:\t%d\nNSsid:\t%d\n", proc.PID, proc.PID, proc.SID, proc.SID)
+	if len(proc.Args) > 0 {
+		fmt.Fprintf(&buf, "VmPeak:\t%8d kB\nVmSize:\t%8d kB\nVmLck:\t%8d kB\nVmPin:\t%8d kB\n", proc.VSZ+412, proc.VSZ, 0, 0)
+		fmt.Fprintf(&buf, "VmHWM:\t%8d kB\nVmRSS:\t%8d kB\nVmData:\t%8d kB\nVmStk:\t%8d kB\n", proc.RSS+96, proc.RSS, proc.VSZ/8, 136)
+		fmt.Fprintf(&buf, "VmExe:\t%8d kB\nVmLib:\t%8d kB\nVmPTE:\t%8d kB\nVmPMD:\t%8d kB\nVmSwap:\t%8d kB\n", 976, 2112, 52, 12, 0)
+	}
+	buf.WriteString("Threads:\t1\nSigQ:\t0/3838\nSigPnd:\t0000000000000000\nShdPnd:\t0000000000000000\n")
+	buf.WriteString("SigBlk:\t0000000000000000\nSigIgn:\t0000000000000000\nSigCgt:\t0000000000000000\n")
+	buf.WriteString("CapInh:\t0000000000000000\n")
+	if proc.UID == 0 {
+		buf.WriteString("CapPrm:\t0000003fffffffff\nCapEff:\t0000003fffffffff\n")
+	} else {
+		buf.WriteString("CapPrm:\t0000000000000000\nCapEff:\t0000000000000000\n")
+	}
+	buf.WriteString("CapBnd:\t0000003fffffffff\nCapAmb:\t0000000000000000\nSeccomp:\t0\n")
+	cpus := CurrentPersona().CPUs
+	cpuList := "0"
+	if cpus > 1 {
+		cpuList = fmt.Sprintf("0-%d", cpus-1)
+	}
+	fmt.Fprintf(&buf, "Cpus_allowed:\t%x\nCpus_allowed_list:\t%v\n", 1<<uint(cpus)-1, cpuList)
+	buf.WriteString("Mems_allowed:\t00000000,00000001\nMems_allowed_list:\t0\n")
+	buf.WriteString("voluntary_ctxt_switches:\t150\nnonvoluntary_ctxt_switches:\t12\n")
+	return buf.Bytes()
+}
+
+func (p *procFs) pidStat(proc Process) []byte {
+	state, _ := procState(proc)
+	if proc.PID == p.sys.Getpid() {
+		state = "R"
+	}
+	boot := p.sys.Processes().Boot()
+	ticks := int64(time.Since(proc.Start).Seconds() * proc.CPU)
+	start := int64(proc.Start.Sub(boot).Seconds() * 100)
+	if start < 0 {
+		start = 0
+	}
+	tty := 0
+	if strings.HasPrefix(proc.TTY, "pts/") {
+		n, _ := strconv.Atoi(proc.TTY[4:])
+		tty = 136<<8 | n
+	}
+	flags := 4194560
+	if len(proc.Args) == 0 {
+		flags = 2129984
+	}
+	fields := []interface{}{proc.PID, "(" + proc.Name + ")", state, proc.PPID, proc.SID, proc.SID, tty, -1, flags,
+		1200, 0, 0, 0, ticks * 3 / 4, ticks / 4, 0, 0, 20, 0, 1, 0, start, int64(proc.VSZ) * 1024, proc.RSS / 4,
+		"18446744073709551615", 4194304, 5192964, 140726832461536, 0, 0, 0, 0, 0, 0, 0, 0, 0, 17, 0, 0, 0, 0, 0, 0,
+		7290352, 7315716, 29560832, 140726832467432, 140726832467438, 140726832467438, 140726832467950, 0}
+	var buf bytes.Buffer
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprint(&buf, f)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func (p *procFs) pidMounts(proc Process) []byte {
+	var buf bytes.Buffer
+	for _, m := range p.mounts() {
+		fmt.Fprintf(&buf, "%v %v %v %v 0 0\n", m.Source, m.Dir, m.Type, m.Options)
+	}
+	return buf.Bytes()
+}
+
+// hexIP returns the IPv4 address in the byte order of the host, as shown
+// in /proc/net
+func hexIP(ip net.IP) string {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return "00000000"
+	}
+	return fmt.Sprintf("%08X", binary.LittleEndian.Uint32(ip4))
+}
+
+func (p *procFs) netDev() []byte {
+	persona := CurrentPersona()
+	up := int64(time.Since(p.sys.Processes().Boot()).Seconds())
+	var buf bytes.Buffer
+	buf.WriteString("Inter-|   Receive                                                |  Transmit\n")
+	buf.WriteString(" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n")
+	for _, dev := range []struct {
+		name     string
+		rxB, rxP int64
+		txB, txP int64
+	}{
+		{"lo", up * 24, up / 5, up * 24, up / 5},
+		{persona.Interface, up * 1917, up * 9, up * 633, up * 5},
+	} {
+		fmt.Fprintf(&buf, "%6s: %7d %7d %4d %4d %4d %5d %10d %9d %8d %7d %4d %4d %4d %5d %7d %10d\n",
+			dev.name, dev.rxB, dev.rxP, 0, 0, 0, 0, 0, 0, dev.txB, dev.txP, 0, 0, 0, 0, 0, 0)
+	}
+	return buf.Bytes()
+}
+
+func (p *procFs) netRoute() []byte {
+	persona := CurrentPersona()
+	_, ipNet := persona.IP()
+	var buf bytes.Buffer
+	line := func(s string) { fmt.Fprintf(&buf, "%-127s\n", s) }
+	line("Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT")
+	line(fmt.Sprintf("%v\t00000000\t%v\t0003\t0\t0\t0\t00000000\t0\t0\t0", persona.Interface, hexIP(net.ParseIP(persona.Gateway))))
+	line(fmt.Sprintf("%v\t%v\t00000000\t0001\t0\t0\t0\t%v\t0\t0\t0", persona.Interface, hexIP(ipNet.IP), hexIP(net.IP(ipNet.Mask))))
+	return buf.Bytes()
+}
+
+func (p *procFs) netArp() []byte {
+	persona := CurrentPersona()
+	gateway, _ := net.ParseMAC(persona.MAC)
+	// The gateway has the MAC of the host with another last octet
+	gateway[len(gateway)-1] ^= 0x5a
+	return []byte(fmt.Sprintf("IP address       HW type     Flags       HW address            Mask     Device\n"+
+		"%-16s 0x1         0x2         %v     *        %v\n", persona.Gateway, gateway, persona.Interface))
+}
+
+// netSockets formats the sockets in /proc/net/tcp or udp
+func netSockets(header string, socks [][2]string, state string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%-149s\n", header)
+	for i, s := range socks {
+		fmt.Fprintf(&buf, "%-149s\n", fmt.Sprintf("%4d: %v %v %v 00000000:00000000 00:00000000 00000000     0        0 %d 1 ffff88003b1e%04x 100 0 0 10 0",
+			i, s[0], s[1], state, 15183+i*7, i*0x800))
+	}
+	return buf.Bytes()
+}
+
+func (p *procFs) netTCP() []byte {
+	// Only sshd listens
+	return netSockets("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode",
+		[][2]string{{"00000000:0016", "00000000:0000"}}, "0A")
+}
+
+// netUDP lists the DHCP client
+func (p *procFs) netUDP() []byte {
+	return netSockets("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops",
+		[][2]string{{"00000000:0044", "00000000:0000"}}, "07")
+}
@@ -0,0 +1,112 @@
+package os
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestProcFs(t *testing.T) {
+	sh := newTestShell(t)
+	procs := sh.sys.Processes()
+	sh.sys.pid, _ = procs.Spawn(1, sh.sys.CurrentUser(), []string{"cat"})
+	defer procs.Exit(sh.sys.pid)
+	fs := sh.sys.FSys()
+
+	version, err := afero.ReadFile(fs, "/proc/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(version), CurrentPersona().KernelRelease+" ") ||
+		!strings.HasSuffix(string(version), CurrentPersona().KernelVersion+"\n") {
+		t.Errorf("Kernel in /proc/version differs from uname: %q", version)
+	}
+	cpuinfo, _ := afero.ReadFile(fs, "/proc/cpuinfo")
+	if !strings.Contains(string(cpuinfo), "model name\t: "+CurrentPersona().CPUModel+"\n") {
+		t.Errorf("CPU model missing in /proc/cpuinfo:\n%s", cpuinfo)
+	}
+	meminfo, _ := afero.ReadFile(fs, "/proc/meminfo")
+	if !strings.HasPrefix(string(meminfo), "MemTotal:        "+strconv.Itoa(CurrentPersona().MemTotal)+" kB\n") {
+		t.Errorf("Wrong memory size in /proc/meminfo:\n%s", meminfo)
+	}
+	uptime, _ := afero.ReadFile(fs, "/proc/uptime")
+	if up, err := strconv.ParseFloat(strings.Fields(string(uptime))[0], 64); err != nil || up < CurrentPersona().Uptime.Seconds() {
+		t.Errorf("Uptime %q less than that of the persona", uptime)
+	}
+
+	if exe, err := Readlink(fs, "/proc/self/exe"); err != nil || exe != "/bin/cat" {
+		t.Errorf("/proc/self/exe links to %q, %v", exe, err)
+	}
+	status, err := afero.ReadFile(fs, "/proc/self/status")
+	if err != nil || !strings.Contains(string(status), "\nPid:\t"+strconv.Itoa(sh.sys.pid)+"\n") {
+		t.Errorf("/proc/self/status: %v\n%s", err, status)
+	}
+	mounts, _ := afero.ReadFile(fs, "/proc/mounts")
+	if !strings.Contains(string(mounts), "proc /proc proc ") {
+		t.Errorf("/proc missing in /proc/mounts:\n%s", mounts)
+	}
+	route, _ := afero.ReadFile(fs, "/proc/net/route")
+	if !strings.Contains(string(route), "eth0\t00000000\t01101FAC\t0003") {
+		t.Errorf("Default route missing in /proc/net/route:\n%s", route)
+	}
+
+	entries, err := afero.ReadDir(fs, "/proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]bool)
+	for _, fi := range entries {
+		listed[fi.Name()] = true
+	}
+	for _, p := range procs.List() {
+		if !listed[strconv.Itoa(p.PID)] {
+			t.Errorf("Process %v not listed in /proc", p.PID)
+		}
+	}
+	if _, err := afero.ReadFile(fs, "/proc/1/environ"); err == nil {
+		t.Error("Read environment of init as user")
+	}
+	if err := afero.WriteFile(fs, "/proc/version", []byte("x"), 0644); err == nil {
+		t.Error("Wrote /proc/version")
+	}
+	if err := fs.Remove("/proc"); err == nil {
+		t.Error("Removed /proc")
+	}
+}
+
+func TestProcExe(t *testing.T) {
+	sh := newTestShell(t)
+	sh.sys.layer = "exetest"
+	afero.WriteFile(sh.sys.FSys(), "/home/mk/xmrig", elfHeader(), 0755)
+	runTestLine(t, sh, "cd /home/mk; ./xmrig &")
+	sh.bg.Wait()
+	if exe, err := Readlink(sh.sys.FSys(), "/proc/"+strconv.Itoa(sh.lastBg)+"/exe"); err != nil || exe != "/home/mk/xmrig" {
+		t.Errorf("/proc/%v/exe links to %q, %v", sh.lastBg, exe, err)
+	}
+	for name, exe := range map[string]string{"cat": "/bin/cat", "../mk/./xmrig": "/home/mk/xmrig", "nosuch": ""} {
+		if p := sh.lookPath(name); p != exe {
+			t.Errorf("Path of %v is %q, want %q", name, p, exe)
+		}
+	}
+}
+
+func TestDevices(t *testing.T) {
+	sh := newTestShell(t)
+	for _, c := range []struct{ line, stdout, stderr string }{
+		{`echo hi >/dev/null 2>&1; echo $?`, "0\n", ""},
+		{`echo hi >/dev/stderr`, "", "hi\n"},
+		{`cat </dev/null; echo $?`, "0\n", ""},
+		{`cat </sys/class/net/eth0/address`, CurrentPersona().MAC + "\n", ""},
+		{`echo hi >/dev/shm/x; cat </dev/shm/x`, "hi\n", ""},
+	} {
+		stdout, stderr, _ := runTestLine(t, sh, c.line)
+		if stdout != c.stdout || stderr != c.stderr {
+			t.Errorf("%q wrote %q, %q", c.line, stdout, stderr)
+		}
+	}
+	if _, stderr, status := runTestLine(t, sh, `echo hi >/run/x`); status == 0 || !strings.Contains(stderr, "Permission denied") {
+		t.Errorf("Wrote /run as user: %q", stderr)
+	}
+}
@@ -0,0 +1,107 @@
+package os
+
+import (
+	"bytes"
+	pathlib "path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPS1 is the prompt of bash in Debian and Ubuntu
+const DefaultPS1 = `\u@\h:\w\$ `
+
+// renderPrompt expands the backslash escapes of the PS1 template with the
+// current user, host and working directory
+func (sh *Shell) renderPrompt() string {
+	ps1, set := sh.sys.envVars["PS1"]
+	if !set {
+		ps1 = sh.PS1
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(ps1); i++ {
+		if ps1[i] != '\\' || i+1 >= len(ps1) {
+			buf.WriteByte(ps1[i])
+			continue
+		}
+		i++
+		switch c := ps1[i]; c {
+		case 'u':
+			buf.WriteString(sh.userName())
+		case 'h':
+			buf.WriteString(strings.SplitN(sh.sys.Hostname(), ".", 2)[0])
+		case 'H':
+			buf.WriteString(sh.sys.Hostname())
+		case 'w':
+			buf.WriteString(sh.tildePath(sh.sys.Getcwd()))
+		case 'W':
+			cwd := sh.tildePath(sh.sys.Getcwd())
+			if cwd != "/" && cwd != "~" {
+				cwd = pathlib.Base(cwd)
+			}
+			buf.WriteString(cwd)
+		case '$':
+			if sh.sys.CurrentUser() == 0 {
+				buf.WriteByte('#')
+			} else {
+				buf.WriteByte('$')
+			}
+		case 's':
+			buf.WriteString("bash")
+		case 'v':
+			buf.WriteString("4.3")
+		case 'V':
+			buf.WriteString("4.3.48")
+		case 'd':
+			buf.WriteString(time.Now().Format("Mon Jan 02"))
+		case 't':
+			buf.WriteString(time.Now().Format("15:04:05"))
+		case 'T':
+			buf.WriteString(time.Now().Format("03:04:05"))
+		case '@':
+			buf.WriteString(time.Now().Format("03:04 PM"))
+		case 'A':
+			buf.WriteString(time.Now().Format("15:04"))
+		case '!', '#':
+			buf.WriteString(strconv.Itoa(len(sh.history) + 1))
+		case 'j', 'l':
+			buf.WriteByte('0')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'e':
+			buf.WriteByte(0x1b)
+		case 'a':
+			buf.WriteByte('\a')
+		case '[', ']':
+			// Markers of non-printing characters are not displayed
+		case '\\':
+			buf.WriteByte('\\')
+		default:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// userName returns the name of the current user
+func (sh *Shell) userName() string {
+	if u := GetUserByID(sh.sys.CurrentUser()); len(u.Name) > 0 {
+		return u.Name
+	}
+	return sh.sys.Getenv("USER")
+}
+
+// tildePath abbreviates the home directory in the path with ~
+func (sh *Shell) tildePath(p string) string {
+	home := strings.TrimSuffix(sh.sys.Getenv("HOME"), "/")
+	switch {
+	case len(home) == 0:
+		return p
+	case p == home:
+		return "~"
+	case strings.HasPrefix(p, home+"/"):
+		return "~" + p[len(home):]
+	}
+	return p
+}
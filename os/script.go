@@ -0,0 +1,308 @@
+package os
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"io"
+	pathlib "path"
+	"strconv"
+	"strings"
+
+	"github.com/mkishere/sshsyrup/virtualfs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// ttyReader marks the stdin of the interactive session, so that a shell
+// started on the terminal does not try to read a script from it
+type ttyReader struct {
+	io.Reader
+}
+
+// shellCommand implements sh, bash and the other shells by running the
+// script with the same interpreter as the login shell
+type shellCommand struct {
+	name, path string
+}
+
+// maxShellDepth is the most shells and sourced files nested in each
+// other. Deeper scripts cannot fork, like on a host out of processes
+const maxShellDepth = 64
+
+// busybox runs the applet given as first argument
+type busybox struct{}
+
+func init() {
+	RegisterCommand("sh", shellCommand{"sh", "/bin/sh"})
+	RegisterCommand("bash", shellCommand{"bash", "/bin/bash"})
+	RegisterCommand("dash", shellCommand{"dash", "/bin/dash"})
+	RegisterCommand("ash", shellCommand{"ash", "/bin/ash"})
+	RegisterCommand("busybox", busybox{})
+}
+
+// systemOf returns the System behind the Sys passed to commands
+func systemOf(sys Sys) *System {
+	switch s := sys.(type) {
+	case *System:
+		return s
+	case *sysLogWrapper:
+		return s.System
+	}
+	return nil
+}
+
+func (sc shellCommand) GetHelp() string {
+	return ""
+}
+
+func (sc shellCommand) Where() string {
+	return sc.path
+}
+
+func (sc shellCommand) Exec(args []string, sys Sys) int {
+	system := systemOf(sys)
+	if system == nil {
+		return 1
+	}
+	stdio := &procIO{in: sys.In(), out: sys.Out(), err: sys.Err()}
+	sh := &Shell{
+		log:        system.log,
+		sys:        system.clone(),
+		inSubshell: true,
+		name:       sc.name,
+		pid:        system.Getpid(),
+		depth:      system.shellDepth + 1,
+	}
+	if lvl, err := strconv.Atoi(sh.sys.Getenv("SHLVL")); err == nil {
+		sh.sys.SetEnv("SHLVL", strconv.Itoa(lvl+1))
+	}
+	var cmdString *string
+	readStdin := false
+	for len(args) > 0 && len(args[0]) > 1 && (args[0][0] == '-' || args[0][0] == '+') {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			// Long options like --login and --norc do not change anything
+			continue
+		}
+		if strings.ContainsRune(arg, 'c') {
+			if len(args) == 0 {
+				fmt.Fprintf(stdio.err, "%v: -c: option requires an argument\n", sc.name)
+				return 2
+			}
+			cmdString = &args[0]
+			args = args[1:]
+		}
+		readStdin = readStdin || strings.ContainsRune(arg, 's')
+	}
+	switch {
+	case cmdString != nil:
+		if len(args) > 0 {
+			sh.name, sh.args = args[0], args[1:]
+		}
+		return sh.runScript(strings.NewReader(*cmdString), stdio)
+	case len(args) > 0 && !readStdin:
+		sh.name, sh.args = args[0], args[1:]
+		content, err := afero.ReadFile(sh.sys.FSys(), absPath(sh.sys.Getcwd(), args[0]))
+		if err != nil {
+			fmt.Fprintf(stdio.err, "%v: %v: %v\n", sc.name, args[0], ErrnoString(err))
+			return 127
+		}
+		sh.lineNo = 1
+		return sh.runScript(bytes.NewReader(content), stdio)
+	}
+	sh.args = args
+	if _, isTTY := stdio.in.(ttyReader); isTTY {
+		// A nested interactive shell behaves the same as the current one
+		return 0
+	}
+	return sh.runScript(stdio.in, stdio)
+}
+
+func (busybox) GetHelp() string {
+	return ""
+}
+
+func (busybox) Where() string {
+	return "/bin/busybox"
+}
+
+func (busybox) Exec(args []string, sys Sys) int {
+	if len(args) == 0 || args[0] == "--help" {
+		fmt.Fprintln(sys.Err(), "BusyBox v1.22.1 (Ubuntu 1:1.22.0-15ubuntu1) multi-call binary.")
+		fmt.Fprintln(sys.Err(), "BusyBox is copyrighted by many authors between 1998-2012.")
+		fmt.Fprintln(sys.Err(), "Licensed under GPLv2. See source distribution for detailed")
+		fmt.Fprintln(sys.Err(), "copyright information.")
+		fmt.Fprintln(sys.Err(), "\nUsage: busybox [function [arguments]...]")
+		fmt.Fprintln(sys.Err(), "   or: busybox --list[-full]")
+		fmt.Fprintln(sys.Err(), "   or: function [arguments]...")
+		return 1
+	}
+	system := systemOf(sys)
+	if _, exists := funcMap[args[0]]; !exists || system == nil || strings.Contains(args[0], "/") {
+		fmt.Fprintf(sys.Err(), "%v: applet not found\n", args[0])
+		return 127
+	}
+	n, _ := system.exec(args[0], args[1:], &procIO{in: sys.In(), out: sys.Out(), err: sys.Err()})
+	return n
+}
+
+// runScript reads the script line by line and runs each command as soon
+// as it is complete. Reading stops when the script calls exit
+func (sh *Shell) runScript(r io.Reader, stdio *procIO) int {
+	br := bufio.NewReader(r)
+	var pending string
+	status := 0
+	for !sh.exited {
+		line, err := br.ReadString('\n')
+		if len(line) == 0 && err != nil {
+			break
+		}
+		src := pending + line
+		list, perr := parse(src)
+		if perr == errIncomplete && err == nil {
+			pending = src
+			continue
+		}
+		pending = ""
+		if perr == errIncomplete {
+			perr = fmt.Errorf("syntax error: unexpected end of file")
+		}
+		if perr != nil {
+			fmt.Fprintf(stdio.err, "%v%v\n", sh.errPrefix(), perr)
+			return 2
+		}
+		status = sh.runList(list, stdio)
+		if sh.lineNo > 0 {
+			sh.lineNo += strings.Count(src, "\n")
+		}
+	}
+	return status
+}
+
+// execFile runs the file in the filesystem. Scripts are interpreted by the
+// shell while other files are logged as an execution attempt
+func (sh *Shell) execFile(args []string, stdio *procIO) int {
+	p := absPath(sh.sys.Getcwd(), args[0])
+	fi, err := sh.sys.FSys().Stat(p)
+	switch {
+	case err != nil:
+		fmt.Fprintf(stdio.err, "%v%v: %v\n", sh.errPrefix(), args[0], ErrnoString(err))
+		return 127
+	case fi.IsDir():
+		fmt.Fprintf(stdio.err, "%v%v: Is a directory\n", sh.errPrefix(), args[0])
+		return 126
+	case Access(sh.sys.FSys(), p, virtualfs.AccessExec) != nil:
+		fmt.Fprintf(stdio.err, "%v%v: Permission denied\n", sh.errPrefix(), args[0])
+		return 126
+	}
+	content, err := afero.ReadFile(sh.sys.FSys(), p)
+	if err != nil {
+		fmt.Fprintf(stdio.err, "%v%v: %v\n", sh.errPrefix(), args[0], ErrnoString(err))
+		return 126
+	}
+	interp, isScript := scriptInterpreter(content)
+	if !isScript {
+		return sh.execBinary(p, args, content, stdio)
+	}
+	if len(interp) == 0 {
+		// Scripts without shebang are run by the shell itself
+		interp = []string{"/bin/sh"}
+	}
+	n, err := sh.sys.exec(interp[0], append(interp[1:], args...), stdio)
+	if err != nil {
+		fmt.Fprintf(stdio.err, "%v%v: %v: bad interpreter: No such file or directory\n", sh.errPrefix(), args[0], interp[0])
+		return 126
+	}
+	return n
+}
+
+// execBinary logs the attempt to run a binary file. Executables built for
+// other architectures fail like on a real x86_64 machine
+func (sh *Shell) execBinary(p string, args []string, content []byte, stdio *procIO) int {
+	hash := sha256.Sum256(content)
+	entry := sh.log.WithFields(log.Fields{
+		"path":   p,
+		"args":   args[1:],
+		"size":   len(content),
+		"sha256": hex.EncodeToString(hash[:]),
+	})
+	f, err := elf.NewFile(bytes.NewReader(content))
+	if err != nil {
+		entry.Infof("Execution attempt of %v", p)
+		fmt.Fprintf(stdio.err, "%v%v: cannot execute binary file: Exec format error\n", sh.errPrefix(), args[0])
+		return 126
+	}
+	entry = entry.WithField("machine", f.Machine.String())
+	entry.Infof("Execution attempt of %v", p)
+	if f.Machine != elf.EM_X86_64 && f.Machine != elf.EM_386 {
+		fmt.Fprintf(stdio.err, "%v%v: cannot execute binary file: Exec format error\n", sh.errPrefix(), args[0])
+		return 126
+	}
+	// The program keeps running until it is killed or the session ends
+	sh.sys.Processes().Update(sh.sys.pid, func(p *Process) {
+		p.detached, p.State = true, "Sl"
+	})
+	return 0
+}
+
+// scriptInterpreter checks if the content is a script. The interpreter and
+// its argument in the shebang line are returned, or nil if there is none
+func scriptInterpreter(content []byte) ([]string, bool) {
+	if bytes.HasPrefix(content, []byte("#!")) {
+		line := content[2:]
+		if end := bytes.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+		fields := strings.Fields(string(line))
+		// #!/usr/bin/env bash
+		if len(fields) > 1 && pathlib.Base(fields[0]) == "env" {
+			fields = fields[1:]
+		}
+		return fields, true
+	}
+	// Like bash, treat files without NUL in the first line as text
+	head := content
+	if len(head) > 80 {
+		head = head[:80]
+	}
+	if end := bytes.IndexByte(head, '\n'); end >= 0 {
+		head = head[:end]
+	}
+	return nil, bytes.IndexByte(head, 0) < 0 && !bytes.HasPrefix(content, []byte(elf.ELFMAG))
+}
+
+// builtinSource runs the script in the current shell
+func builtinSource(sh *Shell, args []string, stdio *procIO) int {
+	if len(args) == 0 {
+		fmt.Fprintf(stdio.err, "%vsource: filename argument required\n", sh.errPrefix())
+		return 2
+	}
+	content, err := afero.ReadFile(sh.sys.FSys(), absPath(sh.sys.Getcwd(), args[0]))
+	if err != nil {
+		fmt.Fprintf(stdio.err, "%v%v: %v\n", sh.errPrefix(), args[0], ErrnoString(err))
+		return 1
+	}
+	if sh.depth >= maxShellDepth {
+		fmt.Fprintf(stdio.err, "%v%v: maximum source nesting level exceeded (%d)\n", sh.errPrefix(), args[0], maxShellDepth)
+		return 1
+	}
+	sh.depth++
+	defer func() { sh.depth-- }()
+	return sh.runScript(bytes.NewReader(content), stdio)
+}
+
+// forkFailed reports that the shell cannot start a process, as when the
+// processes of the host run out
+func (sh *Shell) forkFailed(stdio *procIO) int {
+	fmt.Fprintf(stdio.err, "%vfork: retry: Resource temporarily unavailable\n", sh.errPrefix())
+	fmt.Fprintf(stdio.err, "%vfork: Resource temporarily unavailable\n", sh.errPrefix())
+	return 126
+}
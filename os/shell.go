@@ -1,13 +1,19 @@
 package os
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 
-	"github.com/mattn/go-shellwords"
+	"github.com/mkishere/sshsyrup/util/capture"
 	"github.com/mkishere/sshsyrup/util/termlogger"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -17,41 +23,93 @@ type Shell struct {
 	terminal   *terminal.Terminal
 	sys        *System
 	DelayFunc  func()
+	// PS1 is the prompt template used unless PS1 variable is set
+	PS1        string
+	exited     bool
+	inSubshell bool
+	lastStatus int
+	// substStatus is the status of the last command substitution
+	substStatus int
+	pid         int
+	// name and args are the positional parameters $0 and $1...
+	name string
+	args []string
+	// lineNo is the line being run when the shell runs a script file
+	lineNo int
+	// history holds the command lines entered in the session
+	history    []string
+	prompt     string
+	tabPressed bool
+	// identities are the users switched from by su and sudo
+	identities []identity
+	sudoCached bool
+	// jobs are the commands started in background, bg tracks those still
+	// being run and lastBg is the PID of the last one
+	jobs       []*job
+	bg         sync.WaitGroup
+	lastBg     int
+	background bool
+	// execPid is the process to run the next command, noHup and setsid
+	// are applied to it
+	execPid       int
+	noHup, setsid bool
+	// depth is the number of shells and sourced files the shell runs in
+	depth int
 }
 
+// procIO holds the standard streams of a command being executed
+type procIO struct {
+	in       io.Reader
+	out, err io.Writer
+}
+
+func (p *procIO) In() io.Reader  { return p.in }
+func (p *procIO) Out() io.Writer { return p.out }
+func (p *procIO) Err() io.Writer { return p.err }
+func (p *procIO) Close() error   { return nil }
+
 func NewShell(sys *System, ipSrc string, log *log.Entry, termSignal chan<- int) *Shell {
 
 	return &Shell{
 		log:        log,
 		termSignal: termSignal,
 		sys:        sys,
+		name:       "-bash",
+		PS1:        DefaultPS1,
 	}
 }
 
 func (sh *Shell) HandleRequest(hook termlogger.LogHook) {
 
-	tLog := termlogger.NewLogger(hook, sh.sys.In(), sh.sys.Out(), sh.sys.Err())
+	// Terminal takes care of line endings so the raw channel is used
+	tLog := termlogger.NewLogger(hook, sh.sys.In(), sh.sys.sshChan, sh.sys.sshChan.Stderr())
 	defer tLog.Close()
 
-	sh.terminal = terminal.NewTerminal(struct {
-		io.Reader
-		io.Writer
-	}{
-		tLog.In(),
-		tLog.Out(),
-	}, "$ ")
+	sh.initHistory()
+	sh.prompt = sh.renderPrompt()
+	sh.terminal = sh.newTerminal(tLog.In(), tLog.Out())
+	sh.terminal.SetPrompt(sh.prompt)
+	sh.terminal.AutoCompleteCallback = sh.complete
+	sh.startSession([]string{sh.name}, true)
+	defer sh.endSession(true)
+	defer sh.sys.redirects.flush(sh.sys, true)
+	defer sh.saveHistory()
 	defer func() {
 		if r := recover(); r != nil {
 			sh.log.Errorf("Recovered from panic %v", r)
 			sh.termSignal <- 1
 		}
 	}()
-	shellParser := shellwords.NewParser()
-	shellParser.ParseBacktick = false
+	stdio := &procIO{
+		in:  ttyReader{tLog.In()},
+		out: stdoutWrapper{tLog.Out()},
+		err: stdoutWrapper{tLog.Err()},
+	}
+	var pending string
 	for {
-		cmd, err := sh.terminal.ReadLine()
-		if len(strings.TrimSpace(cmd)) > 0 {
-			sh.log.WithField("cmd", cmd).Infof("User input command %v", cmd)
+		line, err := sh.terminal.ReadLine()
+		if len(strings.TrimSpace(line)) > 0 {
+			sh.log.WithField("cmd", line).Infof("User input command %v", line)
 		}
 		if sh.DelayFunc != nil {
 			sh.DelayFunc()
@@ -65,29 +123,74 @@ func (sh *Shell) HandleRequest(hook termlogger.LogHook) {
 			sh.log.WithError(err).Error("Error when reading terminal")
 			break
 		}
+		if expanded, err := sh.expandHistory(line); err != nil {
+			fmt.Fprintf(stdio.err, "%v%v\n", sh.errPrefix(), err)
+			pending = ""
+			sh.terminal.SetPrompt(sh.prompt)
+			continue
+		} else if expanded != line {
+			// Bash shows the command line after history expansion
+			fmt.Fprintln(stdio.out, expanded)
+			line = expanded
+		}
+		if len(pending) > 0 {
+			line = pending + "\n" + line
+		}
+		list, err := parse(line)
+		if err == errIncomplete {
+			// Keep reading until the quote/pipe is closed, like bash's PS2
+			pending = line
+			sh.terminal.SetPrompt("> ")
+			continue
+		}
+		pending = ""
+		sh.addHistory(line)
+		if err != nil {
+			fmt.Fprintf(stdio.err, "%v%v\n", sh.errPrefix(), err)
+			sh.lastStatus = 2
+		} else if status := sh.runList(list, stdio); sh.exited {
+			sh.termSignal <- status
+			return
+		}
+		sh.sys.redirects.flush(sh.sys, false)
+		if _, alive := sh.sys.Processes().Get(sh.pid); !alive {
+			// The shell itself has been killed, e.g. by kill -9 $$
+			sh.log.Info("Shell process killed by user")
+			sh.termSignal <- 137
+			return
+		}
+		sh.reportJobs(stdio.err)
+		// Directory, user or host name may have been changed by the command
+		sh.prompt = sh.renderPrompt()
+		sh.terminal.SetPrompt(sh.prompt)
+	}
+}
 
-		pos := 0
-		for pos < len(cmd) {
-			cmdList, err := shellParser.Parse(cmd[pos:])
-			if err != nil {
-				sh.terminal.Write([]byte(cmd[pos:] + ": command not found"))
-				break
-			}
-			for i, cmdComp := range cmdList {
-				if strings.Contains(cmdComp, "=") {
-					envVar := strings.SplitN(cmdComp, "=", 1)
-					sh.sys.SetEnv(envVar[0], envVar[1])
-				} else {
-					sh.ExecCmd(strings.Join(cmdList[i:], " "), tLog)
-					break
-				}
-			}
-			if shellParser.Position == -1 {
-				break
-			}
-			pos += shellParser.Position + 1
+// HandleExec runs the command of an exec request without terminal, like
+// bash -c does. The session is recorded through the hook and the exit
+// status is sent to termSignal. Line endings are only converted when the
+// client has requested a pty
+func (sh *Shell) HandleExec(cmd string, hook termlogger.LogHook, pty bool) {
+	tLog := termlogger.NewLogger(hook, sh.sys.In(), sh.sys.sshChan, sh.sys.sshChan.Stderr())
+	defer tLog.Close()
+	defer func() {
+		if r := recover(); r != nil {
+			sh.log.Errorf("Recovered from panic %v", r)
+			sh.termSignal <- 1
 		}
+	}()
+	stdio := &procIO{in: tLog.In(), out: tLog.Out(), err: tLog.Err()}
+	if pty {
+		stdio.out, stdio.err = stdoutWrapper{tLog.Out()}, stdoutWrapper{tLog.Err()}
 	}
+	sh.log.WithField("cmd", cmd).Infof("User input command %v", cmd)
+	sh.name = "bash"
+	sh.startSession([]string{"bash", "-c", cmd}, false)
+	defer sh.endSession(false)
+	defer sh.sys.redirects.flush(sh.sys, true)
+	// exit should not print logout as this is not a login shell
+	sh.inSubshell = true
+	sh.termSignal <- sh.runScript(strings.NewReader(cmd), stdio)
 }
 
 func (sh *Shell) SetSize(width, height int) error {
@@ -96,35 +199,418 @@ func (sh *Shell) SetSize(width, height int) error {
 	return sh.terminal.SetSize(width, height)
 }
 
-func (sh *Shell) ExecCmd(cmd string, tLog termlogger.StdIOErr) {
-	cmd = strings.TrimSpace(cmd)
-	switch {
+// runList executes the and-or lists one by one and returns the exit
+// status of the last one
+func (sh *Shell) runList(list cmdList, stdio *procIO) (status int) {
+	for _, ao := range list {
+		if ao.background {
+			status = sh.runBackground(ao, stdio)
+			sh.lastStatus = status
+			continue
+		}
+		status = sh.runAndOr(ao, stdio)
+		if sh.exited {
+			break
+		}
+	}
+	return
+}
 
-	case strings.TrimSpace(cmd) == "":
-		//Do nothing
-	case cmd == "logout", cmd == "exit":
-		sh.log.Infof("User logged out")
-		sh.terminal.Write([]byte("logout\n"))
-		sh.terminal.SetPrompt("")
-		sh.termSignal <- 0
-		return
-	case strings.HasPrefix(cmd, "cd"):
-		args := strings.Split(cmd, " ")
-		if len(args) > 1 {
-			err := sh.sys.Chdir(args[1])
+// runAndOr runs the pipelines from left to right. A pipeline after &&
+// only runs if the previous status is zero, and one after || only runs
+// if it is non-zero
+func (sh *Shell) runAndOr(ao *andOrList, stdio *procIO) int {
+	status := sh.runPipeline(ao.pipelines[0], stdio)
+	for i, op := range ao.ops {
+		if sh.exited {
+			break
+		}
+		if op == "&&" && status == 0 || op == "||" && status != 0 {
+			status = sh.runPipeline(ao.pipelines[i+1], stdio)
+		}
+	}
+	return status
+}
+
+// runPipeline starts all commands in the pipeline concurrently, with the
+// stdout of each command connected to the stdin of the next one. Like
+// bash, each command of a multi-command pipeline runs in a subshell. The
+// exit status is the one of the last command
+func (sh *Shell) runPipeline(p *pipeline, stdio *procIO) (status int) {
+	defer func() {
+		if p.negate {
+			status = boolStatus(status != 0)
+		}
+		sh.lastStatus = status
+	}()
+	if len(p.cmds) == 1 {
+		return sh.runCommand(p.cmds[0], stdio)
+	}
+	res := make([]int, len(p.cmds))
+	var wg sync.WaitGroup
+	in := stdio.in
+	for i, cmd := range p.cmds {
+		stageIO := &procIO{in: in, out: stdio.out, err: stdio.err}
+		var pw *io.PipeWriter
+		if i < len(p.cmds)-1 {
+			var pr *io.PipeReader
+			pr, pw = io.Pipe()
+			stageIO.out = pw
+			in = pr
+		}
+		wg.Add(1)
+		go func(i int, sub *Shell, cmd command, stageIO *procIO, pw *io.PipeWriter) {
+			defer wg.Done()
+			res[i] = sub.runCommand(cmd, stageIO)
+			if pw != nil {
+				pw.Close()
+			}
+			// Unblock the previous command if this one exits without
+			// consuming all its input, e.g. head
+			if pr, ok := stageIO.in.(*io.PipeReader); ok {
+				pr.Close()
+			}
+		}(i, sh.newSubshell(), cmd, stageIO, pw)
+	}
+	wg.Wait()
+	return res[len(res)-1]
+}
+
+// runCommand runs a simple command, subshell or group
+func (sh *Shell) runCommand(cmd command, stdio *procIO) int {
+	switch c := cmd.(type) {
+	case *subshell:
+		return sh.withRedirects(c.redirs, stdio, func(cmdIO *procIO) int {
+			return sh.newSubshell().runList(c.list, cmdIO)
+		})
+	case *group:
+		return sh.withRedirects(c.redirs, stdio, func(cmdIO *procIO) int {
+			return sh.runList(c.list, cmdIO)
+		})
+	}
+	return sh.runSimpleCommand(cmd.(*simpleCommand), stdio)
+}
+
+// withRedirects applies the redirections and calls run with the
+// resulting streams
+func (sh *Shell) withRedirects(redirs []redirect, stdio *procIO, run func(cmdIO *procIO) int) int {
+	cmdIO, closers, err := sh.redirect(redirs, stdio)
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	if err != nil {
+		fmt.Fprintf(stdio.err, "%v%v\n", sh.errPrefix(), err)
+		return 1
+	}
+	return run(cmdIO)
+}
+
+// runSimpleCommand expands the words and runs a builtin or a command
+// registered in the system
+func (sh *Shell) runSimpleCommand(cmd *simpleCommand, stdio *procIO) int {
+	words := cmd.words
+	// The status of an assignment-only command is the status of the last
+	// command substitution
+	sh.substStatus = 0
+	// Leading NAME=value words are variable assignments
+	assigns := map[string]string{}
+	for len(words) > 0 && isAssignment(words[0]) {
+		pos := strings.IndexByte(words[0], '=')
+		assigns[words[0][:pos]] = sh.expandString(words[0][pos+1:], stdio)
+		words = words[1:]
+	}
+	args := sh.expandWords(words, stdio)
+	if len(args) == 0 {
+		for k, v := range assigns {
+			sh.sys.SetEnv(k, v)
+		}
+		status := sh.substStatus
+		return sh.withRedirects(cmd.redirs, stdio, func(*procIO) int { return status })
+	}
+	// Assignments before a command only apply to that command
+	if len(assigns) > 0 {
+		saved := sh.sys.clone().envVars
+		defer func() { sh.sys.envVars = saved }()
+		for k, v := range assigns {
+			sh.sys.SetEnv(k, v)
+		}
+	}
+	return sh.withRedirects(cmd.redirs, stdio, func(cmdIO *procIO) int {
+		return sh.execArgs(args, cmdIO)
+	})
+}
+
+// commandSubst runs the command in a subshell and returns its output
+// without trailing newlines
+func (sh *Shell) commandSubst(src string, stdio *procIO) string {
+	list, err := parse(src)
+	if err != nil {
+		fmt.Fprintf(stdio.err, "%vcommand substitution: %v\n", sh.errPrefix(), err)
+		sh.lastStatus, sh.substStatus = 2, 2
+		return ""
+	}
+	var buf bytes.Buffer
+	sub := sh.newSubshell()
+	sh.lastStatus = sub.runList(list, &procIO{in: stdio.in, out: &buf, err: stdio.err})
+	sh.substStatus = sh.lastStatus
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// execArgs runs the expanded command line
+func (sh *Shell) execArgs(args []string, cmdIO *procIO) int {
+	sh.log.WithFields(log.Fields{
+		"cmd":  args[0],
+		"args": args[1:],
+	}).Infof("Executing command %v", args[0])
+	if builtin, ok := builtins[args[0]]; ok {
+		return builtin(sh, args[1:], cmdIO)
+	}
+	pid, err := sh.startProcess(args)
+	if err != nil {
+		return sh.forkFailed(cmdIO)
+	}
+	parent := sh.sys.pid
+	sh.sys.pid, sh.sys.shellDepth = pid, sh.depth
+	defer func() {
+		sh.sys.pid = parent
+		sh.sys.Processes().Exit(pid)
+	}()
+	isPath := strings.Contains(args[0], "/")
+	if isPath {
+		p := absPath(sh.sys.Getcwd(), args[0])
+		_, registered := funcMap[p]
+		fi, err := sh.sys.FSys().Stat(p)
+		// Files in the image are empty placeholders of the commands
+		placeholder := err == nil && fi.Mode().IsRegular() && fi.Size() == 0
+		if !registered && !placeholder {
+			return sh.execFile(args, cmdIO)
+		}
+	}
+	n, err := sh.sys.exec(args[0], args[1:], cmdIO)
+	if err != nil {
+		if isPath {
+			return sh.execFile(args, cmdIO)
+		}
+		fmt.Fprintf(cmdIO.err, "%v%v: command not found\n", sh.errPrefix(), args[0])
+	}
+	return n
+}
+
+// errPrefix returns the prefix of error messages printed by the shell
+func (sh *Shell) errPrefix() string {
+	if sh.lineNo > 0 {
+		return fmt.Sprintf("%v: line %d: ", sh.name, sh.lineNo)
+	}
+	return sh.name + ": "
+}
+
+// newSubshell creates a child shell with a copy of the system, so that
+// changes to working directory and variables do not affect the parent
+func (sh *Shell) newSubshell() *Shell {
+	return &Shell{
+		log:        sh.log,
+		termSignal: sh.termSignal,
+		terminal:   sh.terminal,
+		sys:        sh.sys.clone(),
+		DelayFunc:  sh.DelayFunc,
+		inSubshell: true,
+		lastStatus: sh.lastStatus,
+		pid:        sh.pid,
+		name:       sh.name,
+		args:       sh.args,
+		lineNo:     sh.lineNo,
+		background: sh.background,
+		lastBg:     sh.lastBg,
+		depth:      sh.depth,
+	}
+}
+
+func boolStatus(ok bool) int {
+	if ok {
+		return 0
+	}
+	return 1
+}
+
+// devStreams are the files in /dev of the streams of the shell
+var devStreams = map[string]string{
+	"/dev/stdin": "0", "/dev/stdout": "1", "/dev/stderr": "2",
+	"/dev/fd/0": "0", "/dev/fd/1": "1", "/dev/fd/2": "2",
+}
+
+// redirect returns the streams of a command after applying the
+// redirections. Files opened are returned so that caller can close
+// them after the command finishes
+func (sh *Shell) redirect(redirs []redirect, stdio *procIO) (cmdIO *procIO, closers []io.Closer, err error) {
+	cmdIO = &procIO{in: stdio.in, out: stdio.out, err: stdio.err}
+	for _, r := range redirs {
+		switch r.op {
+		case "<<", "<<-":
+			// Body is expanded unless any part of the delimiter is quoted
+			body := r.body
+			if !strings.ContainsAny(r.target, "'\"\\") {
+				body = sh.expandHeredoc(body, stdio)
+			}
+			cmdIO.setFd(r.fd, nil, strings.NewReader(body))
+			continue
+		case "<<<":
+			cmdIO.setFd(r.fd, nil, strings.NewReader(sh.expandString(r.target, stdio)+"\n"))
+			continue
+		}
+		fields := sh.expandWord(r.target, stdio)
+		if len(fields) != 1 {
+			return cmdIO, closers, fmt.Errorf("%v: ambiguous redirect", r.target)
+		}
+		target := fields[0]
+		// Like bash, the shell opens the links to its own streams in /dev
+		// itself
+		if fd, ok := devStreams[target]; ok && (r.op == "<" || r.op == ">" || r.op == ">>") {
+			target = fd
+			if r.op == "<" {
+				r.op = "<&"
+			} else {
+				r.op = ">&"
+			}
+		}
+		switch r.op {
+		case ">&", "<&":
+			fd, _ := strconv.Atoi(target)
+			switch {
+			case target == "-":
+				cmdIO.setFd(r.fd, termlogger.DummyWriter{}, eofReader{})
+			case fd == 0:
+				cmdIO.setFd(r.fd, nil, cmdIO.in)
+			case fd == 1:
+				cmdIO.setFd(r.fd, cmdIO.out, nil)
+			case fd == 2:
+				cmdIO.setFd(r.fd, cmdIO.err, nil)
+			default:
+				return cmdIO, closers, fmt.Errorf("%v: Bad file descriptor", target)
+			}
+		case "<":
+			f, err := sh.sys.FSys().OpenFile(absPath(sh.sys.Getcwd(), target), os.O_RDONLY, 0)
 			if err != nil {
-				sh.terminal.Write([]byte(fmt.Sprintf("-bash: cd: %v: No such file or directory\n", args[1])))
+				return cmdIO, closers, fmt.Errorf("%v: %v", target, ErrnoString(err))
+			}
+			closers = append(closers, f)
+			cmdIO.setFd(r.fd, nil, f)
+		case ">", ">>":
+			p := absPath(sh.sys.Getcwd(), target)
+			if isDir, _ := afero.IsDir(sh.sys.FSys(), p); isDir {
+				return cmdIO, closers, fmt.Errorf("%v: %v", target, ErrnoString(syscall.EISDIR))
 			}
+			flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if r.op == ">>" {
+				flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+			f, err := sh.sys.FSys().OpenFile(p, flag, 0644)
+			if err != nil {
+				return cmdIO, closers, fmt.Errorf("%v: %v", target, ErrnoString(err))
+			}
+			op := "write"
+			if r.op == ">>" {
+				op = "append"
+			}
+			sh.sys.FsEvent(op, p, log.Fields{"cmd": "redirect"})
+			closers = append(closers, capturedFile{f, sh.sys, p})
+			cmdIO.setFd(r.fd, f, nil)
 		}
-	case strings.HasPrefix(cmd, "export"):
+	}
+	return
+}
 
-	default:
-		args := strings.Split(cmd, " ")
-		n, err := sh.sys.exec(args[0], args[1:], tLog)
-		if err != nil {
-			sh.terminal.Write([]byte(fmt.Sprintf("%v: command not found\n", args[0])))
-		} else {
-			sh.sys.envVars["?"] = string(n)
+// capturedFile is a file written by redirection, whose content is queued
+// for capture when closed
+type capturedFile struct {
+	afero.File
+	sys  *System
+	path string
+}
+
+func (f capturedFile) Close() error {
+	err := f.File.Close()
+	// The file is read back through the mounts, as it may be on a tmpfs.
+	// Devices like /dev/null are not files to capture
+	fs := f.sys.mountFs()
+	if fi, serr := fs.Stat(f.path); serr != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+	if data, rerr := afero.ReadFile(fs, f.path); rerr == nil && len(data) > 0 {
+		f.sys.redirects.add(f.sys, f.path, data)
+	}
+	return err
+}
+
+// redirectQueue keeps the latest content of the files written by
+// redirection, so that a file built by many redirections, e.g. a script
+// echoed line by line, is captured once when the command line is done.
+// The content is kept rather than read at the end as the file may have
+// been removed by then
+type redirectQueue struct {
+	lock  sync.Mutex
+	files map[string][]byte
+	order []string
+	// done is set when the session ends, after which the files written by
+	// the jobs left running are captured right away
+	done bool
+}
+
+func newRedirectQueue() *redirectQueue {
+	return &redirectQueue{files: make(map[string][]byte)}
+}
+
+func (q *redirectQueue) add(sys *System, path string, data []byte) {
+	q.lock.Lock()
+	if q.done {
+		q.lock.Unlock()
+		sys.Capture(data, capture.Source{Method: "redirect", Path: path})
+		return
+	}
+	if _, ok := q.files[path]; !ok {
+		q.order = append(q.order, path)
+	}
+	q.files[path] = data
+	q.lock.Unlock()
+}
+
+// flush captures the queued files. The queue is closed for good at the
+// end of the session
+func (q *redirectQueue) flush(sys *System, end bool) {
+	q.lock.Lock()
+	files, order := q.files, q.order
+	q.files, q.order = make(map[string][]byte), nil
+	q.done = q.done || end
+	q.lock.Unlock()
+	for _, path := range order {
+		sys.Capture(files[path], capture.Source{Method: "redirect", Path: path})
+	}
+}
+
+// setFd replaces the stream of the file descriptor. fd -1 stands for
+// both stdout and stderr
+func (p *procIO) setFd(fd int, w io.Writer, r io.Reader) {
+	switch fd {
+	case 0:
+		if r != nil {
+			p.in = r
+		}
+	case 1:
+		if w != nil {
+			p.out = w
+		}
+	case 2:
+		if w != nil {
+			p.err = w
+		}
+	case -1:
+		if w != nil {
+			p.out, p.err = w, w
 		}
 	}
 }
+
+type eofReader struct{}
+
+func (eofReader) Read(p []byte) (int, error) { return 0, io.EOF }
@@ -0,0 +1,741 @@
+package os
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mkishere/sshsyrup/util/capture"
+	"github.com/mkishere/sshsyrup/virtualfs"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+)
+
+type testEcho struct{}
+
+func (testEcho) GetHelp() string { return "" }
+func (testEcho) Where() string   { return "/bin/echo" }
+func (testEcho) Exec(args []string, sys Sys) int {
+	fmt.Fprintln(sys.Out(), strings.Join(args, " "))
+	return 0
+}
+
+type testCat struct{}
+
+func (testCat) GetHelp() string { return "" }
+func (testCat) Where() string   { return "/bin/cat" }
+func (testCat) Exec(args []string, sys Sys) int {
+	io.Copy(sys.Out(), sys.In())
+	return 0
+}
+
+func init() {
+	RegisterCommand("echo", testEcho{})
+	RegisterCommand("cat", testCat{})
+}
+
+func newTestShell(t *testing.T) *Shell {
+	vfs, err := virtualfs.NewVirtualFS("../filesystem.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	for _, u := range []User{
+		{UID: 0, Name: "root", Homedir: "/root", Shell: "/bin/bash"},
+		{UID: 1000, GID: 1000, Name: "mk", Homedir: "/home/mk", Shell: "/bin/bash"},
+	} {
+		users[u.UID] = u
+		usernameMapping[u.Name] = u
+	}
+	sys := &System{
+		userId:    1000,
+		cwd:       "/home/mk",
+		fSys:      virtualfs.NewOwnerFs(virtualfs.NewLayerFs(vfs, afero.NewMemMapFs())),
+		envVars:   loginEnv(usernameMapping["mk"]),
+		width:     80,
+		height:    24,
+		log:       log.NewEntry(logger),
+		hostName:  "spr1139",
+		mounts:    sessionMounts(),
+		redirects: newRedirectQueue(),
+	}
+	return NewShell(sys, "127.0.0.1", sys.log, make(chan int, 1))
+}
+
+func runTestLine(t *testing.T, sh *Shell, line string) (stdout, stderr string, status int) {
+	list, err := parse(line)
+	if err != nil {
+		t.Fatalf("Cannot parse %q: %v", line, err)
+	}
+	var out, errOut bytes.Buffer
+	status = sh.runList(list, &procIO{in: eofReader{}, out: &out, err: &errOut})
+	return out.String(), errOut.String(), status
+}
+
+func TestParsePipeline(t *testing.T) {
+	list, err := parse(`cat /etc/passwd | grep "root user" 2>&1 > /tmp/x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || len(list[0].pipelines) != 1 || len(list[0].pipelines[0].cmds) != 2 {
+		t.Fatalf("Unexpected parse result %v", list)
+	}
+	grep := list[0].pipelines[0].cmds[1].(*simpleCommand)
+	if len(grep.words) != 2 || grep.words[1] != `"root user"` {
+		t.Errorf("Unexpected words %q", grep.words)
+	}
+	expected := []redirect{{2, ">&", "1", ""}, {1, ">", "/tmp/x", ""}}
+	if fmt.Sprint(grep.redirs) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected redirections %v", grep.redirs)
+	}
+}
+
+func TestParseIncomplete(t *testing.T) {
+	for _, line := range []string{`echo "foo`, `echo 'foo`, `cat x |`, `echo foo\`, `echo "${x:-'}"`, `echo ${x:-'}`} {
+		if _, err := parse(line); err != errIncomplete {
+			t.Errorf("%q: expected incomplete input, got %v", line, err)
+		}
+	}
+	for _, line := range []string{`echo foo >`, `; echo`, `echo a )`, `( )`, `echo a && || echo b`} {
+		if _, err := parse(line); err == nil || err == errIncomplete {
+			t.Errorf("%q: expected syntax error, got %v", line, err)
+		}
+	}
+}
+
+func TestParseCompound(t *testing.T) {
+	list, err := parse(`cd /tmp || cd /var/run; (cd /; echo a) && { echo b; echo c; } > x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || len(list[0].pipelines) != 2 || list[0].ops[0] != "||" {
+		t.Fatalf("Unexpected parse result %v", list)
+	}
+	if sub, ok := list[1].pipelines[0].cmds[0].(*subshell); !ok || len(sub.list) != 2 {
+		t.Errorf("Expected subshell, got %v", list[1].pipelines[0].cmds[0])
+	}
+	grp, ok := list[1].pipelines[1].cmds[0].(*group)
+	if !ok || len(grp.list) != 2 || len(grp.redirs) != 1 {
+		t.Errorf("Expected group, got %v", list[1].pipelines[1].cmds[0])
+	}
+}
+
+func TestRedirection(t *testing.T) {
+	sh := newTestShell(t)
+	runTestLine(t, sh, `echo foo > x; echo 'bar  baz' >> /home/mk/x`)
+	out, _, _ := runTestLine(t, sh, `cat < x`)
+	if out != "foo\nbar  baz\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	_, errOut, status := runTestLine(t, sh, `cat < /nonexist`)
+	if status != 1 || errOut != "-bash: /nonexist: No such file or directory\n" {
+		t.Errorf("Unexpected error %q (%v)", errOut, status)
+	}
+}
+
+func TestHeredoc(t *testing.T) {
+	sh := newTestShell(t)
+	tests := []struct {
+		line, expected string
+	}{
+		{"cat << EOF\nhome $HOME\n  `echo sub`\nEOF\n", "home /home/mk\n  sub\n"},
+		{"cat << 'EOF'\nhome $HOME\nEOF\n", "home $HOME\n"},
+		{"cat <<-EOF\n\tone\n\t\ttwo\n\tEOF\n", "one\ntwo\n"},
+		{"cat <<< \"$USER here\"", "mk here\n"},
+		{"cat << A > x; cat < x\nfirst\nA\n", "first\n"},
+	}
+	for _, test := range tests {
+		if out, _, _ := runTestLine(t, sh, test.line); out != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.line, test.expected, out)
+		}
+	}
+	for _, line := range []string{"cat << EOF\n", "cat << EOF\nfoo\n"} {
+		if _, err := parse(line); err != errIncomplete {
+			t.Errorf("%q: expected incomplete input, got %v", line, err)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	sh := newTestShell(t)
+	out, _, _ := runTestLine(t, sh, `echo hello | cat | cat`)
+	if out != "hello\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	out, errOut, status := runTestLine(t, sh, `nosuchcmd 2>&1 | cat`)
+	if out != "-bash: nosuchcmd: command not found\n" || errOut != "" || status != 0 {
+		t.Errorf("Unexpected output %q %q", out, errOut)
+	}
+}
+
+func TestAndOrList(t *testing.T) {
+	sh := newTestShell(t)
+	out, errOut, status := runTestLine(t, sh, `cd /nonexist || cd /home && echo a && nosuchcmd || echo b; echo c`)
+	if out != "a\nb\nc\n" || status != 0 {
+		t.Errorf("Unexpected output %q %q", out, errOut)
+	}
+	if sh.sys.Getcwd() != "/home" {
+		t.Errorf("Unexpected cwd %v", sh.sys.Getcwd())
+	}
+	_, _, status = runTestLine(t, sh, `! echo a > /home/mk/x`)
+	if status != 1 {
+		t.Errorf("Unexpected status %v", status)
+	}
+}
+
+func TestSubshell(t *testing.T) {
+	sh := newTestShell(t)
+	out, _, _ := runTestLine(t, sh, `(cd /boot; exit 3) || echo $?; { cd /boot; echo a; } | cat`)
+	if out != "3\na\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	if sh.sys.Getcwd() != "/home/mk" || sh.exited {
+		t.Errorf("Subshell modified parent shell")
+	}
+	runTestLine(t, sh, `{ cd /boot; }`)
+	if sh.sys.Getcwd() != "/boot" {
+		t.Errorf("Group did not run in current shell")
+	}
+}
+
+func TestVariableExpansion(t *testing.T) {
+	sh := newTestShell(t)
+	tests := []struct {
+		line, out string
+	}{
+		{`echo $HOME ${USER} "$PWD"`, "/home/mk mk /home/mk\n"},
+		{`echo '$HOME' \$HOME "\$HOME"`, "$HOME $HOME $HOME\n"},
+		{`A="x  y"; echo $A "$A"`, "x y x  y\n"},
+		{`echo ${NOTSET:-default value} ${NOTSET:+alt} ${HOME:+alt}`, "default value alt\n"},
+		{`echo ${#USER} $NOTSET "" | cat`, "2 \n"},
+		{`nosuchcmd >/dev/null 2>&1; echo $?`, "127\n"},
+		{`export B=1; unset A; env | cat > env; printenv B A`, "1\n"},
+		{`C=1 printenv C; printenv C || echo unset`, "1\nunset\n"},
+		{`cd /boot; echo $PWD $OLDPWD`, "/boot /home/mk\n"},
+		{`echo "${x:-'}'}" ${x:-"}"} ${x:-\}}`, "} } }\n"},
+	}
+	for _, test := range tests {
+		out, errOut, _ := runTestLine(t, sh, test.line)
+		if out != test.out {
+			t.Errorf("%v: expected %q, got %q %q", test.line, test.out, out, errOut)
+		}
+	}
+	var errOut bytes.Buffer
+	if fields := sh.expandWord(`a'b`, &procIO{err: &errOut}); len(fields) != 1 || fields[0] != "a" ||
+		!strings.Contains(errOut.String(), "unexpected EOF while looking for matching `''") {
+		t.Errorf("Unterminated quote expanded to %q: %q", fields, errOut.String())
+	}
+}
+
+func TestGlobExpansion(t *testing.T) {
+	sh := newTestShell(t)
+	tests := []struct {
+		line, out string
+	}{
+		{`echo /boot/[a-c]*`, "/boot/abi-4.4.0-104-generic /boot/config-4.4.0-104-generic\n"},
+		{`cd /boot; echo *-generic | cat`, "System.map-4.4.0-104-generic abi-4.4.0-104-generic config-4.4.0-104-generic initrd.img-4.4.0-104-generic vmlinuz-4.4.0-104-generic\n"},
+		{`echo ../boot/gr?b/ /etc/a[!b]duser.conf`, "../boot/grub/ /etc/adduser.conf\n"},
+		{`echo '/boot/*' "/boot/a"* /boot/\*`, "/boot/* /boot/abi-4.4.0-104-generic /boot/*\n"},
+		{`echo /nonexist/* /boot/*.none`, "/nonexist/* /boot/*.none\n"},
+		{`P='/boot/g*'; echo $P "$P"`, "/boot/grub /boot/g*\n"},
+		{`echo {a,b}{1,2} x{,y} "{a,b}" {a}`, "a1 a2 b1 b2 x xy {a,b} {a}\n"},
+		{`echo {1..3} {c..a} {01..3} {1..7..3}`, "1 2 3 c b a 01 02 03 1 4 7\n"},
+		{`echo ~ ~/x ~root/.ssh ~nosuch '~'`, "/home/mk /home/mk/x /root/.ssh ~nosuch ~\n"},
+	}
+	for _, test := range tests {
+		out, errOut, _ := runTestLine(t, sh, test.line)
+		if out != test.out {
+			t.Errorf("%v: expected %q, got %q %q", test.line, test.out, out, errOut)
+		}
+	}
+}
+
+func TestCommandSubstitution(t *testing.T) {
+	sh := newTestShell(t)
+	tests := []struct {
+		line, out string
+	}{
+		{"echo $(echo a   b) \"$(echo '  x')\" `echo y`", "a b   x y\n"},
+		{`echo $(echo $(echo "nested )"))`, "nested )\n"},
+		{"echo \"`echo \\`echo z\\``\"", "z\n"},
+		{`A=$(nosuchcmd 2>/dev/null); echo $? "[$A]"`, "127 []\n"},
+		{`cd $(echo /boot) && echo $(echo $PWD | cat)`, "/boot\n"},
+		{`echo $(cd /; echo ok) $PWD`, "ok /boot\n"},
+	}
+	for _, test := range tests {
+		out, errOut, _ := runTestLine(t, sh, test.line)
+		if out != test.out {
+			t.Errorf("%v: expected %q, got %q %q", test.line, test.out, out, errOut)
+		}
+	}
+	if _, err := parse(`echo $(echo a`); err != errIncomplete {
+		t.Errorf("Expected incomplete input, got %v", err)
+	}
+}
+
+func TestScriptExecution(t *testing.T) {
+	sh := newTestShell(t)
+	hook := test.NewLocal(sh.log.Logger)
+	fs := afero.Afero{Fs: sh.sys.FSys()}
+	fs.WriteFile("/home/mk/x.sh", []byte("#!/bin/bash\necho \"$0\" $1 $#\ncd /boot\necho $PWD \\\n  `echo ok`\nexit 3\necho no\n"), 0755)
+	fs.WriteFile("/home/mk/noexec", []byte("echo a\n"), 0644)
+	fs.WriteFile("/home/mk/bad.sh", []byte("echo a\necho b )\necho c\n"), 0644)
+	fs.WriteFile("/home/mk/env", []byte("A=1\nB=2\n"), 0644)
+	fs.WriteFile("/home/mk/bin", []byte("\x7fELF\x02\x01\x01\x00garbage"), 0755)
+	tests := []struct {
+		line, out, errOut string
+	}{
+		{`./x.sh a b; echo $? $PWD`, "./x.sh a 2\n/boot ok\n3 /home/mk\n", ""},
+		{`sh noexec; ./noexec; echo $?`, "a\n126\n", "-bash: ./noexec: Permission denied\n"},
+		{`bash -c 'echo $0 $1; nosuch' foo bar`, "foo bar\n", "foo: nosuch: command not found\n"},
+		{`echo 'echo piped; exit 4' | sh; echo $?`, "piped\n4\n", ""},
+		{`bash bad.sh; echo $?`, "a\n2\n", "bad.sh: line 2: syntax error near unexpected token `)'\n"},
+		{`. ./env; echo $A$B`, "12\n", ""},
+		{`busybox MIRAI`, "", "MIRAI: applet not found\n"},
+		{`./bin; echo $?`, "126\n", "-bash: ./bin: cannot execute binary file: Exec format error\n"},
+		{`./nosuch; /bin`, "", "-bash: ./nosuch: No such file or directory\n-bash: /bin: Is a directory\n"},
+	}
+	// Scripts running themselves stop when processes run out
+	fs.WriteFile("/home/mk/r.sh", []byte("sh r.sh\n"), 0644)
+	fs.WriteFile("/home/mk/s.sh", []byte(". ./s.sh\n"), 0644)
+	procs := len(sh.sys.Processes().List())
+	out, errOut, status := runTestLine(t, sh, "sh r.sh")
+	if status != 126 || !strings.HasPrefix(errOut, "r.sh: line 1: fork: retry: Resource temporarily unavailable\n") {
+		t.Errorf("Recursive script exited with %v: %q %q", status, out, errOut)
+	}
+	out, errOut, status = runTestLine(t, sh, ". ./s.sh")
+	if status != 1 || errOut != "-bash: ./s.sh: maximum source nesting level exceeded (64)\n" {
+		t.Errorf("Recursive source exited with %v: %q %q", status, out, errOut)
+	}
+	if left := len(sh.sys.Processes().List()) - procs; left != 0 {
+		t.Errorf("%d processes left by recursive scripts", left)
+	}
+	for _, test := range tests {
+		out, errOut, _ := runTestLine(t, sh, test.line)
+		if out != test.out || errOut != test.errOut {
+			t.Errorf("%v: expected %q %q, got %q %q", test.line, test.out, test.errOut, out, errOut)
+		}
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Execution attempt of /home/mk/bin" {
+			if hash, _ := entry.Data["sha256"].(string); len(hash) != 64 {
+				t.Errorf("Unexpected hash %q", hash)
+			}
+			return
+		}
+	}
+	t.Errorf("Execution attempt not logged")
+}
+
+// elfHeader returns the header of an x86_64 executable
+func elfHeader() []byte {
+	hdr := make([]byte, 64)
+	copy(hdr, "\x7fELF\x02\x01\x01")
+	binary.LittleEndian.PutUint16(hdr[16:], 2)
+	binary.LittleEndian.PutUint16(hdr[18:], 62)
+	binary.LittleEndian.PutUint32(hdr[20:], 1)
+	binary.LittleEndian.PutUint16(hdr[52:], 64)
+	return hdr
+}
+
+func TestBackgroundJobs(t *testing.T) {
+	sh := newTestShell(t)
+	sh.sys.layer = "jobtest"
+	sh.startSession([]string{"-bash"}, true)
+	procs := sh.sys.Processes()
+	fs := afero.Afero{Fs: sh.sys.FSys()}
+	fs.WriteFile("/home/mk/xmrig", elfHeader(), 0755)
+	_, errOut, _ := runTestLine(t, sh, `nohup ./xmrig -o pool:3333 > log 2>&1 &`)
+	miner := sh.lastBg
+	if errOut != fmt.Sprintf("[1] %d\n", miner) {
+		t.Errorf("Unexpected job output %q", errOut)
+	}
+	if out, _, _ := runTestLine(t, sh, `echo $! | cat; (echo $!); echo $(echo $!)`); out != strings.Repeat(fmt.Sprintf("%d\n", miner), 3) {
+		t.Errorf("$! in subshells: %q", out)
+	}
+	runTestLine(t, sh, `./xmrig & echo done > x & setsid ./xmrig; wait`)
+	out, _, _ := runTestLine(t, sh, `jobs`)
+	expected := "[1]   Running                 nohup ./xmrig -o pool:3333 > log 2>&1 &\n" +
+		"[2]-  Running                 ./xmrig &\n" +
+		"[3]+  Done                    echo done > x\n"
+	if out != expected {
+		t.Errorf("Unexpected jobs %q", out)
+	}
+	if p, exists := procs.Get(miner); !exists || p.Cmdline() != "./xmrig -o pool:3333" || !p.NoHup || p.PPID != sh.pid {
+		t.Errorf("Unexpected process %+v", p)
+	}
+	var setsid Process
+	for _, p := range procs.List() {
+		if p.Cmdline() == "./xmrig" && p.SID == p.PID {
+			setsid = p
+		}
+	}
+	sh.endSession(true)
+	if _, exists := procs.Get(miner); !exists {
+		t.Errorf("Process started by nohup is hung up")
+	}
+	if _, exists := procs.Get(setsid.PID); !exists || setsid.TTY != "?" {
+		t.Errorf("Process started by setsid is hung up")
+	}
+	for _, p := range procs.List() {
+		if p.SID == sh.pid && !p.NoHup {
+			t.Errorf("Process %+v left after logout", p)
+		}
+	}
+}
+
+func TestProcessSignal(t *testing.T) {
+	pt := newProcessTable(time.Now().Add(-time.Hour))
+	pid, _ := pt.Spawn(1, 1000, []string{"./xmrig"})
+	tests := []struct {
+		pid, uid int
+		sig      syscall.Signal
+		err      error
+		state    string
+	}{
+		{pid, 1001, syscall.SIGKILL, syscall.EPERM, "S"},
+		{pid, 1000, syscall.SIGSTOP, nil, "T"},
+		{pid, 1000, syscall.SIGWINCH, nil, "T"},
+		{pid, 1000, syscall.SIGCONT, nil, "S"},
+		{1, 0, syscall.SIGKILL, nil, "Ss"},
+		{2, 0, syscall.SIGKILL, nil, "S"},
+		{pid, 0, syscall.SIGKILL, nil, ""},
+		{pid, 0, 0, syscall.ESRCH, ""},
+	}
+	for _, test := range tests {
+		if err := pt.Signal(test.pid, test.uid, test.sig); err != test.err {
+			t.Errorf("Signal %v to %v: expected %v, got %v", test.sig, test.pid, test.err, err)
+		}
+		if p, _ := pt.Get(test.pid); p.State != test.state {
+			t.Errorf("Signal %v to %v: expected state %q, got %q", test.sig, test.pid, test.state, p.State)
+		}
+	}
+}
+
+func TestPidExhaustion(t *testing.T) {
+	sh := newTestShell(t)
+	pt := newProcessTable(time.Now().Add(-time.Hour))
+	sh.sys.procs = pt
+	for pid := minPid; pid < maxPid; pid++ {
+		if _, used := pt.procs[pid]; !used {
+			pt.procs[pid] = &Process{PID: pid, PPID: 1, TTY: "?", State: "S"}
+		}
+	}
+	if _, err := pt.Spawn(1, 0, []string{"sleep"}); err != syscall.EAGAIN {
+		t.Errorf("Spawn with all PIDs used: %v", err)
+	}
+	_, errOut, status := runTestLine(t, sh, "cat /etc/hostname")
+	if status != 126 || errOut != "-bash: fork: retry: Resource temporarily unavailable\n-bash: fork: Resource temporarily unavailable\n" {
+		t.Errorf("Command with all PIDs used exited with %v: %q", status, errOut)
+	}
+	pt.Exit(maxPid - 1)
+	if pid, err := pt.Spawn(1, 0, []string{"sleep"}); pid != maxPid-1 || err != nil {
+		t.Errorf("Spawn with one free PID returned %v, %v", pid, err)
+	}
+}
+
+func TestLayerProcesses(t *testing.T) {
+	sh := newTestShell(t)
+	sh.sys.layer = "session/a"
+	procs := sh.sys.Processes()
+	pid, _ := procs.Spawn(1, 1000, []string{"./xmrig"})
+	sh.sys.SetHostname("other")
+	if sh.sys.Processes() != procs {
+		t.Error("Process table changed with the host name")
+	}
+	if _, found := layerProcesses("session/b").Get(pid); found {
+		t.Error("Process seen in the table of another layer")
+	}
+	DropProcesses("session/a")
+	if layerProcesses("session/a") == procs {
+		t.Error("Process table of dropped layer kept")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	sh := newTestShell(t)
+	afero.WriteFile(sh.sys.FSys(), "/home/mk/.bash_history", []byte("uname -a\n"), 0600)
+	sh.initHistory()
+	for _, line := range []string{"cd /boot", " secret", "echo a b", "echo a b"} {
+		sh.addHistory(line)
+	}
+	tests := []struct {
+		line, expanded string
+	}{
+		{"!!", "echo a b"},
+		{"sudo !! | cat", "sudo echo a b | cat"},
+		{"ls !$", "ls b"},
+		{"!1; !-2", "uname -a; cd /boot"},
+		{"!un", "uname -a"},
+		{"echo '!!' hi! [ ! x ]", "echo '!!' hi! [ ! x ]"},
+	}
+	for _, test := range tests {
+		if expanded, err := sh.expandHistory(test.line); err != nil || expanded != test.expanded {
+			t.Errorf("%v: expected %q, got %q %v", test.line, test.expanded, expanded, err)
+		}
+	}
+	if _, err := sh.expandHistory("!nosuch"); err == nil || err.Error() != "!nosuch: event not found" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	out, _, _ := runTestLine(t, sh, "history 2")
+	if out != "    2  cd /boot\n    3  echo a b\n" {
+		t.Errorf("Unexpected history %q", out)
+	}
+	// The file is written on exit only
+	content, _ := afero.ReadFile(sh.sys.FSys(), "/home/mk/.bash_history")
+	if string(content) != "uname -a\n" {
+		t.Errorf("History file written before exit %q", content)
+	}
+	runTestLine(t, sh, "HISTSIZE=2")
+	sh.addHistory("id")
+	if err := sh.saveHistory(); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = afero.ReadFile(sh.sys.FSys(), "/home/mk/.bash_history")
+	if string(content) != "echo a b\nid\n" {
+		t.Errorf("Unexpected history file %q", content)
+	}
+	runTestLine(t, sh, "unset HISTFILE")
+	sh.addHistory("w")
+	sh.saveHistory()
+	content, _ = afero.ReadFile(sh.sys.FSys(), "/home/mk/.bash_history")
+	if string(content) != "echo a b\nid\n" {
+		t.Errorf("History saved without HISTFILE %q", content)
+	}
+
+	// The arrow keys recall the history of the file
+	var termOut bytes.Buffer
+	term := sh.newTerminal(strings.NewReader("\x1b[A\x1b[A\r"), &termOut)
+	if line, err := term.ReadLine(); line != "id" || err != nil {
+		t.Errorf("Recalled %q, %v", line, err)
+	}
+	if strings.Count(termOut.String(), "\r\n") != 1 {
+		t.Errorf("History echoed while seeding %q", termOut.String())
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	sh := newTestShell(t)
+	tests := []struct {
+		line, expected string
+	}{
+		{"ech", "echo "},
+		{"cd /bo", "cd /boot/"},
+		{"ls /boot/c", "ls /boot/config-4.4.0-104-generic "},
+		{"cat /boot/grub/nosuch", "cat /boot/grub/nosuch"},
+		{"cd /boot; echo hi | ca", "cd /boot; echo hi | cat "},
+		{"ls ../../bo", "ls ../../boot/"},
+		{"ls /boot/i", "ls /boot/initrd.img-4.4.0-104-generic "},
+	}
+	for _, test := range tests {
+		line, pos, ok := sh.complete(test.line, len(test.line), '\t')
+		if !ok || line != test.expected || pos != len(line) {
+			t.Errorf("%v: expected %q, got %q", test.line, test.expected, line)
+		}
+	}
+	if line, pos, _ := sh.complete("ls /boot/ x", 9, '\t'); line != "ls /boot/ x" || pos != 9 {
+		t.Errorf("Ambiguous completion changed line to %q", line)
+	}
+	if _, _, ok := sh.complete("ls", 2, 'a'); ok {
+		t.Errorf("Non-tab key handled by completion")
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	sh := newTestShell(t)
+	sh.sudoCached = true
+	tests := []struct {
+		line, prompt string
+	}{
+		{"", "mk@spr1139:~$ "},
+		{"cd /boot/grub", "mk@spr1139:/boot/grub$ "},
+		{"PS1='[\\u@\\h \\W]\\$ '", "[mk@spr1139 grub]$ "},
+		{"unset PS1; cd ~; sudo -i", "root@spr1139:/home/mk# "},
+		{"exit", "mk@spr1139:~$ "},
+	}
+	for _, test := range tests {
+		runTestLine(t, sh, test.line)
+		if prompt := sh.renderPrompt(); prompt != test.prompt {
+			t.Errorf("%v: expected prompt %q, got %q", test.line, test.prompt, prompt)
+		}
+	}
+	sh.sys.SetHostname("web01.example.com")
+	if prompt := sh.renderPrompt(); prompt != "mk@web01:~$ " {
+		t.Errorf("Prompt not updated after hostname change: %q", prompt)
+	}
+}
+
+func TestSwitchUser(t *testing.T) {
+	sh := newTestShell(t)
+	_, errOut, status := runTestLine(t, sh, "sudo -i")
+	if status != 1 || sh.sys.CurrentUser() != 1000 {
+		t.Errorf("sudo without password succeeded %q", errOut)
+	}
+	sh.sudoCached = true
+	out, _, _ := runTestLine(t, sh, "sudo su -; echo $USER $HOME; exit; echo $USER; sudo printenv SUDO_USER")
+	if out != "root /root\nlogout\nmk\nmk\n" || sh.sys.CurrentUser() != 1000 {
+		t.Errorf("Unexpected output %q", out)
+	}
+	out, errOut, _ = runTestLine(t, sh, "echo password | su -c 'echo $USER' root; echo $USER")
+	if out != "root\nmk\n" || errOut != "Password: " {
+		t.Errorf("Unexpected output %q %q", out, errOut)
+	}
+	if len(sh.identities) != 0 || sh.exited {
+		t.Errorf("Unexpected shell state")
+	}
+}
+
+// testChannel is a ssh.Channel with stdin from a reader and output kept
+// in buffers
+type testChannel struct {
+	io.Reader
+	out, err bytes.Buffer
+}
+
+func (c *testChannel) Write(p []byte) (int, error) { return c.out.Write(p) }
+func (c *testChannel) Close() error                { return nil }
+func (c *testChannel) CloseWrite() error           { return nil }
+func (c *testChannel) Stderr() io.ReadWriter       { return &c.err }
+func (c *testChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	return true, nil
+}
+
+func TestExec(t *testing.T) {
+	sh := newTestShell(t)
+	quit := make(chan int, 1)
+	sh.termSignal = quit
+	ch := &testChannel{Reader: strings.NewReader("uploaded\n")}
+	sh.sys.sshChan = ch
+	sh.HandleExec(`cat > "up file"; echo "a  b" | cat; cat < up\ file; nosuch; exit 3; echo no`, nil, false)
+	if status := <-quit; status != 3 {
+		t.Errorf("Unexpected exit status %v", status)
+	}
+	if ch.out.String() != "a  b\nuploaded\n" || ch.err.String() != "bash: nosuch: command not found\n" {
+		t.Errorf("Unexpected output %q %q", ch.out.String(), ch.err.String())
+	}
+}
+
+func TestExecBackground(t *testing.T) {
+	sh := newTestShell(t)
+	sh.sys.layer = "exectest"
+	quit := make(chan int, 1)
+	sh.termSignal = quit
+	sh.sys.sshChan = &testChannel{Reader: strings.NewReader("")}
+	afero.WriteFile(sh.sys.FSys(), "/home/mk/xmrig", elfHeader(), 0755)
+	procs := sh.sys.Processes()
+	// The session ends as soon as the command returns, before the jobs run
+	sh.HandleExec(`cd /home/mk; nohup ./xmrig >/dev/null 2>&1 & ./xmrig &`, nil, false)
+	<-quit
+	var jobs []Process
+	for _, p := range procs.List() {
+		if p.SID == sh.pid && p.PID != sh.pid {
+			jobs = append(jobs, p)
+		}
+		if p.PID == sh.pid || strings.HasPrefix(p.Cmdline(), "sshd: mk") {
+			t.Errorf("Process %+v of the session left after exec", p)
+		}
+	}
+	if len(jobs) != 2 || !jobs[0].NoHup || jobs[1].NoHup {
+		t.Errorf("Unexpected jobs after exec %+v", jobs)
+	}
+	sh.bg.Wait()
+}
+
+func TestRedirectFsEvent(t *testing.T) {
+	sh := newTestShell(t)
+	logger, hook := test.NewNullLogger()
+	sh.sys.log = log.NewEntry(logger)
+	if _, stderr, status := runTestLine(t, sh, "echo foo > /home/mk/x; echo bar >> /home/mk/x"); status != 0 {
+		t.Fatalf("Redirection failed: %v", stderr)
+	}
+	var ops []string
+	for _, e := range hook.AllEntries() {
+		if e.Message == "Filesystem modified" && e.Data["path"] == "/home/mk/x" {
+			ops = append(ops, fmt.Sprint(e.Data["op"]))
+		}
+	}
+	if strings.Join(ops, " ") != "write append" {
+		t.Errorf("Unexpected filesystem events %v", ops)
+	}
+}
+
+func TestRedirectCapture(t *testing.T) {
+	sh := newTestShell(t)
+	logger, hook := test.NewNullLogger()
+	sh.sys.log = log.NewEntry(logger)
+	store, _ := capture.NewStore(afero.NewMemMapFs(), "/")
+	capture.SetDefault(store)
+	defer capture.SetDefault(nil)
+	runTestLine(t, sh, `echo '#!/bin/sh' > /home/mk/x; echo id >> /home/mk/x; echo x >/dev/null; echo x >/dev/shm/z; echo y >/home/mk/y`)
+	// Files removed before the end of the command line are captured too
+	sh.sys.FSys().Remove("/home/mk/y")
+	sh.sys.redirects.flush(sh.sys, false)
+	runTestLine(t, sh, `echo w >> /home/mk/x`)
+	sh.sys.redirects.flush(sh.sys, true)
+	runTestLine(t, sh, `echo v >> /dev/shm/z`)
+	var sizes []string
+	for _, e := range hook.AllEntries() {
+		if e.Message == "File captured" && e.Data["method"] == "redirect" {
+			sizes = append(sizes, fmt.Sprintf("%v:%v", e.Data["path"], e.Data["size"]))
+		}
+	}
+	if strings.Join(sizes, " ") != "/home/mk/x:13 /dev/shm/z:2 /home/mk/y:2 /home/mk/x:15 /dev/shm/z:4" {
+		t.Errorf("Unexpected captures %v", sizes)
+	}
+}
+
+func TestCd(t *testing.T) {
+	sh := newTestShell(t)
+	tests := []struct {
+		line, stdout, stderr string
+		status               int
+	}{
+		{"cd /etc; cd; echo $PWD $OLDPWD", "/home/mk /etc\n", "", 0},
+		{"cd /etc; cd -", "/home/mk\n", "", 0},
+		{"cd ~mk/..; echo $PWD", "/home\n", "", 0},
+		{"cd /nonexistent", "", "-bash: cd: /nonexistent: No such file or directory\n", 1},
+		{"cd /etc/hostname", "", "-bash: cd: /etc/hostname: Not a directory\n", 1},
+		{"HOME=; cd; echo $PWD", "/home\n", "", 0},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := runTestLine(t, sh, test.line)
+		if stdout != test.stdout || stderr != test.stderr || status != test.status {
+			t.Errorf("%q: got %q %q %v", test.line, stdout, stderr, status)
+		}
+	}
+	delete(sh.sys.envVars, "HOME")
+	if _, stderr, _ := runTestLine(t, sh, "cd"); stderr != "-bash: cd: HOME not set\n" {
+		t.Errorf("Unexpected error %q", stderr)
+	}
+}
+
+func TestPermission(t *testing.T) {
+	sh := newTestShell(t)
+	tests := []struct {
+		line, stdout, stderr string
+		status               int
+	}{
+		{"cat < /etc/shadow", "", "-bash: /etc/shadow: Permission denied\n", 1},
+		{"echo x > /etc/passwd", "", "-bash: /etc/passwd: Permission denied\n", 1},
+		{"cd /etc/ssl/private", "", "-bash: cd: /etc/ssl/private: Permission denied\n", 1},
+		{"echo x > /home/mk/x; cat < /home/mk/x", "x\n", "", 0},
+	}
+	for _, test := range tests {
+		stdout, stderr, status := runTestLine(t, sh, test.line)
+		if stdout != test.stdout || stderr != test.stderr || status != test.status {
+			t.Errorf("%q: got %q %q %v", test.line, stdout, stderr, status)
+		}
+	}
+	sh.sudoCached = true
+	if out, _, _ := runTestLine(t, sh, "sudo -s; cat < /etc/shadow; exit"); len(out) == 0 {
+		t.Error("Root cannot read /etc/shadow")
+	}
+}
@@ -0,0 +1,250 @@
+package os
+
+import (
+	"fmt"
+	"io"
+	pathlib "path"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// identity is the state of the shell saved when switching to another user
+type identity struct {
+	sys   System
+	login bool
+}
+
+// switchUser changes the user of the shell, which stands for the nested
+// shell started by su or sudo -i. exit returns to the previous user
+func (sh *Shell) switchUser(u User, login bool) {
+	sh.identities = append(sh.identities, identity{*sh.sys.clone(), login})
+	sh.sys.userId = u.UID
+	env := loginEnv(u)
+	if login {
+		// Login shell starts with a clean environment in home directory
+		if term, set := sh.sys.envVars["TERM"]; set {
+			env["TERM"] = term
+		}
+		sh.sys.envVars = env
+		if isDir, _ := afero.IsDir(sh.sys.FSys(), u.Homedir); isDir {
+			sh.sys.cwd = u.Homedir
+			sh.sys.envVars["PWD"] = u.Homedir
+		}
+	} else {
+		for _, k := range []string{"HOME", "SHELL", "USER", "LOGNAME"} {
+			sh.sys.envVars[k] = env[k]
+		}
+	}
+	sh.log.WithField("user", u.Name).Infof("User switched to %v", u.Name)
+}
+
+// restoreUser returns to the user before the last switchUser. The host
+// name is kept since it is not part of the identity
+func (sh *Shell) restoreUser() (identity, bool) {
+	if len(sh.identities) == 0 {
+		return identity{}, false
+	}
+	id := sh.identities[len(sh.identities)-1]
+	sh.identities = sh.identities[:len(sh.identities)-1]
+	host := sh.sys.hostName
+	*sh.sys = id.sys
+	sh.sys.hostName = host
+	sh.log.WithField("user", sh.userName()).Infof("User switched back to %v", sh.userName())
+	return id, true
+}
+
+// askPassword prompts for the password and logs it. Any password is
+// accepted so that the attacker can carry on
+func (sh *Shell) askPassword(prompt string, stdio *procIO) bool {
+	var password string
+	if _, isTTY := stdio.in.(ttyReader); isTTY && sh.terminal != nil {
+		p, err := sh.terminal.ReadPassword(prompt)
+		if err != nil {
+			return false
+		}
+		password = p
+	} else {
+		// Password is read from stdin like sudo -S. Reading byte by byte
+		// leaves the rest of the input to the next command
+		fmt.Fprint(stdio.err, prompt)
+		var line []byte
+		b := make([]byte, 1)
+		for {
+			n, err := stdio.in.Read(b)
+			if n > 0 && b[0] != '\n' {
+				line = append(line, b[0])
+			}
+			if n > 0 && b[0] == '\n' || err == io.EOF && len(line) > 0 {
+				break
+			}
+			if err != nil {
+				return false
+			}
+		}
+		password = strings.TrimSuffix(string(line), "\r")
+	}
+	sh.log.WithField("password", password).Infof("User entered password for %v", sh.userName())
+	return true
+}
+
+func builtinSu(sh *Shell, args []string, stdio *procIO) int {
+	login := false
+	name := "root"
+	var command *string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-" || arg == "-l" || arg == "--login":
+			login = true
+		case arg == "-c" || arg == "--command":
+			if i+1 >= len(args) {
+				fmt.Fprintln(stdio.err, "su: option requires an argument -- 'c'")
+				return 1
+			}
+			i++
+			command = &args[i]
+		case arg == "-s" || arg == "--shell":
+			i++
+		case strings.HasPrefix(arg, "-"):
+			continue
+		default:
+			name = arg
+		}
+	}
+	u, exists := usernameMapping[name]
+	if !exists {
+		fmt.Fprintf(stdio.err, "No passwd entry for user '%v'\n", name)
+		return 1
+	}
+	if sh.sys.CurrentUser() != 0 && !sh.askPassword("Password: ", stdio) {
+		fmt.Fprintln(stdio.err, "su: Authentication failure")
+		return 1
+	}
+	if command != nil {
+		sub := sh.newSubshell()
+		sub.switchUser(u, login)
+		return sub.runScript(strings.NewReader(*command), stdio)
+	}
+	sh.switchUser(u, login)
+	return 0
+}
+
+func builtinSudo(sh *Shell, args []string, stdio *procIO) int {
+	name := "root"
+	login, shell, list, validate := false, false, false, false
+	i := 0
+options:
+	for ; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			i++
+			break options
+		case arg == "--login":
+			login = true
+		case arg == "--shell":
+			shell = true
+		case arg == "--list":
+			list = true
+		case arg == "--user" && i+1 < len(args):
+			i++
+			name = args[i]
+		case arg == "--version":
+			fmt.Fprintln(stdio.out, "Sudo version 1.8.16")
+			return 0
+		case strings.HasPrefix(arg, "--"):
+			continue
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for j := 1; j < len(arg); j++ {
+				switch arg[j] {
+				case 'i':
+					login = true
+				case 's':
+					shell = true
+				case 'l':
+					list = true
+				case 'v':
+					validate = true
+				case 'k', 'K':
+					sh.sudoCached = false
+				case 'V':
+					fmt.Fprintln(stdio.out, "Sudo version 1.8.16")
+					return 0
+				case 'u':
+					if j+1 < len(arg) {
+						name = arg[j+1:]
+					} else if i+1 < len(args) {
+						i++
+						name = args[i]
+					}
+					j = len(arg)
+				}
+			}
+		default:
+			break options
+		}
+	}
+	cmd := args[i:]
+	if len(cmd) == 0 && !login && !shell && !list && !validate {
+		if len(args) > 0 {
+			// sudo -k alone only resets the cached credential
+			return 0
+		}
+		fmt.Fprintln(stdio.err, "usage: sudo -h | -K | -k | -V")
+		fmt.Fprintln(stdio.err, "usage: sudo -v [-AknS] [-g group] [-h host] [-p prompt] [-u user]")
+		fmt.Fprintln(stdio.err, "usage: sudo -l [-AknS] [-g group] [-h host] [-p prompt] [-U user] [-u user] [command]")
+		fmt.Fprintln(stdio.err, "usage: sudo [-AbEHknPS] [-r role] [-t type] [-C num] [-g group] [-h host] [-p prompt] [-u user] [VAR=value] [-i|-s] [<command>]")
+		return 1
+	}
+	u, exists := usernameMapping[name]
+	if !exists {
+		fmt.Fprintf(stdio.err, "sudo: unknown user: %v\n", name)
+		return 1
+	}
+	if sh.sys.CurrentUser() != 0 && !sh.sudoCached {
+		if !sh.askPassword(fmt.Sprintf("[sudo] password for %v: ", sh.userName()), stdio) {
+			fmt.Fprintln(stdio.err, "sudo: no tty present and no askpass program specified")
+			return 1
+		}
+		sh.sudoCached = true
+	}
+	switch {
+	case list:
+		host := sh.sys.Hostname()
+		fmt.Fprintf(stdio.out, "Matching Defaults entries for %v on %v:\n", sh.userName(), host)
+		fmt.Fprintln(stdio.out, `    env_reset, mail_badpass, secure_path=/usr/local/sbin\:/usr/local/bin\:/usr/sbin\:/usr/bin\:/sbin\:/bin\:/snap/bin`)
+		fmt.Fprintf(stdio.out, "\nUser %v may run the following commands on %v:\n", sh.userName(), host)
+		fmt.Fprintln(stdio.out, "    (ALL : ALL) ALL")
+		return 0
+	case validate && len(cmd) == 0:
+		return 0
+	case len(cmd) == 0 || len(cmd) == 1 && isShellName(cmd[0]):
+		sh.switchUser(u, login)
+		return 0
+	}
+	// Run the command as the target user
+	orig := sh.sys.clone()
+	depth := len(sh.identities)
+	sh.sys.userId = u.UID
+	for k, v := range map[string]string{"USER": u.Name, "LOGNAME": u.Name, "USERNAME": u.Name,
+		"SUDO_USER": orig.Getenv("USER"), "SUDO_COMMAND": strings.Join(cmd, " ")} {
+		sh.sys.envVars[k] = v
+	}
+	status := sh.execArgs(cmd, stdio)
+	if len(sh.identities) > depth {
+		// The command was su, exit should return to the user before sudo
+		sh.identities[depth].sys = *orig
+	} else {
+		sh.sys.userId = orig.userId
+		sh.sys.envVars = orig.envVars
+	}
+	return status
+}
+
+func isShellName(name string) bool {
+	switch pathlib.Base(name) {
+	case "sh", "bash", "dash", "ash":
+		return true
+	}
+	return false
+}
@@ -7,8 +7,11 @@ import (
 	"io/ioutil"
 	"os"
 	pathlib "path"
+	"syscall"
 
+	"github.com/mkishere/sshsyrup/util/capture"
 	"github.com/mkishere/sshsyrup/util/termlogger"
+	"github.com/mkishere/sshsyrup/virtualfs"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
@@ -51,6 +54,21 @@ type System struct {
 	log           *log.Entry
 	sessionLog    termlogger.LogHook
 	hostName      string
+	// layer is the key of the writable layer of the filesystem, which the
+	// process table belongs to
+	layer string
+	procs *ProcessTable
+	// pid is the process running the current command
+	pid int
+	// shellDepth is the depth of the shell running the current command,
+	// which the shells it starts are nested in
+	shellDepth int
+	// mounts are the filesystems of the session by mount point, other
+	// than the image and those generated for each process
+	mounts map[string]afero.Fs
+	// redirects are the files written by redirection to be captured, shared
+	// by the subshells of the session
+	redirects *redirectQueue
 }
 
 type Sys interface {
@@ -67,6 +85,13 @@ type Sys interface {
 	CurrentUser() int
 	CurrentGroup() int
 	Hostname() string
+	SetHostname(name string) error
+	Getpid() int
+	Processes() *ProcessTable
+	FsEvent(op, path string, fields log.Fields)
+	LogEvent(msg string, fields log.Fields)
+	Capture(data []byte, src capture.Source)
+	Mounts() []virtualfs.Mount
 }
 type stdoutWrapper struct {
 	io.Writer
@@ -78,31 +103,80 @@ type sysLogWrapper struct {
 }
 
 func (sys *sysLogWrapper) In() io.Reader  { return sys.StdIOErr.In() }
-func (sys *sysLogWrapper) Out() io.Writer { return stdoutWrapper{sys.StdIOErr.Out()} }
-func (sys *sysLogWrapper) Err() io.Writer { return stdoutWrapper{sys.StdIOErr.Err()} }
+func (sys *sysLogWrapper) Out() io.Writer { return sys.StdIOErr.Out() }
+func (sys *sysLogWrapper) Err() io.Writer { return sys.StdIOErr.Err() }
 
 // NewSystem initializer a system object containing current user context: ID,
-// home directory, terminal dimensions, etc.
-func NewSystem(user, host string, fs afero.Fs, channel ssh.Channel, width, height int, log *log.Entry) *System {
+// home directory, terminal dimensions, etc. Layer is the key of the
+// writable layer fs has
+func NewSystem(user, host, layer string, fs afero.Fs, channel ssh.Channel, width, height int, log *log.Entry) *System {
 	if _, exists := IsUserExist(user); !exists {
 		CreateUser(user, "password")
 	}
-	aferoFs := afero.Afero{fs}
-	if exists, _ := aferoFs.DirExists(usernameMapping[user].Homedir); !exists {
-		aferoFs.MkdirAll(usernameMapping[user].Homedir, 0755)
+	// The ownership of the files created by the user is kept by the
+	// filesystem, or in the session if it cannot
+	if _, ok := baseFs(fs).(Chowner); !ok {
+		fs = virtualfs.NewOwnerFs(baseFs(fs))
+	}
+	u := usernameMapping[user]
+	if exists, _ := afero.DirExists(fs, u.Homedir); !exists {
+		fs.MkdirAll(u.Homedir, 0755)
+		Chown(fs, u.Homedir, u.UID, u.GID)
+	}
+	// /tmp is in the layer so that the files dropped there are kept
+	if exists, _ := afero.DirExists(fs, "/tmp"); !exists {
+		fs.Mkdir("/tmp", 0777)
+		fs.Chmod("/tmp", os.ModeSticky|0777)
 	}
 
 	return &System{
-		cwd:      usernameMapping[user].Homedir,
-		fSys:     aferoFs,
-		envVars:  map[string]string{},
-		sshChan:  channel,
-		width:    width,
-		height:   height,
-		log:      log,
-		userId:   usernameMapping[user].UID,
-		hostName: host,
+		cwd:       u.Homedir,
+		fSys:      fs,
+		envVars:   loginEnv(u),
+		sshChan:   channel,
+		width:     width,
+		height:    height,
+		log:       log,
+		userId:    u.UID,
+		hostName:  host,
+		layer:     layer,
+		procs:     layerProcesses(layer),
+		mounts:    sessionMounts(),
+		redirects: newRedirectQueue(),
+	}
+}
+
+// loginEnv returns the initial environment of a login shell of the user
+func loginEnv(u User) map[string]string {
+	shell := u.Shell
+	if len(shell) == 0 {
+		shell = "/bin/sh"
+	}
+	path := "/usr/local/bin:/usr/bin:/bin:/usr/local/games:/usr/games"
+	if u.UID == 0 {
+		path = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
 	}
+	return map[string]string{
+		"HOME":    u.Homedir,
+		"USER":    u.Name,
+		"LOGNAME": u.Name,
+		"SHELL":   shell,
+		"PATH":    path,
+		"PWD":     u.Homedir,
+		"MAIL":    "/var/mail/" + u.Name,
+		"LANG":    "en_US.UTF-8",
+		"SHLVL":   "1",
+	}
+}
+
+// clone returns a copy of the system for running a subshell
+func (sys *System) clone() *System {
+	s := *sys
+	s.envVars = make(map[string]string, len(sys.envVars))
+	for k, v := range sys.envVars {
+		s.envVars[k] = v
+	}
+	return &s
 }
 
 // Getcwd gets current working directory
@@ -116,13 +190,35 @@ func (sys *System) Chdir(path string) error {
 		path = sys.cwd + "/" + path
 	}
 	path = pathlib.Clean(path)
-	if exists, err := afero.DirExists(sys.fSys, path); err == nil && !exists {
-		return os.ErrNotExist
-	} else if err != nil {
-		return err
+	// The working directory keeps the logical path, while symbolic links
+	// to directories are followed to check the target
+	target := path
+	fs := sys.FSys()
+	for i := 0; ; i++ {
+		fi, err := fs.Stat(target)
+		switch {
+		case err != nil:
+			return err
+		case fi.IsDir():
+			if err := Access(fs, target, virtualfs.AccessExec); err != nil {
+				return err
+			}
+			sys.cwd = path
+			return nil
+		case fi.Mode()&os.ModeSymlink == 0:
+			return &os.PathError{Op: "chdir", Path: path, Err: syscall.ENOTDIR}
+		case i == 40:
+			return &os.PathError{Op: "chdir", Path: path, Err: syscall.ELOOP}
+		}
+		link, err := Readlink(fs, target)
+		if err != nil {
+			return err
+		}
+		if !pathlib.IsAbs(link) {
+			link = pathlib.Join(pathlib.Dir(target), link)
+		}
+		target = link
 	}
-	sys.cwd = path
-	return nil
 }
 
 func (sys *System) CurrentUser() int { return sys.userId }
@@ -136,6 +232,55 @@ func (sys *System) Hostname() string {
 	return sys.hostName
 }
 
+// SetHostname changes the host name shown in prompt and commands
+func (sys *System) SetHostname(name string) error {
+	sys.hostName = name
+	return nil
+}
+
+// Getpid returns the PID of the process running the command
+func (sys *System) Getpid() int { return sys.pid }
+
+// Processes returns the process table of the host
+func (sys *System) Processes() *ProcessTable {
+	if sys.procs == nil {
+		return layerProcesses(sys.layer)
+	}
+	return sys.procs
+}
+
+// FsEvent records a change made to the filesystem by the current command,
+// so that what the intruder changed can be reconstructed from the log
+func (sys *System) FsEvent(op, path string, fields log.Fields) {
+	if sys.log == nil {
+		return
+	}
+	sys.log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+		"uid":  sys.userId,
+		"pid":  sys.pid,
+	}).WithFields(fields).Info("Filesystem modified")
+}
+
+// LogEvent logs the event reported by the command, e.g. a download, with
+// the user and process
+func (sys *System) LogEvent(msg string, fields log.Fields) {
+	if sys.log == nil {
+		return
+	}
+	sys.log.WithFields(log.Fields{
+		"uid": sys.userId,
+		"pid": sys.pid,
+	}).WithFields(fields).Info(msg)
+}
+
+// Capture saves the file fetched or written by the command to the capture
+// store
+func (sys *System) Capture(data []byte, src capture.Source) {
+	capture.Capture(sys.log, data, src)
+}
+
 // In returns a io.Reader that represent stdin
 func (sys *System) In() io.Reader { return sys.sshChan }
 
@@ -150,7 +295,11 @@ func (sys *System) Err() io.Writer {
 
 func (sys *System) IOStream() io.ReadWriter { return sys.sshChan }
 
-func (sys *System) FSys() afero.Fs { return sys.fSys }
+// FSys returns the filesystem as accessed by the current user, which
+// checks the permission of the files
+func (sys *System) FSys() afero.Fs {
+	return virtualfs.NewPermFs(sys.mountFs(), Credentials(sys.userId))
+}
 
 func (sys *System) Width() int { return sys.width }
 
@@ -199,12 +348,28 @@ func (sys *System) SetEnv(key, value string) error {
 	return nil
 }
 
+// Getenv returns the value of the environment variable
+func (sys *System) Getenv(key string) string {
+	return sys.envVars[key]
+}
+
+// UnsetEnv removes the variable from the environment
+func (sys *System) UnsetEnv(key string) error {
+	delete(sys.envVars, key)
+	return nil
+}
+
 func (sys *System) Exec(path string, args []string) (int, error) {
 	return sys.exec(path, args, nil)
 }
 
 func (sys *System) exec(path string, args []string, io termlogger.StdIOErr) (int, error) {
 	cmd := pathlib.Base(path)
+	// If logger is not nil, redirect IO to it
+	var cmdSys Sys = sys
+	if io != nil {
+		cmdSys = &sysLogWrapper{io, sys}
+	}
 	if execFunc, ok := funcMap[cmd]; ok {
 
 		defer func() {
@@ -214,30 +379,22 @@ func (sys *System) exec(path string, args []string, io termlogger.StdIOErr) (int
 					"args":  args,
 					"error": r,
 				}).Error("Command has crashed")
-				sys.Err().Write([]byte("Segmentation fault\n"))
+				cmdSys.Err().Write([]byte("Segmentation fault\n"))
 			}
 		}()
-		var res int
-		// If logger is not nil, redirect IO to it
-		if io != nil {
-			loggedSys := &sysLogWrapper{io, sys}
-			res = execFunc.Exec(args, loggedSys)
-		} else {
-			res = execFunc.Exec(args, sys)
-		}
-		return res, nil
+		return execFunc.Exec(args, cmdSys), nil
 	} else if output, inList := fakeFuncList[cmd]; inList {
 		// Print random error message
 		// Make use of golang map random nature :)
 		if len(output) == 0 {
-			return printRandomError(sys)
+			return printRandomError(cmdSys)
 		}
 		// Read file and write output
 		content, err := ioutil.ReadFile(output)
 		if err != nil {
-			return printRandomError(sys)
+			return printRandomError(cmdSys)
 		}
-		sys.Out().Write(content)
+		cmdSys.Out().Write(content)
 		return 0, nil
 	}
 
@@ -266,10 +423,62 @@ func RegisterCommandOutput(cmd, pathToOutput string) {
 	fakeFuncList[cmd] = pathToOutput
 }
 
-func printRandomError(sys *System) (int, error) {
+func printRandomError(sys Sys) (int, error) {
 	for msg := range errMsgList {
 		sys.Err().Write([]byte(msg + "\n"))
 		break
 	}
 	return 1, nil
 }
+
+// absPath resolves path relative to the working directory cwd
+func absPath(cwd, path string) string {
+	if !pathlib.IsAbs(path) {
+		path = pathlib.Join(cwd, path)
+	}
+	return pathlib.Clean(path)
+}
+
+// ErrnoString returns the message of the filesystem error like strerror,
+// as printed by coreutils
+func ErrnoString(err error) string {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	switch {
+	case err == syscall.EPERM:
+		return "Operation not permitted"
+	case err == syscall.ENOTEMPTY:
+		return "Directory not empty"
+	case os.IsNotExist(err):
+		return "No such file or directory"
+	case os.IsPermission(err):
+		return "Permission denied"
+	case os.IsExist(err):
+		return "File exists"
+	case err == syscall.EISDIR:
+		return "Is a directory"
+	case err == syscall.ENOTDIR:
+		return "Not a directory"
+	case err == syscall.EINVAL:
+		return "Invalid argument"
+	case err == syscall.ELOOP:
+		return "Too many levels of symbolic links"
+	case err == syscall.ENOSPC:
+		return "No space left on device"
+	case err == syscall.ENXIO:
+		return "No such device or address"
+	case err == syscall.EBUSY:
+		return "Device or resource busy"
+	case err == syscall.EXDEV:
+		return "Invalid cross-device link"
+	case err == syscall.EROFS:
+		return "Read-only file system"
+	}
+	return err.Error()
+}
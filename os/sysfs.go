@@ -0,0 +1,107 @@
+package os
+
+import (
+	"fmt"
+	"os"
+	pathlib "path"
+	"sort"
+	"time"
+
+	"github.com/mkishere/sshsyrup/virtualfs"
+	"github.com/spf13/afero"
+)
+
+// newSysFs returns the minimal /sys of the persona, with its network
+// interfaces and CPUs
+func newSysFs() afero.Fs {
+	persona := CurrentPersona()
+	files := make(map[string]string)
+	links := make(map[string]string)
+	dirs := []string{"/block", "/bus", "/dev", "/firmware", "/fs", "/hypervisor", "/kernel", "/module", "/power"}
+
+	// The interfaces are linked from /sys/class/net to their devices, as on
+	// a virtual machine of Xen
+	for i, dev := range []struct {
+		name, dir, mac, flags, operstate string
+		typ, mtu, txQueue                int
+	}{
+		{"lo", "/devices/virtual/net/lo", "00:00:00:00:00:00", "0x9", "unknown", 772, 65536, 1},
+		{persona.Interface, "/devices/vif-0/net/" + persona.Interface, persona.MAC, "0x1003", "up", 1, 9001, 1000},
+	} {
+		links["/class/net/"+dev.name] = "../.." + dev.dir
+		for name, val := range map[string]string{
+			"address":      dev.mac,
+			"addr_len":     "6",
+			"broadcast":    "ff:ff:ff:ff:ff:ff",
+			"carrier":      "1",
+			"dev_id":       "0x0",
+			"flags":        dev.flags,
+			"ifindex":      fmt.Sprint(i + 1),
+			"iflink":       fmt.Sprint(i + 1),
+			"mtu":          fmt.Sprint(dev.mtu),
+			"operstate":    dev.operstate,
+			"tx_queue_len": fmt.Sprint(dev.txQueue),
+			"type":         fmt.Sprint(dev.typ),
+		} {
+			files[dev.dir+"/"+name] = val
+		}
+	}
+
+	cpus := "0"
+	if persona.CPUs > 1 {
+		cpus = fmt.Sprintf("0-%d", persona.CPUs-1)
+	}
+	for _, name := range []string{"online", "possible", "present"} {
+		files["/devices/system/cpu/"+name] = cpus
+	}
+	files["/devices/system/cpu/kernel_max"] = "8191"
+	for i := 0; i < persona.CPUs; i++ {
+		dirs = append(dirs, fmt.Sprintf("/devices/system/cpu/cpu%d", i))
+	}
+	files["/kernel/uevent_seqnum"] = "1722"
+	return staticFs("sysfs", files, links, dirs)
+}
+
+// staticFs returns a read-only filesystem of the files with their content
+// and the links with their targets, and the directories holding them or
+// listed in dirs
+func staticFs(name string, files, links map[string]string, dirs []string) afero.Fs {
+	now := time.Now()
+	nodes := map[string]*virtualfs.Node{}
+	entries := map[string][]string{"/": nil}
+	var add func(p string)
+	add = func(p string) {
+		if p == "/" {
+			return
+		}
+		dir := pathlib.Dir(p)
+		if _, exists := entries[dir]; !exists {
+			add(dir)
+		}
+		entries[dir] = append(entries[dir], pathlib.Base(p))
+	}
+	for p, content := range files {
+		data := []byte(content + "\n")
+		nodes[p] = &virtualfs.Node{Mode: 0444, ModTime: now, Size: 4096, Data: func() []byte { return data }}
+		add(p)
+	}
+	for p, target := range links {
+		nodes[p] = &virtualfs.Node{Mode: os.ModeSymlink | 0777, ModTime: now, Target: target}
+		add(p)
+	}
+	for _, p := range dirs {
+		if _, exists := entries[p]; !exists {
+			entries[p] = nil
+			add(p)
+		}
+	}
+	for p := range entries {
+		names := entries[p]
+		sort.Strings(names)
+		nodes[p] = &virtualfs.Node{Mode: os.ModeDir | 0755, ModTime: now, Entries: func() []string { return names }}
+	}
+	return virtualfs.NewSynthFs(name, func(p string) (*virtualfs.Node, bool) {
+		node, exists := nodes[p]
+		return node, exists
+	})
+}
@@ -11,6 +11,7 @@ import (
 	pathlib "path"
 
 	honeyos "github.com/mkishere/sshsyrup/os"
+	"github.com/mkishere/sshsyrup/util/capture"
 	"github.com/mkishere/sshsyrup/virtualfs"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
@@ -33,7 +34,10 @@ type Sftp struct {
 	lock          sync.RWMutex
 	dirCache      map[int]*dirContent
 	fileEOFCache  map[int]bool
-	log           *log.Entry
+	// uploads are the paths of files opened for writing, which are
+	// captured when closed
+	uploads map[int]string
+	log     *log.Entry
 }
 
 type dirContent struct {
@@ -52,12 +56,11 @@ func (sftp *Sftp) GetRealPath(path string) string {
 	return pathlib.Clean(path)
 }
 
+// NewSftp returns the server of the user working on the filesystem as the
+// shell sees it, with the mounts and the permission checks
 func NewSftp(conn io.ReadWriter, vfs afero.Fs, user string, log *log.Entry, quitSig chan<- int) *Sftp {
 	u := honeyos.GetUser(user)
-	fs := afero.Afero{vfs}
-	if exists, _ := fs.DirExists(u.Homedir); !exists {
-		fs.MkdirAll(u.Homedir, 0755)
-	}
+	fs := afero.Afero{Fs: vfs}
 	return &Sftp{
 		conn:          conn,
 		vfs:           fs,
@@ -68,6 +71,7 @@ func NewSftp(conn io.ReadWriter, vfs afero.Fs, user string, log *log.Entry, quit
 		dirCache:      map[int]*dirContent{},
 		log:           log,
 		fileEOFCache:  map[int]bool{},
+		uploads:       map[int]string{},
 	}
 }
 
@@ -443,6 +447,9 @@ func (sftp *Sftp) openFile(file string, flag FileFlag, attr []byte) (string, err
 	}
 	hnd := sftp.nextHandle
 	sftp.fileHandleMap[hnd] = f
+	if flag&SSH_FXF_WRITE != 0 {
+		sftp.uploads[hnd] = file
+	}
 	sftp.nextHandle++
 	return strconv.Itoa(hnd), nil
 }
@@ -508,6 +515,12 @@ func (sftp *Sftp) closeFile(handle string) error {
 		return err
 	}
 	delete(sftp.fileHandleMap, hnd)
+	if p, ok := sftp.uploads[hnd]; ok {
+		delete(sftp.uploads, hnd)
+		if data, err := sftp.vfs.ReadFile(p); err == nil && len(data) > 0 {
+			capture.Capture(sftp.log, data, capture.Source{Method: "sftp", Path: p})
+		}
+	}
 	return nil
 }
 
@@ -3,6 +3,7 @@ package sshsyrup
 import (
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -21,6 +22,7 @@ import (
 	"github.com/mkishere/sshsyrup/os/command"
 	"github.com/mkishere/sshsyrup/sftp"
 	"github.com/mkishere/sshsyrup/util/abuseipdb"
+	"github.com/mkishere/sshsyrup/util/capture"
 	"github.com/mkishere/sshsyrup/util/termlogger"
 	"github.com/mkishere/sshsyrup/virtualfs"
 	log "github.com/sirupsen/logrus"
@@ -42,6 +44,11 @@ type SSHSession struct {
 	sys           *os.System
 	term          string
 	fs            afero.Fs
+	// layer is the key of the writable layer of the filesystem
+	layer string
+	// releaseFs is called when the connection ends to release the writable
+	// layer of the filesystem
+	releaseFs func()
 }
 
 type envRequest struct {
@@ -70,8 +77,8 @@ type tunnelRequest struct {
 }
 
 type Server struct {
-	sshCfg *ssh.ServerConfig
-	vfs    afero.Fs
+	sshCfg   *ssh.ServerConfig
+	overlays *virtualfs.Overlays
 }
 
 var (
@@ -79,7 +86,7 @@ var (
 )
 
 // NewSSHSession create new SSH connection based on existing socket connection
-func NewSSHSession(nConn net.Conn, sshConfig *ssh.ServerConfig, vfs afero.Fs) (*SSHSession, error) {
+func NewSSHSession(nConn net.Conn, sshConfig *ssh.ServerConfig, overlays *virtualfs.Overlays) (*SSHSession, error) {
 	conn, chans, reqs, err := ssh.NewServerConn(nConn, sshConfig)
 	if err != nil {
 		return nil, err
@@ -94,6 +101,11 @@ func NewSSHSession(nConn net.Conn, sshConfig *ssh.ServerConfig, vfs afero.Fs) (*
 	})
 	logger.Infof("New SSH connection with client")
 
+	// The layer of the session is named after its start and ID, so that the
+	// directories of the sessions on disk sort by time
+	layerID := time.Now().Format("20060102T150405") + "-" + hex.EncodeToString(conn.SessionID())[:16]
+	vfs, release := overlays.Acquire(layerID, clientIP)
+	layer := overlays.Key(layerID, clientIP)
 	go ssh.DiscardRequests(reqs)
 	return &SSHSession{
 		user:          conn.User(),
@@ -102,6 +114,8 @@ func NewSSHSession(nConn net.Conn, sshConfig *ssh.ServerConfig, vfs afero.Fs) (*
 		sshChan:       chans,
 		log:           logger,
 		fs:            vfs,
+		layer:         layer,
+		releaseFs:     release,
 	}, nil
 }
 
@@ -115,6 +129,8 @@ func (s *SSHSession) handleNewSession(newChan ssh.NewChannel) {
 	var sh *os.Shell
 	go func(in <-chan *ssh.Request, channel ssh.Channel) {
 		quitSignal := make(chan int, 1)
+		// Environment variables sent before the system is created
+		envVars := map[string]string{}
 		for {
 			select {
 			case req := <-in:
@@ -134,8 +150,8 @@ func (s *SSHSession) handleNewSession(newChan ssh.NewChannel) {
 					} else {
 						s.log.WithField("reqType", req.Type).Infof("User requesting pty(%v %vx%v)", ptyreq.Term, ptyreq.Width, ptyreq.Height)
 
-						s.sys = os.NewSystem(s.user, viper.GetString("server.hostname"), s.fs, channel, int(ptyreq.Width), int(ptyreq.Height), s.log)
 						s.term = ptyreq.Term
+						s.sys = s.newSystem(channel, int(ptyreq.Width), int(ptyreq.Height), envVars)
 						req.Reply(true, nil)
 					}
 				case "env":
@@ -148,15 +164,21 @@ func (s *SSHSession) handleNewSession(newChan ssh.NewChannel) {
 							"envVarName":  envReq.Name,
 							"envVarValue": envReq.Value,
 						}).Infof("User sends envvar:%v=%v", envReq.Name, envReq.Value)
+						if s.sys != nil {
+							s.sys.SetEnv(envReq.Name, envReq.Value)
+						} else {
+							envVars[envReq.Name] = envReq.Value
+						}
 						req.Reply(true, nil)
 					}
 				case "shell":
 					s.log.WithField("reqType", req.Type).Info("User requesting shell access")
 					if s.sys == nil {
-						s.sys = os.NewSystem(s.user, viper.GetString("server.hostname"), s.fs, channel, 80, 24, s.log)
+						s.sys = s.newSystem(channel, 80, 24, envVars)
 					}
 
 					sh = os.NewShell(s.sys, s.src.String(), s.log.WithField("module", "shell"), quitSignal)
+					sh.PS1 = viper.GetString("persona.prompt")
 
 					// Create delay function if exists
 					if viper.GetInt("server.processDelay") > 0 {
@@ -166,28 +188,8 @@ func (s *SSHSession) handleNewSession(newChan ssh.NewChannel) {
 							time.Sleep(time.Millisecond * time.Duration(sleepTime))
 						}
 					}
-					// Create hook for session logger (For recording session to UML/asciinema)
-					var hook termlogger.LogHook
-					if viper.GetString("server.sessionLogFmt") == "asciinema" {
-						asciiLogParams := map[string]string{
-							"TERM": s.term,
-							"USER": s.user,
-							"SRC":  s.src.String(),
-						}
-						hook, err = termlogger.NewAsciinemaHook(s.sys.Width(), s.sys.Height(),
-							viper.GetString("asciinema.apiEndpoint"), viper.GetString("asciinema.apiKey"), asciiLogParams,
-							fmt.Sprintf("logs/sessions/%v-%v.cast", s.user, termlogger.LogTimeFormat))
-
-					} else if viper.GetString("server.sessionLogFmt") == "uml" {
-						hook, err = termlogger.NewUMLHook(0, fmt.Sprintf("logs/sessions/%v-%v.ulm.log", s.user, time.Now().Format(logTimeFormat)))
-					} else {
-						log.Errorf("Session Log option %v not recognized", viper.GetString("server.sessionLogFmt"))
-					}
-					if err != nil {
-						log.Errorf("Cannot create %v log file", viper.GetString("server.sessionLogFmt"))
-					}
 					// The need of a goroutine here is that PuTTY will wait for reply before acknowledge it enters shell mode
-					go sh.HandleRequest(hook)
+					go sh.HandleRequest(s.newLogHook())
 					req.Reply(true, nil)
 				case "subsystem":
 					subsys := string(req.Payload[4:])
@@ -196,7 +198,12 @@ func (s *SSHSession) handleNewSession(newChan ssh.NewChannel) {
 						"subSystem": subsys,
 					}).Infof("User requested subsystem %v", subsys)
 					if subsys == "sftp" {
-						sftpSrv := sftp.NewSftp(channel, s.fs,
+						sys := s.sys
+						if sys == nil {
+							sys = s.newSystem(channel, 80, 24, envVars)
+						}
+						// Like scp, files are accessed as the user within the mounts
+						sftpSrv := sftp.NewSftp(channel, sys.FSys(),
 							s.user, s.log.WithField("module", "sftp"), quitSignal)
 						go sftpSrv.HandleRequest()
 						req.Reply(true, nil)
@@ -218,24 +225,22 @@ func (s *SSHSession) handleNewSession(newChan ssh.NewChannel) {
 						"reqType": req.Type,
 						"cmd":     cmd,
 					}).Info("User request remote exec")
-					args := strings.Split(cmd, " ")
 					var sys *os.System
 					if s.sys == nil {
-						sys = os.NewSystem(s.user, viper.GetString("server.hostname"), s.fs, channel, 80, 24, s.log)
+						sys = s.newSystem(channel, 80, 24, envVars)
 					} else {
 						sys = s.sys
 					}
-					if strings.HasPrefix(args[0], "scp") {
-						scp := command.NewSCP(channel, s.fs, s.log.WithField("module", "scp"))
+					if args := strings.Fields(cmd); len(args) > 0 && args[0] == "scp" {
+						// Transfers are made as the user, within the mounts
+						scp := command.NewSCP(channel, sys.FSys(), s.log.WithField("module", "scp"))
 						go scp.Main(args[1:], quitSignal)
 						req.Reply(true, nil)
 						continue
 					}
-					n, err := sys.Exec(args[0], args[1:])
-					if err != nil {
-						channel.Write([]byte(fmt.Sprintf("%v: command not found\r\n", cmd)))
-					}
-					quitSignal <- n
+					sh = os.NewShell(sys, s.src.String(), s.log.WithField("module", "shell"), quitSignal)
+					sh.PS1 = viper.GetString("persona.prompt")
+					go sh.HandleExec(cmd, s.newLogHook(), len(s.term) > 0)
 					req.Reply(true, nil)
 				default:
 					s.log.WithField("reqType", req.Type).Infof("Unknown channel request type %v", req.Type)
@@ -249,6 +254,53 @@ func (s *SSHSession) handleNewSession(newChan ssh.NewChannel) {
 	}(requests, channel)
 }
 
+// newLogHook creates the hook for recording the session in the format
+// set in config. nil is returned if the recording cannot be created
+func (s *SSHSession) newLogHook() termlogger.LogHook {
+	var hook termlogger.LogHook
+	var err error
+	switch viper.GetString("server.sessionLogFmt") {
+	case "asciinema":
+		asciiLogParams := map[string]string{
+			"TERM": s.term,
+			"USER": s.user,
+			"SRC":  s.src.String(),
+		}
+		width, height := 80, 24
+		if s.sys != nil {
+			width, height = s.sys.Width(), s.sys.Height()
+		}
+		hook, err = termlogger.NewAsciinemaHook(width, height,
+			viper.GetString("asciinema.apiEndpoint"), viper.GetString("asciinema.apiKey"), asciiLogParams,
+			fmt.Sprintf("logs/sessions/%v-%v.cast", s.user, termlogger.LogTimeFormat))
+	case "uml":
+		hook, err = termlogger.NewUMLHook(0, fmt.Sprintf("logs/sessions/%v-%v.ulm.log", s.user, time.Now().Format(logTimeFormat)))
+	default:
+		log.Errorf("Session Log option %v not recognized", viper.GetString("server.sessionLogFmt"))
+		return nil
+	}
+	if err != nil {
+		log.Errorf("Cannot create %v log file", viper.GetString("server.sessionLogFmt"))
+		return nil
+	}
+	return hook
+}
+
+// newSystem creates the system for the session channel with the login
+// environment of the user
+func (s *SSHSession) newSystem(channel ssh.Channel, width, height int, envVars map[string]string) *os.System {
+	sys := os.NewSystem(s.user, viper.GetString("server.hostname"), s.layer, s.fs, channel, width, height, s.log)
+	clientIP, port, _ := net.SplitHostPort(s.src.String())
+	sys.SetEnv("SSH_CLIENT", fmt.Sprintf("%v %v %v", clientIP, port, viper.GetInt("server.port")))
+	if len(s.term) > 0 {
+		sys.SetEnv("TERM", s.term)
+	}
+	for k, v := range envVars {
+		sys.SetEnv(k, v)
+	}
+	return sys
+}
+
 func (s *SSHSession) handleNewConn() {
 	// Service the incoming Channel channel.
 	for newChannel := range s.sshChan {
@@ -289,7 +341,7 @@ func (s *SSHSession) handleNewConn() {
 					newChannel.Reject(ssh.ResourceShortage, "Cannot create new channel")
 				}
 				go ssh.DiscardRequests(req)
-				go func() {
+				go func(newChannel ssh.NewChannel) {
 					s.log.WithFields(log.Fields{
 						"host": host,
 					}).Infoln("Creating connection to remote server")
@@ -303,7 +355,7 @@ func (s *SSHSession) handleNewConn() {
 					}
 					go io.Copy(conn, ch)
 					go io.Copy(ch, conn)
-				}()
+				}(newChannel)
 			} else {
 				newChannel.Reject(ssh.ConnectionFailed, "Malformed channel request")
 			}
@@ -317,10 +369,10 @@ func (s *SSHSession) handleNewConn() {
 	}
 }
 
-func CreateSessionHandler(c <-chan net.Conn, sshConfig *ssh.ServerConfig, vfs afero.Fs) {
+func CreateSessionHandler(c <-chan net.Conn, sshConfig *ssh.ServerConfig, overlays *virtualfs.Overlays) {
 	for conn := range c {
 		sshConfig.PasswordCallback = PasswordChallenge(viper.GetInt("server.maxTries"))
-		sshSession, err := NewSSHSession(conn, sshConfig, vfs)
+		sshSession, err := NewSSHSession(conn, sshConfig, overlays)
 		clientIP, port, _ := net.SplitHostPort(conn.RemoteAddr().String())
 		abuseipdb.CreateProfile(clientIP)
 		abuseipdb.AddCategory(clientIP, abuseipdb.SSH, abuseipdb.Hacking)
@@ -331,6 +383,7 @@ func CreateSessionHandler(c <-chan net.Conn, sshConfig *ssh.ServerConfig, vfs af
 			}).WithError(err).Error("Error establishing SSH connection")
 		} else {
 			sshSession.handleNewConn()
+			sshSession.releaseFs()
 		}
 		//conn.Close()
 		ipConnCnt.DecCount(clientIP)
@@ -352,13 +405,62 @@ func NewServer(configPath string, hostKey []byte) (s Server) {
 		bannerFile = []byte{}
 	}
 
-	// Initalize VFS
-	backupFS := afero.NewBasePathFs(afero.NewOsFs(), viper.GetString("virtualfs.savedFileDir"))
+	// Initalize VFS. Clients write to the layer of their session over the
+	// image
 	zipfs, err := virtualfs.NewVirtualFS(path.Join(configPath, viper.GetString("virtualfs.imageFile")))
 	if err != nil {
 		log.Error("Cannot create virtual filesystem")
 	}
-	vfs := afero.NewCopyOnWriteFs(zipfs, backupFS)
+	overlays := virtualfs.NewOverlays(zipfs, afero.NewOsFs(), virtualfs.OverlayConfig{
+		Scope:   viper.GetString("virtualfs.overlay"),
+		Storage: viper.GetString("virtualfs.overlayStorage"),
+		Dir:     viper.GetString("virtualfs.savedFileDir"),
+		Expiry:  viper.GetDuration("virtualfs.overlayExpiry"),
+		// The processes of the sessions go with their layer
+		Dropped: os.DropProcesses,
+	})
+	overlays.Cleanup(time.Now())
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			overlays.Cleanup(now)
+		}
+	}()
+	// Files fetched or written by clients are kept by their hash
+	store, err := capture.NewStore(afero.NewOsFs(), viper.GetString("capture.dir"))
+	if err != nil {
+		log.WithError(err).Errorf("Cannot create capture directory %v", viper.GetString("capture.dir"))
+	} else {
+		capture.SetDefault(store)
+	}
+	// The machine seen in /proc and by commands
+	os.SetPersona(os.Persona{
+		CPUModel:      viper.GetString("persona.cpuModel"),
+		CPUs:          viper.GetInt("persona.cpus"),
+		CPUMHz:        viper.GetFloat64("persona.cpuMHz"),
+		MemTotal:      viper.GetInt("persona.memTotal"),
+		KernelRelease: viper.GetString("persona.kernelRelease"),
+		KernelVersion: viper.GetString("persona.kernelVersion"),
+		Uptime:        viper.GetDuration("persona.uptime"),
+		Interface:     viper.GetString("persona.interface"),
+		MAC:           viper.GetString("persona.mac"),
+		Address:       viper.GetString("persona.address"),
+		Gateway:       viper.GetString("persona.gateway"),
+	})
+	// Filesystems grafted over the image
+	if viper.IsSet("virtualfs.mounts") {
+		var mounts []virtualfs.Mount
+		if err := viper.UnmarshalKey("virtualfs.mounts", &mounts); err != nil {
+			log.WithError(err).Error("Cannot read mount table")
+		}
+		for i := range mounts {
+			if len(mounts[i].Path) > 0 && !path.IsAbs(mounts[i].Path) {
+				mounts[i].Path = path.Join(configPath, mounts[i].Path)
+			}
+		}
+		if err := os.SetMounts(mounts); err != nil {
+			log.WithError(err).Error("Cannot mount filesystems, using default mount table")
+		}
+	}
 	err = os.LoadUsers(path.Join(configPath, viper.GetString("virtualfs.uidMappingFile")))
 	if err != nil {
 		log.Errorf("Cannot load user mapping file %v", path.Join(configPath, viper.GetString("virtualfs.uidMappingFile")))
@@ -386,7 +488,7 @@ func NewServer(configPath string, hostKey []byte) (s Server) {
 				return string(bannerFile)
 			},
 		},
-		vfs,
+		overlays,
 	}
 	private, err := ssh.ParsePrivateKey(hostKey)
 	if err != nil {
@@ -437,7 +539,7 @@ func (sc Server) ListenAndServe() {
 	connChan := make(chan net.Conn)
 	// Create pool of workers to handle connections
 	for i := 0; i < viper.GetInt("server.maxConnections"); i++ {
-		go CreateSessionHandler(connChan, sc.sshCfg, sc.vfs)
+		go CreateSessionHandler(connChan, sc.sshCfg, sc.overlays)
 	}
 
 	listener, err := net.Listen("tcp", fmt.Sprintf("%v:%v", viper.GetString("server.addr"), viper.GetInt("server.port")))
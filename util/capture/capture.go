@@ -0,0 +1,160 @@
+// Package capture keeps the files downloaded, uploaded or written by clients
+// under their SHA-256 hash, so that identical payloads are stored once and
+// the names chosen by clients never reach the host filesystem
+package capture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// maxSources is the number of sources kept in the sidecar of a file. Later
+// captures only update the count and last seen time
+const maxSources = 100
+
+// Source describes how a file was captured
+type Source struct {
+	// Method is the command or transfer the file came from, e.g. wget,
+	// curl, scp, sftp or redirect
+	Method    string    `json:"method"`
+	URL       string    `json:"url,omitempty"`
+	SessionID string    `json:"sessionId"`
+	SrcIP     string    `json:"srcIP"`
+	Path      string    `json:"path,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Record is the JSON sidecar stored beside the captured file
+type Record struct {
+	SHA256    string    `json:"sha256"`
+	Size      int       `json:"size"`
+	MimeType  string    `json:"mimeType"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Count     int       `json:"count"`
+	Sources   []Source  `json:"sources"`
+}
+
+// Store saves captured files in a directory, named by their hash with the
+// sidecar in <hash>.json
+type Store struct {
+	fs   afero.Fs
+	lock sync.Mutex
+}
+
+var defaultStore *Store
+
+// NewStore returns the store saving files in the directory, creating it
+// if needed
+func NewStore(fs afero.Fs, dir string) (*Store, error) {
+	if err := fs.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{fs: afero.NewBasePathFs(fs, dir)}, nil
+}
+
+// SetDefault sets the store files are captured to
+func SetDefault(s *Store) {
+	defaultStore = s
+}
+
+// Save stores the file if it is not seen before and adds the source to its
+// sidecar
+func (s *Store) Save(data []byte, src Source) (*Record, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rec := &Record{}
+	if b, err := afero.ReadFile(s.fs, "/"+hash+".json"); err == nil {
+		if err := json.Unmarshal(b, rec); err != nil {
+			return nil, err
+		}
+	} else {
+		rec = &Record{SHA256: hash, Size: len(data), MimeType: Sniff(data), FirstSeen: src.Time}
+		// The file is never made executable
+		if _, err := s.fs.Stat("/" + hash); err != nil {
+			if err := afero.WriteFile(s.fs, "/"+hash, data, 0400); err != nil {
+				return nil, err
+			}
+		}
+	}
+	rec.LastSeen = src.Time
+	rec.Count++
+	if len(rec.Sources) < maxSources {
+		rec.Sources = append(rec.Sources, src)
+	}
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := afero.WriteFile(s.fs, "/"+hash+".json", b, 0600); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Capture saves the file to the default store, filling the session of
+// the source from the fields of the logger, and logs the capture. Nothing
+// is saved when no store is set
+func Capture(logger *log.Entry, data []byte, src Source) {
+	if defaultStore == nil || logger == nil {
+		return
+	}
+	if len(src.SessionID) == 0 {
+		src.SessionID, _ = logger.Data["sessionId"].(string)
+	}
+	if len(src.SrcIP) == 0 {
+		src.SrcIP, _ = logger.Data["srcIP"].(string)
+	}
+	if src.Time.IsZero() {
+		src.Time = time.Now()
+	}
+	rec, err := defaultStore.Save(data, src)
+	if err != nil {
+		logger.WithError(err).Error("Cannot save captured file")
+		return
+	}
+	logger.WithFields(log.Fields{
+		"sha256":   rec.SHA256,
+		"size":     rec.Size,
+		"mimeType": rec.MimeType,
+		"method":   src.Method,
+		"url":      src.URL,
+		"path":     src.Path,
+		"count":    rec.Count,
+	}).Info("File captured")
+}
+
+// Sniff returns the MIME type of the content, recognizing the executables
+// and scripts commonly dropped besides those of http.DetectContentType
+func Sniff(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		return "application/x-executable"
+	case bytes.HasPrefix(data, []byte("MZ")):
+		return "application/x-dosexec"
+	case bytes.HasPrefix(data, []byte("#!")):
+		line := data
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		switch {
+		case bytes.Contains(line, []byte("python")):
+			return "text/x-python"
+		case bytes.Contains(line, []byte("perl")):
+			return "text/x-perl"
+		}
+		return "text/x-shellscript"
+	}
+	return http.DetectContentType(data)
+}
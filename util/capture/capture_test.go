@@ -0,0 +1,71 @@
+package capture
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/afero"
+)
+
+func TestStoreSave(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	s, err := NewStore(fs, "/captures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("#!/bin/sh\nwget http://example.com/x\n")
+	first := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := s.Save(payload, Source{Method: "wget", URL: "http://example.com/a.sh", Path: "/tmp/a.sh", Time: first}); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := s.Save(payload, Source{Method: "scp", Path: "/root/b", Time: first.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(payload); rec.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("Unexpected hash %v", rec.SHA256)
+	}
+	if rec.Count != 2 || len(rec.Sources) != 2 || !rec.FirstSeen.Equal(first) || !rec.LastSeen.Equal(first.Add(time.Hour)) {
+		t.Errorf("Unexpected record %+v", rec)
+	}
+	if rec.MimeType != "text/x-shellscript" || rec.Size != len(payload) {
+		t.Errorf("Unexpected type %v or size %v", rec.MimeType, rec.Size)
+	}
+	files, _ := afero.ReadDir(fs, "/captures")
+	if len(files) != 2 {
+		t.Errorf("Expect the file and sidecar only, got %v files", len(files))
+	}
+	data, _ := afero.ReadFile(fs, "/captures/"+rec.SHA256)
+	if string(data) != string(payload) {
+		t.Errorf("Unexpected content %q", data)
+	}
+	var sidecar Record
+	b, _ := afero.ReadFile(fs, "/captures/"+rec.SHA256+".json")
+	if err := json.Unmarshal(b, &sidecar); err != nil || sidecar.Sources[0].URL != "http://example.com/a.sh" {
+		t.Errorf("Unexpected sidecar %s", b)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	s, _ := NewStore(afero.NewMemMapFs(), "/")
+	SetDefault(s)
+	defer SetDefault(nil)
+	logger, hook := test.NewNullLogger()
+	logger.Out = ioutil.Discard
+	entry := logger.WithFields(log.Fields{"sessionId": "abc", "srcIP": "10.0.0.1"})
+	Capture(entry, []byte("\x7fELF\x02\x01\x01"), Source{Method: "sftp", Path: "/tmp/x"})
+	e := hook.LastEntry()
+	if e == nil || e.Message != "File captured" || e.Data["mimeType"] != "application/x-executable" {
+		t.Fatalf("Capture not logged %+v", e)
+	}
+	rec, _ := s.Save([]byte("\x7fELF\x02\x01\x01"), Source{})
+	if src := rec.Sources[0]; src.SessionID != "abc" || src.SrcIP != "10.0.0.1" || src.Time.IsZero() {
+		t.Errorf("Session not recorded %+v", src)
+	}
+}
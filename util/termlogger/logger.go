@@ -38,7 +38,9 @@ func NewLogger(logHook LogHook, in io.Reader, out, err io.Writer) StdIOErr {
 	}
 	tl.keylog.SetLevel(log.InfoLevel)
 	tl.keylog.Out = DummyWriter{}
-	tl.keylog.AddHook(logHook)
+	if logHook != nil {
+		tl.keylog.AddHook(logHook)
+	}
 	inLogStream := logWriter{tl.keylog.WithField("dir", input)}
 	outLogStream := logWriter{tl.keylog.WithField("dir", output)}
 	tl.in = io.TeeReader(in, inLogStream)
@@ -60,5 +62,8 @@ func (tl *ioLogWrapper) Err() io.Writer {
 }
 
 func (tl *ioLogWrapper) Close() error {
+	if tl.hook == nil {
+		return nil
+	}
 	return tl.hook.Close()
 }
@@ -0,0 +1,154 @@
+package virtualfs
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// DeviceReadLimit is the most bytes read from an endless device like
+// /dev/zero each time it is opened, after which it reads end of file so
+// that commands reading it whole finish
+const DeviceReadLimit = 16 << 20
+
+// limitedReader reads from the device up to DeviceReadLimit
+type limitedReader struct {
+	read func(p []byte) (int, error)
+	n    int
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.n >= DeviceReadLimit {
+		return 0, io.EOF
+	}
+	if len(p) > DeviceReadLimit-r.n {
+		p = p[:DeviceReadLimit-r.n]
+	}
+	n, err := r.read(p)
+	r.n += n
+	return n, err
+}
+
+func discard(p []byte) (int, error)   { return len(p), nil }
+func readEOF(p []byte) (int, error)   { return 0, io.EOF }
+func writeFull(p []byte) (int, error) { return 0, syscall.ENOSPC }
+
+func readZero(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// Device is a character device in /dev
+type Device struct {
+	Major, Minor int
+	Mode         os.FileMode
+	GID          int
+	Read         func(p []byte) (int, error)
+	Write        func(p []byte) (int, error)
+	// Endless devices are read up to DeviceReadLimit
+	Endless bool
+}
+
+// Devices are the character devices in /dev other than the terminals
+var Devices = map[string]Device{
+	"null":    {Major: 1, Minor: 3, Mode: 0666, Read: readEOF, Write: discard},
+	"zero":    {Major: 1, Minor: 5, Mode: 0666, Read: readZero, Write: discard, Endless: true},
+	"full":    {Major: 1, Minor: 7, Mode: 0666, Read: readZero, Write: writeFull, Endless: true},
+	"random":  {Major: 1, Minor: 8, Mode: 0666, Read: rand.Read, Write: discard, Endless: true},
+	"urandom": {Major: 1, Minor: 9, Mode: 0666, Read: rand.Read, Write: discard, Endless: true},
+	// Opening a new pseudo terminal gives nothing to read
+	"ptmx": {Major: 5, Minor: 2, Mode: 0666, GID: 5, Read: readEOF, Write: discard},
+}
+
+// stdFds are the links to the standard streams in /dev, which the shell
+// redirects to itself
+var stdFds = map[string]string{"/stdin": "0", "/stdout": "1", "/stderr": "2"}
+
+// Terminal is the pseudo terminal of a session, /dev/pts/<Pts> owned by UID
+type Terminal struct {
+	io.ReadWriter
+	Pts, UID int
+}
+
+// NewDevFs returns /dev with the devices and the terminal, read and written
+// by /dev/tty and its pts device. Without a terminal /dev/tty cannot be
+// opened
+func NewDevFs(tty *Terminal) *SynthFs {
+	boot := time.Now()
+	dir := func(entries ...string) *Node {
+		return &Node{Mode: os.ModeDir | 0755, ModTime: boot, Entries: func() []string { return entries }}
+	}
+	device := func(d Device) *Node {
+		n := &Node{Mode: os.ModeDevice | os.ModeCharDevice | d.Mode, GID: d.GID, ModTime: boot,
+			Rdev: Mkdev(d.Major, d.Minor), Read: d.Read, Write: d.Write}
+		if d.Endless {
+			n.Read = (&limitedReader{read: d.Read}).Read
+		}
+		return n
+	}
+	terminal := func(d Device) *Node {
+		if tty == nil {
+			d.Read = func(p []byte) (int, error) { return 0, syscall.ENXIO }
+			d.Write = func(p []byte) (int, error) { return 0, syscall.ENXIO }
+		} else {
+			d.Read, d.Write = tty.Read, tty.Write
+		}
+		return device(d)
+	}
+	ptsName := ""
+	if tty != nil {
+		ptsName = strconv.Itoa(tty.Pts)
+	}
+	var names []string
+	for name := range Devices {
+		names = append(names, name)
+	}
+	names = append(names, "pts", "tty", "fd", "stdin", "stdout", "stderr")
+	return NewSynthFs("devtmpfs", func(name string) (*Node, bool) {
+		switch {
+		case name == "/":
+			return dir(names...), true
+		case name == "/pts":
+			if len(ptsName) == 0 {
+				return dir("ptmx"), true
+			}
+			return dir("ptmx", ptsName), true
+		case name == "/pts/ptmx":
+			return &Node{Mode: os.ModeDevice | os.ModeCharDevice, ModTime: boot, Rdev: Mkdev(5, 2)}, true
+		case len(ptsName) > 0 && name == "/pts/"+ptsName:
+			n := terminal(Device{Major: 136, Minor: tty.Pts, Mode: 0620, GID: 5})
+			n.UID = tty.UID
+			return n, true
+		case name == "/tty":
+			return terminal(Device{Major: 5, Minor: 0, Mode: 0666, GID: 5}), true
+		case name == "/fd":
+			return &Node{Mode: os.ModeSymlink | 0777, ModTime: boot, Target: "/proc/self/fd"}, true
+		case stdFds[name] != "":
+			return &Node{Mode: os.ModeSymlink | 0777, ModTime: boot, Target: "/proc/self/fd/" + stdFds[name]}, true
+		}
+		if d, exists := Devices[strings.TrimPrefix(name, "/")]; exists {
+			return device(d), true
+		}
+		return nil, false
+	})
+}
+
+// NewTmpFs returns an empty filesystem in memory whose root has the mode,
+// like /tmp or /dev/shm
+func NewTmpFs(mode os.FileMode) afero.Fs {
+	mem := afero.NewMemMapFs()
+	// The root of MemMapFs has no type in its mode
+	mem.Chmod("/", os.ModeDir|mode)
+	// The layer over nothing stores the links
+	fs := NewOwnerFs(NewLayerFs(afero.NewReadOnlyFs(afero.NewMemMapFs()), mem))
+	fs.update("/", func(a *fileAttr) { a.mode = os.ModeDir | mode })
+	return fs
+}
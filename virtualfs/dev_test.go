@@ -0,0 +1,65 @@
+package virtualfs
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestDevFs(t *testing.T) {
+	fs := NewMountFs(afero.NewMemMapFs(),
+		Mount{Dir: "/dev", Fs: NewDevFs(nil)},
+		Mount{Dir: "/dev/shm", Fs: NewTmpFs(0777 | os.ModeSticky)},
+	)
+	if data, err := afero.ReadFile(fs, "/dev/null"); err != nil || len(data) > 0 {
+		t.Errorf("Reading /dev/null: %q, %v", data, err)
+	}
+	if err := afero.WriteFile(fs, "/dev/null", []byte("x"), 0644); err != nil {
+		t.Errorf("Writing /dev/null: %v", err)
+	}
+	if err := afero.WriteFile(fs, "/dev/full", []byte("x"), 0644); errno(err) != syscall.ENOSPC {
+		t.Errorf("Writing /dev/full: %v", err)
+	}
+	f, err := fs.Open("/dev/zero")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Endless devices end when read whole
+	data, _ := ioutil.ReadAll(f)
+	f.Close()
+	if len(data) != DeviceReadLimit || data[0] != 0 {
+		t.Errorf("Read %v bytes from /dev/zero", len(data))
+	}
+	fi, err := fs.Stat("/dev/urandom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if major, minor := fi.Sys().(ZipExtraInfo).Rdev(); fi.Mode()&os.ModeCharDevice == 0 || major != 1 || minor != 9 {
+		t.Errorf("/dev/urandom is %v %v,%v", fi.Mode(), major, minor)
+	}
+	if _, err := fs.OpenFile("/dev/tty", os.O_RDWR, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "/dev/tty", []byte("x"), 0644); errno(err) != syscall.ENXIO {
+		t.Errorf("Writing /dev/tty without terminal: %v", err)
+	}
+	if err := afero.WriteFile(fs, "/dev/file", []byte("x"), 0644); errno(err) != syscall.EACCES {
+		t.Errorf("Creating file in /dev: %v", err)
+	}
+
+	if err := afero.WriteFile(fs, "/dev/shm/file", []byte("x"), 0644); err != nil {
+		t.Errorf("Writing /dev/shm: %v", err)
+	}
+	if fi, err := fs.Stat("/dev/shm"); err != nil || fi.Mode() != os.ModeDir|os.ModeSticky|0777 {
+		t.Errorf("/dev/shm is %v, %v", fi, err)
+	}
+	if err := fs.Rename("/dev/shm/file", "/file"); errno(err) != syscall.EXDEV {
+		t.Errorf("Moving file out of /dev/shm: %v", err)
+	}
+	if err := fs.Remove("/dev/shm"); errno(err) != syscall.EBUSY {
+		t.Errorf("Removing /dev/shm: %v", err)
+	}
+}
@@ -43,6 +43,17 @@ func (f *File) fillBuffer(offset int64) (err error) {
 	return
 }
 
+// handle returns a copy of the node so that each opened file keeps
+// its own offset and buffer
+func (f *File) handle() *File {
+	return &File{
+		FileInfo: f.FileInfo,
+		zipFile:  f.zipFile,
+		children: f.children,
+		SymLink:  f.SymLink,
+	}
+}
+
 func (f *File) Close() (err error) {
 	f.zipFile = nil
 	f.closed = true
@@ -62,8 +73,11 @@ func (f *File) Read(p []byte) (n int, err error) {
 		return 0, afero.ErrFileClosed
 	}
 	err = f.fillBuffer(f.offset + int64(len(p)))
+	if f.offset >= int64(len(f.buf)) {
+		return 0, io.EOF
+	}
 	n = copy(p, f.buf[f.offset:])
-	f.offset += int64(len(p))
+	f.offset += int64(n)
 	return
 }
 
@@ -147,3 +161,11 @@ func (f *File) Truncate(size int64) error {
 func (f *File) WriteString(s string) (ret int, err error) {
 	return 0, os.ErrPermission
 }
+
+// Readlink returns the target if the file is a symbolic link
+func (f *File) Readlink() (string, error) {
+	if f.Mode()&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: f.Name(), Err: syscall.EINVAL}
+	}
+	return f.SymLink, nil
+}
@@ -19,6 +19,8 @@ type ZipExtraInfo struct {
 	mtime time.Time
 	uid   int
 	gid   int
+	// rdev is the device number of devices
+	rdev uint64
 }
 
 type unixFileInfo struct {
@@ -121,6 +123,11 @@ func (zInfo ZipExtraInfo) Ctime() time.Time {
 	return zInfo.ctime
 }
 
+// Rdev returns the major and minor numbers of the device
+func (zInfo ZipExtraInfo) Rdev() (major, minor int) {
+	return int(zInfo.rdev >> 8), int(zInfo.rdev & 0xff)
+}
+
 func GetExtraInfo(fi os.FileInfo) (uid, gid int, aTime, mTime time.Time) {
 
 	switch p := fi.Sys().(type) {
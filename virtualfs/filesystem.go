@@ -21,18 +21,18 @@ type rootInfo struct{}
 
 func (rootInfo) Name() string       { return string(filepath.Separator) }
 func (rootInfo) Size() int64        { return 0 }
-func (rootInfo) Mode() os.FileMode  { return os.ModeDir | os.ModePerm }
+func (rootInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
 func (rootInfo) ModTime() time.Time { return time.Now() }
 func (rootInfo) IsDir() bool        { return true }
 func (rootInfo) Sys() interface{}   { return nil }
 
 // NewVirtualFS initalized the tree, which creates the root directory
 func NewVirtualFS(zipFile string) (afero.Fs, error) {
+	// The reader is kept open as file contents are read on demand
 	r, err := zip.OpenReader(zipFile)
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close()
 	vfs := &VirtualFS{
 		root: &File{
 			FileInfo: rootInfo{},
@@ -137,7 +137,7 @@ func (t *VirtualFS) Open(path string) (afero.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	return n, nil
+	return n.handle(), nil
 }
 
 func (t *VirtualFS) OpenFile(path string, flag int, mode os.FileMode) (afero.File, error) {
@@ -145,7 +145,7 @@ func (t *VirtualFS) OpenFile(path string, flag int, mode os.FileMode) (afero.Fil
 	if err != nil {
 		return nil, err
 	}
-	return node, nil
+	return node.handle(), nil
 }
 
 func (t *VirtualFS) Stat(path string) (os.FileInfo, error) {
@@ -0,0 +1,531 @@
+package virtualfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	pathlib "path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// LayerFs is a writable layer over a read-only filesystem such as the image.
+// Unlike afero.CopyOnWriteFs, the files of the base can be removed and
+// renamed, which hides them behind whiteouts, and symbolic links can be
+// created. Links are stored in the layer as files holding their targets.
+// The whiteouts and which files are links are kept in memory only
+type LayerFs struct {
+	cow   afero.Fs
+	base  afero.Fs
+	layer afero.Fs
+	lock  sync.RWMutex
+	// removed are the files of the base removed from the layer, which hide
+	// the files under them in the base too
+	removed map[string]bool
+	links   map[string]bool
+}
+
+// NewLayerFs returns the filesystem writing the changes to base in layer
+func NewLayerFs(base, layer afero.Fs) *LayerFs {
+	return &LayerFs{
+		cow:     afero.NewCopyOnWriteFs(base, layer),
+		base:    base,
+		layer:   layer,
+		removed: map[string]bool{},
+		links:   map[string]bool{},
+	}
+}
+
+func (l *LayerFs) Name() string {
+	return "LayerFs"
+}
+
+// hidden tells if the file of the base is hidden by a whiteout of it or of
+// one of its directories
+func (l *LayerFs) hidden(name string) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	for p := pathlib.Clean(name); ; p = pathlib.Dir(p) {
+		if l.removed[p] {
+			return true
+		}
+		if p == "/" || p == "." {
+			return false
+		}
+	}
+}
+
+func (l *LayerFs) isLink(name string) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.links[pathlib.Clean(name)]
+}
+
+func (l *LayerFs) inLayer(name string) bool {
+	_, err := l.layer.Stat(name)
+	return err == nil
+}
+
+// inBase tells if the file is in the base and not hidden
+func (l *LayerFs) inBase(name string) bool {
+	if l.hidden(name) {
+		return false
+	}
+	_, err := l.base.Stat(name)
+	return err == nil
+}
+
+// gone tells if the file is hidden in the base and not in the layer
+func (l *LayerFs) gone(name string) bool {
+	return l.hidden(name) && !l.inLayer(name)
+}
+
+// info returns the info of the file, typed as a link if it is one
+func (l *LayerFs) info(name string, fi os.FileInfo) os.FileInfo {
+	if l.isLink(name) {
+		return linkInfo{fi}
+	}
+	return fi
+}
+
+// layerDir makes sure the directory exists in the layer, copying it up from
+// the base if needed
+func (l *LayerFs) layerDir(op, dir string) error {
+	fi, err := l.Stat(dir)
+	switch {
+	case err != nil:
+		return err
+	case !fi.IsDir():
+		return &os.PathError{Op: op, Path: dir, Err: syscall.ENOTDIR}
+	case l.inLayer(dir):
+		return nil
+	}
+	if parent := pathlib.Dir(dir); parent != dir {
+		if err := l.layerDir(op, parent); err != nil {
+			return err
+		}
+	}
+	if err := l.layer.Mkdir(dir, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return l.layer.Chtimes(dir, fi.ModTime(), fi.ModTime())
+}
+
+// copyUp copies the file from the base to the layer, with the files under it
+// if it is a directory
+func (l *LayerFs) copyUp(name string) error {
+	fi, err := l.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !l.inLayer(name) {
+		if err := l.layerDir("copy", pathlib.Dir(name)); err != nil {
+			return err
+		}
+		if err := l.copyFile(name, fi); err != nil {
+			return err
+		}
+	}
+	if !fi.IsDir() {
+		return nil
+	}
+	f, err := l.Open(name)
+	if err != nil {
+		return err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	for _, n := range names {
+		if err := l.copyUp(pathlib.Join(name, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies a single file of the base to the layer. Links of the base
+// become links of the layer
+func (l *LayerFs) copyFile(name string, fi os.FileInfo) error {
+	if fi.IsDir() {
+		return l.layer.Mkdir(name, fi.Mode().Perm())
+	}
+	var r io.Reader
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := readlink(l.base, name)
+		if err != nil {
+			return err
+		}
+		r = strings.NewReader(target)
+	} else {
+		src, err := l.base.Open(name)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		r = src
+	}
+	dst, err := l.layer.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		l.lock.Lock()
+		l.links[pathlib.Clean(name)] = true
+		l.lock.Unlock()
+	}
+	return l.layer.Chtimes(name, fi.ModTime(), fi.ModTime())
+}
+
+// Stat returns the info of the file without following the last link
+func (l *LayerFs) Stat(name string) (os.FileInfo, error) {
+	if fi, err := l.layer.Stat(name); err == nil {
+		return l.info(name, fi), nil
+	}
+	if l.hidden(name) {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return l.base.Stat(name)
+}
+
+func (l *LayerFs) Create(name string) (afero.File, error) {
+	return l.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (l *LayerFs) Open(name string) (afero.File, error) {
+	return l.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (l *LayerFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	var f afero.File
+	var err error
+	switch {
+	case !l.gone(name):
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+			f, err = l.cow.Open(name)
+			break
+		}
+		// The directories are copied up first, CopyOnWriteFs would
+		// create them without their attributes
+		if err := l.layerDir("open", pathlib.Dir(pathlib.Clean(name))); err != nil {
+			return nil, err
+		}
+		f, err = l.cow.OpenFile(name, flag, perm)
+	case flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	default:
+		// The file of the base was removed, a new one is created
+		if err := l.layerDir("open", pathlib.Dir(name)); err != nil {
+			return nil, err
+		}
+		f, err = l.layer.OpenFile(name, flag, perm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &layerFile{File: f, fs: l, name: pathlib.Clean(name)}, nil
+}
+
+func (l *LayerFs) Mkdir(name string, perm os.FileMode) error {
+	if _, err := l.Stat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EEXIST}
+	}
+	if err := l.layerDir("mkdir", pathlib.Dir(pathlib.Clean(name))); err != nil {
+		return err
+	}
+	if err := l.layer.Mkdir(name, perm); err != nil {
+		return err
+	}
+	// MemMapFs leaves the time of new directories unset
+	now := time.Now()
+	return l.layer.Chtimes(name, now, now)
+}
+
+func (l *LayerFs) MkdirAll(name string, perm os.FileMode) error {
+	name = pathlib.Clean(name)
+	if fi, err := l.Stat(name); err == nil {
+		if !fi.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+	if dir := pathlib.Dir(name); dir != name {
+		if err := l.MkdirAll(dir, perm); err != nil {
+			return err
+		}
+	}
+	return l.Mkdir(name, perm)
+}
+
+func (l *LayerFs) Remove(name string) error {
+	name = pathlib.Clean(name)
+	fi, err := l.Stat(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if fi.IsDir() {
+		f, err := l.Open(name)
+		if err != nil {
+			return err
+		}
+		names, _ := f.Readdirnames(-1)
+		f.Close()
+		if len(names) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	inBase := l.inBase(name)
+	if l.inLayer(name) {
+		if err := l.layer.Remove(name); err != nil {
+			return err
+		}
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.links, name)
+	if inBase {
+		l.removed[name] = true
+	}
+	return nil
+}
+
+func (l *LayerFs) RemoveAll(name string) error {
+	name = pathlib.Clean(name)
+	inBase := l.inBase(name)
+	if err := l.layer.RemoveAll(name); err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for p := range l.links {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(l.links, p)
+		}
+	}
+	if inBase {
+		l.removed[name] = true
+	}
+	return nil
+}
+
+// Rename moves the file in the layer, copying it up first if it is in the
+// base. The file left in the base is hidden
+func (l *LayerFs) Rename(oldname, newname string) error {
+	oldname, newname = pathlib.Clean(oldname), pathlib.Clean(newname)
+	if _, err := l.Stat(oldname); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	oldInBase, newInBase := l.inBase(oldname), l.inBase(newname)
+	if oldInBase {
+		if err := l.copyUp(oldname); err != nil {
+			return err
+		}
+	}
+	if err := l.layerDir("rename", pathlib.Dir(newname)); err != nil {
+		return err
+	}
+	if err := l.move(oldname, newname); err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for p := range l.links {
+		if p == newname || strings.HasPrefix(p, newname+"/") {
+			delete(l.links, p)
+		}
+	}
+	for p := range l.links {
+		if p == oldname || strings.HasPrefix(p, oldname+"/") {
+			delete(l.links, p)
+			l.links[newname+strings.TrimPrefix(p, oldname)] = true
+		}
+	}
+	if oldInBase {
+		l.removed[oldname] = true
+	}
+	if newInBase {
+		// The renamed file replaces the one of the base
+		l.removed[newname] = true
+	}
+	return nil
+}
+
+// move renames the file in the layer. Directories are moved file by file, as
+// MemMapFs renames the directory alone
+func (l *LayerFs) move(oldname, newname string) error {
+	fi, err := l.layer.Stat(oldname)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return l.layer.Rename(oldname, newname)
+	}
+	if nfi, err := l.layer.Stat(newname); err == nil {
+		if !nfi.IsDir() {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOTDIR}
+		}
+		if err := l.layer.Remove(newname); err != nil {
+			return err
+		}
+	}
+	if err := l.layer.Mkdir(newname, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	names, err := afero.ReadDir(l.layer, oldname)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := l.move(pathlib.Join(oldname, n.Name()), pathlib.Join(newname, n.Name())); err != nil {
+			return err
+		}
+	}
+	if err := l.layer.Remove(oldname); err != nil {
+		return err
+	}
+	return l.layer.Chtimes(newname, fi.ModTime(), fi.ModTime())
+}
+
+// Chmod changes the permission of the file, keeping its type which MemMapFs
+// would drop
+func (l *LayerFs) Chmod(name string, mode os.FileMode) error {
+	fi, err := l.Stat(name)
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+	}
+	if err := l.layerDir("chmod", pathlib.Dir(pathlib.Clean(name))); err != nil {
+		return err
+	}
+	return l.cow.Chmod(name, fi.Mode()&os.ModeType|mode&^os.ModeType)
+}
+
+func (l *LayerFs) Chtimes(name string, atime, mtime time.Time) error {
+	if l.gone(name) {
+		return &os.PathError{Op: "chtimes", Path: name, Err: os.ErrNotExist}
+	}
+	if err := l.layerDir("chtimes", pathlib.Dir(pathlib.Clean(name))); err != nil {
+		return err
+	}
+	return l.cow.Chtimes(name, atime, mtime)
+}
+
+// Symlink creates newname as a symbolic link to oldname
+func (l *LayerFs) Symlink(oldname, newname string) error {
+	newname = pathlib.Clean(newname)
+	if _, err := l.Stat(newname); err == nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EEXIST}
+	}
+	if err := l.layerDir("symlink", pathlib.Dir(newname)); err != nil {
+		return err
+	}
+	f, err := l.layer.OpenFile(newname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(oldname))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	l.links[newname] = true
+	l.lock.Unlock()
+	return nil
+}
+
+// Readlink returns the target of the symbolic link
+func (l *LayerFs) Readlink(name string) (string, error) {
+	switch {
+	case l.isLink(name):
+		f, err := l.layer.Open(name)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		target, err := ioutil.ReadAll(f)
+		return string(target), err
+	case l.inLayer(name):
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	case l.hidden(name):
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrNotExist}
+	}
+	return readlink(l.base, name)
+}
+
+// linkInfo is the info of a link stored as a file in the layer
+type linkInfo struct {
+	os.FileInfo
+}
+
+func (fi linkInfo) Mode() os.FileMode {
+	return os.ModeSymlink | 0777
+}
+
+func (fi linkInfo) IsDir() bool {
+	return false
+}
+
+// layerFile is the file opened from LayerFs, whose directory entries leave
+// out the hidden files of the base
+type layerFile struct {
+	afero.File
+	fs   *LayerFs
+	name string
+}
+
+func (f *layerFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.info(f.name, fi), nil
+}
+
+func (f *layerFile) Readdir(n int) ([]os.FileInfo, error) {
+	entries, err := f.File.Readdir(n)
+	res := entries[:0]
+	for _, fi := range entries {
+		p := pathlib.Join(f.name, fi.Name())
+		if !f.fs.gone(p) {
+			res = append(res, f.fs.info(p, fi))
+		}
+	}
+	return res, err
+}
+
+func (f *layerFile) Readdirnames(n int) ([]string, error) {
+	entries, err := f.Readdir(n)
+	names := make([]string, len(entries))
+	for i, fi := range entries {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
+
+// Readlink returns the target if the file is a symbolic link
+func (f *layerFile) Readlink() (string, error) {
+	if f.fs.isLink(f.name) {
+		return f.fs.Readlink(f.name)
+	}
+	if r, ok := f.File.(interface {
+		Readlink() (string, error)
+	}); ok {
+		return r.Readlink()
+	}
+	return "", &os.PathError{Op: "readlink", Path: f.name, Err: syscall.EINVAL}
+}
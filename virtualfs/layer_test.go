@@ -0,0 +1,98 @@
+package virtualfs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestLayerFs(t *testing.T) {
+	base := afero.NewMemMapFs()
+	base.Mkdir("/etc", 0755)
+	base.Mkdir("/etc/skel", 0755)
+	afero.WriteFile(base, "/etc/hostname", []byte("base\n"), 0644)
+	afero.WriteFile(base, "/etc/skel/.bashrc", []byte("bashrc\n"), 0644)
+	old := time.Date(2016, 8, 3, 12, 13, 0, 0, time.UTC)
+	base.Chtimes("/etc", old, old)
+	fs := NewLayerFs(afero.NewReadOnlyFs(base), afero.NewMemMapFs())
+
+	if err := fs.Remove("/etc/hostname"); err != nil {
+		t.Fatalf("Removing file of the base: %v", err)
+	}
+	if _, err := fs.Stat("/etc/hostname"); !os.IsNotExist(err) {
+		t.Errorf("Removed file still exists: %v", err)
+	}
+	if err := afero.WriteFile(fs, "/etc/hostname", []byte("layer\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := afero.ReadFile(fs, "/etc/hostname"); string(data) != "layer\n" {
+		t.Errorf("Recreated file reads %q", data)
+	}
+	if fi, err := fs.Stat("/etc"); err != nil || !fi.ModTime().Equal(old) || fi.Mode() != os.ModeDir|0755 {
+		t.Errorf("Directory copied up is %v, %v", fi, err)
+	}
+	if err := fs.Remove("/etc/skel"); errno(err) != syscall.ENOTEMPTY {
+		t.Errorf("Removing directory with files of the base: %v", err)
+	}
+	if err := fs.Rename("/etc/skel", "/etc/skel.old"); err != nil {
+		t.Fatalf("Renaming directory of the base: %v", err)
+	}
+	if data, _ := afero.ReadFile(fs, "/etc/skel.old/.bashrc"); string(data) != "bashrc\n" {
+		t.Errorf("Renamed directory has %q", data)
+	}
+	if names, _ := afero.ReadDir(fs, "/etc"); len(names) != 2 || names[0].Name() != "hostname" || names[1].Name() != "skel.old" {
+		t.Errorf("Unexpected entries %v", names)
+	}
+
+	if err := fs.Symlink("hostname", "/etc/name"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Symlink("hostname", "/etc/name"); errno(err) != syscall.EEXIST {
+		t.Errorf("Creating existing link: %v", err)
+	}
+	if fi, err := fs.Stat("/etc/name"); err != nil || fi.Mode() != os.ModeSymlink|0777 {
+		t.Errorf("Link is %v, %v", fi, err)
+	}
+	if target, err := fs.Readlink("/etc/name"); target != "hostname" || err != nil {
+		t.Errorf("Link points to %q, %v", target, err)
+	}
+	if err := fs.Rename("/etc/name", "/etc/skel.old/name"); err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := fs.Readlink("/etc/skel.old/name"); target != "hostname" {
+		t.Errorf("Renamed link points to %q", target)
+	}
+}
+
+func TestMountFsLinks(t *testing.T) {
+	root := NewLayerFs(afero.NewReadOnlyFs(afero.NewMemMapFs()), afero.NewMemMapFs())
+	root.Mkdir("/etc", 0755)
+	afero.WriteFile(root, "/etc/hostname", []byte("syrup\n"), 0644)
+	fs := NewMountFs(root, Mount{Dir: "/tmp", Fs: NewTmpFs(0777 | os.ModeSticky)})
+
+	if err := fs.Symlink("/etc", "/tmp/etc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Symlink("../tmp/etc/hostname", "/etc/name"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := afero.ReadFile(fs, "/etc/name"); string(data) != "syrup\n" {
+		t.Errorf("Reading through links across mounts: %q, %v", data, err)
+	}
+	if fi, err := fs.Stat("/tmp/etc/name"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Last link followed by Stat: %v, %v", fi, err)
+	}
+	if err := afero.WriteFile(fs, "/tmp/etc/new", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Stat("/etc/new"); err != nil {
+		t.Errorf("File created through link is not in its directory: %v", err)
+	}
+	fs.Symlink("loop", "/tmp/loop")
+	if _, err := fs.Open("/tmp/loop"); errno(err) != syscall.ELOOP {
+		t.Errorf("Opening link to itself: %v", err)
+	}
+}
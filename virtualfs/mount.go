@@ -0,0 +1,418 @@
+package virtualfs
+
+import (
+	"os"
+	pathlib "path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Kinds of filesystems in the mount table of the configuration
+const (
+	// FsImage is the image with the layer of the session, mounted at /
+	FsImage = "image"
+	// FsHost is a directory of the host, always mounted read-only
+	FsHost  = "host"
+	FsTmpfs = "tmpfs"
+	FsProc  = "proc"
+	FsSys   = "sysfs"
+	FsDev   = "devtmpfs"
+)
+
+// Mount is a filesystem grafted at a directory
+type Mount struct {
+	// Dir is the mount point
+	Dir string
+	Fs  afero.Fs
+	// Kind is the filesystem to mount, for mounts in the configuration
+	Kind string
+	// Path is the directory of the host mounted by FsHost
+	Path string
+	// Source, Type and Options are shown in the mount table
+	Source  string
+	Type    string
+	Options string
+	// Size and Used are the space in KiB shown by df. The space used in
+	// tmpfs is counted from its files
+	Size, Used int
+}
+
+// ReadOnly tells if the filesystem is mounted read-only
+func (mnt Mount) ReadOnly() bool {
+	for _, opt := range strings.Split(mnt.Options, ",") {
+		if opt == "ro" {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage returns the size and used space of the filesystem in KiB
+func (mnt Mount) Usage() (size, used int) {
+	if mnt.Kind != FsTmpfs || mnt.Fs == nil {
+		return mnt.Size, mnt.Used
+	}
+	// Files take whole pages
+	afero.Walk(mnt.Fs, "/", func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			used += int((fi.Size() + 4095) / 4096 * 4)
+		}
+		return nil
+	})
+	return mnt.Size, used
+}
+
+// MountFs is a filesystem with others mounted at directories of it. The
+// mount points need not exist in the root filesystem
+type MountFs struct {
+	root   afero.Fs
+	mounts []Mount
+	// routes are the mounts, deeper mount points first
+	routes []Mount
+}
+
+// NewMountFs returns the root filesystem with the mounts
+func NewMountFs(root afero.Fs, mounts ...Mount) *MountFs {
+	m := &MountFs{root: root, mounts: make([]Mount, len(mounts))}
+	for i, mnt := range mounts {
+		mnt.Dir = pathlib.Clean("/" + mnt.Dir)
+		m.mounts[i] = mnt
+	}
+	// Deeper mounts are looked up first
+	m.routes = append([]Mount(nil), m.mounts...)
+	sort.SliceStable(m.routes, func(i, j int) bool { return len(m.routes[i].Dir) > len(m.routes[j].Dir) })
+	return m
+}
+
+func (m *MountFs) Name() string {
+	return "MountFs"
+}
+
+// Mounts returns the mounts in the order they are mounted
+func (m *MountFs) Mounts() []Mount {
+	return append([]Mount(nil), m.mounts...)
+}
+
+// MountOf returns the mount the file is in
+func (m *MountFs) MountOf(name string) (Mount, bool) {
+	name = pathlib.Clean(name)
+	for _, mnt := range m.routes {
+		if name == mnt.Dir || mnt.Dir == "/" || strings.HasPrefix(name, mnt.Dir+"/") {
+			return mnt, true
+		}
+	}
+	return Mount{}, false
+}
+
+// route returns the filesystem the file is in and its path there, and the
+// mount point if the file is one
+func (m *MountFs) route(name string) (afero.Fs, string, bool) {
+	name = pathlib.Clean(name)
+	for _, mnt := range m.routes {
+		if name == mnt.Dir {
+			return mnt.Fs, "/", true
+		}
+		if mnt.Dir == "/" {
+			return mnt.Fs, name, false
+		}
+		if strings.HasPrefix(name, mnt.Dir+"/") {
+			return mnt.Fs, name[len(mnt.Dir):], false
+		}
+	}
+	return m.root, name, false
+}
+
+// resolve returns the path with the symbolic links in it resolved, across
+// the mounted filesystems. The last element is followed if follow is set
+func (m *MountFs) resolve(op, name string, follow bool) (string, error) {
+	parts := strings.Split(pathlib.Clean("/"+name), "/")
+	cur := "/"
+	for hops := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			cur = pathlib.Dir(cur)
+			continue
+		}
+		next := pathlib.Join(cur, part)
+		if len(parts) == 0 && !follow {
+			return next, nil
+		}
+		fs, p, _ := m.route(next)
+		fi, err := fs.Stat(p)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		target, err := readlink(fs, p)
+		if err != nil {
+			cur = next
+			continue
+		}
+		if hops++; hops > 40 {
+			return "", &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		if pathlib.IsAbs(target) {
+			cur = "/"
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return cur, nil
+}
+
+// lookup routes the path with the symbolic links in it resolved
+func (m *MountFs) lookup(op, name string, follow bool) (afero.Fs, string, bool, error) {
+	name, err := m.resolve(op, name, follow)
+	if err != nil {
+		return nil, "", false, err
+	}
+	fs, p, point := m.route(name)
+	return fs, p, point, nil
+}
+
+// children returns the mount points right under the directory
+func (m *MountFs) children(dir string) []string {
+	dir = pathlib.Clean(dir)
+	var res []string
+	for _, mnt := range m.routes {
+		if mnt.Dir != dir && pathlib.Dir(mnt.Dir) == dir {
+			res = append(res, mnt.Dir)
+		}
+	}
+	return res
+}
+
+func (m *MountFs) Stat(name string) (os.FileInfo, error) {
+	name, err := m.resolve("stat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	fs, p, point := m.route(name)
+	fi, err := fs.Stat(p)
+	if err != nil || !point {
+		return fi, err
+	}
+	return namedInfo{fi, pathlib.Base(name)}, nil
+}
+
+func (m *MountFs) Create(name string) (afero.File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *MountFs) Open(name string) (afero.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the file the symbolic links lead to
+func (m *MountFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	name, err := m.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	fs, p, _ := m.route(name)
+	var f afero.File
+	if flag == os.O_RDONLY {
+		f, err = fs.Open(p)
+	} else {
+		f, err = fs.OpenFile(p, flag, perm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.mountFile(name, f), nil
+}
+
+// mountFile adds the mount points under the directory to its entries
+func (m *MountFs) mountFile(name string, f afero.File) afero.File {
+	points := m.children(name)
+	if len(points) == 0 {
+		return f
+	}
+	return &mountDir{File: f, fs: m, points: points}
+}
+
+func (m *MountFs) Mkdir(name string, perm os.FileMode) error {
+	fs, p, point, err := m.lookup("mkdir", name, false)
+	switch {
+	case err != nil:
+		return err
+	case point:
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EEXIST}
+	}
+	return fs.Mkdir(p, perm)
+}
+
+func (m *MountFs) MkdirAll(name string, perm os.FileMode) error {
+	fs, p, _, err := m.lookup("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	return fs.MkdirAll(p, perm)
+}
+
+func (m *MountFs) Remove(name string) error {
+	fs, p, point, err := m.lookup("remove", name, false)
+	switch {
+	case err != nil:
+		return err
+	case point:
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	return fs.Remove(p)
+}
+
+func (m *MountFs) RemoveAll(name string) error {
+	fs, p, point, err := m.lookup("remove", name, false)
+	switch {
+	case err != nil:
+		return err
+	case point:
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	return fs.RemoveAll(p)
+}
+
+// Rename moves the file within its filesystem. Moving between filesystems
+// fails with EXDEV, for which mv copies the file instead
+func (m *MountFs) Rename(oldname, newname string) error {
+	oldFs, oldPath, oldPoint, err := m.lookup("rename", oldname, false)
+	if err != nil {
+		return err
+	}
+	newFs, newPath, newPoint, err := m.lookup("rename", newname, false)
+	switch {
+	case err != nil:
+		return err
+	case oldPoint || newPoint:
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EBUSY}
+	case oldFs != newFs:
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	return oldFs.Rename(oldPath, newPath)
+}
+
+func (m *MountFs) Chmod(name string, mode os.FileMode) error {
+	fs, p, _, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	return fs.Chmod(p, mode)
+}
+
+func (m *MountFs) Chtimes(name string, atime, mtime time.Time) error {
+	fs, p, _, err := m.lookup("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	return fs.Chtimes(p, atime, mtime)
+}
+
+// Chown changes the owner of the file if its filesystem keeps the
+// ownership. Like lchown, the last symbolic link is not followed
+func (m *MountFs) Chown(name string, uid, gid int) error {
+	fs, p, _, err := m.lookup("chown", name, false)
+	if err != nil {
+		return err
+	}
+	if c, ok := fs.(interface {
+		Chown(name string, uid, gid int) error
+	}); ok {
+		return c.Chown(p, uid, gid)
+	}
+	_, err = fs.Stat(p)
+	return err
+}
+
+// Symlink creates the symbolic link if its filesystem supports it
+func (m *MountFs) Symlink(oldname, newname string) error {
+	fs, p, _, err := m.lookup("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if s, ok := fs.(interface {
+		Symlink(oldname, newname string) error
+	}); ok {
+		return s.Symlink(oldname, p)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EPERM}
+}
+
+// Readlink returns the target of the symbolic link
+func (m *MountFs) Readlink(name string) (string, error) {
+	fs, p, _, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	return readlink(fs, p)
+}
+
+// namedInfo is the info of the root of a mounted filesystem, named after
+// the mount point
+type namedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi namedInfo) Name() string { return fi.name }
+
+// mountDir is a directory with mount points in it, which are listed with
+// the info of the mounted filesystems whether or not they exist in the
+// directory
+type mountDir struct {
+	afero.File
+	fs     *MountFs
+	points []string
+	done   bool
+}
+
+func (d *mountDir) Readdir(count int) ([]os.FileInfo, error) {
+	entries, err := d.File.Readdir(count)
+	if d.done || count > 0 && err == nil && len(entries) == count {
+		return d.replace(entries), err
+	}
+	d.done = true
+	entries = d.replace(entries)
+	for _, p := range d.points {
+		if fi, err := d.fs.Stat(p); err == nil {
+			entries = append(entries, fi)
+		}
+	}
+	if len(entries) > 0 {
+		err = nil
+	}
+	return entries, err
+}
+
+// replace drops the entries of the mount points, which are shadowed by the
+// mounted filesystems and added at the end
+func (d *mountDir) replace(entries []os.FileInfo) []os.FileInfo {
+	res := entries[:0]
+	for _, fi := range entries {
+		shadowed := false
+		for _, p := range d.points {
+			if pathlib.Base(p) == fi.Name() {
+				shadowed = true
+			}
+		}
+		if !shadowed {
+			res = append(res, fi)
+		}
+	}
+	return res
+}
+
+func (d *mountDir) Readdirnames(count int) ([]string, error) {
+	entries, err := d.Readdir(count)
+	names := make([]string, len(entries))
+	for i, fi := range entries {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
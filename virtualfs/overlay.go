@@ -0,0 +1,199 @@
+package virtualfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Scopes of the writable layers over the image
+const (
+	// ScopeShared is a single layer seen by all sessions
+	ScopeShared = "shared"
+	// ScopeSession is a layer for each connection, so that the changes of
+	// a client are never seen by another
+	ScopeSession = "session"
+	// ScopeIP is a layer for each source address, kept between the
+	// connections from it until it expires
+	ScopeIP = "ip"
+)
+
+// Storages of the writable layers
+const (
+	StorageMemory = "memory"
+	StorageDisk   = "disk"
+)
+
+// OverlayConfig describes how the writable layers are created
+type OverlayConfig struct {
+	Scope   string
+	Storage string
+	// Dir holds the layers stored on disk. The shared layer is the
+	// directory itself, the others are in session/ and ip/ under it
+	Dir string
+	// Expiry is the time an unused layer is kept. Zero keeps them forever
+	Expiry time.Duration
+	// Dropped, if set, is called with the key of a layer no longer kept,
+	// so that what is kept for the sessions of the layer can go with it
+	Dropped func(key string)
+}
+
+// Overlays hands out the copy-on-write filesystems of the image for the
+// sessions, each with the writable layer of its scope
+type Overlays struct {
+	base   afero.Fs
+	host   afero.Fs
+	config OverlayConfig
+	lock   sync.Mutex
+	layers map[string]*overlay
+}
+
+// overlay is a writable layer and the filesystem over the image with it
+type overlay struct {
+	fs       afero.Fs
+	dir      string
+	refs     int
+	lastUsed time.Time
+}
+
+// NewOverlays returns the overlays of the image. Layers on disk are kept
+// in the directory of host
+func NewOverlays(base, host afero.Fs, config OverlayConfig) *Overlays {
+	switch config.Scope {
+	case ScopeShared, ScopeIP:
+	default:
+		config.Scope = ScopeSession
+	}
+	if config.Storage != StorageMemory {
+		config.Storage = StorageDisk
+	}
+	return &Overlays{
+		base:   base,
+		host:   host,
+		config: config,
+		layers: make(map[string]*overlay),
+	}
+}
+
+// Key returns the name of the layer of the session in the scope, which is
+// also its directory relative to Dir when stored on disk
+func (o *Overlays) Key(sessionID, srcIP string) string {
+	switch o.config.Scope {
+	case ScopeShared:
+		return ""
+	case ScopeIP:
+		// Colons of IPv6 addresses are not allowed in names on all systems
+		return filepath.Join(ScopeIP, strings.Replace(srcIP, ":", "_", -1))
+	}
+	return filepath.Join(ScopeSession, sessionID)
+}
+
+// Acquire returns the filesystem of the session and the function to call
+// when the session ends. SessionID must be usable as a file name
+func (o *Overlays) Acquire(sessionID, srcIP string) (afero.Fs, func()) {
+	key := o.Key(sessionID, srcIP)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	ov, ok := o.layers[key]
+	if !ok {
+		ov = &overlay{}
+		var layer afero.Fs
+		if o.config.Storage == StorageMemory {
+			layer = afero.NewMemMapFs()
+			// The root of MemMapFs has neither type nor time, it takes
+			// those of the image like NewTmpFs does
+			if fi, err := o.base.Stat("/"); err == nil {
+				layer.Chmod("/", os.ModeDir|fi.Mode().Perm())
+				layer.Chtimes("/", fi.ModTime(), fi.ModTime())
+			}
+		} else {
+			ov.dir = filepath.Join(o.config.Dir, key)
+			o.host.MkdirAll(ov.dir, 0700)
+			layer = afero.NewBasePathFs(o.host, ov.dir)
+		}
+		// The layer cannot store the owners of the files, they are kept
+		// with it in memory, as are the removed files and the links
+		ov.fs = NewOwnerFs(NewLayerFs(o.base, layer))
+		o.layers[key] = ov
+	}
+	ov.refs++
+	var once sync.Once
+	return ov.fs, func() {
+		once.Do(func() { o.release(key) })
+	}
+}
+
+func (o *Overlays) release(key string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	ov, ok := o.layers[key]
+	if !ok {
+		return
+	}
+	ov.refs--
+	ov.lastUsed = time.Now()
+	if ov.refs > 0 {
+		return
+	}
+	if len(ov.dir) > 0 {
+		// The time of the directory tells the last use of the layer after
+		// restarts
+		o.host.Chtimes(ov.dir, ov.lastUsed, ov.lastUsed)
+	}
+	// The layer of a session is never used again. In memory it is dropped
+	// now, on disk it stays until it expires
+	if o.config.Scope == ScopeSession {
+		o.drop(key)
+	}
+}
+
+// drop forgets the layer kept in memory
+func (o *Overlays) drop(key string) {
+	delete(o.layers, key)
+	if o.config.Dropped != nil {
+		o.config.Dropped(key)
+	}
+}
+
+// Cleanup removes the layers unused for longer than the expiry, including
+// those on disk left from earlier runs. The shared layer is never removed
+func (o *Overlays) Cleanup(now time.Time) {
+	if o.config.Expiry <= 0 || o.config.Scope == ScopeShared {
+		return
+	}
+	deadline := now.Add(-o.config.Expiry)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for key, ov := range o.layers {
+		if ov.refs == 0 && ov.lastUsed.Before(deadline) {
+			o.drop(key)
+		}
+	}
+	if o.config.Storage != StorageDisk {
+		return
+	}
+	for _, scope := range []string{ScopeSession, ScopeIP} {
+		dir := filepath.Join(o.config.Dir, scope)
+		entries, err := afero.ReadDir(o.host, dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range entries {
+			if _, inUse := o.layers[filepath.Join(scope, fi.Name())]; inUse || !fi.ModTime().Before(deadline) {
+				continue
+			}
+			o.host.RemoveAll(filepath.Join(dir, fi.Name()))
+		}
+	}
+}
+
+// Active returns the number of layers in use or kept in memory
+func (o *Overlays) Active() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.layers)
+}
@@ -0,0 +1,98 @@
+package virtualfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func newTestOverlays(t *testing.T, host afero.Fs, config OverlayConfig) *Overlays {
+	vfs, err := NewVirtualFS("../filesystem.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewOverlays(vfs, host, config)
+}
+
+func TestOverlayScopes(t *testing.T) {
+	tests := []struct {
+		scope      string
+		sameSrc    bool
+		otherSrc   bool
+		afterClose bool
+	}{
+		{ScopeShared, true, true, true},
+		{ScopeSession, false, false, false},
+		{ScopeIP, true, false, true},
+	}
+	for _, test := range tests {
+		for _, storage := range []string{StorageMemory, StorageDisk} {
+			o := newTestOverlays(t, afero.NewMemMapFs(), OverlayConfig{Scope: test.scope, Storage: storage, Dir: "/saved"})
+			fs1, release1 := o.Acquire("s1", "10.0.0.1")
+			fs2, release2 := o.Acquire("s2", "10.0.0.1")
+			fs3, release3 := o.Acquire("s3", "10.0.0.2")
+			if err := afero.WriteFile(fs1, "/etc/dropped", []byte("x"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if exists, _ := afero.Exists(fs2, "/etc/dropped"); exists != test.sameSrc {
+				t.Errorf("%v %v: file seen by session of same source: %v", test.scope, storage, exists)
+			}
+			if exists, _ := afero.Exists(fs3, "/etc/dropped"); exists != test.otherSrc {
+				t.Errorf("%v %v: file seen by session of other source: %v", test.scope, storage, exists)
+			}
+			release1()
+			release2()
+			release3()
+			fs4, _ := o.Acquire("s4", "10.0.0.1")
+			if exists, _ := afero.Exists(fs4, "/etc/dropped"); exists != test.afterClose {
+				t.Errorf("%v %v: file seen by later session of same source: %v", test.scope, storage, exists)
+			}
+		}
+	}
+}
+
+func TestOverlayCleanup(t *testing.T) {
+	host := afero.NewMemMapFs()
+	// A layer left from an earlier run
+	host.MkdirAll("/saved/ip/10.0.0.9", 0700)
+	old := time.Now().Add(-48 * time.Hour)
+	host.Chtimes("/saved/ip/10.0.0.9", old, old)
+
+	var dropped []string
+	o := newTestOverlays(t, host, OverlayConfig{Scope: ScopeIP, Storage: StorageDisk, Dir: "/saved", Expiry: time.Hour,
+		Dropped: func(key string) { dropped = append(dropped, key) }})
+	fs1, release1 := o.Acquire("s1", "10.0.0.1")
+	_, release2 := o.Acquire("s2", "::1")
+	afero.WriteFile(fs1, "/etc/dropped", []byte("x"), 0644)
+	release1()
+	release1()
+	o.Cleanup(time.Now())
+	if exists, _ := afero.Exists(host, "/saved/ip/10.0.0.9"); exists {
+		t.Error("Expired layer of earlier run not removed")
+	}
+	if exists, _ := afero.Exists(host, "/saved/ip/10.0.0.1/etc/dropped"); !exists || len(dropped) > 0 {
+		t.Errorf("Unexpired layer removed, dropped %v", dropped)
+	}
+	o.Cleanup(time.Now().Add(2 * time.Hour))
+	if exists, _ := afero.Exists(host, "/saved/ip/10.0.0.1"); exists || len(dropped) != 1 || dropped[0] != o.Key("s1", "10.0.0.1") {
+		t.Errorf("Expired layer not removed, dropped %v", dropped)
+	}
+	if exists, _ := afero.Exists(host, "/saved/ip/__1"); !exists {
+		t.Error("Layer in use removed")
+	}
+	if o.Active() != 1 {
+		t.Errorf("Unexpected active layers %v", o.Active())
+	}
+	release2()
+}
+
+func TestOverlayRoot(t *testing.T) {
+	o := newTestOverlays(t, afero.NewMemMapFs(), OverlayConfig{Scope: ScopeSession, Storage: StorageMemory})
+	fs, release := o.Acquire("s1", "10.0.0.1")
+	defer release()
+	if fi, err := fs.Stat("/"); err != nil || fi.Mode() != os.ModeDir|0755 || fi.ModTime().IsZero() {
+		t.Errorf("Root is %v, %v", fi, err)
+	}
+}
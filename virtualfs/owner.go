@@ -0,0 +1,296 @@
+package virtualfs
+
+import (
+	"os"
+	pathlib "path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// OwnerFs keeps the owner and mode of the files in a filesystem that cannot
+// store them, such as a writable layer over the image. Files and
+// directories copied up to the layer keep the attributes they had in the
+// image. The attributes are kept in memory only
+type OwnerFs struct {
+	afero.Fs
+	lock  sync.RWMutex
+	attrs map[string]fileAttr
+}
+
+type fileAttr struct {
+	uid, gid int
+	mode     os.FileMode
+}
+
+// attrInfo is the file info with the kept attributes
+type attrInfo struct {
+	os.FileInfo
+	attr fileAttr
+}
+
+func (fi attrInfo) Mode() os.FileMode {
+	return fi.FileInfo.Mode()&os.ModeType | fi.attr.mode&^os.ModeType
+}
+
+func (fi attrInfo) Sys() interface{} {
+	_, _, atime, mtime := GetExtraInfo(fi.FileInfo)
+	if mtime.IsZero() {
+		mtime = fi.ModTime()
+	}
+	if atime.IsZero() {
+		atime = mtime
+	}
+	return ZipExtraInfo{uid: fi.attr.uid, gid: fi.attr.gid, atime: atime, mtime: mtime}
+}
+
+// NewOwnerFs returns the filesystem keeping the attributes of the files of
+// fs
+func NewOwnerFs(fs afero.Fs) *OwnerFs {
+	return &OwnerFs{
+		Fs: fs,
+		// The root of the layer has no mode of its own
+		attrs: map[string]fileAttr{"/": {mode: os.ModeDir | 0755}},
+	}
+}
+
+func (o *OwnerFs) Name() string {
+	return "OwnerFs"
+}
+
+// keep records the attributes of the file and the directories leading to
+// it, before the call that may copy them up to the layer
+func (o *OwnerFs) keep(name string) {
+	name = pathlib.Clean(name)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for p := name; ; p = pathlib.Dir(p) {
+		if _, ok := o.attrs[p]; !ok {
+			if fi, err := o.Fs.Stat(p); err == nil {
+				uid, gid, _, _ := GetExtraInfo(fi)
+				o.attrs[p] = fileAttr{uid: uid, gid: gid, mode: fi.Mode()}
+			}
+		}
+		if p == "/" || p == "." {
+			return
+		}
+	}
+}
+
+// update changes the kept attributes of the file
+func (o *OwnerFs) update(name string, change func(*fileAttr)) {
+	name = pathlib.Clean(name)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if a, ok := o.attrs[name]; ok {
+		change(&a)
+		o.attrs[name] = a
+	}
+}
+
+// forget drops the attributes of the file and, if any, the files under it
+func (o *OwnerFs) forget(name string) {
+	name = pathlib.Clean(name)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for p := range o.attrs {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(o.attrs, p)
+		}
+	}
+}
+
+// info returns the file info with the kept attributes of the file
+func (o *OwnerFs) info(name string, fi os.FileInfo) os.FileInfo {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	if a, ok := o.attrs[pathlib.Clean(name)]; ok {
+		return attrInfo{fi, a}
+	}
+	return fi
+}
+
+func (o *OwnerFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := o.Fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return o.info(name, fi), nil
+}
+
+func (o *OwnerFs) Create(name string) (afero.File, error) {
+	return o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (o *OwnerFs) Open(name string) (afero.File, error) {
+	f, err := o.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ownedFile{f, o, name}, nil
+}
+
+func (o *OwnerFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		o.keep(name)
+	}
+	f, err := o.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &ownedFile{f, o, name}, nil
+}
+
+func (o *OwnerFs) Mkdir(name string, perm os.FileMode) error {
+	o.keep(name)
+	return o.Fs.Mkdir(name, perm)
+}
+
+func (o *OwnerFs) MkdirAll(name string, perm os.FileMode) error {
+	o.keep(name)
+	return o.Fs.MkdirAll(name, perm)
+}
+
+func (o *OwnerFs) Remove(name string) error {
+	if err := o.Fs.Remove(name); err != nil {
+		return err
+	}
+	o.forget(name)
+	return nil
+}
+
+func (o *OwnerFs) RemoveAll(name string) error {
+	if err := o.Fs.RemoveAll(name); err != nil {
+		return err
+	}
+	o.forget(name)
+	return nil
+}
+
+func (o *OwnerFs) Rename(oldname, newname string) error {
+	o.keep(oldname)
+	o.keep(pathlib.Dir(newname))
+	if err := o.Fs.Rename(oldname, newname); err != nil {
+		return err
+	}
+	oldname, newname = pathlib.Clean(oldname), pathlib.Clean(newname)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for p := range o.attrs {
+		if p == newname || strings.HasPrefix(p, newname+"/") {
+			delete(o.attrs, p)
+		}
+	}
+	for p, a := range o.attrs {
+		if p == oldname || strings.HasPrefix(p, oldname+"/") {
+			delete(o.attrs, p)
+			o.attrs[newname+strings.TrimPrefix(p, oldname)] = a
+		}
+	}
+	return nil
+}
+
+func (o *OwnerFs) Chmod(name string, mode os.FileMode) error {
+	o.keep(name)
+	if err := o.Fs.Chmod(name, mode); err != nil {
+		return err
+	}
+	o.update(name, func(a *fileAttr) { a.mode = a.mode&os.ModeType | mode&^os.ModeType })
+	return nil
+}
+
+func (o *OwnerFs) Chtimes(name string, atime, mtime time.Time) error {
+	o.keep(name)
+	return o.Fs.Chtimes(name, atime, mtime)
+}
+
+// Chown records the new owner of the file. The file is not changed in the
+// wrapped filesystem
+func (o *OwnerFs) Chown(name string, uid, gid int) error {
+	o.keep(name)
+	if _, err := o.Fs.Stat(name); err != nil {
+		return err
+	}
+	o.update(name, func(a *fileAttr) { a.uid, a.gid = uid, gid })
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname if the wrapped
+// filesystem supports it
+func (o *OwnerFs) Symlink(oldname, newname string) error {
+	s, ok := o.Fs.(interface {
+		Symlink(oldname, newname string) error
+	})
+	if !ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	o.keep(pathlib.Dir(pathlib.Clean(newname)))
+	if err := s.Symlink(oldname, newname); err != nil {
+		return err
+	}
+	o.forget(newname)
+	return nil
+}
+
+// Readlink returns the target of the symbolic link
+func (o *OwnerFs) Readlink(name string) (string, error) {
+	return readlink(o.Fs, name)
+}
+
+// readlink returns the target of the symbolic link in the filesystem, or
+// the one carried by the file opened from the image
+func readlink(fs afero.Fs, name string) (string, error) {
+	if r, ok := fs.(interface {
+		Readlink(name string) (string, error)
+	}); ok {
+		return r.Readlink(name)
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if r, ok := f.(interface {
+		Readlink() (string, error)
+	}); ok {
+		return r.Readlink()
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+}
+
+// ownedFile is the file opened from OwnerFs, whose info has the kept
+// attributes
+type ownedFile struct {
+	afero.File
+	fs   *OwnerFs
+	name string
+}
+
+func (f *ownedFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.info(f.name, fi), nil
+}
+
+func (f *ownedFile) Readdir(n int) ([]os.FileInfo, error) {
+	entries, err := f.File.Readdir(n)
+	for i, fi := range entries {
+		entries[i] = f.fs.info(pathlib.Join(f.name, fi.Name()), fi)
+	}
+	return entries, err
+}
+
+// Readlink returns the target if the file is a symbolic link
+func (f *ownedFile) Readlink() (string, error) {
+	if r, ok := f.File.(interface {
+		Readlink() (string, error)
+	}); ok {
+		return r.Readlink()
+	}
+	return "", &os.PathError{Op: "readlink", Path: f.name, Err: syscall.EINVAL}
+}
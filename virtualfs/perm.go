@@ -0,0 +1,487 @@
+package virtualfs
+
+import (
+	"os"
+	pathlib "path"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Access bits of PermFs.Access, as of access(2)
+const (
+	AccessRead  = 4
+	AccessWrite = 2
+	AccessExec  = 1
+)
+
+// Credentials is the user the files are accessed as
+type Credentials struct {
+	UID int
+	GID int
+	// Groups are the supplementary groups of the user
+	Groups []int
+}
+
+func (c Credentials) inGroup(gid int) bool {
+	if gid == c.GID {
+		return true
+	}
+	for _, g := range c.Groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// PermFs checks the permission bits and the ownership of the files against
+// the credentials before passing the calls to the wrapped filesystem, like
+// the kernel does for the processes of the user. Root passes all checks
+// except executing files without any execute bit. Files created by the user
+// are given to the user when the wrapped filesystem keeps the ownership
+type PermFs struct {
+	fs   afero.Fs
+	cred Credentials
+}
+
+// NewPermFs returns the filesystem accessed as the user of the credentials
+func NewPermFs(fs afero.Fs, cred Credentials) *PermFs {
+	return &PermFs{fs: fs, cred: cred}
+}
+
+func (p *PermFs) Name() string {
+	return "PermFs"
+}
+
+func (p *PermFs) root() bool {
+	return p.cred.UID == 0
+}
+
+// allowed tells if the user has the access to the file
+func (p *PermFs) allowed(fi os.FileInfo, access uint32) bool {
+	if p.root() {
+		return access&AccessExec == 0 || fi.IsDir() || fi.Mode()&0111 != 0
+	}
+	uid, gid, _, _ := GetExtraInfo(fi)
+	perm := uint32(fi.Mode().Perm())
+	switch {
+	case uid == p.cred.UID:
+		perm >>= 6
+	case p.cred.inGroup(gid):
+		perm >>= 3
+	}
+	return perm&access == access
+}
+
+// owns tells if the user owns the file
+func (p *PermFs) owns(fi os.FileInfo) bool {
+	uid, _, _, _ := GetExtraInfo(fi)
+	return p.root() || uid == p.cred.UID
+}
+
+// lookup checks the search permission of the directories leading to the
+// file and returns the info of the file
+func (p *PermFs) lookup(op, name string) (os.FileInfo, error) {
+	name = pathlib.Clean(name)
+	var dirs []string
+	for dir := pathlib.Dir(name); dir != name; dir = pathlib.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+	for _, dir := range dirs {
+		fi, err := p.statDir(dir)
+		switch {
+		case err != nil:
+			return nil, err
+		case !fi.IsDir():
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		case !p.allowed(fi, AccessExec):
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.EACCES}
+		}
+	}
+	return p.fs.Stat(name)
+}
+
+// follow looks the file up like lookup, following the symbolic links. It
+// returns the path the links lead to as well
+func (p *PermFs) follow(op, name string) (os.FileInfo, string, error) {
+	for hops := 0; ; hops++ {
+		fi, err := p.lookup(op, name)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			return fi, name, err
+		}
+		if hops == 40 {
+			return nil, name, &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		target, err := readlink(p.fs, name)
+		if err != nil {
+			return fi, name, nil
+		}
+		if !pathlib.IsAbs(target) {
+			target = pathlib.Join(pathlib.Dir(pathlib.Clean(name)), target)
+		}
+		name = target
+	}
+}
+
+// statDir returns the info of the directory, following it if it is a
+// symbolic link
+func (p *PermFs) statDir(dir string) (os.FileInfo, error) {
+	fi, err := p.fs.Stat(dir)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return fi, err
+	}
+	f, err := p.fs.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// checkDir checks that the user can add or remove entries of the directory
+// of the file, and returns the info of the directory
+func (p *PermFs) checkDir(op, name string) (os.FileInfo, error) {
+	fi, err := p.statDir(pathlib.Dir(pathlib.Clean(name)))
+	switch {
+	case err != nil:
+		return nil, err
+	case !fi.IsDir():
+		return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	case !p.allowed(fi, AccessWrite|AccessExec):
+		return nil, &os.PathError{Op: op, Path: name, Err: syscall.EACCES}
+	}
+	return fi, nil
+}
+
+// checkSticky checks that the user can remove or replace the file in the
+// directory, which only the owners of them can when the directory is sticky
+func (p *PermFs) checkSticky(op, name string, dir, fi os.FileInfo) error {
+	if dir.Mode()&os.ModeSticky != 0 && !p.owns(fi) && !p.owns(dir) {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EPERM}
+	}
+	return nil
+}
+
+// own gives the new file to the user. The group is the one of the
+// directory if it has the setgid bit
+func (p *PermFs) own(name string, dir os.FileInfo) {
+	c, ok := p.fs.(interface {
+		Chown(name string, uid, gid int) error
+	})
+	if !ok {
+		return
+	}
+	gid := p.cred.GID
+	if dir.Mode()&os.ModeSetgid != 0 {
+		_, gid, _, _ = GetExtraInfo(dir)
+	}
+	c.Chown(name, p.cred.UID, gid)
+}
+
+// Access checks if the user can read, write or execute the file as given
+// by the Access bits
+func (p *PermFs) Access(name string, access uint32) error {
+	fi, _, err := p.follow("access", name)
+	if err != nil {
+		return err
+	}
+	if !p.allowed(fi, access) {
+		return &os.PathError{Op: "access", Path: name, Err: syscall.EACCES}
+	}
+	return nil
+}
+
+func (p *PermFs) Stat(name string) (os.FileInfo, error) {
+	if p.root() {
+		return p.fs.Stat(name)
+	}
+	return p.lookup("stat", name)
+}
+
+func (p *PermFs) Create(name string) (afero.File, error) {
+	return p.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (p *PermFs) Open(name string) (afero.File, error) {
+	if p.root() {
+		return p.fs.Open(name)
+	}
+	fi, _, err := p.follow("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !p.allowed(fi, AccessRead) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+	}
+	return p.fs.Open(name)
+}
+
+func (p *PermFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if p.root() {
+		return p.fs.OpenFile(name, flag, perm)
+	}
+	fi, target, err := p.follow("open", name)
+	switch {
+	case err == nil:
+		access := uint32(AccessRead)
+		switch flag & (os.O_WRONLY | os.O_RDWR) {
+		case os.O_WRONLY:
+			access = AccessWrite
+		case os.O_RDWR:
+			access = AccessRead | AccessWrite
+		}
+		if flag&os.O_TRUNC != 0 {
+			access |= AccessWrite
+		}
+		if flag&(os.O_CREATE|os.O_EXCL) != os.O_CREATE|os.O_EXCL && !p.allowed(fi, access) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+		}
+		return p.fs.OpenFile(name, flag, perm)
+	case os.IsNotExist(err) && flag&os.O_CREATE != 0:
+		// A dangling link creates its target
+		dir, err := p.checkDir("open", target)
+		if err != nil {
+			return nil, err
+		}
+		f, err := p.fs.OpenFile(name, flag, perm)
+		if err == nil {
+			p.own(target, dir)
+		}
+		return f, err
+	}
+	return nil, err
+}
+
+func (p *PermFs) Mkdir(name string, perm os.FileMode) error {
+	if p.root() {
+		return p.fs.Mkdir(name, perm)
+	}
+	_, err := p.lookup("mkdir", name)
+	switch {
+	case err == nil:
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EEXIST}
+	case !os.IsNotExist(err):
+		return err
+	}
+	dir, err := p.checkDir("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if err := p.fs.Mkdir(name, perm); err != nil {
+		return err
+	}
+	p.own(name, dir)
+	return nil
+}
+
+func (p *PermFs) MkdirAll(name string, perm os.FileMode) error {
+	if p.root() {
+		return p.fs.MkdirAll(name, perm)
+	}
+	name = pathlib.Clean(name)
+	if fi, err := p.fs.Stat(name); err == nil {
+		if fi.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	if dir := pathlib.Dir(name); dir != name {
+		if err := p.MkdirAll(dir, perm); err != nil {
+			return err
+		}
+	}
+	return p.Mkdir(name, perm)
+}
+
+func (p *PermFs) Remove(name string) error {
+	if p.root() {
+		return p.fs.Remove(name)
+	}
+	fi, err := p.lookup("remove", name)
+	if err != nil {
+		return err
+	}
+	dir, err := p.checkDir("remove", name)
+	if err != nil {
+		return err
+	}
+	if err := p.checkSticky("remove", name, dir, fi); err != nil {
+		return err
+	}
+	return p.fs.Remove(name)
+}
+
+// RemoveAll removes the file and the files under it, which the user needs
+// the permission to remove each of
+func (p *PermFs) RemoveAll(name string) error {
+	if p.root() {
+		return p.fs.RemoveAll(name)
+	}
+	fi, err := p.lookup("remove", name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if !p.allowed(fi, AccessRead|AccessWrite|AccessExec) {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.EACCES}
+		}
+		f, err := p.fs.Open(name)
+		if err != nil {
+			return err
+		}
+		names, err := f.Readdirnames(0)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			if err := p.RemoveAll(pathlib.Join(name, n)); err != nil {
+				return err
+			}
+		}
+	}
+	return p.Remove(name)
+}
+
+func (p *PermFs) Rename(oldname, newname string) error {
+	if p.root() {
+		return p.fs.Rename(oldname, newname)
+	}
+	fi, err := p.lookup("rename", oldname)
+	if err != nil {
+		return err
+	}
+	dir, err := p.checkDir("rename", oldname)
+	if err != nil {
+		return err
+	}
+	if err := p.checkSticky("rename", oldname, dir, fi); err != nil {
+		return err
+	}
+	target, err := p.lookup("rename", newname)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if dir, err = p.checkDir("rename", newname); err != nil {
+		return err
+	}
+	if target != nil {
+		if err := p.checkSticky("rename", newname, dir, target); err != nil {
+			return err
+		}
+	}
+	// A directory moved elsewhere has its .. entry changed
+	if fi.IsDir() && pathlib.Dir(pathlib.Clean(oldname)) != pathlib.Dir(pathlib.Clean(newname)) && !p.allowed(fi, AccessWrite) {
+		return &os.PathError{Op: "rename", Path: oldname, Err: syscall.EACCES}
+	}
+	return p.fs.Rename(oldname, newname)
+}
+
+// Chmod changes the mode of the file, which only its owner can. The setgid
+// bit is cleared if the user is not in the group of the file
+func (p *PermFs) Chmod(name string, mode os.FileMode) error {
+	if p.root() {
+		return p.fs.Chmod(name, mode)
+	}
+	fi, err := p.lookup("chmod", name)
+	if err != nil {
+		return err
+	}
+	if !p.owns(fi) {
+		return &os.PathError{Op: "chmod", Path: name, Err: syscall.EPERM}
+	}
+	if _, gid, _, _ := GetExtraInfo(fi); !fi.IsDir() && !p.cred.inGroup(gid) {
+		mode &^= os.ModeSetgid
+	}
+	return p.fs.Chmod(name, mode)
+}
+
+// Chtimes changes the times of the file, which the owner or the users who
+// can write the file can
+func (p *PermFs) Chtimes(name string, atime, mtime time.Time) error {
+	if p.root() {
+		return p.fs.Chtimes(name, atime, mtime)
+	}
+	fi, err := p.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	if !p.owns(fi) && !p.allowed(fi, AccessWrite) {
+		return &os.PathError{Op: "chtimes", Path: name, Err: syscall.EACCES}
+	}
+	return p.fs.Chtimes(name, atime, mtime)
+}
+
+// Chown changes the owner of the file. Only root can give files away, while
+// the owner can change the group to one of the groups of the user. A
+// negative uid or gid leaves it unchanged. The change is accepted silently
+// if the wrapped filesystem cannot keep it
+func (p *PermFs) Chown(name string, uid, gid int) error {
+	fi, err := p.lookup("chown", name)
+	if err != nil {
+		return err
+	}
+	oldUID, oldGID, _, _ := GetExtraInfo(fi)
+	if uid < 0 {
+		uid = oldUID
+	}
+	if gid < 0 {
+		gid = oldGID
+	}
+	if !p.root() && (uid != oldUID || !p.owns(fi) || gid != oldGID && !p.cred.inGroup(gid)) {
+		return &os.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+	}
+	if c, ok := p.fs.(interface {
+		Chown(name string, uid, gid int) error
+	}); ok {
+		return c.Chown(name, uid, gid)
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname if the wrapped
+// filesystem supports it
+func (p *PermFs) Symlink(oldname, newname string) error {
+	s, ok := p.fs.(interface {
+		Symlink(oldname, newname string) error
+	})
+	if !ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	if p.root() {
+		return s.Symlink(oldname, newname)
+	}
+	_, err := p.lookup("symlink", newname)
+	switch {
+	case err == nil:
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EEXIST}
+	case !os.IsNotExist(err):
+		return err
+	}
+	dir, err := p.checkDir("symlink", newname)
+	if err != nil {
+		return err
+	}
+	if err := s.Symlink(oldname, newname); err != nil {
+		return err
+	}
+	p.own(newname, dir)
+	return nil
+}
+
+// Readlink returns the target of the symbolic link
+func (p *PermFs) Readlink(name string) (string, error) {
+	if !p.root() {
+		if _, err := p.lookup("readlink", name); err != nil {
+			return "", err
+		}
+	}
+	return readlink(p.fs, name)
+}
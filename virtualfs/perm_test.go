@@ -0,0 +1,156 @@
+package virtualfs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func newTestPermFs(t *testing.T) *OwnerFs {
+	vfs, err := NewVirtualFS("../filesystem.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := NewOwnerFs(NewLayerFs(vfs, afero.NewMemMapFs()))
+	fs.Mkdir("/tmp", 0777|os.ModeSticky)
+	fs.Chmod("/tmp", 0777|os.ModeSticky)
+	fs.MkdirAll("/home/user", 0755)
+	fs.Chown("/home/user", 1000, 100)
+	return fs
+}
+
+func errno(err error) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		return e.Err
+	case *os.LinkError:
+		return e.Err
+	}
+	return err
+}
+
+func TestPermFs(t *testing.T) {
+	base := newTestPermFs(t)
+	user := NewPermFs(base, Credentials{UID: 1000, GID: 100})
+	other := NewPermFs(base, Credentials{UID: 1001, GID: 100})
+	root := NewPermFs(base, Credentials{})
+
+	if _, err := user.Open("/etc/shadow"); errno(err) != syscall.EACCES {
+		t.Errorf("Reading /etc/shadow: %v", err)
+	}
+	if _, err := NewPermFs(base, Credentials{UID: 1000, GID: 100, Groups: []int{42}}).Open("/etc/shadow"); err != nil {
+		t.Errorf("Reading /etc/shadow in group shadow: %v", err)
+	}
+	if _, err := root.Open("/etc/shadow"); err != nil {
+		t.Errorf("Reading /etc/shadow as root: %v", err)
+	}
+	if _, err := user.Open("/etc/passwd"); err != nil {
+		t.Errorf("Reading /etc/passwd: %v", err)
+	}
+	if _, err := user.OpenFile("/etc/passwd", os.O_WRONLY|os.O_TRUNC, 0); errno(err) != syscall.EACCES {
+		t.Errorf("Writing /etc/passwd: %v", err)
+	}
+	if err := afero.WriteFile(user, "/bin/dropped", []byte("x"), 0755); errno(err) != syscall.EACCES {
+		t.Errorf("Writing /bin: %v", err)
+	}
+	if err := user.Mkdir("/etc/dir", 0755); errno(err) != syscall.EACCES {
+		t.Errorf("Creating directory in /etc: %v", err)
+	}
+	if err := user.Chmod("/etc/passwd", 0666); errno(err) != syscall.EPERM {
+		t.Errorf("Changing mode of /etc/passwd: %v", err)
+	}
+	if err := user.Chown("/home/user", 0, -1); errno(err) != syscall.EPERM {
+		t.Errorf("Giving away the home directory: %v", err)
+	}
+
+	// New files belong to the user
+	if err := afero.WriteFile(user, "/home/user/file", []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.MkdirAll("/home/user/a/b", 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/home/user/file", "/home/user/a/b"} {
+		fi, err := base.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uid, gid, _, _ := GetExtraInfo(fi); uid != 1000 || gid != 100 {
+			t.Errorf("%v owned by %v:%v", name, uid, gid)
+		}
+	}
+	if _, err := other.Open("/home/user/file"); errno(err) != syscall.EACCES {
+		t.Errorf("Reading private file of other user: %v", err)
+	}
+	if _, err := other.Stat("/home/user/a/b"); errno(err) != syscall.EACCES {
+		t.Errorf("Searching private directory of other user: %v", err)
+	}
+	if err := user.Chmod("/home/user/file", 0644); err != nil {
+		t.Errorf("Changing mode of own file: %v", err)
+	}
+	if _, err := other.Open("/home/user/file"); err != nil {
+		t.Errorf("Reading readable file of other user: %v", err)
+	}
+
+	// Only the owners can remove the files in sticky directories
+	if err := afero.WriteFile(user, "/tmp/file", []byte("x"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Remove("/tmp/file"); errno(err) != syscall.EPERM {
+		t.Errorf("Removing file of other user in /tmp: %v", err)
+	}
+	if err := other.Rename("/tmp/file", "/tmp/moved"); errno(err) != syscall.EPERM {
+		t.Errorf("Renaming file of other user in /tmp: %v", err)
+	}
+	if _, err := other.OpenFile("/tmp/file", os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		t.Errorf("Writing writable file of other user in /tmp: %v", err)
+	}
+	if err := user.Remove("/tmp/file"); err != nil {
+		t.Errorf("Removing own file in /tmp: %v", err)
+	}
+
+	if err := user.Access("/bin/ls", AccessExec); err != nil {
+		t.Errorf("Executing /bin/ls: %v", err)
+	}
+	if err := root.Access("/etc/passwd", AccessExec); errno(err) != syscall.EACCES {
+		t.Errorf("Executing /etc/passwd as root: %v", err)
+	}
+}
+
+func TestOwnerFs(t *testing.T) {
+	fs := newTestPermFs(t)
+	fi, err := fs.Stat("/etc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode := fi.Mode()
+	// Copying up the directory keeps its attributes
+	if err := afero.WriteFile(fs, "/etc/dropped", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := fs.Stat("/etc"); fi.Mode() != mode {
+		t.Errorf("Mode of /etc changed from %v to %v", mode, fi.Mode())
+	}
+	fs.Chown("/etc/dropped", 1000, 100)
+	if err := fs.Rename("/etc/dropped", "/home/user/moved"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Open("/home/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, _ := f.Readdir(-1)
+	for _, fi := range entries {
+		if fi.Name() != "moved" {
+			continue
+		}
+		if uid, gid, _, _ := GetExtraInfo(fi); uid != 1000 || gid != 100 {
+			t.Errorf("Moved file owned by %v:%v", uid, gid)
+		}
+		return
+	}
+	t.Error("Moved file not listed")
+}
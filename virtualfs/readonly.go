@@ -0,0 +1,89 @@
+package virtualfs
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// ReadOnlyFs is a filesystem mounted read-only, which unlike
+// afero.ReadOnlyFs fails changes with EROFS
+type ReadOnlyFs struct {
+	afero.Fs
+}
+
+// NewReadOnlyFs returns the filesystem mounted read-only
+func NewReadOnlyFs(fs afero.Fs) *ReadOnlyFs {
+	return &ReadOnlyFs{fs}
+}
+
+// NewHostFs returns the directory of the host mounted read-only. Symbolic
+// links in it are followed on the host
+func NewHostFs(dir string) *ReadOnlyFs {
+	return NewReadOnlyFs(afero.NewBasePathFs(afero.NewOsFs(), dir))
+}
+
+func (r *ReadOnlyFs) Name() string {
+	return "ReadOnlyFs"
+}
+
+func (r *ReadOnlyFs) erofs(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: syscall.EROFS}
+}
+
+func (r *ReadOnlyFs) Create(name string) (afero.File, error) {
+	return nil, r.erofs("open", name)
+}
+
+func (r *ReadOnlyFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, r.erofs("open", name)
+	}
+	return r.Fs.OpenFile(name, flag, perm)
+}
+
+func (r *ReadOnlyFs) Mkdir(name string, perm os.FileMode) error {
+	return r.erofs("mkdir", name)
+}
+
+func (r *ReadOnlyFs) MkdirAll(name string, perm os.FileMode) error {
+	if fi, err := r.Fs.Stat(name); err == nil && fi.IsDir() {
+		return nil
+	}
+	return r.erofs("mkdir", name)
+}
+
+func (r *ReadOnlyFs) Remove(name string) error {
+	return r.erofs("remove", name)
+}
+
+func (r *ReadOnlyFs) RemoveAll(name string) error {
+	return r.erofs("remove", name)
+}
+
+func (r *ReadOnlyFs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EROFS}
+}
+
+func (r *ReadOnlyFs) Chmod(name string, mode os.FileMode) error {
+	return r.erofs("chmod", name)
+}
+
+func (r *ReadOnlyFs) Chtimes(name string, atime, mtime time.Time) error {
+	return r.erofs("chtimes", name)
+}
+
+func (r *ReadOnlyFs) Chown(name string, uid, gid int) error {
+	return r.erofs("chown", name)
+}
+
+func (r *ReadOnlyFs) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EROFS}
+}
+
+// Readlink returns the target of the symbolic link
+func (r *ReadOnlyFs) Readlink(name string) (string, error) {
+	return readlink(r.Fs, name)
+}
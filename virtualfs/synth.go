@@ -0,0 +1,289 @@
+package virtualfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	pathlib "path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Node is a file of a synthetic filesystem
+type Node struct {
+	Mode     os.FileMode
+	UID, GID int
+	ModTime  time.Time
+	// Size is the size reported by stat, which is 0 for most generated
+	// files whatever their content
+	Size int64
+	// Data generates the content of a regular file when it is opened
+	Data func() []byte
+	// Target is the target of a symbolic link
+	Target string
+	// Entries lists the names in a directory
+	Entries func() []string
+	// Rdev is the device number of a device, made by Mkdev
+	Rdev uint64
+	// Read and Write are the operations of a device. A device without
+	// Write cannot be opened for writing
+	Read  func(p []byte) (int, error)
+	Write func(p []byte) (int, error)
+}
+
+// Mkdev returns the device number of the major and minor numbers
+func Mkdev(major, minor int) uint64 {
+	return uint64(major)<<8 | uint64(minor)
+}
+
+// SynthFs is a read-only filesystem whose files are generated when looked
+// up, like /proc, but for the devices in it which are read and written
+// through their operations. Lookup returns the node of a clean absolute path with
+// no symbolic links in it, or false if there is none
+type SynthFs struct {
+	name   string
+	lookup func(name string) (*Node, bool)
+}
+
+// NewSynthFs returns the synthetic filesystem of the lookup function
+func NewSynthFs(name string, lookup func(name string) (*Node, bool)) *SynthFs {
+	return &SynthFs{name: name, lookup: lookup}
+}
+
+func (s *SynthFs) Name() string {
+	return s.name
+}
+
+// resolve returns the node of the path and its path with the symbolic
+// links in it resolved. The last element is followed if follow is set.
+// Links to absolute paths point out of the filesystem and are not followed
+func (s *SynthFs) resolve(op, name string, follow bool) (*Node, string, error) {
+	return s.walk(op, name, pathlib.Clean("/"+name), follow, 0)
+}
+
+func (s *SynthFs) walk(op, name, p string, follow bool, depth int) (*Node, string, error) {
+	node, ok := s.lookup("/")
+	if !ok {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	cur := "/"
+	for i, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		if !node.Mode.IsDir() {
+			return nil, "", &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		next := pathlib.Join(cur, part)
+		if node, ok = s.lookup(next); !ok {
+			return nil, "", &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		if node.Mode&os.ModeSymlink != 0 && (follow || i < len(parts)-1) && !pathlib.IsAbs(node.Target) {
+			if depth == 40 {
+				return nil, "", &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+			}
+			rest := append([]string{cur, node.Target}, parts[i+1:]...)
+			return s.walk(op, name, pathlib.Join(rest...), follow, depth+1)
+		}
+		cur = next
+	}
+	return node, cur, nil
+}
+
+func (s *SynthFs) Stat(name string) (os.FileInfo, error) {
+	node, p, err := s.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &synthInfo{node, pathlib.Base(p)}, nil
+}
+
+func (s *SynthFs) Open(name string) (afero.File, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (s *SynthFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	node, p, err := s.resolve("open", name, true)
+	if err != nil {
+		if os.IsNotExist(err) && flag&os.O_CREATE != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+		}
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC|os.O_APPEND) != 0 && (node.Mode&os.ModeDevice == 0 || node.Write == nil) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+	}
+	f := &synthFile{fs: s, node: node, name: name, path: p}
+	if node.Data != nil {
+		f.Reader = bytes.NewReader(node.Data())
+	} else {
+		f.Reader = bytes.NewReader(nil)
+	}
+	return f, nil
+}
+
+func (s *SynthFs) denied(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: syscall.EACCES}
+}
+
+func (s *SynthFs) Create(name string) (afero.File, error) {
+	return nil, s.denied("open", name)
+}
+
+func (s *SynthFs) Mkdir(name string, perm os.FileMode) error {
+	return s.denied("mkdir", name)
+}
+
+func (s *SynthFs) MkdirAll(name string, perm os.FileMode) error {
+	if fi, err := s.Stat(name); err == nil && fi.IsDir() {
+		return nil
+	}
+	return s.denied("mkdir", name)
+}
+
+func (s *SynthFs) Remove(name string) error {
+	if _, err := s.Stat(name); err != nil {
+		return err
+	}
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+}
+
+func (s *SynthFs) RemoveAll(name string) error {
+	return s.Remove(name)
+}
+
+func (s *SynthFs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EPERM}
+}
+
+func (s *SynthFs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: syscall.EPERM}
+}
+
+func (s *SynthFs) Chtimes(name string, atime, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: syscall.EPERM}
+}
+
+// Readlink returns the target of the symbolic link
+func (s *SynthFs) Readlink(name string) (string, error) {
+	node, _, err := s.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node.Mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return node.Target, nil
+}
+
+// synthInfo is the file info of a node
+type synthInfo struct {
+	node *Node
+	name string
+}
+
+func (fi *synthInfo) Name() string       { return fi.name }
+func (fi *synthInfo) Size() int64        { return fi.node.Size }
+func (fi *synthInfo) Mode() os.FileMode  { return fi.node.Mode }
+func (fi *synthInfo) ModTime() time.Time { return fi.node.ModTime }
+func (fi *synthInfo) IsDir() bool        { return fi.node.Mode.IsDir() }
+func (fi *synthInfo) Sys() interface{} {
+	return ZipExtraInfo{uid: fi.node.UID, gid: fi.node.GID, atime: fi.node.ModTime, mtime: fi.node.ModTime, rdev: fi.node.Rdev}
+}
+
+// synthFile is an opened node, whose content is generated when opened
+type synthFile struct {
+	*bytes.Reader
+	fs   *SynthFs
+	node *Node
+	name string
+	// path is the path of the node in the filesystem
+	path string
+	// read are the directory entries already returned by Readdir
+	read int
+}
+
+func (f *synthFile) Name() string { return f.name }
+func (f *synthFile) Close() error { return nil }
+func (f *synthFile) Sync() error  { return nil }
+
+func (f *synthFile) Stat() (os.FileInfo, error) {
+	return &synthInfo{f.node, pathlib.Base(f.path)}, nil
+}
+
+func (f *synthFile) Read(p []byte) (int, error) {
+	switch {
+	case f.node.Mode.IsDir():
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	case f.node.Read != nil:
+		return f.node.Read(p)
+	}
+	return f.Reader.Read(p)
+}
+
+func (f *synthFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.node.Mode.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	var names []string
+	if f.node.Entries != nil {
+		names = f.node.Entries()
+	}
+	sort.Strings(names)
+	if f.read > len(names) {
+		f.read = len(names)
+	}
+	names = names[f.read:]
+	if count > 0 && len(names) > count {
+		names = names[:count]
+	}
+	if count > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	f.read += len(names)
+	entries := make([]os.FileInfo, 0, len(names))
+	for _, n := range names {
+		// Entries may be gone since listed, e.g. processes exited
+		if node, ok := f.fs.lookup(pathlib.Join(f.path, n)); ok {
+			entries = append(entries, &synthInfo{node, n})
+		}
+	}
+	return entries, nil
+}
+
+func (f *synthFile) Readdirnames(count int) ([]string, error) {
+	entries, err := f.Readdir(count)
+	names := make([]string, len(entries))
+	for i, fi := range entries {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
+
+func (f *synthFile) Write(p []byte) (int, error) {
+	if f.node.Write != nil {
+		return f.node.Write(p)
+	}
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *synthFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.Write(p)
+}
+
+func (f *synthFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *synthFile) Truncate(size int64) error {
+	// Devices ignore truncation, like O_TRUNC on /dev/null
+	if f.node.Mode&os.ModeDevice != 0 {
+		return nil
+	}
+	return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EINVAL}
+}